@@ -4,33 +4,45 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
+	ds "github.com/joshskilla/trading-bot/internal/datastore"
 	"github.com/joshskilla/trading-bot/internal/engine"
-	st "github.com/joshskilla/trading-bot/internal/strategy"
+	md "github.com/joshskilla/trading-bot/internal/marketdata"
+	"github.com/joshskilla/trading-bot/internal/marketdata/alpaca"
+	bc "github.com/joshskilla/trading-bot/internal/marketdata/cache"
+	"github.com/joshskilla/trading-bot/internal/marketdata/local"
+	"github.com/joshskilla/trading-bot/internal/session"
 	"github.com/urfave/cli/v3"
 )
 
+// Backtests one or more portfolios over a period, sharing one bar source
+// USAGE: bot backtest -p demo -s momentum -c cp1 --start ... --end ... [--runner other:momentum:cp2 ...]
+// USAGE: bot backtest -f session.yaml
 func BacktestCmd() *cli.Command {
 	return &cli.Command{
 		Name:  "backtest",
-		Usage: "Test a portfolio with a strategy & checkpoint over a period",
-		Flags: []cli.Flag{
-			&cli.StringFlag{Name: "portfolio", Aliases: []string{"p"}, Usage: "Portfolio name", Required: true},
-			&cli.StringFlag{Name: "strategy", Aliases: []string{"s"}, Usage: "Strategy name", Required: true},
-			&cli.StringFlag{Name: "checkpoint", Aliases: []string{"c"}, Usage: "Checkpoint label or id"},
-			&cli.StringFlag{Name: "start", Aliases: []string{"s"}, Usage: "Start time for backtest", Required: true},
-			&cli.StringFlag{Name: "end", Aliases: []string{"e"}, Usage: "End time for backtest", Required: true},
-		},
+		Usage: "Test portfolios with strategies & checkpoints over a period",
+		Flags: append(append(runnerFlags(),
+			&cli.StringFlag{Name: "start", Aliases: []string{"s"}, Usage: "Start time for backtest"},
+			&cli.StringFlag{Name: "end", Aliases: []string{"e"}, Usage: "End time for backtest"},
+		), append(append(simulationFlags(), riskFlags()...), breakerFlags()...)...),
 		Action: func(ctx context.Context, c *cli.Command) error {
-			portfolioName := c.String("portfolio")
-			strategyType := c.String("strategy")
-			checkpointName := c.String("checkpoint")
+			if c.String("file") != "" {
+				plan, err := loadSessionFile(c, "backtest")
+				if err != nil {
+					return err
+				}
+				return runSession(ctx, plan)
+			}
+
 			startStr := c.String("start")
 			endStr := c.String("end")
 
-			if portfolioName == "" || strategyType == "" || checkpointName == "" || startStr == "" || endStr == "" {
-				return errors.New("--portfolio, --strategy, --checkpoint, --start, and --end are required")
+			if startStr == "" || endStr == "" {
+				return errors.New("--start and --end are required")
 			}
 
 			var start, end time.Time
@@ -48,33 +60,83 @@ func BacktestCmd() *cli.Command {
 				}
 			}
 
-			// Load portfolio and checkpoint
-			fmt.Printf("Restoring portfolio %q with strategy %q from checkpoint %q\n", portfolioName, strategyType, checkpointName)
-			portfolio, err := engine.LoadPortfolioFromJSON(portfolioName)
+			entries, err := loadSession(c)
 			if err != nil {
-				return fmt.Errorf("failed to load portfolio: %w", err)
+				return err
 			}
-
-			var checkpoint *st.Checkpoint
-			checkpoint, err = st.LoadCheckpointFromJSON(checkpointName)
+			fills, err := fillModelFromFlags(c)
 			if err != nil {
-				return fmt.Errorf("failed to get checkpoint: %w", err)
+				return err
 			}
-
-			// Restore strategy state
-			var strat st.Strategy
-			strat, err = st.RestoreFromCheckpoint(strategyType, checkpoint)
+			breakers, err := breakersFromFlags(c, entries)
 			if err != nil {
-				return fmt.Errorf("failed to restore strategy from checkpoint: %w", err)
+				return err
 			}
+			return runSession(ctx, &sessionPlan{
+				mode:     "backtest",
+				entries:  entries,
+				start:    start,
+				end:      end,
+				hours:    engine.RegularHours(),
+				fills:    fills,
+				risk:     riskFromFlags(c, entries),
+				breakers: breakers,
+				data: session.Data{
+					Source: c.String("data-source"),
+					Dir:    c.String("data-dir"),
+					Cache:  !c.Bool("no-cache"),
+				},
+			})
+		},
+	}
+}
 
-			trader := engine.NewTestTrader(strat.TickInterval(), start, end)
-			if err := trader.IncludeAssets(ctx, portfolio.Assets()); err != nil {
-				return fmt.Errorf("failed to include assets in trader: %w", err)
-			}
+// Default location of local bar files, relative to BOT_PATH
+const DefaultDataDir = "data/history"
 
-			// Run the trading session
-			return engine.Run(portfolio, strat, trader, true, start, end)
-		},
+// Flags shared by simulated sessions (backtest, optimize): bar source & fill model
+func simulationFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "data-source", Usage: "Bar source: alpaca or file", Value: "alpaca"},
+		&cli.StringFlag{Name: "data-dir", Usage: "Directory of <SYMBOL>.csv/.jsonl/.json bar files (file source)", Value: DefaultDataDir},
+		&cli.BoolFlag{Name: "no-cache", Usage: "Bypass the on-disk bar cache (alpaca source)"},
+		&cli.StringFlag{Name: "fill-at", Usage: "Market order fill price: close or next_open", Value: "close"},
+		&cli.Float64Flag{Name: "commission", Usage: "Fixed commission per order"},
+		&cli.Float64Flag{Name: "commission-rate", Usage: "Commission as a fraction of notional (e.g. 0.0005)"},
+		&cli.StringFlag{Name: "slippage", Usage: "Slippage model: bps:<n>, volume:<impact>, spread:<fraction> or none", Value: "none"},
+	}
+}
+
+// Builds the chosen historical bar source: alpaca (optionally cached on disk) or local files
+func newBarSource(source, dir string, cached bool, interval time.Duration, start, end time.Time) (md.HistoricalProvider, error) {
+	switch source {
+	case "", "alpaca":
+		src := alpaca.NewClient(os.Getenv("ALPACA_API_KEY"), os.Getenv("ALPACA_API_SECRET"), interval, start, end)
+		if !cached {
+			return src, nil
+		}
+		return bc.NewProvider(src, resolvePath(bc.DefaultDir), interval, start, end), nil
+	case "file":
+		return local.NewClient(resolvePath(dir), interval, start, end), nil
+	default:
+		return nil, fmt.Errorf("unknown data source %q (use alpaca or file)", source)
+	}
+}
+
+// Builds the simulated fill model from the backtest flags
+func fillModelFromFlags(c *cli.Command) (engine.FillModel, error) {
+	return session.Fees{
+		FillAt:         c.String("fill-at"),
+		Commission:     c.Float64("commission"),
+		CommissionRate: c.Float64("commission-rate"),
+		Slippage:       c.String("slippage"),
+	}.FillModel()
+}
+
+// Resolves paths relative to BOT_PATH, leaving absolute paths untouched
+func resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
 	}
+	return ds.AbsolutePath(path)
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	"github.com/joshskilla/trading-bot/internal/marketdata/alpaca"
+	bc "github.com/joshskilla/trading-bot/internal/marketdata/cache"
+	t "github.com/joshskilla/trading-bot/internal/types"
+	"github.com/urfave/cli/v3"
+)
+
+// Manage the on-disk bar cache (data/bars)
+// USAGE: bot cache warm --symbols AAPL,MSFT --interval 1m --start 2024-01-02T00:00:00Z --end 2024-02-01T00:00:00Z
+func CacheCmd() *cli.Command {
+	dirFlag := &cli.StringFlag{Name: "dir", Usage: "Cache directory", Value: bc.DefaultDir}
+
+	return &cli.Command{
+		Name:  "cache",
+		Usage: "Manage the on-disk bar cache",
+		Commands: []*cli.Command{
+			{
+				Name:  "ls",
+				Usage: "List cached symbols, intervals and stored days",
+				Flags: []cli.Flag{dirFlag},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					series, err := bc.List(resolvePath(c.String("dir")))
+					if err != nil {
+						return err
+					}
+					if len(series) == 0 {
+						fmt.Println("Cache is empty")
+						return nil
+					}
+					fmt.Printf("%-8s %-8s %-8s %-8s %6s  %-10s  %-10s  %10s\n", "EXCHANGE", "FEED", "SYMBOL", "INTERVAL", "DAYS", "FIRST", "LAST", "BYTES")
+					for _, s := range series {
+						fmt.Printf("%-8s %-8s %-8s %-8s %6d  %-10s  %-10s  %10d\n",
+							s.Exchange, s.Feed, s.Symbol, s.Interval, s.Days, s.First.Format(time.DateOnly), s.Last.Format(time.DateOnly), s.Bytes)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "prune",
+				Usage: "Delete cached days (filter by symbol, interval and/or date)",
+				Flags: []cli.Flag{
+					dirFlag,
+					&cli.StringFlag{Name: "symbol", Usage: "Only this symbol"},
+					&cli.StringFlag{Name: "interval", Usage: "Only this interval (e.g. 1m, 1h, 1d)"},
+					&cli.StringFlag{Name: "before", Usage: "Only days before this date (YYYY-MM-DD)"},
+					&cli.BoolFlag{Name: "all", Usage: "Allow pruning without filters"},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					symbol, beforeStr := c.String("symbol"), c.String("before")
+					interval := c.String("interval")
+					if symbol == "" && interval == "" && beforeStr == "" && !c.Bool("all") {
+						return errors.New("refusing to prune everything: pass --symbol, --interval, --before or --all")
+					}
+					if interval != "" {
+						d, err := bc.ParseInterval(interval)
+						if err != nil {
+							return err
+						}
+						interval = bc.IntervalLabel(d)
+					}
+					var before time.Time
+					if beforeStr != "" {
+						var err error
+						before, err = time.Parse(time.DateOnly, beforeStr)
+						if err != nil {
+							return fmt.Errorf("invalid --before date: %w", err)
+						}
+					}
+					removed, err := bc.Prune(resolvePath(c.String("dir")), symbol, interval, before)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("Pruned %d cached day(s)\n", removed)
+					return nil
+				},
+			},
+			{
+				Name:  "warm",
+				Usage: "Download bars from Alpaca into the cache",
+				Flags: []cli.Flag{
+					dirFlag,
+					&cli.StringFlag{Name: "symbols", Usage: "Comma separated symbols", Required: true},
+					&cli.StringFlag{Name: "interval", Usage: "Bar interval (e.g. 1m, 1h, 1d)", Value: "1m"},
+					&cli.StringFlag{Name: "start", Usage: "Start time (RFC3339)", Required: true},
+					&cli.StringFlag{Name: "end", Usage: "End time (RFC3339)", Required: true},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					interval, err := bc.ParseInterval(c.String("interval"))
+					if err != nil {
+						return err
+					}
+					start, err := time.Parse(time.RFC3339, c.String("start"))
+					if err != nil {
+						return fmt.Errorf("invalid start time: %w", err)
+					}
+					end, err := time.Parse(time.RFC3339, c.String("end"))
+					if err != nil {
+						return fmt.Errorf("invalid end time: %w", err)
+					}
+
+					src := alpaca.NewClient(os.Getenv("ALPACA_API_KEY"), os.Getenv("ALPACA_API_SECRET"), interval, start, end)
+					prov := bc.NewProvider(src, resolvePath(c.String("dir")), interval, start, end)
+					defer prov.Close()
+
+					for _, sym := range strings.Split(c.String("symbols"), ",") {
+						sym = strings.TrimSpace(sym)
+						if sym == "" {
+							continue
+						}
+						asset := t.NewAsset(sym, cfg.Exchange, cfg.AssetType)
+						calls := prov.SourceCalls
+						bars, err := prov.FetchBars(ctx, asset, start, end, interval)
+						if err != nil {
+							return fmt.Errorf("failed to warm %s: %w", sym, err)
+						}
+						fmt.Printf("Warmed %s: %d bars (%d API call(s))\n", sym, len(bars), prov.SourceCalls-calls)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
@@ -7,6 +7,7 @@ import (
   "os"
 
   e "github.com/joshskilla/trading-bot/internal/engine"
+  "github.com/joshskilla/trading-bot/internal/report"
   st "github.com/joshskilla/trading-bot/internal/strategy"
   ds "github.com/joshskilla/trading-bot/internal/datastore"
 )
@@ -31,21 +32,15 @@ func DeleteCmd() *cli.Command {
 			Action: func(ctx context.Context, c *cli.Command) error {
 				name := c.String("name")
 
-				err := os.Remove(ds.AbsolutePath(fmt.Sprintf(e.PortfolioFilePath, name)))
-				if err != nil && !os.IsNotExist(err) {
-					return err
-				}
-
-				err = os.Remove(ds.AbsolutePath(fmt.Sprintf(e.OrdersFilePath, name)))
-				if err != nil && !os.IsNotExist(err) {
-					return err
-				}
-				err = os.Remove(ds.AbsolutePath(fmt.Sprintf(e.PositionsFilePath, name)))
-				if err != nil && !os.IsNotExist(err) {
-					return err
+				paths := append([]string{e.PortfolioFilePath, e.OpenOrdersFilePath, report.ReportFilePath}, e.ResultsFilePaths...)
+				for _, path := range paths {
+					err := os.Remove(ds.AbsolutePath(fmt.Sprintf(path, name)))
+					if err != nil && !os.IsNotExist(err) {
+						return err
+					}
 				}
 
-				fmt.Printf("Deleted portfolio %q and its result CSVs \n", name)
+				fmt.Printf("Deleted portfolio %q and its results\n", name)
 				return nil
 			},
 		},
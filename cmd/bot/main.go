@@ -14,6 +14,13 @@ func main() {
 			DeleteCmd(),
 			RunCmd(),
 			BacktestCmd(),
+			CacheCmd(),
+			ReportCmd(),
+			StrategiesCmd(),
+			OptimizeCmd(),
+			WalkForwardCmd(),
+			MockFinnhubCmd(),
+			ReplayCmd(),
 		},
 	}
 
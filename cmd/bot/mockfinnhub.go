@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/marketdata/finnhub"
+	"github.com/urfave/cli/v3"
+)
+
+// Serves a local stand-in for Finnhub's trade stream, to point `bot run --finnhub-url` at
+// USAGE: bot mock-finnhub --symbols AAPL,MSFT --rate 5 --late 0.05 --drop-every 2m
+// USAGE: bot mock-finnhub --replay trades.jsonl --speed 10
+func MockFinnhubCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "mock-finnhub",
+		Usage: "Serve a fake Finnhub trade stream of random-walk or recorded trades",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "addr", Value: "localhost:9090", Usage: "Address to serve the websocket on"},
+			&cli.StringSliceFlag{Name: "symbols", Value: []string{"AAPL"}, Usage: "Symbols to generate trades for"},
+			&cli.Float64Flag{Name: "price", Value: 100, Usage: "Starting price of generated trades"},
+			&cli.Float64Flag{Name: "rate", Value: 2, Usage: "Generated trades per second, per symbol"},
+			&cli.Float64Flag{Name: "volatility", Value: 0.0005, Usage: "Std dev of each generated price step, as a fraction of price"},
+			&cli.Uint64Flag{Name: "seed", Usage: "Seed for repeatable prices & faults (0 => random)"},
+			&cli.StringFlag{Name: "replay", Usage: "Send recorded trades from this JSON lines file instead of generating them"},
+			&cli.Float64Flag{Name: "speed", Value: 1, Usage: "Replay speed multiple (0 => all at once, with recorded times)"},
+			&cli.Float64Flag{Name: "late", Usage: "Fault: chance a trade is stamped --late-by in the past"},
+			&cli.DurationFlag{Name: "late-by", Value: time.Minute, Usage: "Fault: how late a late trade is"},
+			&cli.Float64Flag{Name: "duplicates", Usage: "Fault: chance a trade is sent twice"},
+			&cli.Float64Flag{Name: "malformed", Usage: "Fault: chance a trade is preceded by a malformed frame"},
+			&cli.DurationFlag{Name: "drop-every", Usage: "Fault: drop all connections this often"},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			var trades []finnhub.MockTrade
+			if path := c.String("replay"); path != "" {
+				f, err := os.Open(path)
+				if err != nil {
+					return fmt.Errorf("failed to open replay file: %w", err)
+				}
+				trades, err = finnhub.ReadTrades(f)
+				f.Close()
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", path, err)
+				}
+			}
+
+			mock, err := finnhub.NewMockStreamAt(c.String("addr"))
+			if err != nil {
+				return err
+			}
+			defer mock.Close()
+			if seed := c.Uint64("seed"); seed != 0 {
+				mock.Seed(seed)
+			}
+			mock.SetFaults(finnhub.MockFaults{
+				Late:      c.Float64("late"),
+				LateBy:    c.Duration("late-by"),
+				Duplicate: c.Float64("duplicates"),
+				Malformed: c.Float64("malformed"),
+			})
+			fmt.Printf("Mock Finnhub stream on %s (bot run --finnhub-url %s)\n", mock.URL(), mock.URL())
+
+			if every := c.Duration("drop-every"); every > 0 {
+				go func() {
+					ticker := time.NewTicker(every)
+					defer ticker.Stop()
+					for {
+						select {
+						case <-ctx.Done():
+							return
+						case <-ticker.C:
+							fmt.Println("Dropping connections")
+							mock.Disconnect()
+						}
+					}
+				}()
+			}
+
+			if c.String("replay") != "" {
+				fmt.Printf("Replaying %d trades\n", len(trades))
+				if err := mock.Replay(ctx, trades, c.Float64("speed")); err != nil {
+					return err
+				}
+				fmt.Println("Replay finished; still serving (Ctrl-C to stop)")
+				<-ctx.Done()
+				return nil
+			}
+
+			symbols := c.StringSlice("symbols")
+			fmt.Printf("Generating %.3g trades/s for %s\n", c.Float64("rate"), strings.Join(symbols, ", "))
+			for _, sym := range symbols {
+				go mock.RandomWalk(ctx, strings.ToUpper(sym), c.Float64("price"), c.Float64("rate"), c.Float64("volatility"))
+			}
+			<-ctx.Done()
+			return nil
+		},
+	}
+}
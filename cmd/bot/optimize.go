@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	ds "github.com/joshskilla/trading-bot/internal/datastore"
+	"github.com/joshskilla/trading-bot/internal/engine"
+	"github.com/joshskilla/trading-bot/internal/marketdata/memory"
+	"github.com/joshskilla/trading-bot/internal/optimize"
+	"github.com/joshskilla/trading-bot/internal/report"
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	"github.com/urfave/cli/v3"
+)
+
+// Sweeps strategy parameters over concurrent in-memory backtests and ranks them
+// USAGE: bot optimize --strategy momentum --param asset=AAPL --param fast=5:20:5 --param slow=20:100:10 --start ... --end ...
+func OptimizeCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "optimize",
+		Usage: "Grid or random search over strategy parameters, ranked by a metric",
+		// --param values carry their own commas (name=a,b,c)
+		DisableSliceFlagSeparator: true,
+		Flags: append(append([]cli.Flag{
+			&cli.StringFlag{Name: "strategy", Aliases: []string{"s"}, Usage: "Strategy name", Required: true},
+			&cli.StringFlag{Name: "start", Usage: "Start time for the backtests (RFC3339)", Required: true},
+			&cli.StringFlag{Name: "end", Usage: "End time for the backtests (RFC3339)", Required: true},
+			&cli.StringFlag{Name: "out", Aliases: []string{"o"}, Usage: "Results CSV (default results/optimize_<strategy>.csv)"},
+		}, sweepFlags()...), simulationFlags()...),
+		Action: func(ctx context.Context, c *cli.Command) error {
+			start, end, err := parsePeriod(c)
+			if err != nil {
+				return err
+			}
+			sw, err := newSweep(ctx, c, start, end)
+			if err != nil {
+				return err
+			}
+
+			trials := optimize.Build(sw.def, sw.combos)
+			fmt.Printf("Running %d backtests of %s on %d workers\n", len(trials), sw.def.Name, sw.cfg.Workers)
+			results := optimize.Run(ctx, sw.cfg, trials)
+			optimize.Rank(results, sw.metric)
+
+			out := c.String("out")
+			if out == "" {
+				out = ds.AbsolutePath(fmt.Sprintf(optimize.ResultsFilePath, sw.def.Name))
+			} else {
+				out = resolvePath(out)
+			}
+			if err := optimize.WriteCSV(out, sw.params, results); err != nil {
+				return fmt.Errorf("failed to write results: %w", err)
+			}
+			printTopResults(sw.params, results, sw.metric, 10)
+			fmt.Printf("Saved %d results to %s\n", len(results), out)
+
+			if results[0].Err != nil {
+				return errors.New("every backtest failed; see the results file")
+			}
+			return nil
+		},
+	}
+}
+
+// Flags describing a parameter sweep (optimize, walkforward)
+func sweepFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{Name: "param", Usage: "Parameter to sweep: name=lo:hi:step, name=a,b,c or name=value (repeatable)"},
+		&cli.Float64Flag{Name: "cash", Usage: "Starting cash of each backtest", Value: 10000},
+		&cli.IntFlag{Name: "random", Usage: "Random search: sample this many combinations instead of the full grid"},
+		&cli.Int64Flag{Name: "seed", Usage: "Random search seed (default: time based)"},
+		&cli.IntFlag{Name: "workers", Aliases: []string{"w"}, Usage: "Concurrent backtests", Value: runtime.NumCPU()},
+		&cli.StringFlag{Name: "metric", Aliases: []string{"m"}, Usage: "Ranking metric: sharpe, sortino, return, annualised_return, max_drawdown, win_rate, realised_pnl", Value: "sharpe"},
+		&cli.Float64Flag{Name: "risk-free", Usage: "Annual risk-free rate for Sharpe & Sortino (e.g. 0.04)"},
+	}
+}
+
+// Parses the required --start & --end flags
+func parsePeriod(c *cli.Command) (start, end time.Time, err error) {
+	if start, err = time.Parse(time.RFC3339, c.String("start")); err != nil {
+		return start, end, fmt.Errorf("invalid start time: %w", err)
+	}
+	if end, err = time.Parse(time.RFC3339, c.String("end")); err != nil {
+		return start, end, fmt.Errorf("invalid end time: %w", err)
+	}
+	if !end.After(start) {
+		return start, end, errors.New("--end must be after --start")
+	}
+	return start, end, nil
+}
+
+// sweep is a parameter sweep set up from the command line
+type sweep struct {
+	def    st.Definition
+	params []optimize.Param
+	combos []map[string]any
+	metric optimize.Metric
+	cfg    optimize.Config
+}
+
+// Expands the sweep's combinations and preloads every bar they need over
+// [start, end) into one in-memory provider shared by all backtests
+func newSweep(ctx context.Context, c *cli.Command, start, end time.Time) (*sweep, error) {
+	strategyType := c.String("strategy")
+	def, ok := st.Lookup(strategyType)
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q (available: %s)", strategyType, strings.Join(st.Names(), ", "))
+	}
+	sw := &sweep{def: def}
+	var err error
+	if sw.metric, err = optimize.ParseMetric(c.String("metric")); err != nil {
+		return nil, err
+	}
+	fills, err := fillModelFromFlags(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expand the parameter space
+	for _, flag := range c.StringSlice("param") {
+		p, err := optimize.ParseParam(flag, def.Params)
+		if err != nil {
+			return nil, err
+		}
+		sw.params = append(sw.params, p)
+	}
+	if n := c.Int("random"); n > 0 {
+		seed := c.Int64("seed")
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		sw.combos = optimize.Random(sw.params, n, rand.New(rand.NewSource(seed)))
+	} else {
+		sw.combos = optimize.Grid(sw.params)
+	}
+
+	// Trial strategies tell us the bar interval & assets to load
+	trials := optimize.Build(def, sw.combos)
+	var interval time.Duration
+	for _, tr := range trials {
+		if tr.Strategy != nil {
+			interval = tr.Strategy.TickInterval()
+			break
+		}
+	}
+	if interval == 0 {
+		return nil, fmt.Errorf("no valid parameter combinations: %w", trials[0].Err)
+	}
+
+	// Load every bar the trials need once, shared read-only by all backtests
+	src, err := newBarSource(c.String("data-source"), c.String("data-dir"), !c.Bool("no-cache"), interval, start, end)
+	if err != nil {
+		return nil, err
+	}
+	assets := optimize.Assets(trials)
+	prov, err := memory.Load(ctx, src, assets, interval, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bars: %w", err)
+	}
+	for _, a := range assets {
+		if prov.Count(a) == 0 {
+			return nil, fmt.Errorf("no %s bars between %s and %s", a.Symbol, start.Format(time.RFC3339), end.Format(time.RFC3339))
+		}
+	}
+
+	sw.cfg = optimize.Config{
+		Name:    c.Name + "-" + strategyType,
+		Start:   start,
+		End:     end,
+		Hours:   engine.RegularHours(),
+		Cash:    c.Float64("cash"),
+		Workers: max(c.Int("workers"), 1),
+		NewTrader: func(start, end time.Time) engine.Trader {
+			tt := engine.NewTestTraderWithProvider(prov, interval, start, end)
+			tt.Fills = fills
+			return tt
+		},
+		Report: report.Options{RiskFreeRate: c.Float64("risk-free")},
+	}
+	return sw, nil
+}
+
+// Prints the n best results
+func printTopResults(params []optimize.Param, results []optimize.Result, metric optimize.Metric, n int) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "RANK")
+	for _, p := range params {
+		fmt.Fprintf(tw, "\t%s", strings.ToUpper(p.Name))
+	}
+	fmt.Fprintf(tw, "\t%s\tRETURN\tTRADES\n", strings.ToUpper(metric.Name))
+	for i, res := range results[:min(n, len(results))] {
+		if res.Err != nil {
+			break
+		}
+		fmt.Fprintf(tw, "%d", i+1)
+		for _, p := range params {
+			fmt.Fprintf(tw, "\t%v", res.Params[p.Name])
+		}
+		fmt.Fprintf(tw, "\t%.4f\t%.2f%%\t%d\n", metric.Value(res.Report), res.Report.TotalReturn*100, res.Report.Trades)
+	}
+	tw.Flush()
+}
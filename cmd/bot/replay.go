@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	ds "github.com/joshskilla/trading-bot/internal/datastore"
+	"github.com/joshskilla/trading-bot/internal/engine"
+	"github.com/joshskilla/trading-bot/internal/marketdata/finnhub"
+	"github.com/urfave/cli/v3"
+)
+
+// Flags saying how `bot replay` plays a session back; they go with --file
+// rather than being replaced by it
+var replayFlags = []string{"recording", "date", "speed", "output"}
+
+// Replays a paper or live session's recorded trade stream through its portfolios,
+// paper trading on a simulated clock. Results go to their own BOT_PATH.
+// USAGE: bot replay -f paper.yaml --date yesterday
+// USAGE: bot replay -p demo -s momentum -c cp1 --recording recordings/trades_2024-01-02T143000Z.jsonl.gz --speed 60
+func ReplayCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "replay",
+		Usage: "Replay recorded trade streams through portfolios with strategies & checkpoints",
+		Flags: append(append(runnerFlags(),
+			&cli.StringSliceFlag{Name: "recording", Usage: "Recording to replay (repeatable, played in order)"},
+			&cli.StringFlag{Name: "date", Usage: "Replay every recording from this UTC date: YYYY-MM-DD, today or yesterday"},
+			&cli.Float64Flag{Name: "speed", Usage: "Multiple of real time to replay at, e.g. 1 or 60 (0 => as fast as possible)"},
+			&cli.StringFlag{Name: "output", Usage: "BOT_PATH for the replay's results (default replays/<recording>)"},
+		), append(riskFlags(), breakerFlags()...)...),
+		Action: func(ctx context.Context, c *cli.Command) error {
+			paths, err := recordingPaths(c.StringSlice("recording"), c.String("date"))
+			if err != nil {
+				return err
+			}
+			if c.Float64("speed") < 0 {
+				return errors.New("--speed must not be negative")
+			}
+
+			var plan *sessionPlan
+			if c.String("file") != "" {
+				if plan, err = loadSessionFile(c, "paper", "live"); err != nil {
+					return err
+				}
+			} else {
+				entries, err := loadSession(c)
+				if err != nil {
+					return err
+				}
+				breakers, err := breakersFromFlags(c, entries)
+				if err != nil {
+					return err
+				}
+				plan = &sessionPlan{
+					entries:  entries,
+					hours:    engine.RegularHours(),
+					fills:    engine.DefaultFillModel(),
+					risk:     riskFromFlags(c, entries),
+					breakers: breakers,
+				}
+			}
+
+			interval, err := sessionInterval(plan.entries)
+			if err != nil {
+				return err
+			}
+			replay, err := finnhub.LoadReplay(interval, paths...)
+			if err != nil {
+				return err
+			}
+			plan.mode, plan.replay, plan.speed = "replay", replay, c.Float64("speed")
+			plan.start, plan.end = replay.Span()
+
+			// Portfolios & checkpoints are loaded; keep what the replay writes apart
+			output := c.String("output")
+			if output == "" {
+				output = filepath.Join("replays", strings.TrimSuffix(filepath.Base(paths[0]), ".jsonl.gz"))
+			}
+			if err := useOutputDir(resolvePath(output)); err != nil {
+				return err
+			}
+			fmt.Printf("Replaying %d recording(s) from %s to %s; results in %s\n",
+				len(paths), plan.start.Format(time.RFC3339), plan.end.Format(time.RFC3339), ds.AbsolutePath(""))
+			return runSession(ctx, plan)
+		},
+	}
+}
+
+// Resolves --recording paths, or finds --date's recordings
+func recordingPaths(recordings []string, date string) ([]string, error) {
+	switch {
+	case len(recordings) > 0 && date != "":
+		return nil, errors.New("use --recording or --date, not both")
+	case len(recordings) > 0:
+		paths := make([]string, len(recordings))
+		for i, r := range recordings {
+			paths[i] = resolvePath(r)
+		}
+		return paths, nil
+	case date == "":
+		return nil, errors.New("--recording or --date is required")
+	}
+
+	switch date {
+	case "today":
+		date = time.Now().UTC().Format(time.DateOnly)
+	case "yesterday":
+		date = time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+	default:
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return nil, fmt.Errorf("invalid --date %q (want YYYY-MM-DD, today or yesterday)", date)
+		}
+	}
+	pattern := ds.AbsolutePath(fmt.Sprintf(finnhub.RecordingFilePath, date+"T*"))
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no recordings from %s in %s", date, filepath.Dir(pattern))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/report"
+	"github.com/urfave/cli/v3"
+)
+
+// Regenerates a portfolio's performance report from its saved results
+// USAGE: bot report --portfolio demo [--start 2024-01-02T00:00:00Z] [--end ...]
+func ReportCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "report",
+		Usage: "Print & save a performance report from a portfolio's results",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "portfolio", Aliases: []string{"p"}, Usage: "Portfolio name", Required: true},
+			&cli.StringFlag{Name: "start", Usage: "Only include results from this time (RFC3339)"},
+			&cli.StringFlag{Name: "end", Usage: "Only include results up to this time (RFC3339)"},
+			&cli.Float64Flag{Name: "risk-free", Usage: "Annual risk-free rate for Sharpe & Sortino (e.g. 0.04)"},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			var from, to time.Time
+			var err error
+			if s := c.String("start"); s != "" {
+				if from, err = time.Parse(time.RFC3339, s); err != nil {
+					return fmt.Errorf("invalid start time: %w", err)
+				}
+			}
+			if s := c.String("end"); s != "" {
+				if to, err = time.Parse(time.RFC3339, s); err != nil {
+					return fmt.Errorf("invalid end time: %w", err)
+				}
+			}
+			return writeReport(c.String("portfolio"), from, to, report.Options{RiskFreeRate: c.Float64("risk-free")})
+		},
+	}
+}
+
+// Generates, prints and saves a portfolio's report
+func writeReport(name string, from, to time.Time, opts report.Options) error {
+	r, err := report.Generate(name, from, to, opts)
+	if err != nil {
+		return fmt.Errorf("failed to generate report: %w", err)
+	}
+	r.Print(os.Stdout)
+	if err := r.SaveToJSON(); err != nil {
+		return fmt.Errorf("failed to save report: %w", err)
+	}
+	fmt.Printf("Saved report to "+report.ReportFilePath+"\n", name)
+	return nil
+}
@@ -2,64 +2,87 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"os"
 	"time"
 
+	broker "github.com/joshskilla/trading-bot/internal/broker/alpaca"
 	cfg "github.com/joshskilla/trading-bot/internal/config"
 	"github.com/joshskilla/trading-bot/internal/engine"
-	st "github.com/joshskilla/trading-bot/internal/strategy"
+	md "github.com/joshskilla/trading-bot/internal/marketdata"
+	"github.com/joshskilla/trading-bot/internal/session"
 
 	"github.com/urfave/cli/v3"
 )
 
+// Runs one or more portfolios against live data, sharing one market data feed
+// USAGE: bot run -p demo -s momentum -c cp1 [--runner other:momentum:cp2 ...]
+// USAGE: bot run -f session.yaml
 func RunCmd() *cli.Command {
 	return &cli.Command{
 		Name:  "run",
-		Usage: "Run a portfolio with a strategy & checkpoint",
-		Flags: []cli.Flag{
-			&cli.StringFlag{Name: "portfolio", Aliases: []string{"p"}, Usage: "Portfolio name", Required: true},
-			&cli.StringFlag{Name: "strategy", Aliases: []string{"s"}, Usage: "Strategy name", Required: true},
-			&cli.StringFlag{Name: "checkpoint", Aliases: []string{"c"}, Usage: "Checkpoint label or id"},
-		},
+		Usage: "Run portfolios with strategies & checkpoints",
+		Flags: append(append(runnerFlags(),
+			&cli.StringFlag{Name: "mode", Value: "paper", Usage: "paper (simulated fills) or live (orders sent to the Alpaca account)"},
+			&cli.StringFlag{Name: "listen", Usage: "Serve the HTTP status & control API on this address, e.g. :8080 or localhost:8080"},
+			&cli.StringFlag{Name: "finnhub-url", Usage: "Stream trades from this websocket instead of Finnhub's (or FINNHUB_URL), e.g. ws://localhost:9090 from `bot mock-finnhub`"},
+			&cli.BoolFlag{Name: "record", Value: true, Usage: "Record the trade stream under recordings/ for `bot replay`"},
+		), append(riskFlags(), breakerFlags()...)...),
 		Action: func(ctx context.Context, c *cli.Command) error {
-			portfolioName := c.String("portfolio")
-			strategyType := c.String("strategy")
-			checkpointName := c.String("checkpoint")
-
-			if portfolioName == "" || strategyType == "" || checkpointName == "" {
-				return errors.New("--portfolio, --strategy, and --checkpoint are required")
-			}
-
-			// Load portfolio and checkpoint
-			fmt.Printf("Restoring portfolio %q with strategy %q from checkpoint %q\n", portfolioName, strategyType, checkpointName)
-			portfolio, err := engine.LoadPortfolioFromJSON(portfolioName)
-			if err != nil {
-				return fmt.Errorf("failed to load portfolio: %w", err)
+			if c.String("file") != "" {
+				plan, err := loadSessionFile(c, "paper", "live")
+				if err != nil {
+					return err
+				}
+				return runSession(ctx, plan)
 			}
 
-			var checkpoint *st.Checkpoint
-			checkpoint, err = st.LoadCheckpointFromJSON(checkpointName)
+			entries, err := loadSession(c)
 			if err != nil {
-				return fmt.Errorf("failed to get checkpoint: %w", err)
+				return err
 			}
-
-			// Restore strategy state
-			var strat st.Strategy
-			strat, err = st.RestoreFromCheckpoint(strategyType, checkpoint)
+			breakers, err := breakersFromFlags(c, entries)
 			if err != nil {
-				return fmt.Errorf("failed to restore strategy from checkpoint: %w", err)
+				return err
 			}
-
-			trader := engine.NewPaperTrader(ctx, strat.TickInterval())
-			if err := trader.IncludeAssets(ctx, portfolio.Assets()); err != nil {
-				return fmt.Errorf("failed to include assets in trader: %w", err)
-			}
-
-			// Run the trading session
 			start := time.Now()
-			defaultEnd := start.Add(cfg.MaxLiveTradingDuration)
-			return engine.Run(portfolio, strat, trader, false, start, defaultEnd)
+			return runSession(ctx, &sessionPlan{
+				mode:     c.String("mode"),
+				entries:  entries,
+				start:    start,
+				end:      start.Add(cfg.MaxLiveTradingDuration),
+				hours:    engine.RegularHours(),
+				fills:    engine.DefaultFillModel(),
+				risk:     riskFromFlags(c, entries),
+				breakers: breakers,
+				listen:   c.String("listen"),
+				data:     session.Data{Source: "finnhub", URL: c.String("finnhub-url"), Record: c.Bool("record")},
+			})
 		},
 	}
 }
+
+// newLiveSessionTrader builds a portfolio's trader for a live-data session. Live mode
+// reconciles the portfolio with the broker account before trading.
+func newLiveSessionTrader(ctx context.Context, mode string, p *engine.Portfolio, prov md.BarProvider) (engine.Trader, error) {
+	switch mode {
+	case "paper":
+		trader := engine.NewPaperTraderWithProvider(prov)
+		if err := trader.TrackOrders(p.Name); err != nil {
+			return nil, err
+		}
+		return trader, nil
+	case "live":
+		br := broker.NewClient(os.Getenv("ALPACA_TRADING_URL"), os.Getenv("ALPACA_API_KEY"), os.Getenv("ALPACA_API_SECRET"))
+		trader := engine.NewLiveTraderWithBroker(prov, br)
+		if err := trader.TrackOrders(p.Name); err != nil {
+			return nil, err
+		}
+		if err := trader.Reconcile(ctx, p); err != nil {
+			return nil, fmt.Errorf("failed to reconcile with broker: %w", err)
+		}
+		return trader, nil
+	default:
+		return nil, fmt.Errorf("unknown mode %q (use paper or live)", mode)
+	}
+}
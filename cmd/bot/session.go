@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/api"
+	ds "github.com/joshskilla/trading-bot/internal/datastore"
+	"github.com/joshskilla/trading-bot/internal/engine"
+	md "github.com/joshskilla/trading-bot/internal/marketdata"
+	"github.com/joshskilla/trading-bot/internal/marketdata/finnhub"
+	"github.com/joshskilla/trading-bot/internal/report"
+	"github.com/joshskilla/trading-bot/internal/session"
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	t "github.com/joshskilla/trading-bot/internal/types"
+	"github.com/urfave/cli/v3"
+)
+
+// sessionEntry is one portfolio traded by one strategy within a session
+type sessionEntry struct {
+	portfolio    *engine.Portfolio
+	strat        st.Strategy
+	strategyType string         // registry name, e.g. momentum
+	checkpoint   *st.Checkpoint // nil => state isn't saved
+}
+
+// Modes that save strategy state back to its checkpoint when the session ends.
+// Backtests & replays don't: their state is as of the end of some past window
+// (its last bar included, so rerunning from the checkpoint would skip every bar).
+var checkpointModes = []string{"paper", "live"}
+
+// sessionPlan is a fully specified session, from flags or a session file
+type sessionPlan struct {
+	mode       string // backtest, paper, live or replay
+	entries    []sessionEntry
+	start, end time.Time
+	hours      t.TradingHours
+	fills      engine.FillModel
+	risk       map[string]engine.RiskLimits // by portfolio
+	breakers   map[string]engine.BreakerLimits
+	data       session.Data
+	listen     string // address to serve the HTTP API on, "" => none
+	replay     *finnhub.Replay
+	speed      float64 // replays: multiple of real time, 0 => as fast as possible
+}
+
+// Flags selecting the session's portfolios: a single -p/-s/-c triple and/or repeated --runner
+func runnerFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "file", Aliases: []string{"f"}, Usage: "Session file (YAML) describing the whole session, instead of flags"},
+		&cli.StringFlag{Name: "portfolio", Aliases: []string{"p"}, Usage: "Portfolio name"},
+		&cli.StringFlag{Name: "strategy", Aliases: []string{"s"}, Usage: "Strategy name"},
+		&cli.StringFlag{Name: "checkpoint", Aliases: []string{"c"}, Usage: "Checkpoint label or id"},
+		&cli.StringSliceFlag{Name: "runner", Aliases: []string{"r"}, Usage: "portfolio:strategy:checkpoint to run alongside the others (repeatable)"},
+	}
+}
+
+// Flags setting pre-trade risk limits, applied to every portfolio in the session
+func riskFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.Float64Flag{Name: "max-position", Usage: "Risk: max value held in any one asset"},
+		&cli.Float64Flag{Name: "max-exposure", Usage: "Risk: max gross value held across all assets"},
+		&cli.Float64Flag{Name: "max-order", Usage: "Risk: max value of a single order"},
+		&cli.IntFlag{Name: "max-orders-per-minute", Usage: "Risk: max orders sent in any minute"},
+		&cli.Float64Flag{Name: "max-daily-loss", Usage: "Risk: equity lost in a day before only risk-reducing orders are allowed"},
+		&cli.BoolFlag{Name: "no-shorting", Usage: "Risk: never sell below a flat position"},
+	}
+}
+
+// Builds the risk limits from the flags, for every portfolio in the session
+func riskFromFlags(c *cli.Command, entries []sessionEntry) map[string]engine.RiskLimits {
+	limits := engine.RiskLimits{
+		MaxPosition:        c.Float64("max-position"),
+		MaxGrossExposure:   c.Float64("max-exposure"),
+		MaxOrderNotional:   c.Float64("max-order"),
+		MaxOrdersPerMinute: c.Int("max-orders-per-minute"),
+		MaxDailyLoss:       c.Float64("max-daily-loss"),
+		NoShorting:         c.Bool("no-shorting"),
+	}
+	risk := make(map[string]engine.RiskLimits, len(entries))
+	for _, e := range entries {
+		risk[e.portfolio.Name] = limits
+	}
+	return risk
+}
+
+// Flags setting the circuit breaker, applied to every portfolio in the session
+func breakerFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.Float64Flag{Name: "max-drawdown", Usage: "Halt: fraction of peak equity lost before trading stops, e.g. 0.1"},
+		&cli.IntFlag{Name: "max-rejections", Usage: "Halt: consecutive rejected orders before trading stops"},
+		&cli.DurationFlag{Name: "max-data-age", Usage: "Halt: how old the newest bar may get before trading stops, e.g. 5m"},
+		&cli.BoolFlag{Name: "flatten-on-halt", Usage: "Halt: close every position when trading stops"},
+	}
+}
+
+// Builds the circuit breaker limits from the flags, for every portfolio in the session
+func breakersFromFlags(c *cli.Command, entries []sessionEntry) (map[string]engine.BreakerLimits, error) {
+	limits := engine.BreakerLimits{
+		MaxDrawdown:   c.Float64("max-drawdown"),
+		MaxRejections: c.Int("max-rejections"),
+		MaxDataAge:    c.Duration("max-data-age"),
+		Flatten:       c.Bool("flatten-on-halt"),
+	}
+	if limits.MaxDrawdown < 0 || limits.MaxDrawdown >= 1 {
+		return nil, fmt.Errorf("--max-drawdown %v: want a fraction of peak equity in [0, 1)", limits.MaxDrawdown)
+	}
+	breakers := make(map[string]engine.BreakerLimits, len(entries))
+	for _, e := range entries {
+		breakers[e.portfolio.Name] = limits
+	}
+	return breakers, nil
+}
+
+// Loads every portfolio & restores every strategy named on the command line
+func loadSession(c *cli.Command) ([]sessionEntry, error) {
+	var specs [][3]string
+	if p, s, cp := c.String("portfolio"), c.String("strategy"), c.String("checkpoint"); p != "" || s != "" || cp != "" {
+		if p == "" || s == "" || cp == "" {
+			return nil, errors.New("--portfolio, --strategy, and --checkpoint are required together")
+		}
+		specs = append(specs, [3]string{p, s, cp})
+	}
+	for _, r := range c.StringSlice("runner") {
+		parts := strings.Split(r, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid --runner %q (want portfolio:strategy:checkpoint)", r)
+		}
+		specs = append(specs, [3]string{parts[0], parts[1], parts[2]})
+	}
+	if len(specs) == 0 {
+		return nil, errors.New("--portfolio, --strategy, and --checkpoint (or --runner, or --file) are required")
+	}
+
+	seen := make(map[string]bool)
+	entries := make([]sessionEntry, 0, len(specs))
+	for _, spec := range specs {
+		portfolioName, strategyType, checkpointName := spec[0], spec[1], spec[2]
+		if seen[portfolioName] {
+			return nil, fmt.Errorf("portfolio %q is listed twice; each runner needs its own portfolio", portfolioName)
+		}
+		seen[portfolioName] = true
+
+		// Load portfolio and checkpoint
+		fmt.Printf("Restoring portfolio %q with strategy %q from checkpoint %q\n", portfolioName, strategyType, checkpointName)
+		portfolio, err := engine.LoadPortfolioFromJSON(portfolioName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load portfolio %s: %w", portfolioName, err)
+		}
+		checkpoint, err := st.LoadCheckpointFromJSON(checkpointName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get checkpoint %s: %w", checkpointName, err)
+		}
+
+		// Restore strategy state
+		strat, err := st.RestoreFromCheckpoint(strategyType, checkpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore strategy %s from checkpoint: %w", strategyType, err)
+		}
+		entries = append(entries, sessionEntry{portfolio: portfolio, strat: strat, strategyType: strategyType, checkpoint: checkpoint})
+	}
+	return entries, nil
+}
+
+// ----------- SESSION FILES -----------
+
+// Loads the --file session, checking it is for the command's modes and
+// isn't mixed with flags the file replaces
+func loadSessionFile(c *cli.Command, modes ...string) (*sessionPlan, error) {
+	for _, f := range c.Flags {
+		if name := f.Names()[0]; name != "file" && !contains(replayFlags, name) && c.IsSet(name) {
+			return nil, fmt.Errorf("--%s can't be combined with --file; set it in the session file", name)
+		}
+	}
+	s, err := session.Load(c.String("file"))
+	if err != nil {
+		return nil, err
+	}
+	if !contains(modes, s.Mode) {
+		return nil, s.Errorf("mode", "%s sessions can't be started with `bot %s` (want %s)", s.Mode, c.Name, strings.Join(modes, " or "))
+	}
+
+	plan := &sessionPlan{mode: s.Mode, start: s.Start, end: s.End, hours: s.Hours, fills: s.Fills, data: s.Data, listen: s.Listen}
+	plan.risk = make(map[string]engine.RiskLimits, len(s.Runners))
+	plan.breakers = make(map[string]engine.BreakerLimits, len(s.Runners))
+	if plan.mode != "backtest" {
+		plan.start = time.Now()
+		plan.end = plan.start.Add(s.Duration)
+	}
+	if plan.data.Dir == "" {
+		plan.data.Dir = resolvePath(DefaultDataDir) // before BOT_PATH moves to the output directory
+	}
+	if s.Output != "" {
+		if err := useOutputDir(s.Output); err != nil {
+			return nil, s.Errorf("output", "%v", err)
+		}
+	}
+
+	for i, r := range s.Runners {
+		key := fmt.Sprintf("runners[%d]", i)
+		portfolio, err := engine.LoadPortfolioFromJSON(r.Portfolio)
+		switch {
+		case errors.Is(err, os.ErrNotExist) && r.Cash > 0:
+			fmt.Printf("Creating portfolio %q with cash=%.2f\n", r.Portfolio, r.Cash)
+			portfolio = engine.NewPortfolio(r.Portfolio, r.Cash)
+			if err := portfolio.SaveToJSON(); err != nil {
+				return nil, fmt.Errorf("failed to create portfolio %s: %w", r.Portfolio, err)
+			}
+		case errors.Is(err, os.ErrNotExist):
+			return nil, s.Errorf(key+".portfolio", "portfolio %q doesn't exist; set cash to create it", r.Portfolio)
+		case err != nil:
+			return nil, fmt.Errorf("failed to load portfolio %s: %w", r.Portfolio, err)
+		}
+
+		// Saved state, overridden by the file's parameters
+		attrs := make(map[string]any)
+		var checkpoint *st.Checkpoint
+		if r.Checkpoint != "" {
+			checkpoint = &st.Checkpoint{ID: r.Checkpoint}
+			saved, err := st.LoadCheckpointFromJSON(r.Checkpoint)
+			switch {
+			case err == nil:
+				attrs = saved.Attributes
+			case !errors.Is(err, os.ErrNotExist):
+				return nil, fmt.Errorf("failed to get checkpoint %s: %w", r.Checkpoint, err)
+			}
+		}
+		if def, ok := st.Lookup(r.Strategy); ok {
+			def.Params.Override(attrs, r.Params)
+		} else {
+			maps.Copy(attrs, r.Params)
+		}
+
+		fmt.Printf("Starting portfolio %q with strategy %q\n", r.Portfolio, r.Strategy)
+		strat, err := st.RestoreFromCheckpoint(r.Strategy, &st.Checkpoint{ID: r.Checkpoint, Attributes: attrs})
+		if err != nil {
+			return nil, s.Errorf(key, "%v", err)
+		}
+		plan.entries = append(plan.entries, sessionEntry{portfolio: portfolio, strat: strat, strategyType: r.Strategy, checkpoint: checkpoint})
+		plan.risk[r.Portfolio] = r.Risk
+		plan.breakers[r.Portfolio] = r.Breaker
+	}
+	return plan, nil
+}
+
+// Points BOT_PATH at dir for the rest of the process, creating the
+// directories the session writes to
+func useOutputDir(dir string) error {
+	for _, path := range []string{engine.PortfolioFilePath, engine.OpenOrdersFilePath, st.CheckpointFilePath, engine.EquityFilePath} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755); err != nil {
+			return err
+		}
+	}
+	return os.Setenv("BOT_PATH", dir)
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ----------- RUNNING -----------
+
+// Builds a trader per portfolio over one shared data feed, runs the
+// session and saves what it leaves behind
+func runSession(ctx context.Context, plan *sessionPlan) error {
+	interval, err := sessionInterval(plan.entries)
+	if err != nil {
+		return err
+	}
+
+	// One data feed (& Finnhub websocket) for every runner
+	var feed *md.Shared
+	switch plan.mode {
+	case "backtest":
+		src, err := newBarSource(plan.data.Source, plan.data.Dir, plan.data.Cache, interval, plan.start, plan.end)
+		if err != nil {
+			return err
+		}
+		feed = md.NewShared(src)
+	case "replay":
+		feed = md.NewShared(plan.replay)
+	default:
+		if plan.mode == "live" && len(plan.entries) > 1 {
+			return errors.New("live mode reconciles each portfolio with the whole broker account; run one portfolio per live session")
+		}
+		stream := engine.NewStreamProvider(interval)
+		if plan.data.URL != "" {
+			stream.URL = plan.data.URL
+		}
+		if plan.data.Record {
+			name := fmt.Sprintf(finnhub.RecordingFilePath, time.Now().UTC().Format(finnhub.RecordingTimeFormat))
+			rec, err := finnhub.NewRecorder(ds.AbsolutePath(name))
+			if err != nil {
+				return err
+			}
+			defer rec.Close()
+			stream.Recorder = rec
+			fmt.Printf("Recording the trade stream to %s\n", rec.Path())
+		}
+		feed = md.NewShared(stream)
+	}
+
+	events := engine.NewEventBus()
+	runners := make([]*engine.Runner, 0, len(plan.entries))
+	for _, e := range plan.entries {
+		// A backtest or replay reports on its own fills & equity, not the last run's too
+		if plan.mode == "backtest" || plan.mode == "replay" {
+			if err := e.portfolio.ClearResults(); err != nil {
+				return fmt.Errorf("failed to clear results of %s: %w", e.portfolio.Name, err)
+			}
+		}
+		var trader engine.Trader
+		switch plan.mode {
+		case "backtest":
+			tt := engine.NewTestTraderWithProvider(feed.Acquire(), interval, plan.start, plan.end)
+			tt.Fills = plan.fills
+			trader = tt
+		case "replay":
+			pt := engine.NewPaperTraderWithProvider(feed.Acquire())
+			pt.Fills = plan.fills
+			pt.Clock = t.NewSimClock(plan.start) // moved on tick by tick by its runner
+			trader = pt
+		default:
+			if trader, err = newLiveSessionTrader(ctx, plan.mode, e.portfolio, feed.Acquire()); err != nil {
+				return err
+			}
+			if pt, ok := trader.(*engine.PaperTrader); ok {
+				pt.Fills = plan.fills
+			}
+		}
+		if err := trader.IncludeAssets(ctx, engine.MarketAssets(e.portfolio, e.strat)); err != nil {
+			return fmt.Errorf("failed to include assets in trader: %w", err)
+		}
+		runner := engine.NewRunner(e.portfolio, trader, e.strat, nil)
+		runner.StrategyType = e.strategyType
+		runner.Events = events
+		if limits := plan.risk[e.portfolio.Name]; !limits.IsZero() {
+			runner.Risk = engine.NewRiskManager(limits)
+		}
+		if limits := plan.breakers[e.portfolio.Name]; !limits.IsZero() {
+			runner.Breaker = engine.NewCircuitBreaker(limits)
+			runner.Breaker.Watch(trader.Orders())
+		}
+		if e.checkpoint != nil {
+			runner.CheckpointID = e.checkpoint.ID
+		}
+		runners = append(runners, runner)
+	}
+
+	// Run the trading session, controlled from stdin (& HTTP when listening)
+	console := engine.NewConsole(runners)
+	if plan.listen != "" {
+		stop, err := api.NewServer(console, events).Listen(plan.listen)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+	if plan.mode == "replay" {
+		// Paced by the recording's own time, sped up; or as fast as possible
+		var clock t.Clock = t.NewSimClock(plan.start)
+		if plan.speed > 0 {
+			clock = t.NewAcceleratedClock(plan.start, plan.speed)
+		}
+		err = engine.RunWithTicks(console, t.ReplayTicks, clock, false, plan.start, plan.end, plan.hours)
+	} else {
+		err = engine.Run(console, plan.mode == "backtest", plan.start, plan.end, plan.hours)
+	}
+	if err != nil {
+		return err
+	}
+	if contains(checkpointModes, plan.mode) {
+		if err := saveCheckpoints(plan.entries); err != nil {
+			return err
+		}
+	}
+	if plan.mode == "backtest" || plan.mode == "replay" {
+		for _, e := range plan.entries {
+			if err := writeReport(e.portfolio.Name, plan.start, plan.end, report.Options{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the tick interval shared by the session's strategies
+func sessionInterval(entries []sessionEntry) (time.Duration, error) {
+	interval := entries[0].strat.TickInterval()
+	for _, e := range entries[1:] {
+		if e.strat.TickInterval() != interval {
+			return 0, fmt.Errorf("strategy %s on portfolio %s ticks every %s, not %s; a session's strategies must share a tick interval",
+				e.strat.Name(), e.portfolio.Name, e.strat.TickInterval(), interval)
+		}
+	}
+	return interval, nil
+}
+
+// Saves each strategy's state so the next run resumes where this one stopped
+func saveCheckpoints(entries []sessionEntry) error {
+	for _, e := range entries {
+		cp, ok := e.strat.(st.Checkpointer)
+		if !ok || e.checkpoint == nil {
+			continue
+		}
+		if err := cp.Checkpoint(e.checkpoint.ID).SaveToJSON(); err != nil {
+			return fmt.Errorf("failed to save checkpoint: %w", err)
+		}
+		fmt.Printf("Saved strategy state to checkpoint %q\n", e.checkpoint.ID)
+	}
+	return nil
+}
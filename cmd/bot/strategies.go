@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	"github.com/urfave/cli/v3"
+)
+
+// Inspect registered strategies and their checkpoint parameters
+// USAGE: bot strategies list | bot strategies describe momentum
+func StrategiesCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "strategies",
+		Usage: "List strategies & describe their checkpoint parameters",
+		Commands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "List registered strategies",
+				Action: func(ctx context.Context, c *cli.Command) error {
+					tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(tw, "NAME\tPARAMS\tDESCRIPTION")
+					for _, def := range st.Registered() {
+						fmt.Fprintf(tw, "%s\t%d\t%s\n", def.Name, len(def.Params), def.Description)
+					}
+					return tw.Flush()
+				},
+			},
+			{
+				Name:      "describe",
+				Usage:     "Print a strategy's parameter schema",
+				ArgsUsage: "<name>",
+				Action: func(ctx context.Context, c *cli.Command) error {
+					name := c.Args().First()
+					if name == "" {
+						return errors.New("strategy name required")
+					}
+					def, ok := st.Lookup(name)
+					if !ok {
+						return fmt.Errorf("unknown strategy %q (available: %s)", name, strings.Join(st.Names(), ", "))
+					}
+					fmt.Printf("%s: %s\n\n", def.Name, def.Description)
+					tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(tw, "PARAM\tTYPE\tDEFAULT\tRANGE\tALIASES\tDESCRIPTION")
+					for _, p := range def.Params {
+						fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+							p.Name, p.Type, describeDefault(p), describeRange(p), strings.Join(p.Aliases, ","), p.Description)
+					}
+					return tw.Flush()
+				},
+			},
+		},
+	}
+}
+
+func describeDefault(p st.Param) string {
+	if p.Default == nil {
+		return "(required)"
+	}
+	return fmt.Sprint(p.Default)
+}
+
+func describeRange(p st.Param) string {
+	if p.Min == nil && p.Max == nil {
+		return "-"
+	}
+	lo, hi := "", ""
+	if p.Min != nil {
+		lo = fmt.Sprint(*p.Min)
+	}
+	if p.Max != nil {
+		hi = fmt.Sprint(*p.Max)
+	}
+	return fmt.Sprintf("[%s, %s]", lo, hi)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	ds "github.com/joshskilla/trading-bot/internal/datastore"
+	"github.com/joshskilla/trading-bot/internal/engine"
+	bc "github.com/joshskilla/trading-bot/internal/marketdata/cache"
+	"github.com/joshskilla/trading-bot/internal/optimize"
+	"github.com/urfave/cli/v3"
+)
+
+// Walk-forward analysis: optimise on rolling in-sample windows, trade each
+// winner on the out-of-sample period that follows, and report the stitched result
+// USAGE: bot walkforward --strategy momentum --param asset=AAPL --param fast=5:20:5 --start ... --end ... --in-sample 60d --out-sample 20d
+func WalkForwardCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "walkforward",
+		Usage: "Optimise on rolling in-sample windows & stitch the out-of-sample results",
+		// --param values carry their own commas (name=a,b,c)
+		DisableSliceFlagSeparator: true,
+		Flags: append(append([]cli.Flag{
+			&cli.StringFlag{Name: "strategy", Aliases: []string{"s"}, Usage: "Strategy name", Required: true},
+			&cli.StringFlag{Name: "start", Usage: "Start of the first in-sample window (RFC3339)", Required: true},
+			&cli.StringFlag{Name: "end", Usage: "End of the last out-of-sample window (RFC3339)", Required: true},
+			&cli.StringFlag{Name: "in-sample", Usage: "In-sample window length, e.g. 60d or 720h", Required: true},
+			&cli.StringFlag{Name: "out-sample", Usage: "Out-of-sample window length, e.g. 20d", Required: true},
+			&cli.BoolFlag{Name: "anchored", Usage: "Grow in-sample windows from --start instead of rolling them"},
+			&cli.StringFlag{Name: "portfolio", Aliases: []string{"p"}, Usage: "Name for the stitched results (default walkforward-<strategy>)"},
+		}, sweepFlags()...), simulationFlags()...),
+		Action: func(ctx context.Context, c *cli.Command) error {
+			start, end, err := parsePeriod(c)
+			if err != nil {
+				return err
+			}
+			inSample, err := bc.ParseInterval(c.String("in-sample"))
+			if err != nil {
+				return fmt.Errorf("invalid --in-sample: %w", err)
+			}
+			outSample, err := bc.ParseInterval(c.String("out-sample"))
+			if err != nil {
+				return fmt.Errorf("invalid --out-sample: %w", err)
+			}
+			windows, err := optimize.Windows(start, end, inSample, outSample, c.Bool("anchored"))
+			if err != nil {
+				return err
+			}
+			sw, err := newSweep(ctx, c, start, end)
+			if err != nil {
+				return err
+			}
+			name := c.String("portfolio")
+			if name == "" {
+				name = "walkforward-" + sw.def.Name
+			}
+
+			fmt.Printf("Walking %s forward over %d windows, %d combinations each\n", sw.def.Name, len(windows), len(sw.combos))
+			p := engine.NewMemoryPortfolio(name, sw.cfg.Cash)
+			steps := optimize.WalkForward(ctx, sw.cfg, sw.def, sw.combos, sw.metric, windows, p)
+			printSteps(sw.params, sw.metric, steps)
+
+			path := ds.AbsolutePath(fmt.Sprintf(optimize.WalkForwardFilePath, sw.def.Name))
+			if err := optimize.WriteStepsCSV(path, sw.params, sw.metric, steps); err != nil {
+				return fmt.Errorf("failed to write windows: %w", err)
+			}
+			fmt.Printf("Saved %d windows to %s\n", len(steps), path)
+
+			if len(p.EquityHistory) == 0 {
+				return errors.New("no out-of-sample results; see the windows file")
+			}
+			if err := saveResults(p); err != nil {
+				return err
+			}
+			return writeReport(name, time.Time{}, time.Time{}, sw.cfg.Report)
+		},
+	}
+}
+
+// Writes an in-memory portfolio's equity curve & executions as its results files,
+// replacing any from an earlier run, so `bot report` can read them
+func saveResults(mem *engine.Portfolio) error {
+	p := engine.NewPortfolio(mem.Name, mem.Cash)
+	if err := p.ClearResults(); err != nil {
+		return err
+	}
+	p.Positions, p.CostBasis, p.LastPrices, p.MarkedAt = mem.Positions, mem.CostBasis, mem.LastPrices, mem.MarkedAt
+	p.EquityHistory, p.ExecutionHistory = mem.EquityHistory, mem.ExecutionHistory
+	if err := p.FlushEquityToFile(); err != nil {
+		return fmt.Errorf("failed to write equity: %w", err)
+	}
+	if len(p.ExecutionHistory) > 0 {
+		if err := p.FlushOrdersToFile(); err != nil {
+			return fmt.Errorf("failed to write orders: %w", err)
+		}
+	}
+	return p.FlushPositionsToFile()
+}
+
+// Prints each window's chosen parameters & out-of-sample return
+func printSteps(params []optimize.Param, metric optimize.Metric, steps []optimize.Step) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "WINDOW\tIN SAMPLE\tOUT OF SAMPLE")
+	for _, p := range params {
+		fmt.Fprintf(tw, "\t%s", strings.ToUpper(p.Name))
+	}
+	fmt.Fprintf(tw, "\tIS %s\tOOS RETURN\n", strings.ToUpper(metric.Name))
+	const day = "2006-01-02 15:04"
+	for i, s := range steps {
+		fmt.Fprintf(tw, "%d\t%s..%s\t..%s", i+1, s.InStart.Format(day), s.InEnd.Format(day), s.OutEnd.Format(day))
+		for _, p := range params {
+			fmt.Fprintf(tw, "\t%v", s.Best.Params[p.Name])
+		}
+		if s.Err != nil {
+			fmt.Fprintf(tw, "\t-\t%v\n", s.Err)
+			continue
+		}
+		fmt.Fprintf(tw, "\t%.4f\t%.2f%%\n", metric.Value(s.Best.Report), s.OutSample.TotalReturn*100)
+	}
+	tw.Flush()
+}
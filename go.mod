@@ -6,11 +6,13 @@ require github.com/urfave/cli/v3 v3.4.1
 
 require github.com/joho/godotenv v1.5.1
 
-require github.com/gorilla/websocket v1.5.3
+require (
+	github.com/alpacahq/alpaca-trade-api-go/v3 v3.8.1
+	github.com/gorilla/websocket v1.5.3
+)
 
 require (
 	cloud.google.com/go v0.122.0 // indirect
-	github.com/alpacahq/alpaca-trade-api-go/v3 v3.8.1 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/mailru/easyjson v0.9.0 // indirect
 	github.com/shopspring/decimal v1.4.0 // indirect
@@ -20,5 +22,5 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.11.1
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
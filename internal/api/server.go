@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/joshskilla/trading-bot/internal/engine"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// Server exposes a running session over local HTTP: JSON status & control
+// endpoints backed by the session's console, and a server-sent events
+// stream of its ticks, fills and halts. Most endpoints take ?portfolio=
+// to pick one portfolio.
+//
+//	GET  /status                 status of each portfolio
+//	GET  /portfolios/{name}      status, positions & open orders of one portfolio
+//	GET  /executions?n=10        recent fills
+//	GET  /bars                   latest bar per asset
+//	POST /pause, /resume         stop & restart trading
+//	POST /checkpoint?id=...      save strategy state (id defaults to the session's)
+//	POST /shutdown               end the session
+//	POST /command                any console command: {"command": "flatten AAPL @demo"}
+//	GET  /events?type=fill,tick  text/event-stream of engine.Events
+type Server struct {
+	console *engine.Console
+	events  *engine.EventBus
+	mux     *http.ServeMux
+}
+
+// Events published while a subscriber is writing are buffered up to this
+// many before they are dropped for it
+const eventBuffer = 256
+
+func NewServer(console *engine.Console, events *engine.EventBus) *Server {
+	s := &Server{console: console, events: events, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /status", s.command("status"))
+	s.mux.HandleFunc("GET /portfolios/{name}", s.handlePortfolio)
+	s.mux.HandleFunc("GET /executions", s.command("executions", "n"))
+	s.mux.HandleFunc("GET /bars", s.command("bars"))
+	s.mux.HandleFunc("POST /pause", s.command("pause"))
+	s.mux.HandleFunc("POST /resume", s.command("resume"))
+	s.mux.HandleFunc("POST /checkpoint", s.command("checkpoint", "id"))
+	s.mux.HandleFunc("POST /shutdown", s.command("shutdown"))
+	s.mux.HandleFunc("POST /command", s.handleCommand)
+	s.mux.HandleFunc("GET /events", s.handleEvents)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Listen serves the API on addr (e.g. ":8080") in the background. The
+// returned func stops it, closing open event streams.
+func (s *Server) Listen(addr string) (func() error, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	srv := &http.Server{Handler: s}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("API server stopped: %v\n", err)
+		}
+	}()
+	fmt.Printf("API listening on http://%s\n", ln.Addr())
+	return srv.Close, nil
+}
+
+// ----------- COMMANDS -----------
+
+// Handles an endpoint that runs one console command, taking its
+// arguments from the named query parameters (in order, where given)
+func (s *Server) command(name string, params ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cmd := engine.Command{Name: name, Target: r.URL.Query().Get("portfolio")}
+		if name == "checkpoint" {
+			cmd.Args = []string{"save"}
+		}
+		for _, p := range params {
+			if v := r.URL.Query().Get(p); v != "" {
+				cmd.Args = append(cmd.Args, v)
+			}
+		}
+		s.respond(w, s.console.Run(r.Context(), cmd))
+	}
+}
+
+// Runs any console command, as typed into the session
+func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Command string `json:"command"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, engine.Response{Error: "want a JSON body like {\"command\": \"status\"}"})
+		return
+	}
+	s.respond(w, s.console.Exec(r.Context(), body.Command))
+}
+
+// Snapshot is one portfolio's status, positions and open orders
+type Snapshot struct {
+	Portfolio string                  `json:"portfolio"`
+	Status    *engine.RunnerStatus    `json:"status"`
+	Positions []engine.PositionRecord `json:"positions"`
+	Orders    []t.Order               `json:"orders"`
+}
+
+func (s *Server) handlePortfolio(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	snapshot := Snapshot{Portfolio: name}
+	for _, cmd := range []string{"status", "positions", "orders"} {
+		resp := s.console.Run(r.Context(), engine.Command{Name: cmd, Target: name})
+		if resp.Error != "" || len(resp.Results) == 0 || resp.Results[0].Error != "" {
+			s.respond(w, resp)
+			return
+		}
+		res := resp.Results[0]
+		switch cmd {
+		case "status":
+			snapshot.Status = res.Status
+		case "positions":
+			snapshot.Positions = nonNil(res.Positions)
+		case "orders":
+			snapshot.Orders = nonNil(res.Orders)
+		}
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// Writes a console response with a status code for how it went
+func (s *Server) respond(w http.ResponseWriter, resp engine.Response) {
+	code := http.StatusOK
+	switch {
+	case strings.HasPrefix(resp.Error, "no portfolio"):
+		code = http.StatusNotFound
+	case resp.Error != "":
+		code = http.StatusBadRequest
+	case len(resp.Results) > 0 && allFailed(resp.Results):
+		code = http.StatusConflict
+	}
+	writeJSON(w, code, resp)
+}
+
+func allFailed(results []engine.Result) bool {
+	for _, res := range results {
+		if res.Error == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func nonNil[T any](xs []T) []T {
+	if xs == nil {
+		return []T{}
+	}
+	return xs
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("Failed to write API response: %v\n", err)
+	}
+}
+
+// ----------- EVENTS -----------
+
+// Streams events as they happen, optionally only those of ?type= (comma
+// separated) for ?portfolio=
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	portfolio := r.URL.Query().Get("portfolio")
+	var types []string
+	if v := r.URL.Query().Get("type"); v != "" {
+		types = strings.Split(v, ",")
+	}
+
+	events, stop := s.events.Subscribe(eventBuffer)
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-events:
+			if portfolio != "" && e.Portfolio != portfolio || len(types) > 0 && !slices.Contains(types, e.Type) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/engine"
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	"github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+var testAsset = types.NewAsset("AAPL", "IEX", "stock")
+
+// barProvider serves one flat bar per minute
+type barProvider struct{}
+
+func (barProvider) FetchBarAt(ctx context.Context, asset types.Asset, ts time.Time) (types.Bar, bool, error) {
+	start := ts.Truncate(time.Minute)
+	return types.Bar{
+		Asset: asset, Start: start, End: start.Add(time.Minute), Interval: time.Minute,
+		Open: 100, High: 100, Low: 100, Close: 100, Volume: 1000, Status: types.BarStatusOfficial,
+	}, true, nil
+}
+func (barProvider) IncludeAssets(ctx context.Context, assets []types.Asset) error { return nil }
+func (barProvider) Close() error                                                  { return nil }
+
+// buyOnce buys one share on its first tick
+type buyOnce struct {
+	bar    types.Bar
+	bought bool
+}
+
+func (s *buyOnce) Init() error                 { return nil }
+func (s *buyOnce) OnTick(mc *st.MarketContext) { s.bar = mc.Bars[testAsset] }
+func (s *buyOnce) TickInterval() time.Duration { return time.Minute }
+func (s *buyOnce) Name() string                { return "BuyOnce" }
+func (s *buyOnce) Assets() []types.Asset       { return []types.Asset{testAsset} }
+func (s *buyOnce) GenerateSignals() []types.Signal {
+	if s.bought {
+		return nil
+	}
+	s.bought = true
+	return []types.Signal{{Bar: s.bar, Action: types.Buy, Qty: 1}}
+}
+
+func TestServer(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	events := engine.NewEventBus()
+	trader := engine.NewTestTraderWithProvider(barProvider{}, time.Minute, start, start.Add(time.Hour))
+	runner := engine.NewRunner(engine.NewMemoryPortfolio("UnitTestAPI", 1000), trader, &buyOnce{}, make(chan types.Tick))
+	runner.Events = events
+	var wg sync.WaitGroup
+	wg.Go(func() { runner.Run(context.Background()) })
+	defer func() {
+		close(runner.Ticks)
+		wg.Wait()
+	}()
+
+	srv := httptest.NewServer(NewServer(engine.NewConsole([]*engine.Runner{runner}), events))
+	defer srv.Close()
+
+	call := func(method, path, body string, v any) int {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+
+	// Fills stream as they happen
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events?type=fill", nil)
+	require.NoError(t, err)
+	stream, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer stream.Body.Close()
+	require.Equal(t, "text/event-stream", stream.Header.Get("Content-Type"))
+	lines := bufio.NewScanner(stream.Body)
+	require.True(t, lines.Scan())
+	require.Equal(t, ": connected", lines.Text()) // subscribed before the tick
+
+	runner.Ticks <- types.NewTick(start)
+	var event engine.Event
+	for lines.Scan() {
+		if data, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+			require.NoError(t, json.Unmarshal([]byte(data), &event))
+			break
+		}
+	}
+	require.Equal(t, "fill", event.Type)
+	require.Equal(t, "UnitTestAPI", event.Portfolio)
+	require.Equal(t, 1.0, event.Fill.Qty)
+
+	var resp engine.Response
+	require.Equal(t, http.StatusOK, call("GET", "/status", "", &resp))
+	require.Len(t, resp.Results, 1)
+	require.Equal(t, 1, resp.Results[0].Status.Positions)
+
+	var snapshot Snapshot
+	require.Equal(t, http.StatusOK, call("GET", "/portfolios/UnitTestAPI", "", &snapshot))
+	require.Len(t, snapshot.Positions, 1)
+	require.Empty(t, snapshot.Orders)
+	require.Equal(t, http.StatusNotFound, call("GET", "/portfolios/nope", "", nil))
+
+	resp = engine.Response{}
+	require.Equal(t, http.StatusOK, call("POST", "/pause?portfolio=UnitTestAPI", "", &resp))
+	require.Equal(t, "paused", resp.Results[0].Message)
+	require.Equal(t, http.StatusMethodNotAllowed, call("GET", "/pause", "", nil))
+
+	resp = engine.Response{}
+	require.Equal(t, http.StatusOK, call("GET", "/executions?n=5", "", &resp))
+	require.Len(t, resp.Results[0].Executions, 1)
+
+	resp = engine.Response{}
+	require.Equal(t, http.StatusOK, call("POST", "/command", `{"command": "positions @UnitTestAPI"}`, &resp))
+	require.Equal(t, 1.0, resp.Results[0].Positions[0].Qty)
+	require.Equal(t, http.StatusBadRequest, call("POST", "/command", `{"command": "launch"}`, nil))
+
+	// Shutdown needs engine.Run to own the session
+	resp = engine.Response{}
+	require.Equal(t, http.StatusBadRequest, call("POST", "/shutdown", "", &resp))
+	require.Equal(t, "no session is running", resp.Error)
+}
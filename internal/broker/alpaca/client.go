@@ -0,0 +1,265 @@
+// internal/broker/alpaca/client.go
+package alpaca
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+const (
+	PaperBaseURL = "https://paper-api.alpaca.markets"
+	LiveBaseURL  = "https://api.alpaca.markets"
+)
+
+// Client talks to the Alpaca trading REST API (orders, positions, account).
+// The base URL is configurable so it can point at a mock broker.
+type Client struct {
+	baseURL   string
+	apiKey    string
+	apiSecret string
+	http      *http.Client
+}
+
+// NewClient builds a trading client; an empty baseURL defaults to paper trading.
+func NewClient(baseURL, apiKey, apiSecret string) *Client {
+	if baseURL == "" {
+		baseURL = PaperBaseURL
+	}
+	return &Client{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		http:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// --- API types (Alpaca sends decimals as strings) ---
+
+type OrderRequest struct {
+	Symbol        string `json:"symbol"`
+	Qty           string `json:"qty"`
+	Side          string `json:"side"`
+	Type          string `json:"type"`
+	TimeInForce   string `json:"time_in_force"`
+	LimitPrice    string `json:"limit_price,omitempty"`
+	StopPrice     string `json:"stop_price,omitempty"`
+	ClientOrderID string `json:"client_order_id,omitempty"`
+}
+
+type Order struct {
+	ID             string    `json:"id"`
+	ClientOrderID  string    `json:"client_order_id"`
+	Symbol         string    `json:"symbol"`
+	Side           string    `json:"side"`
+	Type           string    `json:"type"`
+	TimeInForce    string    `json:"time_in_force"`
+	Qty            string    `json:"qty"`
+	FilledQty      string    `json:"filled_qty"`
+	FilledAvgPrice string    `json:"filled_avg_price,omitempty"`
+	LimitPrice     string    `json:"limit_price,omitempty"`
+	StopPrice      string    `json:"stop_price,omitempty"`
+	Status         string    `json:"status"`
+	SubmittedAt    time.Time `json:"submitted_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type Position struct {
+	Symbol        string `json:"symbol"`
+	Qty           string `json:"qty"`
+	AvgEntryPrice string `json:"avg_entry_price"`
+	MarketValue   string `json:"market_value,omitempty"`
+}
+
+type Account struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	Cash        string `json:"cash"`
+	Equity      string `json:"equity,omitempty"`
+	BuyingPower string `json:"buying_power,omitempty"`
+}
+
+// APIError is a non-2xx response from the API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("alpaca: %d %s", e.StatusCode, e.Message)
+}
+
+// IsRejection reports whether err means the broker refused the request
+// (as opposed to a transport failure worth retrying).
+func IsRejection(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500
+}
+
+// --- Endpoints ---
+
+func (c *Client) SubmitOrder(ctx context.Context, req OrderRequest) (Order, error) {
+	var o Order
+	err := c.do(ctx, http.MethodPost, "/v2/orders", req, &o)
+	return o, err
+}
+
+func (c *Client) GetOrder(ctx context.Context, id string) (Order, error) {
+	var o Order
+	err := c.do(ctx, http.MethodGet, "/v2/orders/"+url.PathEscape(id), nil, &o)
+	return o, err
+}
+
+// GetOrderByClientID looks an order up by the ID we submitted it with,
+// e.g. when the submission response was lost.
+func (c *Client) GetOrderByClientID(ctx context.Context, clientID string) (Order, error) {
+	var o Order
+	err := c.do(ctx, http.MethodGet, "/v2/orders:by_client_order_id?client_order_id="+url.QueryEscape(clientID), nil, &o)
+	return o, err
+}
+
+// ListOrders lists orders by status ("open", "closed" or "all").
+func (c *Client) ListOrders(ctx context.Context, status string) ([]Order, error) {
+	var os []Order
+	err := c.do(ctx, http.MethodGet, "/v2/orders?status="+url.QueryEscape(status), nil, &os)
+	return os, err
+}
+
+// CancelOrder requests cancellation; the order's status confirms it later.
+func (c *Client) CancelOrder(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v2/orders/"+url.PathEscape(id), nil, nil)
+}
+
+func (c *Client) CancelAllOrders(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/v2/orders", nil, nil)
+}
+
+func (c *Client) ListPositions(ctx context.Context) ([]Position, error) {
+	var ps []Position
+	err := c.do(ctx, http.MethodGet, "/v2/positions", nil, &ps)
+	return ps, err
+}
+
+func (c *Client) GetAccount(ctx context.Context) (Account, error) {
+	var a Account
+	err := c.do(ctx, http.MethodGet, "/v2/account", nil, &a)
+	return a, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("APCA-API-KEY-ID", c.apiKey)
+	req.Header.Set("APCA-API-SECRET-KEY", c.apiSecret)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("alpaca %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &e) != nil || e.Message == "" {
+			e.Message = strings.TrimSpace(string(data))
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: e.Message}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// --- Conversions ---
+
+// NewOrderRequest converts an engine order into an API request.
+// The local order ID is sent as the client order ID.
+func NewOrderRequest(o t.Order) (OrderRequest, error) {
+	req := OrderRequest{
+		Symbol:        o.Asset.Symbol,
+		Qty:           FormatDecimal(o.Qty),
+		ClientOrderID: o.ID,
+	}
+	switch o.Action {
+	case t.Buy:
+		req.Side = "buy"
+	case t.Sell:
+		req.Side = "sell"
+	default:
+		return req, fmt.Errorf("alpaca: unsupported action %s", o.Action)
+	}
+	switch o.Type {
+	case t.MarketOrder:
+		req.Type = "market"
+	case t.LimitOrder:
+		req.Type = "limit"
+		req.LimitPrice = FormatDecimal(o.LimitPrice)
+	case t.StopOrder:
+		req.Type = "stop"
+		req.StopPrice = FormatDecimal(o.StopPrice)
+	case t.StopLimitOrder:
+		req.Type = "stop_limit"
+		req.LimitPrice = FormatDecimal(o.LimitPrice)
+		req.StopPrice = FormatDecimal(o.StopPrice)
+	}
+	req.TimeInForce = strings.ToLower(o.TIF.String())
+	return req, nil
+}
+
+// OrderStatus maps Alpaca's order statuses onto the engine's lifecycle.
+func OrderStatus(s string) t.OrderStatus {
+	switch s {
+	case "partially_filled":
+		return t.OrderPartiallyFilled
+	case "filled":
+		return t.OrderFilled
+	case "canceled", "expired", "done_for_day", "replaced":
+		return t.OrderCancelled
+	case "rejected", "suspended", "stopped":
+		return t.OrderRejected
+	default: // new, accepted, pending_new, pending_cancel, ...
+		return t.OrderNew
+	}
+}
+
+func FormatDecimal(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// ParseDecimal reads an API decimal string, treating empty as zero.
+func ParseDecimal(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,74 @@
+package alpaca
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_OrderLifecycleAgainstMock(t *testing.T) {
+	mock := NewMockBroker(10000)
+	defer mock.Close()
+	mock.SetPrice("AAPL", 100)
+	mock.SetBehaviour("AAPL", MockPartialFill)
+	cl := mock.Client()
+	ctx := context.Background()
+
+	o, err := cl.SubmitOrder(ctx, OrderRequest{Symbol: "AAPL", Qty: "10", Side: "buy", Type: "market", TimeInForce: "day", ClientOrderID: "ord-000001"})
+	require.NoError(t, err)
+	require.Equal(t, "new", o.Status)
+
+	o, err = cl.GetOrder(ctx, o.ID)
+	require.NoError(t, err)
+	require.Equal(t, "partially_filled", o.Status)
+	require.Equal(t, "5", o.FilledQty)
+
+	byClient, err := cl.GetOrderByClientID(ctx, "ord-000001")
+	require.NoError(t, err)
+	require.Equal(t, o.ID, byClient.ID)
+
+	o, err = cl.GetOrder(ctx, o.ID)
+	require.NoError(t, err)
+	require.Equal(t, "filled", o.Status)
+	require.Equal(t, "100", o.FilledAvgPrice)
+	require.Error(t, cl.CancelOrder(ctx, o.ID), "filled orders can't be cancelled")
+
+	positions, err := cl.ListPositions(ctx)
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	require.Equal(t, "10", positions[0].Qty)
+	account, err := cl.GetAccount(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "9000", account.Cash)
+}
+
+func TestClient_RejectionsAndAuth(t *testing.T) {
+	mock := NewMockBroker(10000)
+	defer mock.Close()
+	mock.SetBehaviour("TSLA", MockReject)
+	ctx := context.Background()
+
+	_, err := mock.Client().SubmitOrder(ctx, OrderRequest{Symbol: "TSLA", Qty: "1", Side: "buy", Type: "market", TimeInForce: "day"})
+	require.Error(t, err)
+	require.True(t, IsRejection(err))
+	require.Contains(t, err.Error(), "insufficient buying power")
+
+	_, err = NewClient(mock.Server.URL, "wrong", "key").GetAccount(ctx)
+	require.Error(t, err)
+	require.True(t, IsRejection(err))
+}
+
+func TestOrderStatus(t *testing.T) {
+	cases := map[string]string{
+		"new":              "NEW",
+		"pending_cancel":   "NEW",
+		"partially_filled": "PARTIALLY_FILLED",
+		"filled":           "FILLED",
+		"expired":          "CANCELLED",
+		"rejected":         "REJECTED",
+	}
+	for in, want := range cases {
+		require.Equal(t, want, OrderStatus(in).String(), in)
+	}
+}
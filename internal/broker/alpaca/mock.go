@@ -0,0 +1,310 @@
+// internal/broker/alpaca/mock.go
+package alpaca
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// MockBehaviour scripts how the mock broker treats orders for a symbol
+type MockBehaviour int
+
+const (
+	MockFill        MockBehaviour = iota // accepted, filled in full on the next status poll
+	MockPartialFill                      // accepted, half the quantity fills on each poll
+	MockRest                             // accepted, never fills (until cancelled)
+	MockReject                           // refused at submission
+)
+
+// MockBroker is an in-process stand-in for the Alpaca trading API, serving the
+// order, position and account endpoints over httptest. Orders progress when
+// their status is polled, according to the symbol's behaviour.
+type MockBroker struct {
+	Server *httptest.Server
+	Key    string
+	Secret string
+
+	mu         sync.Mutex
+	behaviours map[string]MockBehaviour
+	prices     map[string]float64
+	orders     map[string]*Order
+	ids        []string // submission order
+	positions  map[string]*Position
+	cash       float64
+	seq        int
+}
+
+func NewMockBroker(cash float64) *MockBroker {
+	m := &MockBroker{
+		Key:        "mock-key",
+		Secret:     "mock-secret",
+		behaviours: make(map[string]MockBehaviour),
+		prices:     make(map[string]float64),
+		orders:     make(map[string]*Order),
+		positions:  make(map[string]*Position),
+		cash:       cash,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v2/orders", m.handleSubmit)
+	mux.HandleFunc("GET /v2/orders", m.handleList)
+	mux.HandleFunc("GET /v2/orders/{id}", m.handleGet)
+	mux.HandleFunc("GET /v2/orders:by_client_order_id", m.handleGetByClientID)
+	mux.HandleFunc("DELETE /v2/orders/{id}", m.handleCancel)
+	mux.HandleFunc("DELETE /v2/orders", m.handleCancelAll)
+	mux.HandleFunc("GET /v2/positions", m.handlePositions)
+	mux.HandleFunc("GET /v2/account", m.handleAccount)
+	m.Server = httptest.NewServer(m.auth(mux))
+	return m
+}
+
+// Client returns a trading client pointed at the mock.
+func (m *MockBroker) Client() *Client {
+	return NewClient(m.Server.URL, m.Key, m.Secret)
+}
+
+func (m *MockBroker) Close() { m.Server.Close() }
+
+func (m *MockBroker) SetBehaviour(symbol string, b MockBehaviour) {
+	m.mu.Lock()
+	m.behaviours[symbol] = b
+	m.mu.Unlock()
+}
+
+// SetPrice sets the price orders for symbol fill at.
+func (m *MockBroker) SetPrice(symbol string, price float64) {
+	m.mu.Lock()
+	m.prices[symbol] = price
+	m.mu.Unlock()
+}
+
+// SetPosition overwrites the account's position in symbol.
+func (m *MockBroker) SetPosition(symbol string, qty, avgPrice float64) {
+	m.mu.Lock()
+	m.positions[symbol] = &Position{Symbol: symbol, Qty: FormatDecimal(qty), AvgEntryPrice: FormatDecimal(avgPrice)}
+	m.mu.Unlock()
+}
+
+// Order returns a copy of the order with the given broker ID, without advancing it.
+func (m *MockBroker) Order(id string) (Order, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.orders[id]
+	if !ok {
+		return Order{}, false
+	}
+	return *o, true
+}
+
+// --- Handlers ---
+
+func (m *MockBroker) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("APCA-API-KEY-ID") != m.Key || r.Header.Get("APCA-API-SECRET-KEY") != m.Secret {
+			writeError(w, http.StatusUnauthorized, "request is not authorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (m *MockBroker) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req OrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order: "+err.Error())
+		return
+	}
+	qty, err := ParseDecimal(req.Qty)
+	if err != nil || qty <= 0 {
+		writeError(w, http.StatusUnprocessableEntity, "qty must be > 0")
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.behaviours[req.Symbol] == MockReject {
+		writeError(w, http.StatusForbidden, "insufficient buying power")
+		return
+	}
+	m.seq++
+	now := time.Now().UTC()
+	o := &Order{
+		ID:            fmt.Sprintf("mock-%04d", m.seq),
+		ClientOrderID: req.ClientOrderID,
+		Symbol:        req.Symbol,
+		Side:          req.Side,
+		Type:          req.Type,
+		TimeInForce:   req.TimeInForce,
+		Qty:           req.Qty,
+		FilledQty:     "0",
+		LimitPrice:    req.LimitPrice,
+		StopPrice:     req.StopPrice,
+		Status:        "new",
+		SubmittedAt:   now,
+		UpdatedAt:     now,
+	}
+	m.orders[o.ID] = o
+	m.ids = append(m.ids, o.ID)
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (m *MockBroker) handleGet(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.orders[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "order not found")
+		return
+	}
+	m.advance(o)
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (m *MockBroker) handleGetByClientID(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := r.URL.Query().Get("client_order_id")
+	for _, o := range m.orders {
+		if o.ClientOrderID == id && id != "" {
+			writeJSON(w, http.StatusOK, o)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "order not found")
+}
+
+func (m *MockBroker) handleList(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := r.URL.Query().Get("status")
+	out := []Order{}
+	for _, id := range m.ids {
+		o := m.orders[id]
+		open := OrderStatus(o.Status).IsOpen()
+		if status == "all" || status == "closed" && !open || (status == "" || status == "open") && open {
+			out = append(out, *o)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (m *MockBroker) handleCancel(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.orders[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "order not found")
+		return
+	}
+	if !OrderStatus(o.Status).IsOpen() {
+		writeError(w, http.StatusUnprocessableEntity, "order is not cancelable")
+		return
+	}
+	o.Status = "canceled"
+	o.UpdatedAt = time.Now().UTC()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *MockBroker) handleCancelAll(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range m.orders {
+		if OrderStatus(o.Status).IsOpen() {
+			o.Status = "canceled"
+			o.UpdatedAt = time.Now().UTC()
+		}
+	}
+	w.WriteHeader(http.StatusMultiStatus)
+}
+
+func (m *MockBroker) handlePositions(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []Position{}
+	for _, p := range m.positions {
+		if qty, _ := ParseDecimal(p.Qty); qty != 0 {
+			out = append(out, *p)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (m *MockBroker) handleAccount(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writeJSON(w, http.StatusOK, Account{ID: "mock-account", Status: "ACTIVE", Cash: FormatDecimal(m.cash)})
+}
+
+// advance moves an open order along according to its symbol's behaviour.
+// Caller holds mu.
+func (m *MockBroker) advance(o *Order) {
+	if !OrderStatus(o.Status).IsOpen() {
+		return
+	}
+	price := m.prices[o.Symbol]
+	if limit, _ := ParseDecimal(o.LimitPrice); limit > 0 {
+		if price == 0 {
+			price = limit
+		}
+		if o.Side == "buy" && price > limit || o.Side == "sell" && price < limit {
+			return // not marketable yet
+		}
+	}
+	if price <= 0 {
+		return
+	}
+
+	qty, _ := ParseDecimal(o.Qty)
+	filled, _ := ParseDecimal(o.FilledQty)
+	var fill float64
+	switch m.behaviours[o.Symbol] {
+	case MockFill:
+		fill = qty - filled
+	case MockPartialFill:
+		fill = math.Min(math.Ceil(qty/2), qty-filled)
+	default:
+		return
+	}
+
+	avg, _ := ParseDecimal(o.FilledAvgPrice)
+	total := filled + fill
+	o.FilledAvgPrice = FormatDecimal((avg*filled + price*fill) / total)
+	o.FilledQty = FormatDecimal(total)
+	o.Status = "partially_filled"
+	if total >= qty {
+		o.Status = "filled"
+	}
+	o.UpdatedAt = time.Now().UTC()
+
+	// Book the fill against the account
+	pos, ok := m.positions[o.Symbol]
+	if !ok {
+		pos = &Position{Symbol: o.Symbol, Qty: "0", AvgEntryPrice: "0"}
+		m.positions[o.Symbol] = pos
+	}
+	held, _ := ParseDecimal(pos.Qty)
+	entry, _ := ParseDecimal(pos.AvgEntryPrice)
+	if o.Side == "buy" {
+		m.cash -= fill * price
+		pos.AvgEntryPrice = FormatDecimal((entry*held + price*fill) / (held + fill))
+		held += fill
+	} else {
+		m.cash += fill * price
+		held -= fill
+	}
+	pos.Qty = FormatDecimal(held)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]any{"code": status * 10000, "message": msg})
+}
@@ -0,0 +1,214 @@
+// Package calendar knows when exchanges trade: per-date sessions with their
+// holidays, early closes and optional pre & post-market windows.
+package calendar
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Date is a calendar day at the exchange, whatever its time zone
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// DateOf is the day ts falls on in loc
+func DateOf(ts time.Time, loc *time.Location) Date {
+	y, m, d := ts.In(loc).Date()
+	return Date{y, m, d}
+}
+
+// At is the instant (UTC) tod falls at on the day in loc, daylight saving included
+func (d Date) At(tod TimeOfDay, loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, tod.Hour, tod.Minute, 0, 0, loc).UTC()
+}
+
+func (d Date) AddDays(n int) Date {
+	y, m, day := time.Date(d.Year, d.Month, d.Day+n, 0, 0, 0, 0, time.UTC).Date()
+	return Date{y, m, day}
+}
+
+func (d Date) Weekday() time.Weekday {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, time.UTC).Weekday()
+}
+
+func (d Date) Before(o Date) bool {
+	if d.Year != o.Year {
+		return d.Year < o.Year
+	}
+	if d.Month != o.Month {
+		return d.Month < o.Month
+	}
+	return d.Day < o.Day
+}
+
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// TimeOfDay is a wall clock time at the exchange
+type TimeOfDay struct {
+	Hour   int
+	Minute int
+}
+
+func (t TimeOfDay) minutes() int { return t.Hour*60 + t.Minute }
+
+// Session is a day's trading, in UTC
+type Session struct {
+	Date       Date
+	Open       time.Time // regular session
+	Close      time.Time
+	PreOpen    time.Time // pre-market opens (zero unless extended hours are traded)
+	PostClose  time.Time // post-market closes (zero unless extended hours are traded)
+	EarlyClose bool
+}
+
+// Start is when trading opens: the pre-market if it's traded
+func (s Session) Start() time.Time {
+	if !s.PreOpen.IsZero() {
+		return s.PreOpen
+	}
+	return s.Open
+}
+
+// End is when trading closes: the post-market if it's traded
+func (s Session) End() time.Time {
+	if !s.PostClose.IsZero() {
+		return s.PostClose
+	}
+	return s.Close
+}
+
+// Contains reports whether ts is within the session, its close included
+func (s Session) Contains(ts time.Time) bool {
+	return !ts.Before(s.Start()) && !ts.After(s.End())
+}
+
+// Calendar is an exchange's trading days & hours. Open & Close may be set
+// apart from the exchange's regular hours; its early closes still cut a
+// session short. Safe for concurrent use.
+type Calendar struct {
+	Location    *time.Location
+	Open        TimeOfDay
+	Close       TimeOfDay
+	WeekendsOff bool
+	Exchange    *Exchange // holidays, early closes & extended hours (nil => none)
+	Extended    bool      // also trade the exchange's pre & post-market sessions
+
+	mu    sync.Mutex
+	years map[int]year
+}
+
+// Holidays & early closes of a year, worked out once from the exchange's rules
+type year struct {
+	holidays    map[Date]string
+	earlyCloses map[Date]string
+}
+
+// The furthest NextOpen looks ahead for a session
+const maxClosedDays = 366
+
+// Regular is the exchange's regular trading hours, weekends & holidays off
+func Regular(ex *Exchange) (*Calendar, error) {
+	loc, err := time.LoadLocation(ex.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timezone: %w", err)
+	}
+	return &Calendar{Location: loc, Open: ex.Open, Close: ex.Close, WeekendsOff: true, Exchange: ex}, nil
+}
+
+// Holiday returns why the exchange is closed on d, if it's a holiday
+func (c *Calendar) Holiday(d Date) (string, bool) {
+	if c.Exchange == nil {
+		return "", false
+	}
+	name, ok := c.year(d.Year).holidays[d]
+	return name, ok
+}
+
+// SessionOn is the session on day d, false if the market doesn't open
+func (c *Calendar) SessionOn(d Date) (Session, bool) {
+	if c.WeekendsOff && (d.Weekday() == time.Saturday || d.Weekday() == time.Sunday) {
+		return Session{}, false
+	}
+	if _, ok := c.Holiday(d); ok {
+		return Session{}, false
+	}
+
+	s := Session{Date: d, Open: d.At(c.Open, c.Location), Close: d.At(c.Close, c.Location)}
+	if c.Exchange == nil {
+		return s, true
+	}
+	ex := c.Exchange
+	closeAt, postClose := c.Close, ex.PostClose
+	if _, ok := c.year(d.Year).earlyCloses[d]; ok && ex.EarlyClose.minutes() < closeAt.minutes() {
+		closeAt, postClose = ex.EarlyClose, ex.EarlyPostClose
+		s.Close, s.EarlyClose = d.At(closeAt, c.Location), true
+	}
+	if c.Extended {
+		s.PreOpen, s.PostClose = s.Open, s.Close
+		if ex.PreOpen.minutes() < c.Open.minutes() {
+			s.PreOpen = d.At(ex.PreOpen, c.Location)
+		}
+		if postClose.minutes() > closeAt.minutes() {
+			s.PostClose = d.At(postClose, c.Location)
+		}
+	}
+	return s, true
+}
+
+// SessionAt is the session on the day ts falls on at the exchange, whether
+// or not ts is within it
+func (c *Calendar) SessionAt(ts time.Time) (Session, bool) {
+	return c.SessionOn(DateOf(ts, c.Location))
+}
+
+// IsOpenAt reports whether the market trades at ts
+func (c *Calendar) IsOpenAt(ts time.Time) bool {
+	s, ok := c.SessionAt(ts)
+	return ok && s.Contains(ts)
+}
+
+// NextOpen is when the first session starting at or after ts opens (zero if
+// none does within a year)
+func (c *Calendar) NextOpen(ts time.Time) time.Time {
+	d := DateOf(ts, c.Location)
+	for range maxClosedDays {
+		if s, ok := c.SessionOn(d); ok && !s.Start().Before(ts) {
+			return s.Start()
+		}
+		d = d.AddDays(1)
+	}
+	return time.Time{}
+}
+
+// SessionsBetween is every session trading within [start, end), in order
+func (c *Calendar) SessionsBetween(start, end time.Time) []Session {
+	var sessions []Session
+	last := DateOf(end, c.Location)
+	for d := DateOf(start, c.Location); !last.Before(d); d = d.AddDays(1) {
+		s, ok := c.SessionOn(d)
+		if ok && s.End().Compare(start) >= 0 && s.Start().Before(end) {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions
+}
+
+func (c *Calendar) year(y int) year {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if yr, ok := c.years[y]; ok {
+		return yr
+	}
+	if c.years == nil {
+		c.years = make(map[int]year)
+	}
+	yr := year{holidays: c.Exchange.Holidays(y), earlyCloses: c.Exchange.EarlyCloses(y)}
+	c.years[y] = yr
+	return yr
+}
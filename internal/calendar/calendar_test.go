@@ -0,0 +1,130 @@
+package calendar
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sortedDates(m map[Date]string) []string {
+	out := make([]string, 0, len(m))
+	for d := range m {
+		out = append(out, d.String())
+	}
+	sort.Strings(out)
+	return out
+}
+
+// As published by the NYSE
+func TestUSEquities_HolidaysAndEarlyCloses(t *testing.T) {
+	cases := []struct {
+		year        int
+		holidays    []string
+		earlyCloses []string
+	}{
+		{2022,
+			[]string{"2022-01-17", "2022-02-21", "2022-04-15", "2022-05-30", "2022-06-20", "2022-07-04", "2022-09-05", "2022-11-24", "2022-12-26"},
+			[]string{"2022-11-25"}},
+		{2024,
+			[]string{"2024-01-01", "2024-01-15", "2024-02-19", "2024-03-29", "2024-05-27", "2024-06-19", "2024-07-04", "2024-09-02", "2024-11-28", "2024-12-25"},
+			[]string{"2024-07-03", "2024-11-29", "2024-12-24"}},
+		{2025,
+			[]string{"2025-01-01", "2025-01-09", "2025-01-20", "2025-02-17", "2025-04-18", "2025-05-26", "2025-06-19", "2025-07-04", "2025-09-01", "2025-11-27", "2025-12-25"},
+			[]string{"2025-07-03", "2025-11-28", "2025-12-24"}},
+		{2026,
+			[]string{"2026-01-01", "2026-01-19", "2026-02-16", "2026-04-03", "2026-05-25", "2026-06-19", "2026-07-03", "2026-09-07", "2026-11-26", "2026-12-25"},
+			[]string{"2026-11-27", "2026-12-24"}},
+		{2027,
+			[]string{"2027-01-01", "2027-01-18", "2027-02-15", "2027-03-26", "2027-05-31", "2027-06-18", "2027-07-05", "2027-09-06", "2027-11-25", "2027-12-24"},
+			[]string{"2027-11-26"}},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.holidays, sortedDates(NYSE.Holidays(c.year)), "%d holidays", c.year)
+		require.Equal(t, c.earlyCloses, sortedDates(NYSE.EarlyCloses(c.year)), "%d early closes", c.year)
+	}
+}
+
+func TestCalendar_Sessions(t *testing.T) {
+	cal, err := Regular(NYSE)
+	require.NoError(t, err)
+
+	// Daylight saving: 9:30 New York is 14:30 UTC in winter, 13:30 in summer
+	s, ok := cal.SessionOn(Date{2024, time.January, 2})
+	require.True(t, ok)
+	require.Equal(t, time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC), s.Open)
+	require.Equal(t, time.Date(2024, 1, 2, 21, 0, 0, 0, time.UTC), s.Close)
+	s, ok = cal.SessionOn(Date{2024, time.March, 11})
+	require.True(t, ok)
+	require.Equal(t, time.Date(2024, 3, 11, 13, 30, 0, 0, time.UTC), s.Open)
+
+	// Half day
+	s, ok = cal.SessionOn(Date{2024, time.November, 29})
+	require.True(t, ok)
+	require.True(t, s.EarlyClose)
+	require.Equal(t, time.Date(2024, 11, 29, 18, 0, 0, 0, time.UTC), s.Close)
+
+	// Holidays & weekends
+	_, ok = cal.SessionOn(Date{2024, time.November, 28})
+	require.False(t, ok)
+	name, ok := cal.Holiday(Date{2024, time.November, 28})
+	require.True(t, ok)
+	require.Equal(t, "Thanksgiving Day", name)
+	_, ok = cal.SessionOn(Date{2024, time.November, 30})
+	require.False(t, ok)
+
+	require.True(t, cal.IsOpenAt(time.Date(2024, 11, 29, 18, 0, 0, 0, time.UTC)))
+	require.False(t, cal.IsOpenAt(time.Date(2024, 11, 29, 18, 1, 0, 0, time.UTC)))
+	require.False(t, cal.IsOpenAt(time.Date(2024, 11, 28, 15, 0, 0, 0, time.UTC)))
+
+	// Wednesday's close => Friday's open, past Thanksgiving
+	require.Equal(t, time.Date(2024, 11, 29, 14, 30, 0, 0, time.UTC), cal.NextOpen(time.Date(2024, 11, 27, 21, 0, 0, 0, time.UTC)))
+	require.Equal(t, time.Date(2024, 11, 27, 14, 30, 0, 0, time.UTC), cal.NextOpen(time.Date(2024, 11, 27, 14, 30, 0, 0, time.UTC)))
+
+	var days []string
+	for _, s := range cal.SessionsBetween(time.Date(2024, 12, 20, 21, 0, 0, 0, time.UTC), time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)) {
+		days = append(days, s.Date.String())
+	}
+	require.Equal(t, []string{"2024-12-20", "2024-12-23", "2024-12-24", "2024-12-26", "2024-12-27", "2024-12-30", "2024-12-31", "2025-01-02"}, days)
+}
+
+func TestCalendar_ExtendedHours(t *testing.T) {
+	cal, err := Regular(NASDAQ)
+	require.NoError(t, err)
+	cal.Extended = true
+
+	s, ok := cal.SessionOn(Date{2024, time.July, 2})
+	require.True(t, ok)
+	require.Equal(t, time.Date(2024, 7, 2, 8, 0, 0, 0, time.UTC), s.Start())
+	require.Equal(t, time.Date(2024, 7, 2, 13, 30, 0, 0, time.UTC), s.Open)
+	require.Equal(t, time.Date(2024, 7, 3, 0, 0, 0, 0, time.UTC), s.End())
+	require.True(t, cal.IsOpenAt(time.Date(2024, 7, 2, 22, 0, 0, 0, time.UTC)))
+
+	// Half day: the post-market closes early too
+	s, ok = cal.SessionOn(Date{2024, time.July, 3})
+	require.True(t, ok)
+	require.Equal(t, time.Date(2024, 7, 3, 17, 0, 0, 0, time.UTC), s.Close)
+	require.Equal(t, time.Date(2024, 7, 3, 21, 0, 0, 0, time.UTC), s.End())
+}
+
+func TestCalendar_CustomHoursKeepHolidays(t *testing.T) {
+	loc, err := time.LoadLocation("UTC")
+	require.NoError(t, err)
+	cal := &Calendar{Location: loc, Close: TimeOfDay{23, 59}, Exchange: NYSE}
+
+	_, ok := cal.SessionOn(Date{2024, time.December, 25})
+	require.False(t, ok)
+	s, ok := cal.SessionOn(Date{2024, time.December, 28}) // weekends on
+	require.True(t, ok)
+	require.False(t, s.EarlyClose)
+	s, ok = cal.SessionOn(Date{2024, time.December, 24})
+	require.True(t, ok)
+	require.Equal(t, time.Date(2024, 12, 24, 13, 0, 0, 0, time.UTC), s.Close)
+
+	_, err = LookupExchange("LSE")
+	require.ErrorContains(t, err, "want NASDAQ or NYSE")
+	ex, err := LookupExchange("nasdaq")
+	require.NoError(t, err)
+	require.Same(t, NASDAQ, ex)
+}
@@ -0,0 +1,161 @@
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Exchange is what a calendar needs to know about an exchange: its regular
+// & extended hours, and the rules for its holidays & early closes
+type Exchange struct {
+	Name           string
+	TimeZone       string
+	Open           TimeOfDay
+	Close          TimeOfDay
+	EarlyClose     TimeOfDay // close on half days
+	PreOpen        TimeOfDay // pre-market opens
+	PostClose      TimeOfDay // post-market closes
+	EarlyPostClose TimeOfDay // post-market closes on half days
+
+	Holidays    func(year int) map[Date]string // closed all day, by reason
+	EarlyCloses func(year int) map[Date]string // closes at EarlyClose, by reason
+}
+
+// NYSE & NASDAQ keep the same holidays, half days & hours
+var (
+	NYSE   = usEquities("NYSE")
+	NASDAQ = usEquities("NASDAQ")
+)
+
+var exchanges = map[string]*Exchange{"NYSE": NYSE, "NASDAQ": NASDAQ}
+
+// LookupExchange finds an exchange by name, e.g. "NYSE"
+func LookupExchange(name string) (*Exchange, error) {
+	if ex, ok := exchanges[strings.ToUpper(name)]; ok {
+		return ex, nil
+	}
+	names := make([]string, 0, len(exchanges))
+	for n := range exchanges {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown exchange calendar %q (want %s)", name, strings.Join(names, " or "))
+}
+
+func usEquities(name string) *Exchange {
+	return &Exchange{
+		Name:           name,
+		TimeZone:       "America/New_York",
+		Open:           TimeOfDay{9, 30},
+		Close:          TimeOfDay{16, 0},
+		EarlyClose:     TimeOfDay{13, 0},
+		PreOpen:        TimeOfDay{4, 0},
+		PostClose:      TimeOfDay{20, 0},
+		EarlyPostClose: TimeOfDay{17, 0},
+		Holidays:       usEquityHolidays,
+		EarlyCloses:    usEquityEarlyCloses,
+	}
+}
+
+// Unscheduled closures: national days of mourning, disasters
+var usEquityClosures = map[Date]string{
+	{2001, time.September, 11}: "September 11 attacks",
+	{2001, time.September, 12}: "September 11 attacks",
+	{2001, time.September, 13}: "September 11 attacks",
+	{2001, time.September, 14}: "September 11 attacks",
+	{2004, time.June, 11}:      "Day of mourning for Ronald Reagan",
+	{2007, time.January, 2}:    "Day of mourning for Gerald Ford",
+	{2012, time.October, 29}:   "Hurricane Sandy",
+	{2012, time.October, 30}:   "Hurricane Sandy",
+	{2018, time.December, 5}:   "Day of mourning for George H. W. Bush",
+	{2025, time.January, 9}:    "Day of mourning for Jimmy Carter",
+}
+
+func usEquityHolidays(year int) map[Date]string {
+	h := map[Date]string{}
+	// A New Year's Day on a Saturday isn't made up on the Friday: that would close the old year
+	if d := (Date{year, time.January, 1}); d.Weekday() != time.Saturday {
+		h[observed(d)] = "New Year's Day"
+	}
+	if year >= 1998 {
+		h[nthWeekday(year, time.January, time.Monday, 3)] = "Martin Luther King Jr. Day"
+	}
+	h[nthWeekday(year, time.February, time.Monday, 3)] = "Washington's Birthday"
+	h[easter(year).AddDays(-2)] = "Good Friday"
+	h[lastWeekday(year, time.May, time.Monday)] = "Memorial Day"
+	if year >= 2022 {
+		h[observed(Date{year, time.June, 19})] = "Juneteenth"
+	}
+	h[observed(Date{year, time.July, 4})] = "Independence Day"
+	h[nthWeekday(year, time.September, time.Monday, 1)] = "Labor Day"
+	h[nthWeekday(year, time.November, time.Thursday, 4)] = "Thanksgiving Day"
+	h[observed(Date{year, time.December, 25})] = "Christmas Day"
+	for d, reason := range usEquityClosures {
+		if d.Year == year {
+			h[d] = reason
+		}
+	}
+	return h
+}
+
+func usEquityEarlyCloses(year int) map[Date]string {
+	e := map[Date]string{}
+	// Eves falling on a Friday are holidays themselves (the holiday is on a Saturday)
+	if d := (Date{year, time.July, 3}); isMonToThu(d) {
+		e[d] = "Independence Day eve"
+	}
+	e[nthWeekday(year, time.November, time.Thursday, 4).AddDays(1)] = "Day after Thanksgiving"
+	if d := (Date{year, time.December, 24}); isMonToThu(d) {
+		e[d] = "Christmas Eve"
+	}
+	return e
+}
+
+// ----------- DATE RULES -----------
+
+// Holidays on a Saturday are observed the Friday before, on a Sunday the Monday after
+func observed(d Date) Date {
+	switch d.Weekday() {
+	case time.Saturday:
+		return d.AddDays(-1)
+	case time.Sunday:
+		return d.AddDays(1)
+	}
+	return d
+}
+
+func isMonToThu(d Date) bool {
+	return d.Weekday() >= time.Monday && d.Weekday() <= time.Thursday
+}
+
+// The nth (from 1) weekday of the month
+func nthWeekday(year int, month time.Month, wd time.Weekday, n int) Date {
+	first := Date{year, month, 1}
+	offset := (int(wd) - int(first.Weekday()) + 7) % 7
+	return first.AddDays(offset + 7*(n-1))
+}
+
+// The last weekday of the month
+func lastWeekday(year int, month time.Month, wd time.Weekday) Date {
+	last := Date{year, month + 1, 1}.AddDays(-1)
+	offset := (int(last.Weekday()) - int(wd) + 7) % 7
+	return last.AddDays(-offset)
+}
+
+// Easter Sunday (Gregorian), by the anonymous algorithm
+func easter(year int) Date {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return Date{year, time.Month(month), day}
+}
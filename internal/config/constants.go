@@ -9,6 +9,7 @@ const (
 	Exchange               = "IEX"
 	Feed				   = "IEX"
 	ExchangeTimeZone       = "America/New_York"
+	ExchangeCalendar       = "NYSE"
 	Currency               = "USD"
 	OpenHour               = 9
 	OpenMinute             = 30
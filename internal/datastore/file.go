@@ -3,8 +3,10 @@ package datastore
 import (
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
+	"slices"
 	"strconv"
 	"time"
 	"path/filepath"
@@ -27,6 +29,7 @@ type CSVWriter struct {
 	File    File
 	Headers []string
 	Offset  int
+	checked bool // an existing file's header has been compared with Headers
 }
 
 func NewCSVWriter(file File, headers []string) *CSVWriter {
@@ -43,6 +46,13 @@ func (w *CSVWriter) Write(data any) error {
 		return fmt.Errorf("csvwriter: expected slice, got %T", data)
 	}
 
+	if !w.checked {
+		if err := w.rotateStale(); err != nil {
+			return err
+		}
+		w.checked = true
+	}
+
 	f, err := os.OpenFile(AbsolutePath(w.Path()), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return err
@@ -67,6 +77,31 @@ func (w *CSVWriter) Write(data any) error {
 	return writer.Error()
 }
 
+// Moves an existing file with other headers (e.g. written before columns were
+// added) aside to <name>.<time>.<type>, so rows never sit under the wrong header
+func (w *CSVWriter) rotateStale() error {
+	path := AbsolutePath(w.Path())
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	header, err := csv.NewReader(f).Read()
+	f.Close()
+	if err == io.EOF || len(w.Headers) == 0 || err == nil && slices.Equal(header, w.Headers) {
+		return nil
+	}
+
+	stale := w.File.Dir + "/" + w.File.Name + "." + time.Now().UTC().Format("20060102T150405") + "." + w.File.Type
+	if err := os.Rename(path, AbsolutePath(stale)); err != nil {
+		return err
+	}
+	fmt.Printf("Moved %s to %s: its columns aren't %v\n", w.Path(), stale, w.Headers)
+	return nil
+}
+
 func extractFields(obj any) []string {
 	v := reflect.ValueOf(obj)
 	var row []string
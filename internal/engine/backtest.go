@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// RegularHours is the exchange's regular trading session, on its calendar
+func RegularHours() t.TradingHours {
+	return t.TradingHours{
+		OpenHour:    cfg.OpenHour,
+		OpenMinute:  cfg.OpenMinute,
+		CloseHour:   cfg.ClosingHour,
+		CloseMinute: cfg.ClosingMinute,
+		WeekendsOff: true,
+		ExchangeTZ:  cfg.ExchangeTimeZone,
+		Exchange:    cfg.ExchangeCalendar,
+	}
+}
+
+// Backtest runs strat against trader over [start, end) within hours and
+// returns once the ticks are exhausted or ctx is cancelled. Unlike Run it
+// reads no console input, so many can run side by side (e.g. parameter
+// sweeps); pair it with NewMemoryPortfolio to keep results off disk.
+func Backtest(ctx context.Context, p *Portfolio, strat st.Strategy, trader Trader, start, end time.Time, hours t.TradingHours) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ticks := make(chan t.Tick, 10)
+	go func() {
+		defer close(ticks)
+		t.GenerateTestTicks(runCtx, t.NewSimClock(start), ticks, start, end, strat.TickInterval(), hours)
+	}()
+
+	NewRunner(p, trader, strat, ticks).Run(runCtx)
+
+	// Runner stopped early (cancelled): let the generator see ctx and exit
+	cancel()
+	for range ticks {
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// BreakerLimits are the conditions that halt a runner; zero values disable a trigger
+type BreakerLimits struct {
+	MaxDrawdown   float64       // fraction of peak equity lost, e.g. 0.1
+	MaxRejections int           // consecutive rejected orders
+	MaxDataAge    time.Duration // since the end of the newest bar for any of the runner's assets
+	Flatten       bool          // close every position when halted
+}
+
+// IsZero reports whether no trigger is set
+func (l BreakerLimits) IsZero() bool {
+	return l.MaxDrawdown == 0 && l.MaxRejections == 0 && l.MaxDataAge == 0
+}
+
+// CircuitBreaker watches a runner's equity, order rejections and market data
+// and reports when trading should halt
+type CircuitBreaker struct {
+	Limits BreakerLimits
+
+	mu         sync.Mutex // rejections are counted from order book updates
+	rejections int
+	peak       float64
+	lastData   time.Time // end of the newest bar seen
+	lastTick   time.Time
+}
+
+func NewCircuitBreaker(limits BreakerLimits) *CircuitBreaker {
+	return &CircuitBreaker{Limits: limits}
+}
+
+// Watch counts consecutive rejections among ob's orders; any fill resets the count
+func (cb *CircuitBreaker) Watch(ob *OrderBook) {
+	ob.OnUpdate(func(o t.Order) {
+		cb.mu.Lock()
+		defer cb.mu.Unlock()
+		switch {
+		case o.Status == t.OrderRejected:
+			cb.rejections++
+		case o.FilledQty > 0:
+			cb.rejections = 0
+		}
+	})
+}
+
+// Check is called once per tick, after the portfolio is marked. It returns
+// why the runner should halt, if it should.
+func (cb *CircuitBreaker) Check(p *Portfolio, mc *st.MarketContext) (string, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	l := cb.Limits
+
+	equity := p.Equity()
+	cb.peak = max(cb.peak, equity)
+	if l.MaxDrawdown > 0 && cb.peak > 0 {
+		if dd := (cb.peak - equity) / cb.peak; dd >= l.MaxDrawdown {
+			return fmt.Sprintf("drawdown %.2f%% from peak equity %.2f (max %.2f%%)", dd*100, cb.peak, l.MaxDrawdown*100), true
+		}
+	}
+
+	if l.MaxRejections > 0 && cb.rejections >= l.MaxRejections {
+		return fmt.Sprintf("%d orders rejected in a row (max %d)", cb.rejections, l.MaxRejections), true
+	}
+
+	if l.MaxDataAge > 0 {
+		now := mc.Tick.Time
+		if now.Sub(cb.lastTick) > l.MaxDataAge {
+			// First tick, or first since the market reopened: data has until
+			// MaxDataAge from now to arrive
+			cb.lastData = now
+		}
+		cb.lastTick = now
+		for _, bar := range mc.Bars {
+			if bar.End.After(cb.lastData) {
+				cb.lastData = bar.End
+			}
+		}
+		if age := now.Sub(cb.lastData); age > l.MaxDataAge {
+			return fmt.Sprintf("market data stale: newest bar ended %s ago (max %s)", age.Round(time.Second), l.MaxDataAge), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	"github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker_Triggers(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	bar := testBar(start, 100, 100, 100, 100, 1000)
+	mc := func(ts time.Time, bars ...types.Bar) *st.MarketContext {
+		ctx := &st.MarketContext{Tick: types.NewTick(ts), Bars: make(map[types.Asset]types.Bar)}
+		for _, b := range bars {
+			ctx.Bars[b.Asset] = b
+		}
+		return ctx
+	}
+
+	t.Run("drawdown from peak", func(t *testing.T) {
+		p := NewMemoryPortfolio("UnitTestBreakerDrawdown", 1000)
+		cb := NewCircuitBreaker(BreakerLimits{MaxDrawdown: 0.1})
+		_, trip := cb.Check(p, mc(start))
+		require.False(t, trip)
+		p.Cash = 1200 // new peak
+		_, trip = cb.Check(p, mc(start))
+		require.False(t, trip)
+		p.Cash = 1081 // down 9.9%
+		_, trip = cb.Check(p, mc(start))
+		require.False(t, trip)
+		p.Cash = 1080
+		reason, trip := cb.Check(p, mc(start))
+		require.True(t, trip)
+		require.Contains(t, reason, "drawdown 10.00%")
+	})
+
+	t.Run("consecutive rejections", func(t *testing.T) {
+		tt := NewTestTraderWithProvider(newMapProvider(time.Minute, bar), time.Minute, start, start.Add(time.Hour))
+		p := NewMemoryPortfolio("UnitTestBreakerRejections", 150)
+		cb := NewCircuitBreaker(BreakerLimits{MaxRejections: 2})
+		cb.Watch(tt.Orders())
+
+		_, ok := tt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 2}) // insufficient cash
+		require.False(t, ok)
+		_, ok = tt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 1}) // a fill resets the count
+		require.True(t, ok)
+		_, ok = tt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 2})
+		require.False(t, ok)
+		_, trip := cb.Check(p, mc(start))
+		require.False(t, trip)
+
+		_, ok = tt.Execute(p, types.Signal{Bar: bar, Action: types.Sell, Qty: 5}) // no shorting
+		require.False(t, ok)
+		reason, trip := cb.Check(p, mc(start))
+		require.True(t, trip)
+		require.Contains(t, reason, "2 orders rejected in a row")
+	})
+
+	t.Run("stale data", func(t *testing.T) {
+		p := NewMemoryPortfolio("UnitTestBreakerStale", 1000)
+		cb := NewCircuitBreaker(BreakerLimits{MaxDataAge: 3 * time.Minute})
+
+		// Data has MaxDataAge from the first tick to arrive
+		_, trip := cb.Check(p, mc(start))
+		require.False(t, trip)
+		_, trip = cb.Check(p, mc(start.Add(2*time.Minute), bar)) // bar ended at start+1m
+		require.False(t, trip)
+		_, trip = cb.Check(p, mc(start.Add(4*time.Minute), bar))
+		require.False(t, trip)
+		reason, trip := cb.Check(p, mc(start.Add(5*time.Minute), bar))
+		require.True(t, trip)
+		require.Contains(t, reason, "market data stale")
+
+		// The first tick after a gap (e.g. overnight) starts the clock again
+		cb = NewCircuitBreaker(BreakerLimits{MaxDataAge: 3 * time.Minute})
+		_, trip = cb.Check(p, mc(start.Add(time.Minute), bar))
+		require.False(t, trip)
+		_, trip = cb.Check(p, mc(start.Add(18*time.Hour), bar))
+		require.False(t, trip)
+	})
+}
+
+// buyingStrategy buys one share of testAsset every tick
+type buyingStrategy struct {
+	contextStrategy
+	last types.Bar
+}
+
+func (s *buyingStrategy) OnTick(mc *st.MarketContext) {
+	s.contextStrategy.OnTick(mc)
+	s.last = mc.Bars[testAsset]
+}
+
+func (s *buyingStrategy) GenerateSignals() []types.Signal {
+	return []types.Signal{{Bar: s.last, Action: types.Buy, Qty: 1}}
+}
+
+func TestRunner_BreakerHaltsAndFlattens(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	var bars []types.Bar
+	for i, close := range []float64{100, 100, 50, 50, 50} {
+		bars = append(bars, testBar(start.Add(time.Duration(i)*time.Minute), close, close, close, close, 1000))
+	}
+	tt := NewTestTraderWithProvider(newMapProvider(time.Minute, bars...), time.Minute, start, start.Add(time.Hour))
+	p := NewMemoryPortfolio("UnitTestRunnerHalt", 1000)
+	strat := &buyingStrategy{contextStrategy: contextStrategy{assets: []types.Asset{testAsset}}}
+
+	r := NewRunner(p, tt, strat, make(chan types.Tick, len(bars)))
+	r.Breaker = NewCircuitBreaker(BreakerLimits{MaxDrawdown: 0.05, Flatten: true})
+	for _, b := range bars {
+		r.Ticks <- types.NewTick(b.Start)
+	}
+	close(r.Ticks)
+	r.Run(context.Background())
+
+	// Bought at 100 twice, then once more at 50 before the drop was marked
+	reason, halted := r.Halted()
+	require.True(t, halted)
+	require.Contains(t, reason, "drawdown")
+	require.Len(t, strat.seen, 3, "no ticks reach the strategy once halted")
+	require.Zero(t, p.Positions[testAsset])
+	require.InDelta(t, 1000-200-50+150, p.Cash, 1e-9)
+}
+
+func TestRunner_ManualHalt(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	bar := testBar(start, 100, 100, 100, 100, 1000)
+	tt := NewTestTraderWithProvider(newMapProvider(time.Minute, bar), time.Minute, start, start.Add(time.Hour))
+	p := NewMemoryPortfolio("UnitTestRunnerManualHalt", 1000)
+	strat := &buyingStrategy{contextStrategy: contextStrategy{assets: []types.Asset{testAsset}}}
+
+	r := NewRunner(p, tt, strat, make(chan types.Tick))
+	done := make(chan struct{})
+	go func() {
+		r.Run(context.Background())
+		close(done)
+	}()
+	r.Ticks <- types.NewTick(bar.End)
+	r.Halt("operator")
+	r.Halt("again") // dropped: a halt is already pending
+	r.Ticks <- types.NewTick(bar.End.Add(30 * time.Second))
+	close(r.Ticks)
+	<-done
+
+	reason, halted := r.Halted()
+	require.True(t, halted)
+	require.Equal(t, "manual: operator", reason)
+	require.Len(t, strat.seen, 1)
+	require.Equal(t, 1.0, p.Positions[testAsset], "positions are kept without Flatten")
+}
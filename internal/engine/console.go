@@ -0,0 +1,490 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// ----------- COMMANDS -----------
+
+// Command is one line typed into a running session
+type Command struct {
+	Name   string // e.g. "status"
+	Args   []string
+	Target string // portfolio picked with @name, "" => every runner
+}
+
+type commandSpec struct {
+	name     string
+	args     string
+	min, max int // argument counts, max < 0 => any number
+	help     string
+}
+
+var commandSpecs = []commandSpec{
+	{"status", "", 0, 0, "equity, cash and trading state of each portfolio"},
+	{"positions", "", 0, 0, "positions valued at the latest marks"},
+	{"orders", "", 0, 0, "open orders"},
+	{"executions", "[n]", 0, 1, "the latest n fills (default 10)"},
+	{"bars", "", 0, 0, "the latest bar for each asset followed"},
+	{"pause", "", 0, 0, "stop trading until resumed; the market is still followed"},
+	{"resume", "", 0, 0, "trade again after a pause"},
+	{"flatten", "<symbol>", 1, 1, "cancel orders in symbol and close its position at market"},
+	{"set", "<param> <value>", 2, 2, "change a strategy parameter, keeping the strategy's state"},
+	{"checkpoint", "save [id]", 1, 2, "save the strategy's state (default: the session's checkpoint)"},
+	{"subscribe", "<symbol>", 1, 1, "follow symbol's market data"},
+	{"halt", "[reason]", 0, -1, "stop trading for the rest of the session, as the circuit breaker would"},
+	{"help", "", 0, 0, "list commands"},
+	{"shutdown", "", 0, 0, "end the session"},
+}
+
+func (s commandSpec) usage() string {
+	return strings.TrimSpace(s.name + " " + s.args)
+}
+
+// ParseCommand splits a line into a command, its arguments and any
+// @portfolio target. Older --flag spellings (e.g. --shutdown) still work.
+func ParseCommand(line string) (Command, error) {
+	var cmd Command
+	for _, field := range strings.Fields(line) {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			if cmd.Target != "" {
+				return cmd, errors.New("only one @portfolio may be given")
+			}
+			if cmd.Target = field[1:]; cmd.Target == "" {
+				return cmd, errors.New("@ needs a portfolio name")
+			}
+		case cmd.Name == "":
+			cmd.Name = strings.ToLower(strings.TrimPrefix(field, "--"))
+		default:
+			cmd.Args = append(cmd.Args, field)
+		}
+	}
+	if cmd.Name == "" {
+		return cmd, errors.New("no command given (try help)")
+	}
+
+	i := slices.IndexFunc(commandSpecs, func(s commandSpec) bool { return s.name == cmd.Name })
+	if i < 0 {
+		return cmd, fmt.Errorf("unknown command %q (try help)", cmd.Name)
+	}
+	spec := commandSpecs[i]
+	if len(cmd.Args) < spec.min || spec.max >= 0 && len(cmd.Args) > spec.max ||
+		cmd.Name == "checkpoint" && cmd.Args[0] != "save" {
+		return cmd, fmt.Errorf("usage: %s", spec.usage())
+	}
+	return cmd, nil
+}
+
+// CommandHelp lists the console's commands
+func CommandHelp() string {
+	var b strings.Builder
+	b.WriteString("Commands (add @portfolio to pick one portfolio):\n")
+	for _, s := range commandSpecs {
+		fmt.Fprintf(&b, "  %-26s %s\n", s.usage(), s.help)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// ----------- RESPONSES -----------
+
+// Response is the outcome of a command, with a result per portfolio it ran on
+type Response struct {
+	Command string   `json:"command"`
+	Error   string   `json:"error,omitempty"`   // the command as a whole failed
+	Message string   `json:"message,omitempty"` // e.g. help
+	Results []Result `json:"results,omitempty"`
+}
+
+// Result is a command's outcome on one portfolio
+type Result struct {
+	Portfolio  string            `json:"portfolio"`
+	Error      string            `json:"error,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	Status     *RunnerStatus     `json:"status,omitempty"`
+	Positions  []PositionRecord  `json:"positions,omitempty"`
+	Orders     []t.Order         `json:"orders,omitempty"`
+	Executions []ExecutionRecord `json:"executions,omitempty"`
+	Bars       []t.Bar           `json:"bars,omitempty"`
+}
+
+// RunnerStatus is a snapshot of a runner for the status command
+type RunnerStatus struct {
+	Strategy      string    `json:"strategy"`
+	State         string    `json:"state"` // trading, paused or halted
+	HaltReason    string    `json:"halt_reason,omitempty"`
+	Cash          float64   `json:"cash"`
+	Equity        float64   `json:"equity"`
+	RealisedPnL   float64   `json:"realised_pnl"`
+	UnrealisedPnL float64   `json:"unrealised_pnl"`
+	Positions     int       `json:"positions"`
+	OpenOrders    int       `json:"open_orders"`
+	LastTick      time.Time `json:"last_tick"`
+}
+
+func (resp Response) String() string {
+	var b strings.Builder
+	switch {
+	case resp.Error != "":
+		fmt.Fprintf(&b, "%s: %s\n", resp.Command, resp.Error)
+	case resp.Message != "":
+		fmt.Fprintf(&b, "%s\n", resp.Message)
+	}
+	for _, res := range resp.Results {
+		prefix := res.Portfolio + ": "
+		switch {
+		case res.Error != "":
+			fmt.Fprintf(&b, "%serror: %s\n", prefix, res.Error)
+		case res.Status != nil:
+			s := res.Status
+			state := s.State
+			if s.HaltReason != "" {
+				state += " (" + s.HaltReason + ")"
+			}
+			lastTick := "no ticks yet"
+			if !s.LastTick.IsZero() {
+				lastTick = "last tick " + s.LastTick.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(&b, "%s%s | %s | equity %.2f cash %.2f | realised %.2f unrealised %.2f | %d positions, %d open orders | %s\n",
+				prefix, state, s.Strategy, s.Equity, s.Cash, s.RealisedPnL, s.UnrealisedPnL, s.Positions, s.OpenOrders, lastTick)
+		case resp.Command == "positions":
+			if len(res.Positions) == 0 {
+				fmt.Fprintf(&b, "%sno positions\n", prefix)
+			}
+			for _, p := range res.Positions {
+				fmt.Fprintf(&b, "%s%s %v @ %.2f (cost %.2f) | value %.2f unrealised %.2f\n",
+					prefix, p.Asset.Symbol, p.Qty, p.Price, p.CostBasis, p.MarketValue, p.UnrealisedPnL)
+			}
+		case resp.Command == "orders":
+			if len(res.Orders) == 0 {
+				fmt.Fprintf(&b, "%sno open orders\n", prefix)
+			}
+			for _, o := range res.Orders {
+				fmt.Fprintf(&b, "%s%s\n", prefix, o.Pretty())
+			}
+		case resp.Command == "executions":
+			if len(res.Executions) == 0 {
+				fmt.Fprintf(&b, "%sno fills yet\n", prefix)
+			}
+			for _, e := range res.Executions {
+				fmt.Fprintf(&b, "%s%s %s %v %s @ %.2f | fee %.2f | cash %.2f\n",
+					prefix, e.Time.UTC().Format(time.RFC3339), e.Action, e.Qty, e.Asset.Symbol, e.Price, e.Fee, e.Cash)
+			}
+		case resp.Command == "bars":
+			if len(res.Bars) == 0 {
+				fmt.Fprintf(&b, "%sno bars yet\n", prefix)
+			}
+			for _, bar := range res.Bars {
+				fmt.Fprintf(&b, "%s%s %s O %.2f H %.2f L %.2f C %.2f V %.0f\n",
+					prefix, bar.Asset.Symbol, bar.Start.UTC().Format(time.RFC3339), bar.Open, bar.High, bar.Low, bar.Close, bar.Volume)
+			}
+		default:
+			fmt.Fprintf(&b, "%s%s\n", prefix, res.Message)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// ----------- CONSOLE -----------
+
+// Console applies operator commands to a session's runners. Each command
+// runs on its runner's goroutine, between ticks.
+type Console struct {
+	runners []*Runner
+
+	mu       sync.Mutex
+	shutdown func() // set by Run; ends the session
+}
+
+func NewConsole(runners []*Runner) *Console {
+	return &Console{runners: runners}
+}
+
+// Exec parses and runs one line
+func (c *Console) Exec(ctx context.Context, line string) Response {
+	cmd, err := ParseCommand(line)
+	if err != nil {
+		return Response{Command: cmd.Name, Error: err.Error()}
+	}
+	return c.Run(ctx, cmd)
+}
+
+// Run applies a parsed command to its target runner(s)
+func (c *Console) Run(ctx context.Context, cmd Command) Response {
+	resp := Response{Command: cmd.Name}
+	switch cmd.Name {
+	case "help":
+		resp.Message = CommandHelp()
+		return resp
+	case "shutdown":
+		c.mu.Lock()
+		shutdown := c.shutdown
+		c.mu.Unlock()
+		if shutdown == nil {
+			resp.Error = "no session is running"
+			return resp
+		}
+		shutdown()
+		resp.Message = "Shutting down trading-bot..."
+		return resp
+	}
+
+	runners := c.runners
+	if cmd.Target != "" {
+		i := slices.IndexFunc(c.runners, func(r *Runner) bool { return r.Portfolio.Name == cmd.Target })
+		if i < 0 {
+			resp.Error = fmt.Sprintf("no portfolio %q in this session (have %s)", cmd.Target, strings.Join(c.portfolios(), ", "))
+			return resp
+		}
+		runners = c.runners[i : i+1]
+	}
+	if (cmd.Name == "set" || cmd.Name == "checkpoint") && len(runners) > 1 {
+		resp.Error = fmt.Sprintf("%s applies to one strategy; pick its portfolio with @name (%s)", cmd.Name, strings.Join(c.portfolios(), ", "))
+		return resp
+	}
+
+	for _, r := range runners {
+		res := Result{Portfolio: r.Portfolio.Name}
+		err := r.Do(ctx, func(ctx context.Context) {
+			msg, err := r.exec(ctx, cmd, &res)
+			if err != nil {
+				res.Error = err.Error()
+			}
+			res.Message = msg
+		})
+		if err != nil {
+			res.Error = err.Error()
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	return resp
+}
+
+// Runners returns the session's runners
+func (c *Console) Runners() []*Runner {
+	return c.runners
+}
+
+func (c *Console) portfolios() []string {
+	names := make([]string, len(c.runners))
+	for i, r := range c.runners {
+		names[i] = r.Portfolio.Name
+	}
+	return names
+}
+
+// Applies cmd on the runner's goroutine, filling in res's data and
+// returning a message for the operator
+func (r *Runner) exec(ctx context.Context, cmd Command, res *Result) (string, error) {
+	switch cmd.Name {
+	case "status":
+		res.Status = r.status()
+	case "positions":
+		res.Positions = r.Portfolio.PositionRecords()
+	case "orders":
+		res.Orders = r.Trader.Orders().Open()
+	case "executions":
+		n := 10
+		if len(cmd.Args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(cmd.Args[0]); err != nil || n <= 0 {
+				return "", fmt.Errorf("want a positive number of fills, not %q", cmd.Args[0])
+			}
+		}
+		res.Executions = slices.Clone(r.fills[max(len(r.fills)-n, 0):])
+	case "bars":
+		for _, asset := range r.marketAssets() {
+			if r.history == nil {
+				break
+			}
+			if h := r.history.bars[asset]; len(h) > 0 {
+				res.Bars = append(res.Bars, h[len(h)-1])
+			}
+		}
+	case "pause":
+		if r.halted != "" {
+			return "", fmt.Errorf("halted (%s)", r.halted)
+		}
+		r.paused = true
+		fmt.Printf("Paused strategy %s on portfolio %s\n", r.Strategy.Name(), r.Portfolio.Name)
+		return "paused", nil
+	case "resume":
+		if r.halted != "" {
+			return "", fmt.Errorf("halted (%s); trading stays stopped for the rest of the session", r.halted)
+		}
+		r.paused = false
+		fmt.Printf("Resumed strategy %s on portfolio %s\n", r.Strategy.Name(), r.Portfolio.Name)
+		return "trading", nil
+	case "halt":
+		if r.halted != "" {
+			return "already halted: " + r.halted, nil
+		}
+		reason := strings.Join(cmd.Args, " ")
+		if reason == "" {
+			reason = "operator"
+		}
+		r.manualHalt(ctx, reason)
+		return "halted: " + r.halted, nil
+	case "flatten":
+		return r.flattenSymbol(ctx, cmd.Args[0])
+	case "set":
+		return r.setParam(cmd.Args[0], cmd.Args[1])
+	case "checkpoint":
+		id := r.CheckpointID
+		if len(cmd.Args) > 1 {
+			id = cmd.Args[1]
+		}
+		return r.saveCheckpoint(id)
+	case "subscribe":
+		return r.subscribe(ctx, cmd.Args[0])
+	}
+	return "", nil
+}
+
+func (r *Runner) status() *RunnerStatus {
+	s := &RunnerStatus{
+		Strategy:      r.Strategy.Name(),
+		State:         "trading",
+		HaltReason:    r.halted,
+		Cash:          r.Portfolio.Cash,
+		Equity:        r.Portfolio.Equity(),
+		RealisedPnL:   r.Portfolio.RealisedPnL,
+		UnrealisedPnL: r.Portfolio.UnrealisedPnL(),
+		OpenOrders:    len(r.Trader.Orders().Open()),
+		LastTick:      r.lastTick,
+	}
+	switch {
+	case r.halted != "":
+		s.State = "halted"
+	case r.paused:
+		s.State = "paused"
+	}
+	for _, qty := range r.Portfolio.Positions {
+		if qty != 0 {
+			s.Positions++
+		}
+	}
+	return s
+}
+
+// Cancels open orders in the symbol, then closes the position at market
+func (r *Runner) flattenSymbol(ctx context.Context, symbol string) (string, error) {
+	var asset t.Asset
+	found := false
+	for a, qty := range r.Portfolio.Positions {
+		if strings.EqualFold(a.Symbol, symbol) && qty != 0 {
+			asset, found = a, true
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("no %s position", strings.ToUpper(symbol))
+	}
+	for _, o := range r.Trader.Orders().Open() {
+		if o.Asset == asset {
+			_, execs, _ := r.Trader.CancelOrder(o.ID, "flattened by operator")
+			r.record(execs...)
+		}
+	}
+
+	qty := r.Portfolio.Positions[asset]
+	if err := r.flattenAsset(ctx, asset, r.lastTick); err != nil {
+		return "", err
+	}
+	if left := r.Portfolio.Positions[asset]; left != 0 {
+		return fmt.Sprintf("sent order to close %v %s; %v held until it fills", qty, asset.Symbol, left), nil
+	}
+	return fmt.Sprintf("closed %v %s", qty, asset.Symbol), nil
+}
+
+// Rebuilds the strategy from its own checkpoint with one parameter changed,
+// so it keeps its state
+func (r *Runner) setParam(name, value string) (string, error) {
+	cp, ok := r.Strategy.(st.Checkpointer)
+	if !ok {
+		return "", fmt.Errorf("strategy %s can't be changed while running: it has no checkpoint", r.Strategy.Name())
+	}
+	def, ok := r.strategyDefinition()
+	if !ok {
+		return "", fmt.Errorf("strategy %s isn't registered", r.Strategy.Name())
+	}
+	param, ok := def.Params.Lookup(name)
+	if !ok {
+		return "", fmt.Errorf("%s takes no parameter %q", def.Name, name)
+	}
+
+	attrs := cp.Checkpoint(r.CheckpointID).Attributes
+	old := attrs[param.Name]
+	attrs[param.Name] = value
+	strat, err := st.RestoreFromCheckpoint(def.Name, &st.Checkpoint{ID: r.CheckpointID, Attributes: attrs})
+	if err != nil {
+		return "", errors.New(strings.TrimPrefix(err.Error(), "invalid checkpoint: "))
+	}
+	if strat.TickInterval() != r.Strategy.TickInterval() {
+		return "", fmt.Errorf("the change would make %s tick every %s, not %s like the session", def.Name, strat.TickInterval(), r.Strategy.TickInterval())
+	}
+	r.Strategy = strat
+
+	now := value
+	if cp, ok := strat.(st.Checkpointer); ok {
+		now = fmt.Sprint(cp.Checkpoint(r.CheckpointID).Attributes[param.Name])
+	}
+	fmt.Printf("Set %s on strategy %s for portfolio %s: %v -> %s\n", param.Name, r.Strategy.Name(), r.Portfolio.Name, old, now)
+	return fmt.Sprintf("%s: %v -> %s", param.Name, old, now), nil
+}
+
+// The registry entry the runner's strategy was built from
+func (r *Runner) strategyDefinition() (st.Definition, bool) {
+	if r.StrategyType != "" {
+		return st.Lookup(r.StrategyType)
+	}
+	for _, def := range st.Registered() {
+		if strings.EqualFold(def.Name, r.Strategy.Name()) {
+			return def, true
+		}
+	}
+	return st.Definition{}, false
+}
+
+func (r *Runner) saveCheckpoint(id string) (string, error) {
+	if id == "" {
+		return "", errors.New("the session has no checkpoint; give an id")
+	}
+	cp, ok := r.Strategy.(st.Checkpointer)
+	if !ok {
+		return "", fmt.Errorf("strategy %s has no state to checkpoint", r.Strategy.Name())
+	}
+	if err := cp.Checkpoint(id).SaveToJSON(); err != nil {
+		return "", fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return fmt.Sprintf("saved checkpoint %q", id), nil
+}
+
+// Adds the symbol to the assets the runner fetches data for
+func (r *Runner) subscribe(ctx context.Context, symbol string) (string, error) {
+	asset := t.NewAsset(strings.ToUpper(symbol), cfg.Exchange, cfg.AssetType)
+	if strings.Contains(symbol, ":") {
+		asset = t.AssetFromString(symbol)
+	}
+	if asset.Symbol == "" {
+		return "", fmt.Errorf("invalid symbol %q (want SYMBOL or SYMBOL:EXCHANGE:TYPE)", symbol)
+	}
+	if slices.Contains(r.marketAssets(), asset) {
+		return fmt.Sprintf("already following %s", asset.Symbol), nil
+	}
+	if err := r.Trader.IncludeAssets(ctx, []t.Asset{asset}); err != nil {
+		return "", fmt.Errorf("failed to subscribe to %s: %w", asset.Symbol, err)
+	}
+	r.watched = append(r.watched, asset)
+	return fmt.Sprintf("following %s", asset.Symbol), nil
+}
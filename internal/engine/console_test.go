@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	ds "github.com/joshskilla/trading-bot/internal/datastore"
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	"github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		line string
+		want Command
+		err  string
+	}{
+		{line: "status", want: Command{Name: "status"}},
+		{line: "--shutdown", want: Command{Name: "shutdown"}},
+		{line: "  Flatten aapl @demo ", want: Command{Name: "flatten", Args: []string{"aapl"}, Target: "demo"}},
+		{line: "@demo set fast 5", want: Command{Name: "set", Args: []string{"fast", "5"}, Target: "demo"}},
+		{line: "halt feed looks wrong", want: Command{Name: "halt", Args: []string{"feed", "looks", "wrong"}}},
+		{line: "checkpoint save", want: Command{Name: "checkpoint", Args: []string{"save"}}},
+		{line: "", err: "no command given"},
+		{line: "launch", err: `unknown command "launch"`},
+		{line: "set fast", err: "usage: set <param> <value>"},
+		{line: "checkpoint load cp1", err: "usage: checkpoint save [id]"},
+		{line: "status @a @b", err: "only one @portfolio"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.line, func(t *testing.T) {
+			cmd, err := ParseCommand(tc.line)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, cmd)
+		})
+	}
+}
+
+func TestConsole_RoutesCommandsToRunners(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	bar := testBar(start, 100, 100, 100, 100, 1000)
+	newTrader := func() *TestTrader {
+		return NewTestTraderWithProvider(newMapProvider(time.Minute, bar), time.Minute, start, start.Add(time.Hour))
+	}
+
+	momentum, err := st.RestoreFromCheckpoint("momentum", &st.Checkpoint{Attributes: map[string]any{"asset": "AAPL", "fast": 2, "slow": 4}})
+	require.NoError(t, err)
+	a := NewRunner(NewMemoryPortfolio("UnitTestConsoleA", 1000), newTrader(), momentum, make(chan types.Tick))
+	a.StrategyType = "momentum"
+	buyer := &buyingStrategy{contextStrategy: contextStrategy{assets: []types.Asset{testAsset}}}
+	b := NewRunner(NewMemoryPortfolio("UnitTestConsoleB", 1000), newTrader(), buyer, make(chan types.Tick))
+
+	var wg sync.WaitGroup
+	for _, r := range []*Runner{a, b} {
+		wg.Go(func() { r.Run(context.Background()) })
+	}
+	b.Ticks <- types.NewTick(bar.End) // buys 1 AAPL
+
+	ctx := context.Background()
+	console := NewConsole([]*Runner{a, b})
+	run := func(line string) Response {
+		t.Helper()
+		resp := console.Exec(ctx, line)
+		require.NotEmpty(t, resp.String())
+		return resp
+	}
+
+	resp := run("status")
+	require.Len(t, resp.Results, 2)
+	require.Equal(t, "trading", resp.Results[1].Status.State)
+	require.Equal(t, 1, resp.Results[1].Status.Positions)
+
+	resp = run("pause @UnitTestConsoleB")
+	require.Len(t, resp.Results, 1)
+	require.Equal(t, "paused", resp.Results[0].Message)
+	b.Ticks <- types.NewTick(bar.End.Add(30 * time.Second))
+	require.Len(t, buyer.seen, 1, "paused runners don't trade")
+	require.Equal(t, "paused", run("status @UnitTestConsoleB").Results[0].Status.State)
+
+	resp = run("positions @UnitTestConsoleB")
+	require.Len(t, resp.Results[0].Positions, 1)
+	require.Equal(t, 1.0, resp.Results[0].Positions[0].Qty)
+
+	// Strategy changes pick one portfolio
+	require.Contains(t, run("set fast 3").Error, "pick its portfolio with @name")
+	require.Contains(t, run("status @nope").Error, `no portfolio "nope"`)
+	require.Equal(t, "FastWindow: 2 -> 3", run("set fast 3 @UnitTestConsoleA").Results[0].Message)
+	require.Contains(t, run("set slow 2 @UnitTestConsoleA").Results[0].Error, "must be shorter than SlowWindow")
+	require.Contains(t, run("set fats 3 @UnitTestConsoleA").Results[0].Error, `takes no parameter "fats"`)
+
+	id := "UnitTestConsoleCheckpoint"
+	defer os.Remove(ds.AbsolutePath(fmt.Sprintf(st.CheckpointFilePath, id)))
+	require.Equal(t, `saved checkpoint "`+id+`"`, run("checkpoint save "+id+" @UnitTestConsoleA").Results[0].Message)
+	saved, err := st.LoadCheckpointFromJSON(id)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, saved.Attributes["FastWindow"])
+	require.Contains(t, run("checkpoint save @UnitTestConsoleA").Results[0].Error, "give an id")
+
+	require.Equal(t, "following MSFT", run("subscribe msft @UnitTestConsoleA").Results[0].Message)
+	require.Equal(t, "already following AAPL", run("subscribe AAPL @UnitTestConsoleA").Results[0].Message)
+
+	require.Equal(t, "closed 1 AAPL", run("flatten aapl @UnitTestConsoleB").Results[0].Message)
+	require.Contains(t, run("flatten aapl @UnitTestConsoleB").Results[0].Error, "no AAPL position")
+
+	require.Equal(t, "halted: manual: maintenance", run("halt maintenance @UnitTestConsoleB").Results[0].Message)
+	require.Contains(t, run("resume @UnitTestConsoleB").Results[0].Error, "halted (manual: maintenance)")
+
+	close(a.Ticks)
+	close(b.Ticks)
+	wg.Wait()
+	require.Contains(t, a.marketAssets(), types.NewAsset("MSFT", "IEX", "stock"))
+	require.Equal(t, ErrRunnerStopped.Error(), run("status").Results[0].Error)
+}
+
+func TestRunWithTicks_ShutdownFromStdinWaitsForRunners(t *testing.T) {
+	stdin, typed, err := os.Pipe()
+	require.NoError(t, err)
+	defer typed.Close()
+	defer func(orig *os.File) { os.Stdin = orig }(os.Stdin)
+	os.Stdin = stdin
+
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	tt := NewTestTraderWithProvider(newMapProvider(time.Minute), time.Minute, start, start.Add(time.Hour))
+	buyer := &buyingStrategy{contextStrategy: contextStrategy{assets: []types.Asset{testAsset}}}
+	r := NewRunner(NewMemoryPortfolio("UnitTestStdinShutdown", 1000), tt, buyer, nil)
+	untilShutdown := func(ctx context.Context, clock types.Clock, ticks chan types.Tick, start, end time.Time, interval time.Duration, th types.TradingHours) {
+		<-ctx.Done()
+	}
+
+	fmt.Fprintln(typed, "shutdown")
+	require.NoError(t, RunWithTicks(NewConsole([]*Runner{r}), untilShutdown, types.NewSimClock(start), false, start, start.Add(time.Hour), types.TradingHours{}))
+	require.ErrorIs(t, r.Do(context.Background(), func(context.Context) {}), ErrRunnerStopped, "runners finish before the session returns")
+}
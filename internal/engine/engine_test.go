@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -129,3 +130,58 @@ func TestFlushingPositionsFromPortfolio(t *testing.T) {
 	// Clean up
 	os.Remove(path)
 }
+
+func TestClearingPortfolioResults(t *testing.T) {
+	portfolio := NewPortfolio("UnitTest6ClearingResults", 1000)
+	portfolio.ExecutionHistory = append(portfolio.ExecutionHistory, ExecutionRecord{Time: time.Now().UTC(), Asset: types.NewAsset("AAPL", "NASDAQ", "stock"), Action: types.Buy, Qty: 1, Price: 150, Cash: 850})
+	require.NoError(t, portfolio.FlushOrdersToFile())
+	require.NoError(t, portfolio.RecordHalt(time.Now(), "test"))
+
+	require.NoError(t, portfolio.ClearResults())
+	for _, path := range ResultsFilePaths {
+		require.False(t, ds.FileExists(ds.AbsolutePath(fmt.Sprintf(path, portfolio.Name))), path)
+	}
+	require.NoError(t, portfolio.ClearResults(), "nothing left to clear")
+}
+
+func TestPortfolioCostBasisAndPnL(t *testing.T) {
+	portfolio := NewPortfolio("UnitTest6Valuation", 1000)
+	asset := types.NewAsset("AAPL", "NASDAQ", "stock")
+	now := time.Now().UTC()
+
+	// Average cost includes buy fees; sells realise against it
+	bookFill(portfolio, now, asset, types.Buy, 2, 100, 2, 0)
+	bookFill(portfolio, now, asset, types.Buy, 2, 110, 0, 0)
+	require.InDelta(t, 105.5, portfolio.CostBasis[asset], 1e-9)
+
+	exec := bookFill(portfolio, now, asset, types.Sell, 1, 120, 1, 0)
+	require.InDelta(t, 13.5, exec.RealisedPnL, 1e-9)
+	require.InDelta(t, 13.5, portfolio.RealisedPnL, 1e-9)
+
+	// Mark at a later bar
+	bars := newMapProvider(time.Minute, types.Bar{Asset: asset, Start: now.Truncate(time.Minute), Close: 115})
+	require.NoError(t, portfolio.MarkToMarket(context.Background(), bars, now))
+	require.InDelta(t, 345, portfolio.MarketValue(), 1e-9)
+	require.InDelta(t, 3*(115-105.5), portfolio.UnrealisedPnL(), 1e-9)
+	require.InDelta(t, portfolio.Cash+345, portfolio.Equity(), 1e-9)
+
+	// Equity curve and valuation survive a save/load
+	require.NoError(t, portfolio.RecordEquity(now))
+	require.NoError(t, portfolio.FlushEquityToFile())
+	equityPath := ds.AbsolutePath(fmt.Sprintf(EquityFilePath, portfolio.Name))
+	require.True(t, ds.FileExists(equityPath))
+	defer os.Remove(equityPath)
+
+	require.NoError(t, portfolio.SaveToJSON())
+	path := ds.AbsolutePath(fmt.Sprintf(PortfolioFilePath, portfolio.Name))
+	defer os.Remove(path)
+	loaded, err := LoadPortfolioFromJSON(portfolio.Name)
+	require.NoError(t, err)
+	require.Equal(t, portfolio.CostBasis, loaded.CostBasis)
+	require.Equal(t, portfolio.RealisedPnL, loaded.RealisedPnL)
+	require.Equal(t, portfolio.LastPrices, loaded.LastPrices)
+
+	// Closing out clears the cost basis
+	bookFill(portfolio, now, asset, types.Sell, 3, 100, 0, 0)
+	require.NotContains(t, portfolio.CostBasis, asset)
+}
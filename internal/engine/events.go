@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is something a runner did, as streamed to session watchers
+type Event struct {
+	Type      string           `json:"type"` // tick, fill or halt
+	Portfolio string           `json:"portfolio"`
+	Time      time.Time        `json:"time"`
+	Equity    float64          `json:"equity,omitempty"` // ticks: after marking
+	Cash      float64          `json:"cash,omitempty"`
+	Fill      *ExecutionRecord `json:"fill,omitempty"`
+	Reason    string           `json:"reason,omitempty"` // halts
+}
+
+// EventBus fans runner events out to subscribers. Publishing never blocks:
+// a subscriber that falls behind misses events.
+type EventBus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of events and a func to stop receiving them
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default: // subscriber is behind
+		}
+	}
+}
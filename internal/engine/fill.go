@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// ----------- FILL MODEL -----------
+
+// FillTiming picks the reference price a simulated market order fills at
+type FillTiming int
+
+const (
+	FillAtClose    FillTiming = iota // close of the signal's bar
+	FillAtNextOpen                   // open of the bar after the signal's bar
+)
+
+func (ft FillTiming) String() string {
+	switch ft {
+	case FillAtNextOpen:
+		return "next_open"
+	default:
+		return "close"
+	}
+}
+
+func ParseFillTiming(s string) (FillTiming, error) {
+	switch s {
+	case "", "close":
+		return FillAtClose, nil
+	case "next_open":
+		return FillAtNextOpen, nil
+	default:
+		return FillAtClose, fmt.Errorf("unknown fill timing %q (use close or next_open)", s)
+	}
+}
+
+// FillModel decides how simulated orders are priced and charged
+type FillModel struct {
+	Timing           FillTiming
+	Commission       CommissionModel // nil => no commission
+	Slippage         SlippageModel   // nil => no slippage
+	MaxParticipation float64         // max share of a bar's volume one fill may take (0 => unlimited)
+}
+
+// DefaultFillModel fills at the bar close with no costs
+func DefaultFillModel() FillModel {
+	return FillModel{Timing: FillAtClose}
+}
+
+// Quote returns the fill price, commission and total slippage cost for an order
+// of qty at reference price ref, with bar giving the market context.
+func (fm FillModel) Quote(action t.Action, qty, ref float64, bar t.Bar) (price, fee, slippage float64) {
+	perUnit := 0.0
+	if fm.Slippage != nil {
+		perUnit = math.Max(fm.Slippage.Slippage(qty, ref, bar), 0)
+	}
+	price = ref
+	switch action {
+	case t.Buy:
+		price = ref + perUnit
+	case t.Sell:
+		price = math.Max(ref-perUnit, 0)
+	}
+	if fm.Commission != nil {
+		fee = fm.Commission.Commission(qty, price)
+	}
+	return price, fee, math.Abs(price-ref) * qty
+}
+
+// --- Commissions ---
+
+type CommissionModel interface {
+	// Commission charged for filling qty at price
+	Commission(qty, price float64) float64
+}
+
+// FixedCommission charges a flat amount per order
+type FixedCommission struct {
+	PerOrder float64
+}
+
+func (c FixedCommission) Commission(qty, price float64) float64 { return c.PerOrder }
+
+// PercentCommission charges a fraction of notional (e.g. 0.001 = 10bps), with an optional minimum
+type PercentCommission struct {
+	Rate    float64
+	Minimum float64
+}
+
+func (c PercentCommission) Commission(qty, price float64) float64 {
+	return math.Max(qty*price*c.Rate, c.Minimum)
+}
+
+// Commissions sums several commission models (e.g. fixed + percentage)
+type Commissions []CommissionModel
+
+func (cs Commissions) Commission(qty, price float64) float64 {
+	total := 0.0
+	for _, c := range cs {
+		total += c.Commission(qty, price)
+	}
+	return total
+}
+
+// --- Slippage ---
+
+type SlippageModel interface {
+	// Adverse price move per unit for filling qty at reference price ref
+	Slippage(qty, ref float64, bar t.Bar) float64
+}
+
+// FixedBpsSlippage moves the price by a fixed number of basis points
+type FixedBpsSlippage struct {
+	Bps float64
+}
+
+func (s FixedBpsSlippage) Slippage(qty, ref float64, bar t.Bar) float64 {
+	return ref * s.Bps / 10_000
+}
+
+// VolumeSlippage grows linearly with the order's share of the bar's volume:
+// slippage = ref * Impact * qty/Volume (participation capped at 1, and 1 for empty bars)
+type VolumeSlippage struct {
+	Impact float64
+}
+
+func (s VolumeSlippage) Slippage(qty, ref float64, bar t.Bar) float64 {
+	participation := 1.0
+	if bar.Volume > 0 {
+		participation = math.Min(qty/bar.Volume, 1)
+	}
+	return ref * s.Impact * participation
+}
+
+// SpreadSlippage pays half of an estimated spread, taken as Fraction of the bar's High-Low range
+type SpreadSlippage struct {
+	Fraction float64
+}
+
+func (s SpreadSlippage) Slippage(qty, ref float64, bar t.Bar) float64 {
+	return (bar.High - bar.Low) * s.Fraction / 2
+}
+
+// ParseSlippage builds a slippage model from "<model>:<value>", one of
+// bps:<basis points>, volume:<impact>, spread:<fraction of range>, or "none".
+func ParseSlippage(spec string) (SlippageModel, error) {
+	if spec == "" || spec == "none" {
+		return nil, nil
+	}
+	model, val, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid slippage %q (want model:value)", spec)
+	}
+	v, err := strconv.ParseFloat(val, 64)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("invalid slippage value %q", val)
+	}
+	switch model {
+	case "bps":
+		return FixedBpsSlippage{Bps: v}, nil
+	case "volume":
+		return VolumeSlippage{Impact: v}, nil
+	case "spread":
+		return SpreadSlippage{Fraction: v}, nil
+	default:
+		return nil, fmt.Errorf("unknown slippage model %q (use bps, volume or spread)", model)
+	}
+}
+
+// ----------- BOOKING FILLS -----------
+
+// Tolerance for float comparisons of quantities and cash
+const qtyEpsilon = 1e-9
+
+// applyFill books a fill against the portfolio. Buys need enough cash for
+// notional plus fee, sells need enough of the asset held (no shorting).
+func applyFill(p *Portfolio, ts time.Time, asset t.Asset, action t.Action, qty, price, fee, slippage float64) (ExecutionRecord, error) {
+	if qty <= 0 {
+		return ExecutionRecord{}, fmt.Errorf("invalid quantity %v", qty)
+	}
+	switch action {
+	case t.Buy:
+		if cost := qty*price + fee; p.Cash+qtyEpsilon < cost {
+			return ExecutionRecord{}, fmt.Errorf("insufficient cash: need %.2f, have %.2f", cost, p.Cash)
+		}
+	case t.Sell:
+		if held := p.Positions[asset]; held+qtyEpsilon < qty {
+			return ExecutionRecord{}, fmt.Errorf("insufficient position: selling %v, holding %v", qty, held)
+		}
+	default:
+		return ExecutionRecord{}, fmt.Errorf("unsupported action %s", action)
+	}
+	return bookFill(p, ts, asset, action, qty, price, fee, slippage), nil
+}
+
+// bookFill records a fill without checks, for fills a broker has already confirmed.
+// Buys roll into the average cost basis; sells realise PnL against it.
+func bookFill(p *Portfolio, ts time.Time, asset t.Asset, action t.Action, qty, price, fee, slippage float64) ExecutionRecord {
+	notional := qty * price
+	realised := 0.0
+	switch action {
+	case t.Buy:
+		held := p.Positions[asset]
+		if held > 0 {
+			p.CostBasis[asset] = (p.CostBasis[asset]*held + notional + fee) / (held + qty)
+		} else {
+			p.CostBasis[asset] = (notional + fee) / qty
+		}
+		p.Cash -= notional + fee
+		p.Positions[asset] += qty
+	case t.Sell:
+		realised = (price-p.CostBasis[asset])*qty - fee
+		p.RealisedPnL += realised
+		p.Cash += notional - fee
+		p.Positions[asset] -= qty
+		if math.Abs(p.Positions[asset]) < qtyEpsilon {
+			p.Positions[asset] = 0 // keep asset tracked, drop float dust
+			delete(p.CostBasis, asset)
+		}
+	}
+	p.LastPrices[asset] = price
+	return ExecutionRecord{
+		Time:        ts.UTC(),
+		Asset:       asset,
+		Action:      action,
+		Qty:         qty,
+		Price:       price,
+		Cash:        p.Cash,
+		Fee:         fee,
+		Slippage:    slippage,
+		RealisedPnL: realised,
+	}
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// sampleFetcher is implemented by traders with a live trade feed
+type sampleFetcher interface {
+	FetchSample(ctx context.Context, asset t.Asset) (t.Sample, error)
+}
+
+// marketHistory keeps the rolling window of bars the runner shows its strategy
+type marketHistory struct {
+	length int
+	bars   map[t.Asset][]t.Bar
+}
+
+func newMarketHistory(length int) *marketHistory {
+	if length <= 0 {
+		length = st.DefaultHistoryLength
+	}
+	return &marketHistory{length: length, bars: make(map[t.Asset][]t.Bar)}
+}
+
+// add appends bar if it is newer than the asset's latest, dropping the oldest beyond length
+func (h *marketHistory) add(bar t.Bar) {
+	bars := h.bars[bar.Asset]
+	if n := len(bars); n > 0 && !bar.Start.After(bars[n-1].Start) {
+		return
+	}
+	bars = append(bars, bar)
+	if extra := len(bars) - h.length; extra > 0 {
+		bars = append(bars[:0], bars[extra:]...)
+	}
+	h.bars[bar.Asset] = bars
+}
+
+// MarketAssets lists the assets a session needs data for:
+// what the portfolio holds plus what the strategy trades
+func MarketAssets(p *Portfolio, strat st.Strategy) []t.Asset {
+	seen := make(map[t.Asset]bool)
+	var assets []t.Asset
+	add := func(as []t.Asset) {
+		for _, a := range as {
+			if !seen[a] {
+				seen[a] = true
+				assets = append(assets, a)
+			}
+		}
+	}
+	add(p.Assets())
+	if u, ok := strat.(st.AssetUniverse); ok {
+		add(u.Assets())
+	}
+	return assets
+}
+
+// The runner's market assets, plus any subscribed to since it started
+func (r *Runner) marketAssets() []t.Asset {
+	assets := MarketAssets(r.Portfolio, r.Strategy)
+	for _, a := range r.watched {
+		if !slices.Contains(assets, a) {
+			assets = append(assets, a)
+		}
+	}
+	return assets
+}
+
+// marketContext fetches the latest bar (and trade, where streamed) for every asset
+// and snapshots the portfolio for the strategy's view of the tick
+func (r *Runner) marketContext(ctx context.Context, tick t.Tick) *st.MarketContext {
+	if r.history == nil {
+		length := st.DefaultHistoryLength
+		if hs, ok := r.Strategy.(st.HistorySizer); ok {
+			length = hs.HistoryLength()
+		}
+		r.history = newMarketHistory(length)
+	}
+
+	mc := &st.MarketContext{
+		Tick:      tick,
+		Bars:      make(map[t.Asset]t.Bar),
+		History:   make(map[t.Asset][]t.Bar),
+		Samples:   make(map[t.Asset]t.Sample),
+		Positions: maps.Clone(r.Portfolio.Positions),
+		Cash:      r.Portfolio.Cash,
+	}
+	samples, live := r.Trader.(sampleFetcher)
+	at := tick.Time
+	if h, ok := r.Trader.(historical); ok {
+		// Only the bar before the one holding the tick has closed by then
+		at = tick.Time.Add(-h.barInterval())
+	}
+	for _, asset := range r.marketAssets() {
+		bar, ok, err := r.Trader.FetchBarAt(ctx, asset, at)
+		if err != nil {
+			fmt.Printf("Failed to fetch %s bar at %s: %v\n", asset.Symbol, tick.Time.Format(time.RFC3339), err)
+		}
+		if ok && bar.IsClosed() && !bar.End.After(tick.Time) {
+			r.history.add(bar)
+		}
+		if h := r.history.bars[asset]; len(h) > 0 {
+			mc.Bars[asset] = h[len(h)-1]
+			mc.History[asset] = append([]t.Bar(nil), h...)
+		}
+
+		if live {
+			if sm, err := samples.FetchSample(ctx, asset); err == nil {
+				mc.Samples[asset] = sm
+				continue
+			}
+		}
+		// No trade feed (e.g. backtests): the latest close stands in
+		if b, ok := mc.Bars[asset]; ok {
+			mc.Samples[asset] = t.NewSample(asset, b.End, b.Close, 0)
+		}
+	}
+	return mc
+}
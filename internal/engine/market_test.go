@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	"github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+// contextStrategy records the contexts it is handed
+type contextStrategy struct {
+	assets  []types.Asset
+	history int
+	seen    []*st.MarketContext
+}
+
+func (s *contextStrategy) Init() error                     { return nil }
+func (s *contextStrategy) OnTick(mc *st.MarketContext)     { s.seen = append(s.seen, mc) }
+func (s *contextStrategy) GenerateSignals() []types.Signal { return nil }
+func (s *contextStrategy) TickInterval() time.Duration     { return time.Minute }
+func (s *contextStrategy) Name() string                    { return "Context" }
+func (s *contextStrategy) Assets() []types.Asset           { return s.assets }
+func (s *contextStrategy) HistoryLength() int              { return s.history }
+
+func TestRunner_BuildsMarketContext(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	msft := types.NewAsset("MSFT", "IEX", "stock")
+	var bars []types.Bar
+	for i := range 4 {
+		bars = append(bars, testBar(start.Add(time.Duration(i)*time.Minute), 100, 100, 100, float64(100+i), 10))
+	}
+	tt := NewTestTraderWithProvider(newMapProvider(time.Minute, bars...), time.Minute, start, start.Add(time.Hour))
+
+	p := NewPortfolio("UnitTestMarketContext", 500)
+	p.Positions[msft] = 3 // held, but no data
+	strat := &contextStrategy{assets: []types.Asset{testAsset}, history: 2}
+	require.ElementsMatch(t, []types.Asset{msft, testAsset}, MarketAssets(p, strat))
+
+	r := &Runner{Portfolio: p, Trader: tt, Strategy: strat}
+	for i := range 4 {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		strat.OnTick(r.marketContext(context.Background(), types.NewTick(ts)))
+		strat.OnTick(r.marketContext(context.Background(), types.NewTick(ts.Add(30*time.Second)))) // same bar again
+	}
+
+	_, ok := strat.seen[0].Bar(testAsset)
+	require.False(t, ok, "no bar has closed by the first tick")
+
+	// At 14:33:30 the latest closed bar is 14:32-14:33: the one still open isn't seen
+	mc := strat.seen[len(strat.seen)-1]
+	bar, ok := mc.Bar(testAsset)
+	require.True(t, ok)
+	require.Equal(t, 102.0, bar.Close)
+	require.Len(t, mc.History[testAsset], 2) // capped at HistoryLength, no repeats
+	require.Equal(t, []float64{101, 102}, []float64{mc.LastBars(testAsset, 5)[0].Close, mc.LastBars(testAsset, 5)[1].Close})
+
+	sample, ok := mc.Sample(testAsset)
+	require.True(t, ok)
+	require.Equal(t, 102.0, sample.Price) // backtests fall back to the close
+
+	_, ok = mc.Bar(msft)
+	require.False(t, ok)
+	require.Equal(t, 3.0, mc.Position(msft))
+	require.Equal(t, 500.0, mc.Cash)
+
+	// The context is a snapshot: later fills don't change what the strategy saw
+	p.Positions[msft] = 0
+	require.Equal(t, 3.0, mc.Position(msft))
+}
+
+func TestRunner_SeesAlpacaBars(t *testing.T) {
+	// Alpaca's bars API, serving bars as they come from it: no status of ours
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"bars":{"AAPL":[`+
+			`{"t":"2024-01-02T14:30:00Z","o":100,"h":101,"l":99,"c":100.5,"v":1000},`+
+			`{"t":"2024-01-02T14:31:00Z","o":100.5,"h":102,"l":100,"c":101.5,"v":1000}`+
+			`]},"next_page_token":null}`)
+	}))
+	defer srv.Close()
+	t.Setenv("APCA_API_DATA_URL", srv.URL)
+
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	tt := NewTestTrader(time.Minute, start, start.Add(time.Hour))
+	strat := &contextStrategy{assets: []types.Asset{testAsset}}
+	r := &Runner{Portfolio: NewMemoryPortfolio("UnitTestAlpacaBars", 1000), Trader: tt, Strategy: strat}
+
+	mc := r.marketContext(context.Background(), types.NewTick(start.Add(2*time.Minute)))
+	bar, ok := mc.Bar(testAsset)
+	require.True(t, ok, "historical Alpaca bars are closed")
+	require.Equal(t, 101.5, bar.Close)
+	require.Len(t, mc.History[testAsset], 1)
+}
@@ -0,0 +1,302 @@
+package engine
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ds "github.com/joshskilla/trading-bot/internal/datastore"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// Closed orders kept for inspection before being dropped (oldest first)
+const MaxClosedOrders = 1000
+
+const (
+	OpenOrdersFilePath = "data/orders/%s.json"
+	orderIDFormat      = "ord-%s-%06d" // book, sequence
+)
+
+// OrderBook tracks a trader's orders through their lifecycle.
+// Safe for concurrent use; listeners are called on every change.
+type OrderBook struct {
+	mu        sync.Mutex
+	orders    map[string]*t.Order // by ID
+	open      []string            // open order IDs in submission order
+	closed    []string            // closed order IDs, oldest first
+	bookID    string              // random, so IDs are never reused across restarts
+	seq       int
+	listeners []func(t.Order)
+}
+
+func NewOrderBook() *OrderBook {
+	return &OrderBook{orders: make(map[string]*t.Order), bookID: newBookID()}
+}
+
+// Order IDs are sent to the broker as client order IDs, which it won't take
+// twice: so each book numbers its orders under its own random ID.
+func newBookID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// OnUpdate registers fn to receive a copy of every new or changed order.
+func (ob *OrderBook) OnUpdate(fn func(t.Order)) {
+	ob.mu.Lock()
+	ob.listeners = append(ob.listeners, fn)
+	ob.mu.Unlock()
+}
+
+// Submit validates and stores a new order, assigning its ID if not set.
+// Invalid orders are stored as rejected.
+func (ob *OrderBook) Submit(o t.Order, now time.Time) t.Order {
+	ob.mu.Lock()
+	ob.seq++
+	if o.ID == "" {
+		o.ID = fmt.Sprintf(orderIDFormat, ob.bookID, ob.seq)
+	}
+	o.Created, o.Updated = now, now
+	o.Status = t.OrderNew
+	if err := o.Validate(); err != nil {
+		o.Status = t.OrderRejected
+		o.Reason = err.Error()
+	}
+	ob.store(&o)
+	ob.mu.Unlock()
+
+	ob.notify(o)
+	return o
+}
+
+// Update replaces a stored order (matched by ID) with o.
+func (ob *OrderBook) Update(o t.Order) {
+	ob.mu.Lock()
+	if _, ok := ob.orders[o.ID]; !ok {
+		ob.mu.Unlock()
+		return
+	}
+	ob.store(&o)
+	ob.mu.Unlock()
+
+	ob.notify(o)
+}
+
+// Reject marks an open order as rejected with a reason.
+func (ob *OrderBook) Reject(id, reason string, now time.Time) (t.Order, bool) {
+	return ob.close(id, t.OrderRejected, reason, now)
+}
+
+// Cancel marks an open order as cancelled with a reason.
+func (ob *OrderBook) Cancel(id, reason string, now time.Time) (t.Order, bool) {
+	return ob.close(id, t.OrderCancelled, reason, now)
+}
+
+// CancelAll cancels every open order, returning the cancelled orders.
+func (ob *OrderBook) CancelAll(reason string, now time.Time) []t.Order {
+	var out []t.Order
+	for _, o := range ob.Open() {
+		if c, ok := ob.Cancel(o.ID, reason, now); ok {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (ob *OrderBook) close(id string, status t.OrderStatus, reason string, now time.Time) (t.Order, bool) {
+	ob.mu.Lock()
+	o, ok := ob.orders[id]
+	if !ok || !o.Status.IsOpen() {
+		ob.mu.Unlock()
+		return t.Order{}, false
+	}
+	c := *o
+	c.Status = status
+	c.Reason = reason
+	c.Updated = now
+	ob.store(&c)
+	ob.mu.Unlock()
+
+	ob.notify(c)
+	return c, true
+}
+
+// Get returns the order with the given ID.
+func (ob *OrderBook) Get(id string) (t.Order, bool) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	o, ok := ob.orders[id]
+	if !ok {
+		return t.Order{}, false
+	}
+	return *o, true
+}
+
+// Open returns copies of all open orders in submission order.
+func (ob *OrderBook) Open() []t.Order {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	out := make([]t.Order, 0, len(ob.open))
+	for _, id := range ob.open {
+		out = append(out, *ob.orders[id])
+	}
+	return out
+}
+
+// Closed returns copies of retained closed orders, oldest first.
+func (ob *OrderBook) Closed() []t.Order {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	out := make([]t.Order, 0, len(ob.closed))
+	for _, id := range ob.closed {
+		out = append(out, *ob.orders[id])
+	}
+	return out
+}
+
+// store saves o and keeps the open/closed indexes in step. Caller holds mu.
+func (ob *OrderBook) store(o *t.Order) {
+	_, existed := ob.orders[o.ID]
+	ob.orders[o.ID] = o
+	if o.Status.IsOpen() {
+		if !existed {
+			ob.open = append(ob.open, o.ID)
+		}
+		return
+	}
+	// Closed: move out of the open index
+	for i, id := range ob.open {
+		if id == o.ID {
+			ob.open = append(ob.open[:i], ob.open[i+1:]...)
+			break
+		}
+	}
+	ob.closed = append(ob.closed, o.ID)
+	if len(ob.closed) > MaxClosedOrders {
+		delete(ob.orders, ob.closed[0])
+		ob.closed = ob.closed[1:]
+	}
+}
+
+func (ob *OrderBook) notify(o t.Order) {
+	ob.mu.Lock()
+	listeners := ob.listeners
+	ob.mu.Unlock()
+	for _, fn := range listeners {
+		fn(o)
+	}
+}
+
+// ----------- PERSISTENCE -----------
+
+// Marshal open orders to JSON and write to data/orders/<name>.json
+func (ob *OrderBook) SaveOpenOrders(name string) error {
+	data, err := json.MarshalIndent(ob.Open(), "", "  ")
+	if err != nil {
+		return err
+	}
+	path := ds.AbsolutePath(fmt.Sprintf(OpenOrdersFilePath, name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Load open orders from data/orders/<name>.json (if any) into the book,
+// so resting orders survive restarts.
+func (ob *OrderBook) RestoreOpenOrders(name string) error {
+	path := ds.AbsolutePath(fmt.Sprintf(OpenOrdersFilePath, name))
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var orders []t.Order
+	if err := json.Unmarshal(data, &orders); err != nil {
+		return err
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	for i := range orders {
+		o := orders[i]
+		if !o.Status.IsOpen() {
+			continue
+		}
+		ob.store(&o)
+	}
+	return nil
+}
+
+// ----------- MATCHING -----------
+
+// matchOrder checks whether an open order can fill during bar, returning the
+// reference fill price. Stop orders are marked triggered once their stop trades.
+// Gaps through a price fill at the bar's open, as the market would.
+func matchOrder(o *t.Order, bar t.Bar) (float64, bool) {
+	buy := o.Action == t.Buy
+
+	// Stops trigger when the stop price trades
+	if (o.Type == t.StopOrder || o.Type == t.StopLimitOrder) && !o.Triggered {
+		if buy && bar.High >= o.StopPrice || !buy && bar.Low <= o.StopPrice {
+			o.Triggered = true
+		} else {
+			return 0, false
+		}
+	}
+
+	switch o.Type {
+	case t.MarketOrder:
+		return bar.Open, true
+	case t.StopOrder:
+		if buy {
+			return math.Max(bar.Open, o.StopPrice), true
+		}
+		return math.Min(bar.Open, o.StopPrice), true
+	case t.LimitOrder, t.StopLimitOrder:
+		from := bar.Open
+		if o.Type == t.StopLimitOrder {
+			// Best case once triggered is the stop price (or a gap past it)
+			if buy {
+				from = math.Max(bar.Open, o.StopPrice)
+			} else {
+				from = math.Min(bar.Open, o.StopPrice)
+			}
+		}
+		if buy && bar.Low <= o.LimitPrice {
+			return math.Min(from, o.LimitPrice), true
+		}
+		if !buy && bar.High >= o.LimitPrice {
+			return math.Max(from, o.LimitPrice), true
+		}
+	}
+	return 0, false
+}
+
+// fillableQty caps qty by the fill model's share of bar volume (0 = no cap).
+func (fm FillModel) fillableQty(qty float64, bar t.Bar) float64 {
+	if fm.MaxParticipation <= 0 {
+		return qty
+	}
+	return math.Min(qty, bar.Volume*fm.MaxParticipation)
+}
+
+// isLimitType reports whether fills must respect the order's limit price.
+func isLimitType(o t.Order) bool {
+	return o.Type == t.LimitOrder || o.Type == t.StopLimitOrder
+}
+
+// sameTradingDay compares calendar days in the exchange time zone.
+func sameTradingDay(a, b time.Time, loc *time.Location) bool {
+	ay, am, ad := a.In(loc).Date()
+	by, bm, bd := b.In(loc).Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -1,9 +1,12 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"time"
 
 	_ "github.com/joshskilla/trading-bot/internal/config"
@@ -17,38 +20,82 @@ const (
 	ResultsFileType   = "csv"
 	OrdersFileName    = "%s_orders"
 	PositionsFileName = "%s_positions"
+	EquityFileName    = "%s_equity"
+	HaltsFileName     = "%s_halts"
 	OrdersFilePath    = "results/%s_orders.csv"
 	PositionsFilePath = "results/%s_positions.csv"
+	EquityFilePath    = "results/%s_equity.csv"
+	HaltsFilePath     = "results/%s_halts.csv"
 )
 
+// ResultsFilePaths are the CSVs a portfolio's sessions write
+var ResultsFilePaths = []string{OrdersFilePath, PositionsFilePath, EquityFilePath, HaltsFilePath}
+
+// Equity points buffered before being flushed to the equity curve CSV
+const MaxEquityHistory = 100
+
 type Portfolio struct {
 	Name             string              `json:"name"`
 	Cash             float64             `json:"cash"`
 	Positions        map[t.Asset]float64 `json:"positions"`
+	CostBasis        map[t.Asset]float64 `json:"-"` // average cost per unit held, buy fees included
+	RealisedPnL      float64             `json:"-"` // from closed quantity, net of fees
+	LastPrices       map[t.Asset]float64 `json:"-"` // latest marks (bar closes)
+	MarkedAt         time.Time           `json:"-"` // time of the latest mark
+	Clock            t.Clock             `json:"-"` // stamps positions not yet marked
 	ExecutionHistory []ExecutionRecord   `json:"-"`
+	EquityHistory    []EquityRecord      `json:"-"`
 	OrderWriter      ds.Writer           `json:"-"`
 	PositionWriter   ds.Writer           `json:"-"`
+	EquityWriter     ds.Writer           `json:"-"`
+	HaltWriter       ds.Writer           `json:"-"`
 }
 type portfolioJSON struct {
-	Name      string             `json:"name"`
-	Cash      float64            `json:"cash"`
-	Positions map[string]float64 `json:"positions"`
+	Name        string             `json:"name"`
+	Cash        float64            `json:"cash"`
+	Positions   map[string]float64 `json:"positions"`
+	CostBasis   map[string]float64 `json:"cost_basis,omitempty"`
+	RealisedPnL float64            `json:"realised_pnl,omitempty"`
+	LastPrices  map[string]float64 `json:"last_prices,omitempty"`
 }
 
 type PositionRecord struct {
-	Time  time.Time
-	Asset t.Asset
-	Qty   float64
-	Price float64
+	Time          time.Time
+	Asset         t.Asset
+	Qty           float64
+	Price         float64 // latest mark
+	CostBasis     float64 // average cost per unit
+	MarketValue   float64
+	UnrealisedPnL float64
 }
 
-type ExecutionRecord struct {
+// EquityRecord is one point on the portfolio's equity curve
+type EquityRecord struct {
+	Time          time.Time
+	Cash          float64
+	MarketValue   float64 // holdings at their latest marks
+	Equity        float64 // cash + market value
+	RealisedPnL   float64
+	UnrealisedPnL float64
+}
+
+// HaltRecord notes when & why trading on the portfolio was halted
+type HaltRecord struct {
 	Time   time.Time
-	Asset  t.Asset
-	Action t.Action
-	Qty    float64
-	Price  float64
-	Cash   float64
+	Reason string
+	Equity float64
+}
+
+type ExecutionRecord struct {
+	Time        time.Time
+	Asset       t.Asset
+	Action      t.Action
+	Qty         float64
+	Price       float64 // fill price, slippage included
+	Cash        float64 // cash after the fill
+	Fee         float64 // commission charged
+	Slippage    float64 // total cost of slippage vs the reference price
+	RealisedPnL float64 // sells: gain vs average cost, net of fees
 }
 
 func NewPortfolio(name string, cash float64) *Portfolio {
@@ -56,20 +103,42 @@ func NewPortfolio(name string, cash float64) *Portfolio {
 		Name:             name,
 		Cash:             cash,
 		Positions:        make(map[t.Asset]float64),
+		CostBasis:        make(map[t.Asset]float64),
+		LastPrices:       make(map[t.Asset]float64),
+		Clock:            t.RealClock{},
 		ExecutionHistory: []ExecutionRecord{},
+		EquityHistory:    []EquityRecord{},
 		OrderWriter: ds.NewCSVWriter(ds.File{
 			Name: fmt.Sprintf(OrdersFileName, name),
 			Dir:  ResultsFileDir,
 			Type: ResultsFileType,
-		}, []string{"Time", "Asset", "Action", "Qty", "Price", "Cash"}),
+		}, []string{"Time", "Asset", "Action", "Qty", "Price", "Cash", "Fee", "Slippage", "RealisedPnL"}),
 		PositionWriter: ds.NewCSVWriter(ds.File{
 			Name: fmt.Sprintf(PositionsFileName, name),
 			Dir:  ResultsFileDir,
 			Type: ResultsFileType,
-		}, []string{"Time", "Asset", "Qty", "Price"}),
+		}, []string{"Time", "Asset", "Qty", "Price", "CostBasis", "MarketValue", "UnrealisedPnL"}),
+		EquityWriter: ds.NewCSVWriter(ds.File{
+			Name: fmt.Sprintf(EquityFileName, name),
+			Dir:  ResultsFileDir,
+			Type: ResultsFileType,
+		}, []string{"Time", "Cash", "MarketValue", "Equity", "RealisedPnL", "UnrealisedPnL"}),
+		HaltWriter: ds.NewCSVWriter(ds.File{
+			Name: fmt.Sprintf(HaltsFileName, name),
+			Dir:  ResultsFileDir,
+			Type: ResultsFileType,
+		}, []string{"Time", "Reason", "Equity"}),
 	}
 }
 
+// NewMemoryPortfolio builds a portfolio that writes no files: its execution
+// history and equity curve stay in memory (e.g. for parameter sweeps)
+func NewMemoryPortfolio(name string, cash float64) *Portfolio {
+	p := NewPortfolio(name, cash)
+	p.OrderWriter, p.PositionWriter, p.EquityWriter, p.HaltWriter = nil, nil, nil, nil
+	return p
+}
+
 func (p *Portfolio) Assets() []t.Asset {
 	assets := make([]t.Asset, 0, len(p.Positions))
 	for a := range p.Positions {
@@ -85,9 +154,12 @@ func (p *Portfolio) SaveToJSON() error {
 		po[a.String()] = v // define Asset.String() to return a stable key (e.g., "NASDAQ:AAPL")
 	}
 	data, err := json.MarshalIndent(portfolioJSON{
-		Name:      p.Name,
-		Cash:      p.Cash,
-		Positions: po,
+		Name:        p.Name,
+		Cash:        p.Cash,
+		Positions:   po,
+		CostBasis:   keyByString(p.CostBasis),
+		RealisedPnL: p.RealisedPnL,
+		LastPrices:  keyByString(p.LastPrices),
 	}, "", "  ")
 	if err != nil {
 		return err
@@ -113,10 +185,32 @@ func LoadPortfolioFromJSON(name string) (*Portfolio, error) {
 	for k, v := range pJ.Positions {
 		p.Positions[t.AssetFromString(k)] = v
 	}
+	for k, v := range pJ.CostBasis {
+		p.CostBasis[t.AssetFromString(k)] = v
+	}
+	for k, v := range pJ.LastPrices {
+		p.LastPrices[t.AssetFromString(k)] = v
+	}
+	p.RealisedPnL = pJ.RealisedPnL
 	return &p, nil
 }
 
+// keyByString re-keys an asset map by Asset.String() for JSON (nil if empty)
+func keyByString(m map[t.Asset]float64) map[string]float64 {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]float64, len(m))
+	for a, v := range m {
+		out[a.String()] = v
+	}
+	return out
+}
+
 func (p *Portfolio) FlushOrdersToFile() error {
+	if p.OrderWriter == nil {
+		return nil // in memory: keep the history
+	}
 	if err := p.OrderWriter.Write(p.ExecutionHistory); err != nil {
 		return err
 	}
@@ -124,16 +218,26 @@ func (p *Portfolio) FlushOrdersToFile() error {
 	return nil
 }
 
-func (p *Portfolio) FlushPositionsToFile() error {
-	now := time.Now().UTC()
-	for asset, qty := range p.Positions {
-		price := 0.0 // TODO: send requests for price
-		record := PositionRecord{
-			Time:  now,
-			Asset: asset,
-			Qty:   qty,
-			Price: price,
+// ClearResults removes the portfolio's result CSVs, so the next session's
+// rows don't follow on from the last one's (e.g. when rerunning a backtest)
+func (p *Portfolio) ClearResults() error {
+	for _, w := range []ds.Writer{p.OrderWriter, p.PositionWriter, p.EquityWriter, p.HaltWriter} {
+		if w == nil {
+			continue
 		}
+		if err := os.Remove(ds.AbsolutePath(w.Path())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes a row per position, valued at the latest marks
+func (p *Portfolio) FlushPositionsToFile() error {
+	if p.PositionWriter == nil {
+		return nil
+	}
+	for _, record := range p.PositionRecords() {
 		slice := []PositionRecord{record}
 		if err := p.PositionWriter.Write(slice); err != nil {
 			return err
@@ -141,3 +245,121 @@ func (p *Portfolio) FlushPositionsToFile() error {
 	}
 	return nil
 }
+
+// PositionRecords values each position at the latest marks, by symbol
+func (p *Portfolio) PositionRecords() []PositionRecord {
+	ts := p.MarkedAt
+	if ts.IsZero() {
+		ts = p.Clock.Now().UTC()
+	}
+	records := make([]PositionRecord, 0, len(p.Positions))
+	for asset, qty := range p.Positions {
+		price := p.LastPrices[asset]
+		records = append(records, PositionRecord{
+			Time:          ts,
+			Asset:         asset,
+			Qty:           qty,
+			Price:         price,
+			CostBasis:     p.CostBasis[asset],
+			MarketValue:   qty * price,
+			UnrealisedPnL: p.unrealisedPnL(asset),
+		})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Asset.Symbol < records[j].Asset.Symbol })
+	return records
+}
+
+// ----------- VALUATION -----------
+
+// BarFetcher is anything that can fetch the bar covering a time, e.g. a Trader
+type BarFetcher interface {
+	FetchBarAt(ctx context.Context, asset t.Asset, ts time.Time) (t.Bar, bool, error)
+}
+
+// MarkToMarket updates the latest price of every held asset from the bar at ts.
+// Assets without a bar keep their previous mark.
+func (p *Portfolio) MarkToMarket(ctx context.Context, bars BarFetcher, ts time.Time) error {
+	var errs []error
+	for asset, qty := range p.Positions {
+		if qty == 0 {
+			continue
+		}
+		bar, ok, err := bars.FetchBarAt(ctx, asset, ts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("mark %s: %w", asset.Symbol, err))
+			continue
+		}
+		if ok && bar.Close > 0 {
+			p.LastPrices[asset] = bar.Close
+		}
+	}
+	p.MarkedAt = ts.UTC()
+	return errors.Join(errs...)
+}
+
+// MarketValue is the value of all holdings at their latest marks
+func (p *Portfolio) MarketValue() float64 {
+	total := 0.0
+	for asset, qty := range p.Positions {
+		total += qty * p.LastPrices[asset]
+	}
+	return total
+}
+
+// Equity is cash plus the market value of holdings
+func (p *Portfolio) Equity() float64 {
+	return p.Cash + p.MarketValue()
+}
+
+// UnrealisedPnL is the gain on held quantity vs its average cost
+func (p *Portfolio) UnrealisedPnL() float64 {
+	total := 0.0
+	for asset := range p.Positions {
+		total += p.unrealisedPnL(asset)
+	}
+	return total
+}
+
+func (p *Portfolio) unrealisedPnL(asset t.Asset) float64 {
+	price, ok := p.LastPrices[asset]
+	if !ok {
+		return 0 // never marked: no view on its value
+	}
+	return p.Positions[asset] * (price - p.CostBasis[asset])
+}
+
+// RecordEquity appends a point to the equity curve at ts, flushing to file as needed
+func (p *Portfolio) RecordEquity(ts time.Time) error {
+	mv := p.MarketValue()
+	p.EquityHistory = append(p.EquityHistory, EquityRecord{
+		Time:          ts.UTC(),
+		Cash:          p.Cash,
+		MarketValue:   mv,
+		Equity:        p.Cash + mv,
+		RealisedPnL:   p.RealisedPnL,
+		UnrealisedPnL: p.UnrealisedPnL(),
+	})
+	if len(p.EquityHistory) >= MaxEquityHistory {
+		return p.FlushEquityToFile()
+	}
+	return nil
+}
+
+// RecordHalt writes why trading on the portfolio halted at ts
+func (p *Portfolio) RecordHalt(ts time.Time, reason string) error {
+	if p.HaltWriter == nil {
+		return nil
+	}
+	return p.HaltWriter.Write([]HaltRecord{{Time: ts.UTC(), Reason: reason, Equity: p.Equity()}})
+}
+
+func (p *Portfolio) FlushEquityToFile() error {
+	if len(p.EquityHistory) == 0 || p.EquityWriter == nil {
+		return nil
+	}
+	if err := p.EquityWriter.Write(p.EquityHistory); err != nil {
+		return err
+	}
+	p.EquityHistory = []EquityRecord{}
+	return nil
+}
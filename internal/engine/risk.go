@@ -0,0 +1,254 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// RiskLimits are pre-trade limits on a portfolio; zero values are unlimited
+type RiskLimits struct {
+	MaxPosition        float64 // value held in any one asset
+	MaxGrossExposure   float64 // value held across all assets, longs & shorts alike
+	MaxOrderNotional   float64 // value of a single order
+	MaxOrdersPerMinute int     // orders approved in any trailing minute
+	MaxDailyLoss       float64 // equity lost since the exchange day began; then only risk-reducing orders
+	NoShorting         bool    // sells may not take a position below zero
+}
+
+// IsZero reports whether no limit is set
+func (l RiskLimits) IsZero() bool { return l == RiskLimits{} }
+
+// RiskVerdict is the outcome of a pre-trade check
+type RiskVerdict int
+
+const (
+	RiskApproved RiskVerdict = iota
+	RiskResized
+	RiskRejected
+)
+
+func (v RiskVerdict) String() string {
+	switch v {
+	case RiskApproved:
+		return "approved"
+	case RiskResized:
+		return "resized"
+	case RiskRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// RiskDecision records what the risk manager did with a signal
+type RiskDecision struct {
+	Time    time.Time
+	Asset   t.Asset
+	Action  t.Action
+	Qty     float64 // as signalled
+	Allowed float64 // as approved (0 if rejected)
+	Verdict RiskVerdict
+	Reasons []string // the limits that cut the order
+}
+
+func (d RiskDecision) String() string {
+	desc := fmt.Sprintf("Risk %s %s %v %s", d.Verdict, d.Action, d.Qty, d.Asset.Symbol)
+	if d.Verdict == RiskResized {
+		desc += fmt.Sprintf(" to %v", d.Allowed)
+	}
+	if len(d.Reasons) > 0 {
+		desc += ": " + strings.Join(d.Reasons, "; ")
+	}
+	return desc
+}
+
+// RiskManager checks signals against a portfolio's limits before they reach
+// the trader, rejecting them or shrinking them to fit. Checks use the tick's
+// time & the signal's bar, so they behave the same in backtest, paper and live.
+type RiskManager struct {
+	Limits RiskLimits
+	// Called with every decision (default: printed)
+	Log func(RiskDecision)
+
+	recent   []time.Time // approvals in the trailing minute
+	day      time.Time   // exchange day the loss limit is measured over
+	dayStart float64     // equity when it began
+	loc      *time.Location
+}
+
+func NewRiskManager(limits RiskLimits) *RiskManager {
+	loc, err := time.LoadLocation(cfg.ExchangeTimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return &RiskManager{
+		Limits: limits,
+		Log:    func(d RiskDecision) { fmt.Println(d) },
+		loc:    loc,
+	}
+}
+
+// Check sizes sig to fit the limits, given the portfolio and its open orders
+// (whose remaining quantity counts as already held). It returns the signal
+// to send and false if nothing may be sent.
+func (rm *RiskManager) Check(p *Portfolio, open []t.Order, sig t.Signal, ts time.Time) (t.Signal, bool) {
+	d := RiskDecision{Time: ts, Asset: sig.Bar.Asset, Action: sig.Action, Qty: sig.Qty, Allowed: sig.Qty}
+	rm.OnTick(p, ts)
+	rm.evaluate(p, open, sig, ts, &d)
+
+	// Whole-share signals stay whole
+	if sig.Qty == math.Trunc(sig.Qty) {
+		d.Allowed = math.Floor(d.Allowed + qtyEpsilon)
+	}
+	switch {
+	case d.Allowed <= qtyEpsilon:
+		d.Verdict, d.Allowed = RiskRejected, 0
+	case d.Allowed < sig.Qty-qtyEpsilon:
+		d.Verdict = RiskResized
+	default:
+		d.Verdict, d.Allowed = RiskApproved, sig.Qty
+	}
+	if rm.Log != nil {
+		rm.Log(d)
+	}
+	if d.Verdict == RiskRejected {
+		return sig, false
+	}
+	if rm.Limits.MaxOrdersPerMinute > 0 {
+		rm.recent = append(rm.recent, ts)
+	}
+	sig.Qty = d.Allowed
+	return sig, true
+}
+
+func (rm *RiskManager) evaluate(p *Portfolio, open []t.Order, sig t.Signal, ts time.Time, d *RiskDecision) {
+	l := rm.Limits
+	asset := sig.Bar.Asset
+	limit := func(qty float64, reason string, args ...any) {
+		if qty < d.Allowed {
+			d.Allowed = max(qty, 0)
+			d.Reasons = append(d.Reasons, fmt.Sprintf(reason, args...))
+		}
+	}
+
+	if sig.Action != t.Buy && sig.Action != t.Sell {
+		return // left to the trader to refuse
+	}
+	price := riskPrice(sig)
+	if price <= 0 {
+		d.Allowed = 0
+		d.Reasons = append(d.Reasons, "no price to value the order at")
+		return
+	}
+	side := 1.0
+	if sig.Action == t.Sell {
+		side = -1
+	}
+	held := committed(p, open, asset)
+	// An order that only shrinks the position never adds risk
+	reducing := held*side < 0
+	reducible := math.Abs(held) // quantity it can trade before adding risk
+
+	if l.MaxOrdersPerMinute > 0 {
+		cutoff := ts.Add(-time.Minute)
+		kept := rm.recent[:0]
+		for _, at := range rm.recent {
+			if at.After(cutoff) {
+				kept = append(kept, at)
+			}
+		}
+		rm.recent = kept
+		if len(rm.recent) >= l.MaxOrdersPerMinute {
+			limit(0, "%d orders in the last minute (max %d)", len(rm.recent), l.MaxOrdersPerMinute)
+		}
+	}
+
+	if l.MaxOrderNotional > 0 {
+		limit(l.MaxOrderNotional/price, "order notional %.2f over max %.2f", sig.Qty*price, l.MaxOrderNotional)
+	}
+
+	if l.NoShorting && sig.Action == t.Sell {
+		limit(max(held, 0), "no shorting: %v held or on order", held)
+	}
+
+	if l.MaxDailyLoss > 0 {
+		if loss := rm.dayStart - p.Equity(); loss >= l.MaxDailyLoss {
+			if reducing {
+				limit(reducible, "daily loss %.2f over max %.2f: only reducing", loss, l.MaxDailyLoss)
+			} else {
+				limit(0, "daily loss %.2f over max %.2f", loss, l.MaxDailyLoss)
+			}
+		}
+	}
+
+	if l.MaxPosition > 0 {
+		// Room to trade: back to flat, then out to the limit on the other side
+		room := l.MaxPosition / price
+		if reducing {
+			room += reducible
+		} else {
+			room -= reducible
+		}
+		limit(room, "position value %.2f over max %.2f", math.Abs(held+side*sig.Qty)*price, l.MaxPosition)
+	}
+
+	if l.MaxGrossExposure > 0 {
+		gross := 0.0
+		for a, qty := range p.Positions {
+			if a != asset {
+				gross += math.Abs(qty) * p.LastPrices[a]
+			}
+		}
+		room := (l.MaxGrossExposure - gross) / price
+		if reducing {
+			room = max(room+reducible, reducible)
+		} else {
+			room -= reducible
+		}
+		limit(room, "gross exposure %.2f over max %.2f", gross+math.Abs(held+side*sig.Qty)*price, l.MaxGrossExposure)
+	}
+}
+
+// OnTick records the equity the daily loss limit counts from, at the
+// first tick of each exchange day
+func (rm *RiskManager) OnTick(p *Portfolio, ts time.Time) {
+	y, m, d := ts.In(rm.loc).Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, rm.loc)
+	if !day.Equal(rm.day) {
+		rm.day, rm.dayStart = day, p.Equity()
+	}
+}
+
+// The price an order is valued at: its limit (or stop) price, else the bar close
+func riskPrice(sig t.Signal) float64 {
+	switch {
+	case sig.LimitPrice > 0:
+		return sig.LimitPrice
+	case sig.StopPrice > 0:
+		return sig.StopPrice
+	default:
+		return sig.Bar.Close
+	}
+}
+
+// The position in asset once every open order fills
+func committed(p *Portfolio, open []t.Order, asset t.Asset) float64 {
+	held := p.Positions[asset]
+	for _, o := range open {
+		if o.Asset != asset {
+			continue
+		}
+		switch o.Action {
+		case t.Buy:
+			held += o.Remaining()
+		case t.Sell:
+			held -= o.Remaining()
+		}
+	}
+	return held
+}
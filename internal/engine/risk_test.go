@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRiskManager_Limits(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	bar := testBar(ts, 100, 100, 100, 100, 1000)
+	msft := types.NewAsset("MSFT", "IEX", "stock")
+	buy := func(qty float64) types.Signal { return types.Signal{Bar: bar, Action: types.Buy, Qty: qty} }
+	sell := func(qty float64) types.Signal { return types.Signal{Bar: bar, Action: types.Sell, Qty: qty} }
+
+	cases := []struct {
+		name    string
+		limits  RiskLimits
+		held    float64 // AAPL
+		open    []types.Order
+		sig     types.Signal
+		allowed float64
+		verdict RiskVerdict
+	}{
+		{"unlimited", RiskLimits{}, 0, nil, buy(10), 10, RiskApproved},
+		{"order notional resizes", RiskLimits{MaxOrderNotional: 550}, 0, nil, buy(10), 5, RiskResized},
+		{"position counts holdings", RiskLimits{MaxPosition: 1000}, 8, nil, buy(5), 2, RiskResized},
+		{"position counts open orders", RiskLimits{MaxPosition: 1000}, 0,
+			[]types.Order{{Asset: testAsset, Action: types.Buy, Qty: 10, Status: types.OrderNew}}, buy(5), 0, RiskRejected},
+		{"position reducing is allowed", RiskLimits{MaxPosition: 1000}, 20, nil, sell(20), 20, RiskApproved},
+		{"no shorting", RiskLimits{NoShorting: true}, 3, nil, sell(5), 3, RiskResized},
+		{"no shorting flat", RiskLimits{NoShorting: true}, 0, nil, sell(5), 0, RiskRejected},
+		{"gross exposure", RiskLimits{MaxGrossExposure: 2000}, 0, nil, buy(20), 15, RiskResized}, // 500 of MSFT held
+		{"fractional stays fractional", RiskLimits{MaxOrderNotional: 250}, 0, nil, buy(3.5), 2.5, RiskResized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewMemoryPortfolio("UnitTestRisk", 100000)
+			p.Positions[testAsset] = tc.held
+			p.Positions[msft] = 5
+			p.LastPrices[testAsset], p.LastPrices[msft] = 100, 100
+
+			var logged []RiskDecision
+			rm := NewRiskManager(tc.limits)
+			rm.Log = func(d RiskDecision) { logged = append(logged, d) }
+
+			sig, ok := rm.Check(p, tc.open, tc.sig, ts)
+			require.Len(t, logged, 1, "every decision is logged")
+			require.Equal(t, tc.verdict, logged[0].Verdict)
+			require.Equal(t, tc.allowed, logged[0].Allowed)
+			require.Equal(t, tc.verdict != RiskRejected, ok)
+			if ok {
+				require.Equal(t, tc.allowed, sig.Qty)
+			}
+			if tc.verdict != RiskApproved {
+				require.NotEmpty(t, logged[0].Reasons)
+			}
+		})
+	}
+}
+
+func TestRiskManager_OrdersPerMinuteAndDailyLoss(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	bar := testBar(ts, 100, 100, 100, 100, 1000)
+	p := NewMemoryPortfolio("UnitTestRiskRate", 10000)
+	rm := NewRiskManager(RiskLimits{MaxOrdersPerMinute: 2, MaxDailyLoss: 500})
+	rm.Log = nil
+
+	buy := types.Signal{Bar: bar, Action: types.Buy, Qty: 1}
+	rm.OnTick(p, ts)
+	for i, want := range []bool{true, true, false} {
+		_, ok := rm.Check(p, nil, buy, ts.Add(time.Duration(i)*10*time.Second))
+		require.Equal(t, want, ok, i)
+	}
+	_, ok := rm.Check(p, nil, buy, ts.Add(61*time.Second)) // the first has aged out
+	require.True(t, ok)
+
+	// Down 600 on the day: only sells that reduce the position get through
+	p.Positions[testAsset], p.LastPrices[testAsset] = 10, 100
+	p.Cash -= 1600
+	rm.Limits.MaxOrdersPerMinute = 0
+	_, ok = rm.Check(p, nil, buy, ts.Add(2*time.Minute))
+	require.False(t, ok)
+	sig, ok := rm.Check(p, nil, types.Signal{Bar: bar, Action: types.Sell, Qty: 15}, ts.Add(2*time.Minute))
+	require.True(t, ok)
+	require.Equal(t, 10.0, sig.Qty)
+
+	// A new exchange day starts the count again
+	next := ts.Add(24 * time.Hour)
+	rm.OnTick(p, next)
+	_, ok = rm.Check(p, nil, buy, next)
+	require.True(t, ok)
+}
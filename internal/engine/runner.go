@@ -2,7 +2,10 @@ package engine
 
 import (
 	ctx "context"
+	"errors"
 	"fmt"
+	"math"
+	"time"
 
 	st "github.com/joshskilla/trading-bot/internal/strategy"
 	t "github.com/joshskilla/trading-bot/internal/types"
@@ -13,22 +16,96 @@ type Runner struct {
 	Trader    Trader
 	Strategy  st.Strategy
 	Ticks     chan t.Tick
+
+	// Live & paper sessions: save state after every fill and
+	// keep GTC orders open across restarts
+	Persist bool
+
+	// Pre-trade limits every signal must pass (nil => none)
+	Risk *RiskManager
+
+	// Halts trading when tripped (nil => only manual halts)
+	Breaker *CircuitBreaker
+	// Checkpoint the strategy's state is saved to on a halt ("" => not saved)
+	CheckpointID string
+	// Registry name the strategy was built from, to rebuild it with new
+	// parameters ("" => matched against the strategy's Name)
+	StrategyType string
+
+	// Receives the runner's ticks, fills & halts (nil => none published)
+	Events *EventBus
+
+	history  *marketHistory    // bars shown to the strategy, built up tick by tick
+	watched  []t.Asset         // subscribed to on request, beyond MarketAssets
+	fills    []ExecutionRecord // the latest MaxRecentExecutions, for the console
+	halts    chan string       // manual halt requests
+	halted   string            // why trading halted ("" => trading)
+	paused   bool              // no trading until resumed
+	lastTick time.Time
+
+	requests chan func(ctx.Context) // run on the runner's goroutine between ticks
+	stopped  chan struct{}          // closed once Run returns
 }
 
 const MaxExecutionHistory = 10
 
+// Fills a runner keeps in memory for the console, whatever has been flushed
+const MaxRecentExecutions = 100
+
 func NewRunner(p *Portfolio, t Trader, s st.Strategy, ch chan t.Tick) *Runner {
 	return &Runner{
 		Portfolio: p,
 		Trader:    t,
 		Strategy:  s,
 		Ticks:     ch,
+		halts:     make(chan string, 1),
+		requests:  make(chan func(ctx.Context)),
+		stopped:   make(chan struct{}),
 	}
 }
 
+// ErrRunnerStopped is returned for requests to a runner that has finished
+var ErrRunnerStopped = errors.New("runner has stopped")
+
+// Do runs fn on the runner's goroutine between ticks, so it may read and
+// change the runner's state safely, and waits for it to finish
+func (r *Runner) Do(c ctx.Context, fn func(ctx.Context)) error {
+	done := make(chan struct{})
+	req := func(c ctx.Context) {
+		defer close(done)
+		fn(c)
+	}
+	select {
+	case r.requests <- req:
+	case <-r.stopped:
+		return ErrRunnerStopped
+	case <-c.Done():
+		return c.Err()
+	}
+	<-done // runs to completion once taken
+	return nil
+}
+
+// Halt stops the runner trading, as if its circuit breaker had tripped.
+// Safe to call from any goroutine.
+func (r *Runner) Halt(reason string) {
+	select {
+	case r.halts <- reason:
+	default: // a halt is already pending
+	}
+}
+
+// Halted returns why the runner stopped trading, if it has
+func (r *Runner) Halted() (string, bool) {
+	return r.halted, r.halted != ""
+}
+
 func (r *Runner) Run(ctx ctx.Context) {
 	// Cleanup on exit
 	defer func() {
+		if r.stopped != nil {
+			close(r.stopped)
+		}
 		r.Trader.Close() // ensure trader resources are cleaned up
 		fmt.Printf("Trader closed for strategy %s on portfolio %s\n", r.Strategy.Name(), r.Portfolio.Name)
 	}()
@@ -37,36 +114,212 @@ func (r *Runner) Run(ctx ctx.Context) {
 		select {
 		case <-ctx.Done():
 			// Runner cancelled:
+			// Cancel open orders
 			// Flush remaining executions before exit
-			// (Cancel live orders TODO)
 			// Stop the runner
-			if len(r.Portfolio.ExecutionHistory) > 0 {
-				r.Portfolio.FlushOrdersToFile()
-			}
+			r.cancelOpenOrders("session cancelled")
+			r.flush()
 			fmt.Printf("Shut down strategy %s on portfolio %s...\n", r.Strategy.Name(), r.Portfolio.Name)
 			return
+		case reason := <-r.halts:
+			r.manualHalt(ctx, reason)
+		case req := <-r.requests:
+			req(ctx)
 		case t, ok := <-r.Ticks:
 			if !ok {
 				// Completed ticks (channel closed):
-				// (Wait on live orders TODO)
-				if len(r.Portfolio.ExecutionHistory) > 0 {
-					r.Portfolio.FlushOrdersToFile()
-				}
+				// No more market data to match against: cancel open orders
+				r.cancelOpenOrders("session ended")
+				r.flush()
 				fmt.Printf("Finished processing for strategy %s on portfolio %s...\n", r.Strategy.Name(), r.Portfolio.Name)
 				return
 			}
-			r.Strategy.OnTick(t)
-			for _, sig := range r.Strategy.GenerateSignals() {
-				execRecord, ok := r.Trader.Execute(r.Portfolio, sig)
-				if !ok {
-					continue
-				}
-				r.Portfolio.ExecutionHistory = append(r.Portfolio.ExecutionHistory, execRecord)
-				if len(r.Portfolio.ExecutionHistory) >= MaxExecutionHistory {
-					r.Portfolio.FlushOrdersToFile()
+			r.lastTick = t.Time
+			r.syncClock(t.Time)
+			// A halt requested before this tick stops it being traded
+			select {
+			case reason := <-r.halts:
+				r.manualHalt(ctx, reason)
+			default:
+			}
+			// Resting orders get first go at the new bar
+			r.record(r.Trader.ProcessOrders(ctx, r.Portfolio, t.Time)...)
+
+			// Once halted (or while paused), the market is still followed but no longer traded
+			mc := r.marketContext(ctx, t)
+			if r.halted == "" && !r.paused {
+				r.trade(mc)
+			}
+
+			// Value the portfolio as of this tick
+			if err := r.Portfolio.MarkToMarket(ctx, r.Trader, t.Time); err != nil {
+				fmt.Printf("Failed to mark portfolio %s to market: %v\n", r.Portfolio.Name, err)
+			}
+			if err := r.Portfolio.RecordEquity(t.Time); err != nil {
+				fmt.Printf("Failed to write equity for %s: %v\n", r.Portfolio.Name, err)
+			}
+			r.Events.Publish(Event{Type: "tick", Portfolio: r.Portfolio.Name, Time: t.Time, Equity: r.Portfolio.Equity(), Cash: r.Portfolio.Cash})
+
+			if r.Breaker != nil && r.halted == "" {
+				if reason, trip := r.Breaker.Check(r.Portfolio, mc); trip {
+					r.halt(ctx, reason, t.Time)
 				}
-				r.Portfolio.FlushPositionsToFile()
 			}
 		}
 	}
 }
+
+// Moves a simulated trader's clock to the tick, and has the portfolio tell
+// the time by it, so what they stamp is in market time
+func (r *Runner) syncClock(ts time.Time) {
+	c, ok := r.Trader.(clocked)
+	if !ok {
+		return
+	}
+	if sim, ok := c.clock().(*t.SimClock); ok {
+		sim.Set(ts)
+		r.Portfolio.Clock = sim
+	}
+}
+
+// Passes the tick to the strategy and its signals, once past risk, to the trader
+func (r *Runner) trade(mc *st.MarketContext) {
+	r.Strategy.OnTick(mc)
+	if r.Risk != nil {
+		r.Risk.OnTick(r.Portfolio, mc.Tick.Time)
+	}
+	for _, sig := range r.Strategy.GenerateSignals() {
+		if r.Risk != nil {
+			var ok bool
+			if sig, ok = r.Risk.Check(r.Portfolio, r.Trader.Orders().Open(), sig, mc.Tick.Time); !ok {
+				continue
+			}
+		}
+		execRecord, ok := r.Trader.Execute(r.Portfolio, sig)
+		if !ok {
+			continue
+		}
+		r.record(execRecord)
+	}
+}
+
+// Stops the runner trading: cancels its open orders, optionally closes its
+// positions, then records why and saves its state
+func (r *Runner) halt(ctx ctx.Context, reason string, ts time.Time) {
+	r.halted = reason
+	fmt.Printf("HALTED strategy %s on portfolio %s: %s\n", r.Strategy.Name(), r.Portfolio.Name, reason)
+
+	cancelled, execs := r.Trader.CancelOrders("halted: " + reason)
+	r.record(execs...)
+	for _, o := range cancelled {
+		fmt.Printf("Cancelled %s (halted)\n", o.Pretty())
+	}
+	if r.Breaker != nil && r.Breaker.Limits.Flatten {
+		r.flatten(ctx, ts)
+	}
+
+	r.Events.Publish(Event{Type: "halt", Portfolio: r.Portfolio.Name, Time: ts, Reason: reason})
+	if err := r.Portfolio.RecordHalt(ts, reason); err != nil {
+		fmt.Printf("Failed to record halt for %s: %v\n", r.Portfolio.Name, err)
+	}
+	r.flush()
+	if !r.Persist {
+		return
+	}
+	if err := r.Portfolio.SaveToJSON(); err != nil {
+		fmt.Printf("Failed to save portfolio %s: %v\n", r.Portfolio.Name, err)
+	}
+	if cp, ok := r.Strategy.(st.Checkpointer); ok && r.CheckpointID != "" {
+		if err := cp.Checkpoint(r.CheckpointID).SaveToJSON(); err != nil {
+			fmt.Printf("Failed to save checkpoint %s: %v\n", r.CheckpointID, err)
+		}
+	}
+}
+
+func (r *Runner) manualHalt(ctx ctx.Context, reason string) {
+	if r.halted == "" {
+		r.halt(ctx, "manual: "+reason, r.lastTick)
+	}
+}
+
+// Sends a market order closing each position
+func (r *Runner) flatten(ctx ctx.Context, ts time.Time) {
+	for asset := range r.Portfolio.Positions {
+		if err := r.flattenAsset(ctx, asset, ts); err != nil {
+			fmt.Printf("Can't flatten %s: %v\n", asset.Symbol, err)
+		}
+	}
+}
+
+// Sends a market order closing the position in asset, at the latest bar seen for it
+func (r *Runner) flattenAsset(ctx ctx.Context, asset t.Asset, ts time.Time) error {
+	qty := r.Portfolio.Positions[asset]
+	if math.Abs(qty) <= qtyEpsilon {
+		return nil
+	}
+	bar, ok, err := r.Trader.FetchBarAt(ctx, asset, ts)
+	if !ok && r.history != nil {
+		if h := r.history.bars[asset]; len(h) > 0 {
+			bar, ok = h[len(h)-1], true
+		}
+	}
+	if !ok {
+		return fmt.Errorf("no market data to price %v %s (%v)", qty, asset.Symbol, err)
+	}
+	sig := t.Signal{Time: ts, Bar: bar, Action: t.Sell, Qty: qty}
+	if qty < 0 {
+		sig.Action, sig.Qty = t.Buy, -qty
+	}
+	if execRecord, ok := r.Trader.Execute(r.Portfolio, sig); ok {
+		r.record(execRecord)
+	}
+	return nil
+}
+
+// Flushes remaining executions, the equity curve and final positions before exit
+func (r *Runner) flush() {
+	if len(r.Portfolio.ExecutionHistory) > 0 {
+		r.Portfolio.FlushOrdersToFile()
+	}
+	if err := r.Portfolio.FlushEquityToFile(); err != nil {
+		fmt.Printf("Failed to write equity for %s: %v\n", r.Portfolio.Name, err)
+	}
+	r.Portfolio.FlushPositionsToFile()
+}
+
+// Appends executions to the portfolio's history, flushing to file as needed
+func (r *Runner) record(execs ...ExecutionRecord) {
+	if len(execs) == 0 {
+		return
+	}
+	r.Portfolio.ExecutionHistory = append(r.Portfolio.ExecutionHistory, execs...)
+	for _, exec := range execs {
+		r.Events.Publish(Event{Type: "fill", Portfolio: r.Portfolio.Name, Time: exec.Time, Fill: &exec})
+	}
+	r.fills = append(r.fills, execs...)
+	if n := len(r.fills) - MaxRecentExecutions; n > 0 {
+		r.fills = append([]ExecutionRecord(nil), r.fills[n:]...)
+	}
+	if r.Persist || len(r.Portfolio.ExecutionHistory) >= MaxExecutionHistory {
+		r.Portfolio.FlushOrdersToFile()
+	}
+	r.Portfolio.FlushPositionsToFile()
+	if r.Persist {
+		if err := r.Portfolio.SaveToJSON(); err != nil {
+			fmt.Printf("Failed to save portfolio %s: %v\n", r.Portfolio.Name, err)
+		}
+	}
+}
+
+func (r *Runner) cancelOpenOrders(reason string) {
+	for _, o := range r.Trader.Orders().Open() {
+		if r.Persist && o.TIF == t.GTCTIF {
+			continue // resumes with the next session
+		}
+		c, execs, ok := r.Trader.CancelOrder(o.ID, reason)
+		r.record(execs...)
+		if ok {
+			fmt.Printf("Cancelled %s (%s)\n", c.Pretty(), reason)
+		}
+	}
+}
@@ -3,54 +3,89 @@ package engine
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
-	st "github.com/joshskilla/trading-bot/internal/strategy"
 	t "github.com/joshskilla/trading-bot/internal/types"
-	cfg "github.com/joshskilla/trading-bot/internal/config"
 )
 
 // Runs the trading session
-// Coordinates the runners, tick generators, trader, and live command inputs
-func Run(portfolio *Portfolio, strat st.Strategy, trader Trader, isTest bool, start time.Time, end time.Time) error {
+// Coordinates the console's runners, tick generators, trader, and live command inputs
+// Every runner is driven by the same ticks, so their strategies must share a tick interval
+func Run(console *Console, isTest bool, start time.Time, end time.Time, tradingHours t.TradingHours) error {
+	if isTest {
+		return RunWithTicks(console, t.GenerateTestTicks, t.NewSimClock(start), false, start, end, tradingHours)
+	}
+	return RunWithTicks(console, t.GenerateLiveTicks, t.RealClock{}, true, start, end, tradingHours)
+}
+
+// Runs the trading session on ticks from tickGen (e.g. t.ReplayTicks) as
+// clock tells the time, saving portfolios & orders as it goes if persist is set
+func RunWithTicks(console *Console, tickGen t.TickGenerator, clock t.Clock, persist bool, start time.Time, end time.Time, tradingHours t.TradingHours) error {
+	runners := console.Runners()
+	if len(runners) == 0 {
+		return errors.New("no runners in session")
+	}
+	tickInterval := runners[0].Strategy.TickInterval()
+	for _, r := range runners[1:] {
+		if r.Strategy.TickInterval() != tickInterval {
+			return fmt.Errorf("strategy %s on portfolio %s ticks every %s, not %s like the rest of the session",
+				r.Strategy.Name(), r.Portfolio.Name, r.Strategy.TickInterval(), tickInterval)
+		}
+	}
 
 	ticks := make(chan t.Tick, 10)
-	tickInterval := strat.TickInterval()
-	runner := NewRunner(portfolio, trader, strat, ticks)
+	for _, r := range runners {
+		r.Ticks = make(chan t.Tick, 10)
+		r.Persist = persist
+	}
 
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(context.Background())
 	cmdChan := make(chan string)
-
-	var tickGen t.TickGenerator
-	if isTest {
-		tickGen = t.GenerateTestTicks
-	} else {
-		tickGen = t.GenerateLiveTicks
-	}
-
-	tradingHours := t.TradingHours{
-		OpenHour:    cfg.OpenHour,
-		OpenMinute:  cfg.OpenMinute,
-		CloseHour:   cfg.ClosingHour,
-		CloseMinute: cfg.ClosingMinute,
-		WeekendsOff: true,
-		ExchangeTZ:  cfg.ExchangeTimeZone,
-	}
+	console.mu.Lock()
+	console.shutdown = cancel // e.g. from the HTTP API
+	console.mu.Unlock()
 
 	// Generate ticks for runner(s)
 	go func() {
 		defer close(ticks)
-		tickGen(ctx, ticks, start, end, tickInterval, tradingHours)
+		tickGen(ctx, clock, ticks, start, end, tickInterval, tradingHours)
+	}()
+
+	// Fan each tick out to every runner
+	go func() {
+		defer func() {
+			for _, r := range runners {
+				close(r.Ticks)
+			}
+		}()
+		for tick := range ticks {
+			for _, r := range runners {
+				select {
+				case r.Ticks <- tick:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
 	}()
 
 	// Run runner(s)
-	wg.Go(func() {
-		runner.Run(ctx)
-	})
+	// Session ends once runner(s) complete (e.g. backtest ticks exhausted)
+	for _, r := range runners {
+		wg.Go(func() {
+			r.Run(ctx)
+		})
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
 
 	// Command line input goroutine
 	go func() {
@@ -64,13 +99,17 @@ func Run(portfolio *Portfolio, strat st.Strategy, trader Trader, isTest bool, st
 	// Main loop: handle live commands
 	for {
 		select {
-		case cmd := <-cmdChan:
-			if cmd == "--shutdown" {
-				cancel() // Signal runners to stop
-				fmt.Println("Shutting down trading-bot...")
-				return nil
+		case line := <-cmdChan:
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			cmd, err := ParseCommand(line)
+			if err != nil {
+				fmt.Println(err)
+				continue
 			}
-			// Other commands...
+			// Routed to the runners; shutdown cancels ctx, ending the session below
+			fmt.Println(console.Run(ctx, cmd))
 		case <-ctx.Done():
 			// Wait on runners to gracefully shut down
 			wg.Wait()
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// simBroker fills orders against market data using a FillModel.
+// Shared by the simulated traders; the order book holds resting orders.
+type simBroker struct {
+	Orders *OrderBook
+	Fills  *FillModel     // owned by the trader, so it can be configured after construction
+	loc    *time.Location // exchange time zone, for DAY expiry
+}
+
+func newSimBroker(fm *FillModel) *simBroker {
+	loc, err := time.LoadLocation(cfg.ExchangeTimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return &simBroker{Orders: NewOrderBook(), Fills: fm, loc: loc}
+}
+
+// submit records the signal as an order, returning it and whether it was accepted.
+func (b *simBroker) submit(sig t.Signal, now time.Time) (t.Order, bool) {
+	o := b.Orders.Submit(t.NewOrderFromSignal(sig), now)
+	if o.Status == t.OrderRejected {
+		fmt.Printf("Rejected %s: %s\n", o.Pretty(), o.Reason)
+		return o, false
+	}
+	return o, true
+}
+
+// fill executes as much of the order as the bar allows at reference price ref,
+// booking it against the portfolio. Orders the portfolio cannot honour are rejected.
+func (b *simBroker) fill(p *Portfolio, o t.Order, ref float64, bar t.Bar, stamp time.Time) (ExecutionRecord, bool) {
+	qty := b.Fills.fillableQty(o.Remaining(), bar)
+	if qty <= 0 {
+		return ExecutionRecord{}, false // no volume to fill against this bar
+	}
+	price, fee, slippage := b.Fills.Quote(o.Action, qty, ref, bar)
+	if isLimitType(o) {
+		// Never fill beyond the limit, whatever the slippage model says
+		if o.Action == t.Buy && price > o.LimitPrice || o.Action == t.Sell && price < o.LimitPrice {
+			price = o.LimitPrice
+			slippage = 0
+		}
+	}
+
+	exec, err := applyFill(p, stamp, o.Asset, o.Action, qty, price, fee, slippage)
+	if err != nil {
+		if r, ok := b.Orders.Reject(o.ID, err.Error(), stamp); ok {
+			fmt.Printf("Rejected %s: %s\n", r.Pretty(), r.Reason)
+		}
+		return ExecutionRecord{}, false
+	}
+	o.RecordFill(qty, price, stamp)
+	b.Orders.Update(o)
+	return exec, true
+}
+
+// match tries every open order against the latest bar for its asset,
+// expiring DAY orders from earlier sessions and cancelling unfilled IOC remainders.
+// Only bars starting at or after an order's creation are considered.
+func (b *simBroker) match(p *Portfolio, barFor func(t.Asset) (t.Bar, bool), stamp time.Time) []ExecutionRecord {
+	var execs []ExecutionRecord
+	for _, o := range b.Orders.Open() {
+		bar, ok := barFor(o.Asset)
+		if !ok || bar.Start.Before(o.Created) {
+			continue
+		}
+		if o.TIF == t.DayTIF && !sameTradingDay(o.Created, bar.Start, b.loc) {
+			b.Orders.Cancel(o.ID, "expired at end of day", stamp)
+			continue
+		}
+
+		wasTriggered := o.Triggered
+		filled := false
+		if ref, ok := matchOrder(&o, bar); ok {
+			var exec ExecutionRecord
+			if exec, filled = b.fill(p, o, ref, bar, stamp); filled {
+				execs = append(execs, exec)
+			}
+		}
+		if !filled && o.Triggered != wasTriggered {
+			// Keep the trigger, unless the fill attempt closed the order
+			if cur, ok := b.Orders.Get(o.ID); ok && cur.Status.IsOpen() {
+				b.Orders.Update(o)
+			}
+		}
+
+		if o.TIF == t.IOCTIF {
+			b.Orders.Cancel(o.ID, "immediate or cancel", stamp)
+		}
+	}
+	return execs
+}
@@ -2,9 +2,12 @@ package engine
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"os"
 	"time"
 
+	broker "github.com/joshskilla/trading-bot/internal/broker/alpaca"
 	"github.com/joshskilla/trading-bot/internal/marketdata/alpaca"
 	"github.com/joshskilla/trading-bot/internal/marketdata/finnhub"
 
@@ -13,23 +16,99 @@ import (
 )
 
 type Trader interface {
+	// Places the signal's order, true if (part) filled immediately
 	Execute(*Portfolio, t.Signal) (ExecutionRecord, bool)
+	// Matches resting orders against market data at ts, returning their fills
+	ProcessOrders(ctx context.Context, p *Portfolio, ts time.Time) []ExecutionRecord
+	// Cancels an open order, returning with it any fills that raced the cancellation
+	CancelOrder(id, reason string) (t.Order, []ExecutionRecord, bool)
+	CancelOrders(reason string) ([]t.Order, []ExecutionRecord) // cancels all open orders
+	Orders() *OrderBook
 	FetchBarAt(ctx context.Context, asset t.Asset, ts time.Time) (t.Bar, bool, error)
 	IncludeAssets(ctx context.Context, assets []t.Asset) error
 	Close() error // ensure streams/sessions are cleaned up, ensure idempotency
 }
 
+// Traders tell the time by their clock. A simulated one (backtests &
+// replays) is moved to each tick's time by the runner before it's handled.
+type clocked interface {
+	clock() t.Clock
+}
+
+// Backtest traders serve historical bars, the bar at a time being the one
+// holding it (still open then), rather than the last closed as streams do
+type historical interface {
+	barInterval() time.Duration
+}
+
 // ----------- LIVE TRADER -----------
+
+// LiveTrader routes orders to a real broker (Alpaca). Fills are only booked
+// against the portfolio once the broker confirms them, by polling order status.
 type LiveTrader struct {
 	Provider md.BarProvider
+	Broker   *broker.Client
+	Clock    t.Clock // stamps orders & fills, paces cancel confirmation
+	orders   *OrderBook
+
+	// Portfolio fills are booked to; bound by Reconcile/Execute/ProcessOrders
+	// so fills confirmed while cancelling are not lost
+	portfolio *Portfolio
 }
 
 // Ensure LiveTrader implements Trader
 var _ Trader = (*LiveTrader)(nil)
 
-func NewLiveTrader(ctx context.Context, interval time.Duration) *LiveTrader {
+const (
+	brokerTimeout     = 10 * time.Second       // per broker request
+	cancelConfirmWait = 200 * time.Millisecond // between polls confirming a cancel
+	cancelConfirmPoll = 10                     // polls before giving up on a cancel
+)
+
+// NewStreamProvider builds bars from Finnhub's trade stream (FINNHUB_API_KEY,
+// at FINNHUB_URL if set), backfilling any it misses while reconnecting from Alpaca's bars API if
+// ALPACA_API_KEY is set.
+func NewStreamProvider(interval time.Duration) *finnhub.Client {
 	cl := finnhub.NewClient(os.Getenv("FINNHUB_API_KEY"), interval)
-	return &LiveTrader{Provider: cl}
+	cl.URL = os.Getenv("FINNHUB_URL")
+	if key := os.Getenv("ALPACA_API_KEY"); key != "" {
+		cl.Backfill = alpaca.NewClient(key, os.Getenv("ALPACA_API_SECRET"), interval, time.Time{}, time.Time{})
+	}
+	cl.OnState = func(s finnhub.ConnState, err error) {
+		if err != nil {
+			fmt.Printf("Finnhub stream %s: %v\n", s, err)
+			return
+		}
+		fmt.Printf("Finnhub stream %s\n", s)
+	}
+	return cl
+}
+
+// NewLiveTrader trades through the Alpaca account in ALPACA_API_KEY/ALPACA_API_SECRET.
+// Orders go to ALPACA_TRADING_URL, defaulting to the paper trading API.
+func NewLiveTrader(ctx context.Context, interval time.Duration) *LiveTrader {
+	cl := NewStreamProvider(interval)
+	br := broker.NewClient(os.Getenv("ALPACA_TRADING_URL"), os.Getenv("ALPACA_API_KEY"), os.Getenv("ALPACA_API_SECRET"))
+	return NewLiveTraderWithBroker(cl, br)
+}
+
+// NewLiveTraderWithBroker trades through any Alpaca-compatible API (e.g. a mock broker).
+func NewLiveTraderWithBroker(prov md.BarProvider, br *broker.Client) *LiveTrader {
+	return &LiveTrader{Provider: prov, Broker: br, Clock: t.RealClock{}, orders: NewOrderBook()}
+}
+
+// TrackOrders restores the portfolio's open orders (with their broker IDs) from disk
+// and keeps the file up to date, so orders placed before a restart keep being polled.
+func (lt *LiveTrader) TrackOrders(portfolioName string) error {
+	return trackOrders(lt.orders, portfolioName)
+}
+
+// FetchSample returns the latest trade, if the data provider streams them
+func (lt *LiveTrader) FetchSample(ctx context.Context, asset t.Asset) (t.Sample, error) {
+	if sp, ok := lt.Provider.(md.SampleProvider); ok {
+		return sp.FetchSample(ctx, asset)
+	}
+	return t.Sample{}, fmt.Errorf("no trade feed for %s", asset.Symbol)
 }
 
 func (lt *LiveTrader) IncludeAssets(ctx context.Context, assets []t.Asset) error {
@@ -40,44 +119,336 @@ func (lt *LiveTrader) FetchBarAt(ctx context.Context, asset t.Asset, ts time.Tim
 	return lt.Provider.FetchBarAt(ctx, asset, ts)
 }
 
+// Reconcile binds the portfolio to the broker account and overwrites its positions,
+// cost basis and cash with the broker's, logging any differences. Broker positions
+// in assets the portfolio doesn't track are reported but left alone.
+func (lt *LiveTrader) Reconcile(ctx context.Context, p *Portfolio) error {
+	lt.portfolio = p
+	positions, err := lt.Broker.ListPositions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list broker positions: %w", err)
+	}
+	account, err := lt.Broker.GetAccount(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get broker account: %w", err)
+	}
+
+	held := make(map[string]float64, len(positions))
+	costs := make(map[string]float64, len(positions))
+	for _, bp := range positions {
+		qty, err := broker.ParseDecimal(bp.Qty)
+		if err != nil {
+			return fmt.Errorf("invalid broker position %s qty %q: %w", bp.Symbol, bp.Qty, err)
+		}
+		held[bp.Symbol] = qty
+		costs[bp.Symbol], _ = broker.ParseDecimal(bp.AvgEntryPrice)
+	}
+	for asset, qty := range p.Positions {
+		if b := held[asset.Symbol]; math.Abs(b-qty) > qtyEpsilon {
+			fmt.Printf("Reconcile %s: portfolio holds %v, broker holds %v\n", asset.Symbol, qty, b)
+			p.Positions[asset] = b
+		}
+		if cost := costs[asset.Symbol]; cost > 0 {
+			p.CostBasis[asset] = cost
+		} else if p.Positions[asset] == 0 {
+			delete(p.CostBasis, asset)
+		}
+		delete(held, asset.Symbol)
+	}
+	for sym, qty := range held {
+		fmt.Printf("Reconcile %s: broker holds %v, not tracked by portfolio %s\n", sym, qty, p.Name)
+	}
+
+	cash, err := broker.ParseDecimal(account.Cash)
+	if err != nil {
+		return fmt.Errorf("invalid broker cash %q: %w", account.Cash, err)
+	}
+	if math.Abs(cash-p.Cash) > 0.005 {
+		fmt.Printf("Reconcile cash: portfolio has %.2f, broker has %.2f\n", p.Cash, cash)
+		p.Cash = cash
+	}
+	return nil
+}
+
+// Execute submits the signal's order to the broker. It only returns a fill if
+// the broker reports one straight away; later fills arrive through ProcessOrders.
 func (lt *LiveTrader) Execute(p *Portfolio, sig t.Signal) (ExecutionRecord, bool) {
-	// Placeholder - will need to interface with broker API to place live orders
+	lt.portfolio = p
+	now := lt.Clock.Now().UTC()
+	o := lt.orders.Submit(t.NewOrderFromSignal(sig), now)
+	if o.Status == t.OrderRejected {
+		fmt.Printf("Rejected %s: %s\n", o.Pretty(), o.Reason)
+		return ExecutionRecord{}, false
+	}
+	req, err := broker.NewOrderRequest(o)
+	if err != nil {
+		lt.reject(o, err.Error())
+		return ExecutionRecord{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+	ro, err := lt.Broker.SubmitOrder(ctx, req)
+	if err != nil && !broker.IsRejection(err) {
+		// The order may have reached the broker before the connection failed
+		ro, err = lt.Broker.GetOrderByClientID(ctx, o.ID)
+	}
+	if err != nil {
+		lt.reject(o, err.Error())
+		return ExecutionRecord{}, false
+	}
+
+	o.BrokerID = ro.ID
+	lt.orders.Update(o)
+	fmt.Printf("Submitted %s to broker as %s\n", o.Pretty(), ro.ID)
+	if execs := lt.sync(p, o, ro, ""); len(execs) > 0 {
+		return execs[0], true
+	}
 	return ExecutionRecord{}, false
 }
 
+// ProcessOrders polls the broker for every open order, booking newly confirmed fills.
+func (lt *LiveTrader) ProcessOrders(ctx context.Context, p *Portfolio, ts time.Time) []ExecutionRecord {
+	lt.portfolio = p
+	var execs []ExecutionRecord
+	for _, o := range lt.orders.Open() {
+		if o.BrokerID == "" {
+			continue
+		}
+		ro, err := lt.Broker.GetOrder(ctx, o.BrokerID)
+		if err != nil {
+			fmt.Printf("Failed to poll order %s: %v\n", o.ID, err)
+			continue
+		}
+		execs = append(execs, lt.sync(p, o, ro, "")...)
+	}
+	return execs
+}
+
+// CancelOrder asks the broker to cancel and waits for it to confirm. Fills that
+// raced the cancellation are booked and returned, for the runner to record.
+func (lt *LiveTrader) CancelOrder(id, reason string) (t.Order, []ExecutionRecord, bool) {
+	o, ok := lt.orders.Get(id)
+	if !ok || !o.Status.IsOpen() {
+		return t.Order{}, nil, false
+	}
+	if o.BrokerID == "" {
+		o, ok = lt.orders.Cancel(id, reason, lt.Clock.Now().UTC())
+		return o, nil, ok
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+	if err := lt.Broker.CancelOrder(ctx, o.BrokerID); err != nil {
+		// Usually filled in the meantime; the status poll below tells
+		fmt.Printf("Broker refused to cancel %s: %v\n", o.ID, err)
+	}
+
+	var execs []ExecutionRecord
+	for range cancelConfirmPoll {
+		ro, err := lt.Broker.GetOrder(ctx, o.BrokerID)
+		if err == nil {
+			execs = append(execs, lt.sync(lt.portfolio, o, ro, reason)...)
+			if o, _ = lt.orders.Get(id); !o.Status.IsOpen() {
+				break
+			}
+		}
+		<-lt.Clock.After(cancelConfirmWait)
+	}
+	o, _ = lt.orders.Get(id)
+	return o, execs, o.Status == t.OrderCancelled
+}
+
+func (lt *LiveTrader) CancelOrders(reason string) ([]t.Order, []ExecutionRecord) {
+	var out []t.Order
+	var execs []ExecutionRecord
+	for _, o := range lt.orders.Open() {
+		c, late, ok := lt.CancelOrder(o.ID, reason)
+		execs = append(execs, late...)
+		if ok {
+			out = append(out, c)
+		}
+	}
+	return out, execs
+}
+
+func (lt *LiveTrader) Orders() *OrderBook { return lt.orders }
+
+func (lt *LiveTrader) clock() t.Clock { return lt.Clock }
+
 func (lt *LiveTrader) Close() error { return lt.Provider.Close() }
 
+func (lt *LiveTrader) reject(o t.Order, reason string) {
+	if r, ok := lt.orders.Reject(o.ID, reason, lt.Clock.Now().UTC()); ok {
+		fmt.Printf("Rejected %s: %s\n", r.Pretty(), r.Reason)
+	}
+}
+
+// sync brings a local order in line with the broker's view of it, booking any
+// newly filled quantity against p. reason explains a broker-side close
+// (defaults to the broker's status).
+func (lt *LiveTrader) sync(p *Portfolio, o t.Order, ro broker.Order, reason string) []ExecutionRecord {
+	now := lt.Clock.Now().UTC()
+	changed := false
+	var execs []ExecutionRecord
+
+	filled, errQty := broker.ParseDecimal(ro.FilledQty)
+	avg, errAvg := broker.ParseDecimal(ro.FilledAvgPrice)
+	if errQty != nil || errAvg != nil {
+		fmt.Printf("Ignoring malformed fill for %s: qty %q, price %q\n", o.ID, ro.FilledQty, ro.FilledAvgPrice)
+	} else if delta := filled - o.FilledQty; delta > qtyEpsilon {
+		if p == nil {
+			fmt.Printf("Fill of %v for %s confirmed with no portfolio to book it to\n", delta, o.ID)
+		} else {
+			// Price of just the new fills, backed out of the broker's running average
+			price := (avg*filled - o.AvgFillPrice*o.FilledQty) / delta
+			execs = append(execs, bookFill(p, now, o.Asset, o.Action, delta, price, 0, 0))
+			o.RecordFill(delta, price, now)
+			changed = true
+		}
+	}
+
+	if status := broker.OrderStatus(ro.Status); !status.IsOpen() && o.Status.IsOpen() {
+		if reason == "" {
+			reason = "broker: " + ro.Status
+		}
+		o.Status, o.Reason, o.Updated = status, reason, now
+		changed = true
+	}
+	if changed {
+		lt.orders.Update(o)
+	}
+	return execs
+}
+
 // ----------- PAPER TRADER -----------
+
+// PaperTrader simulates a broker against live market data: market orders fill
+// at the latest traded price, resting orders match against subsequent live bars.
 type PaperTrader struct {
 	Provider md.BarProvider
+	Samples  md.SampleProvider // latest trades for market orders (nil => signal bar close)
+	Fills    FillModel
+	Clock    t.Clock // stamps orders & fills (a SimClock when replaying)
+	broker   *simBroker
 }
 
 // Ensure PaperTrader implements Trader
 var _ Trader = (*PaperTrader)(nil)
 
 func NewPaperTrader(ctx context.Context, interval time.Duration) *PaperTrader {
-	cl := finnhub.NewClient(os.Getenv("FINNHUB_API_KEY"), interval)
-	return &PaperTrader{Provider: cl}
+	cl := NewStreamProvider(interval)
+	return NewPaperTraderWithProvider(cl)
+}
+
+// NewPaperTraderWithProvider paper trades against any live bar source,
+// using its latest samples for market orders if it also provides them.
+func NewPaperTraderWithProvider(prov md.BarProvider) *PaperTrader {
+	pt := &PaperTrader{Provider: prov, Fills: DefaultFillModel(), Clock: t.RealClock{}}
+	if sp, ok := prov.(md.SampleProvider); ok {
+		pt.Samples = sp
+	}
+	pt.broker = newSimBroker(&pt.Fills)
+	return pt
+}
+
+// TrackOrders restores the portfolio's resting orders from disk and keeps
+// the file up to date as orders change, so pending orders survive restarts.
+func (pt *PaperTrader) TrackOrders(portfolioName string) error {
+	return trackOrders(pt.broker.Orders, portfolioName)
 }
 
 func (pt *PaperTrader) FetchBarAt(ctx context.Context, asset t.Asset, ts time.Time) (t.Bar, bool, error) {
 	return pt.Provider.FetchBarAt(ctx, asset, ts)
 }
 
+// FetchSample returns the latest trade, if the data provider streams them
+func (pt *PaperTrader) FetchSample(ctx context.Context, asset t.Asset) (t.Sample, error) {
+	if pt.Samples == nil {
+		return t.Sample{}, fmt.Errorf("no trade feed for %s", asset.Symbol)
+	}
+	return pt.Samples.FetchSample(ctx, asset)
+}
+
 func (pt *PaperTrader) IncludeAssets(ctx context.Context, assets []t.Asset) error {
 	return pt.Provider.IncludeAssets(ctx, assets)
 }
 
+// Execute places the signal's order. Market orders fill straight away at the
+// latest traded price; other orders rest until ProcessOrders matches them.
 func (pt *PaperTrader) Execute(p *Portfolio, sig t.Signal) (ExecutionRecord, bool) {
-	// Placeholder - will need to interface with broker API to place paper orders
-	return ExecutionRecord{}, false
+	now := pt.Clock.Now().UTC()
+	o, ok := pt.broker.submit(sig, now)
+	if !ok || o.Type != t.MarketOrder {
+		return ExecutionRecord{}, false
+	}
+
+	ref := sig.Bar.Close
+	if pt.Samples != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		sm, err := pt.Samples.FetchSample(ctx, o.Asset)
+		cancel()
+		if err == nil {
+			ref = sm.Price
+		} else {
+			fmt.Printf("No live price for %s (%v), using bar close %.2f\n", o.Asset.Symbol, err, ref)
+		}
+	}
+	if ref <= 0 {
+		pt.broker.Orders.Reject(o.ID, "no price to fill at", now)
+		fmt.Printf("Rejected %s: no price to fill at\n", o.Pretty())
+		return ExecutionRecord{}, false
+	}
+
+	exec, filled := pt.broker.fill(p, o, ref, sig.Bar, now)
+	if o.TIF == t.IOCTIF {
+		pt.broker.Orders.Cancel(o.ID, "immediate or cancel", now)
+	}
+	return exec, filled
 }
 
+// ProcessOrders matches resting orders against the latest closed live bars.
+func (pt *PaperTrader) ProcessOrders(ctx context.Context, p *Portfolio, ts time.Time) []ExecutionRecord {
+	barFor := func(asset t.Asset) (t.Bar, bool) {
+		bar, ok, err := pt.Provider.FetchBarAt(ctx, asset, ts)
+		return bar, ok && err == nil
+	}
+	return pt.broker.match(p, barFor, pt.Clock.Now().UTC())
+}
+
+func (pt *PaperTrader) CancelOrder(id, reason string) (t.Order, []ExecutionRecord, bool) {
+	o, ok := pt.broker.Orders.Cancel(id, reason, pt.Clock.Now().UTC())
+	return o, nil, ok
+}
+
+func (pt *PaperTrader) CancelOrders(reason string) ([]t.Order, []ExecutionRecord) {
+	return pt.broker.Orders.CancelAll(reason, pt.Clock.Now().UTC()), nil
+}
+
+func (pt *PaperTrader) Orders() *OrderBook { return pt.broker.Orders }
+
+func (pt *PaperTrader) clock() t.Clock { return pt.Clock }
+
 func (pt *PaperTrader) Close() error { return pt.Provider.Close() }
 
+func trackOrders(ob *OrderBook, portfolioName string) error {
+	if err := ob.RestoreOpenOrders(portfolioName); err != nil {
+		return fmt.Errorf("failed to restore open orders: %w", err)
+	}
+	ob.OnUpdate(func(o t.Order) {
+		if err := ob.SaveOpenOrders(portfolioName); err != nil {
+			fmt.Printf("Failed to save open orders for %s: %v\n", portfolioName, err)
+		}
+	})
+	return nil
+}
+
 // ----------- TEST TRADER -----------
 type TestTrader struct {
 	Provider md.BarProvider
+	Fills    FillModel
+	Clock    t.Clock // simulated: its runner moves it to each tick
+	broker   *simBroker
 	interval time.Duration
 	start    time.Time // inclusive, UTC
 	end      time.Time // exclusive, UTC
@@ -88,12 +459,21 @@ var _ Trader = (*TestTrader)(nil)
 
 func NewTestTrader(interval time.Duration, start, end time.Time) *TestTrader {
 	prov := alpaca.NewClient(os.Getenv("ALPACA_API_KEY"), os.Getenv("ALPACA_API_SECRET"), interval, start, end)
-	return &TestTrader{
+	return NewTestTraderWithProvider(prov, interval, start, end)
+}
+
+// NewTestTraderWithProvider backtests against any historical bar source (e.g. local files)
+func NewTestTraderWithProvider(prov md.BarProvider, interval time.Duration, start, end time.Time) *TestTrader {
+	tt := &TestTrader{
 		Provider: prov,
+		Fills:    DefaultFillModel(),
+		Clock:    t.NewSimClock(start.UTC()),
 		interval: interval,
 		start:    start.UTC(),
 		end:      end.UTC(),
 	}
+	tt.broker = newSimBroker(&tt.Fills)
+	return tt
 }
 
 func (tt *TestTrader) FetchBarAt(ctx context.Context, asset t.Asset, ts time.Time) (t.Bar, bool, error) {
@@ -104,19 +484,57 @@ func (tt *TestTrader) IncludeAssets(ctx context.Context, assets []t.Asset) error
 	return tt.Provider.IncludeAssets(ctx, assets)
 }
 
+// Execute places the signal's order. Market orders fill straight away against the
+// signal's bar (close or next open); other orders rest until ProcessOrders matches
+// them against subsequent bars.
 func (tt *TestTrader) Execute(p *Portfolio, sig t.Signal) (ExecutionRecord, bool) {
-	qty := sig.Qty
-	price := sig.Bar.Close
-	asset := sig.Bar.Asset
+	bar := sig.Bar
+	o, ok := tt.broker.submit(sig, bar.End) // orders live from the end of the signal's bar
+	if !ok || o.Type != t.MarketOrder {
+		return ExecutionRecord{}, false
+	}
+
+	ref := bar.Close
+	if tt.Fills.Timing == FillAtNextOpen {
+		next, ok, err := tt.Provider.FetchBarAt(context.Background(), o.Asset, bar.End)
+		if err != nil || !ok {
+			tt.broker.Orders.Reject(o.ID, "no bar after "+bar.End.Format(time.RFC3339)+" to fill at", bar.End)
+			fmt.Printf("Rejected %s: no bar after %s to fill at\n", o.Pretty(), bar.End.Format(time.RFC3339))
+			return ExecutionRecord{}, false
+		}
+		bar, ref = next, next.Open
+	}
+
 	// live execute will only add it to execHistory once order fulfilled - and get price then
-	cost := qty * price
-	if sig.Action == t.Buy && p.Cash >= cost {
-		p.Cash -= cost
-		p.Positions[asset] += qty
-		exec := ExecutionRecord{time.Now().UTC(), asset, t.Buy, qty, price, p.Cash}
-		return exec, true
+	exec, filled := tt.broker.fill(p, o, ref, bar, tt.Clock.Now().UTC())
+	if o.TIF == t.IOCTIF {
+		tt.broker.Orders.Cancel(o.ID, "immediate or cancel", bar.End)
 	}
-	return ExecutionRecord{}, false
+	return exec, filled
 }
 
-func (tt *TestTrader) Close() error { return nil }
+// ProcessOrders matches resting orders against the bar at ts.
+func (tt *TestTrader) ProcessOrders(ctx context.Context, p *Portfolio, ts time.Time) []ExecutionRecord {
+	barFor := func(asset t.Asset) (t.Bar, bool) {
+		bar, ok, err := tt.Provider.FetchBarAt(ctx, asset, ts)
+		return bar, ok && err == nil
+	}
+	return tt.broker.match(p, barFor, ts.UTC())
+}
+
+func (tt *TestTrader) CancelOrder(id, reason string) (t.Order, []ExecutionRecord, bool) {
+	o, ok := tt.broker.Orders.Cancel(id, reason, tt.Clock.Now().UTC())
+	return o, nil, ok
+}
+
+func (tt *TestTrader) CancelOrders(reason string) ([]t.Order, []ExecutionRecord) {
+	return tt.broker.Orders.CancelAll(reason, tt.Clock.Now().UTC()), nil
+}
+
+func (tt *TestTrader) Orders() *OrderBook { return tt.broker.Orders }
+
+func (tt *TestTrader) clock() t.Clock { return tt.Clock }
+
+func (tt *TestTrader) barInterval() time.Duration { return tt.interval }
+
+func (tt *TestTrader) Close() error { return tt.Provider.Close() }
@@ -0,0 +1,362 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	broker "github.com/joshskilla/trading-bot/internal/broker/alpaca"
+	ds "github.com/joshskilla/trading-bot/internal/datastore"
+	"github.com/joshskilla/trading-bot/internal/marketdata/alpaca"
+	"github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+// mapProvider serves bars from memory, keyed by aligned start
+type mapProvider struct {
+	interval time.Duration
+	bars     map[types.Asset]map[time.Time]types.Bar
+}
+
+func newMapProvider(interval time.Duration, bars ...types.Bar) *mapProvider {
+	mp := &mapProvider{interval: interval, bars: make(map[types.Asset]map[time.Time]types.Bar)}
+	for _, b := range bars {
+		if mp.bars[b.Asset] == nil {
+			mp.bars[b.Asset] = make(map[time.Time]types.Bar)
+		}
+		mp.bars[b.Asset][b.Start] = b
+	}
+	return mp
+}
+
+func (mp *mapProvider) FetchBarAt(ctx context.Context, asset types.Asset, ts time.Time) (types.Bar, bool, error) {
+	b, ok := mp.bars[asset][types.IntervalStart(ts, mp.interval)]
+	return b, ok, nil
+}
+func (mp *mapProvider) IncludeAssets(ctx context.Context, assets []types.Asset) error { return nil }
+func (mp *mapProvider) Close() error                                                  { return nil }
+
+var testAsset = types.NewAsset("AAPL", "IEX", "stock")
+
+func testBar(start time.Time, o, h, l, c, v float64) types.Bar {
+	return types.Bar{
+		Asset: testAsset, Start: start, End: start.Add(time.Minute), Interval: time.Minute,
+		Open: o, High: h, Low: l, Close: c, Volume: v, Status: types.BarStatusOfficial,
+	}
+}
+
+func TestTestTrader_BuyAndSellWithCosts(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	bar := testBar(start, 100, 102, 98, 100, 1000)
+	tt := NewTestTraderWithProvider(newMapProvider(time.Minute, bar), time.Minute, start, start.Add(time.Hour))
+	tt.Fills = FillModel{
+		Timing:     FillAtClose,
+		Commission: Commissions{FixedCommission{PerOrder: 1}, PercentCommission{Rate: 0.001}},
+		Slippage:   FixedBpsSlippage{Bps: 10},
+	}
+	p := NewPortfolio("UnitTestTraderCosts", 1000)
+
+	exec, ok := tt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 5})
+	require.True(t, ok)
+	require.InDelta(t, 100.1, exec.Price, 1e-9)         // +10bps
+	require.InDelta(t, 1+0.5005, exec.Fee, 1e-9)        // fixed + 0.1% of 500.5
+	require.InDelta(t, 0.5, exec.Slippage, 1e-9)        // 0.1 * 5
+	require.InDelta(t, 1000-500.5-1.5005, p.Cash, 1e-9) // notional + fee
+	require.Equal(t, 5.0, p.Positions[testAsset])
+	require.Equal(t, start, exec.Time, "stamped with simulated, not wall clock, time")
+
+	exec, ok = tt.Execute(p, types.Signal{Bar: bar, Action: types.Sell, Qty: 5})
+	require.True(t, ok)
+	require.Equal(t, types.Sell, exec.Action)
+	require.InDelta(t, 99.9, exec.Price, 1e-9)
+	require.Equal(t, 0.0, p.Positions[testAsset])
+	require.InDelta(t, 1000-500.5-1.5005+499.5-1.4995, p.Cash, 1e-9)
+}
+
+func TestTestTrader_Rejections(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	bar := testBar(start, 100, 100, 100, 100, 1000)
+	tt := NewTestTraderWithProvider(newMapProvider(time.Minute, bar), time.Minute, start, start.Add(time.Hour))
+	p := NewPortfolio("UnitTestTraderRejections", 150)
+
+	_, ok := tt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 2})
+	require.False(t, ok, "insufficient cash")
+	_, ok = tt.Execute(p, types.Signal{Bar: bar, Action: types.Sell, Qty: 1})
+	require.False(t, ok, "no shorting")
+	_, ok = tt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 0})
+	require.False(t, ok, "zero quantity")
+	require.Equal(t, 150.0, p.Cash)
+}
+
+func TestTestTrader_NextOpenAndSlippageModels(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	bar := testBar(start, 100, 101, 99, 100, 1000)
+	next := testBar(start.Add(time.Minute), 105, 110, 100, 106, 200)
+	tt := NewTestTraderWithProvider(newMapProvider(time.Minute, bar, next), time.Minute, start, start.Add(time.Hour))
+	tt.Fills = FillModel{Timing: FillAtNextOpen, Slippage: VolumeSlippage{Impact: 0.1}}
+	p := NewPortfolio("UnitTestTraderNextOpen", 10000)
+
+	exec, ok := tt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 20})
+	require.True(t, ok)
+	require.InDelta(t, 105+105*0.1*(20.0/200), exec.Price, 1e-9)
+
+	// Spread: half of 10% of the High-Low range
+	price, _, _ := FillModel{Slippage: SpreadSlippage{Fraction: 0.1}}.Quote(types.Sell, 1, 106, next)
+	require.InDelta(t, 105.5, price, 1e-9)
+
+	// No bar after the last one
+	_, ok = tt.Execute(p, types.Signal{Bar: next, Action: types.Buy, Qty: 1})
+	require.False(t, ok)
+}
+
+func TestTestTrader_RestingOrders(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	b0 := testBar(start, 100, 100, 100, 100, 1000)
+	b1 := testBar(start.Add(time.Minute), 100, 101, 99, 100, 1000)  // limit 98 not reached
+	b2 := testBar(start.Add(2*time.Minute), 99, 99, 97, 98, 1000)   // limit 98 reached
+	b3 := testBar(start.Add(3*time.Minute), 104, 106, 103, 105, 10) // gaps through stop 102
+	tt := NewTestTraderWithProvider(newMapProvider(time.Minute, b0, b1, b2, b3), time.Minute, start, start.Add(time.Hour))
+	p := NewPortfolio("UnitTestTraderResting", 10000)
+
+	var updates []types.OrderStatus
+	tt.Orders().OnUpdate(func(o types.Order) { updates = append(updates, o.Status) })
+
+	_, ok := tt.Execute(p, types.Signal{Bar: b0, Action: types.Buy, Qty: 10, OrderType: types.LimitOrder, LimitPrice: 98})
+	require.False(t, ok, "limit orders rest")
+	require.Len(t, tt.Orders().Open(), 1)
+
+	require.Empty(t, tt.ProcessOrders(context.Background(), p, b1.Start))
+	execs := tt.ProcessOrders(context.Background(), p, b2.Start)
+	require.Len(t, execs, 1)
+	require.Equal(t, 98.0, execs[0].Price)
+	require.Equal(t, b2.Start, execs[0].Time)
+	require.Empty(t, tt.Orders().Open())
+	require.Equal(t, []types.OrderStatus{types.OrderNew, types.OrderFilled}, updates)
+
+	// Stop buy gapped through fills at the open, partially when volume is capped
+	tt.Fills.MaxParticipation = 0.5
+	_, ok = tt.Execute(p, types.Signal{Bar: b2, Action: types.Buy, Qty: 8, OrderType: types.StopOrder, StopPrice: 102, TIF: types.GTCTIF})
+	require.False(t, ok)
+	execs = tt.ProcessOrders(context.Background(), p, b3.Start)
+	require.Len(t, execs, 1)
+	require.Equal(t, 104.0, execs[0].Price)
+	require.Equal(t, 5.0, execs[0].Qty)
+	open := tt.Orders().Open()
+	require.Len(t, open, 1)
+	require.Equal(t, types.OrderPartiallyFilled, open[0].Status)
+	require.True(t, open[0].Triggered)
+
+	cancelled, execs := tt.CancelOrders("test over")
+	require.Empty(t, execs)
+	require.Len(t, cancelled, 1)
+	require.Equal(t, types.OrderCancelled, cancelled[0].Status)
+	require.Equal(t, 15.0, p.Positions[testAsset])
+}
+
+func TestTestTrader_OrderExpiry(t *testing.T) {
+	day1 := time.Date(2024, 1, 2, 20, 59, 0, 0, time.UTC)
+	day2 := time.Date(2024, 1, 3, 14, 30, 0, 0, time.UTC)
+	b0 := testBar(day1, 100, 100, 100, 100, 1000)
+	b1 := testBar(day2, 90, 95, 85, 90, 1000)
+	tt := NewTestTraderWithProvider(newMapProvider(time.Minute, b0, b1), time.Minute, day1, day2.Add(time.Hour))
+	p := NewPortfolio("UnitTestTraderExpiry", 10000)
+
+	tt.Execute(p, types.Signal{Bar: b0, Action: types.Buy, Qty: 1, OrderType: types.LimitOrder, LimitPrice: 95})
+	tt.Execute(p, types.Signal{Bar: b0, Action: types.Buy, Qty: 1, OrderType: types.LimitOrder, LimitPrice: 80, TIF: types.IOCTIF})
+	tt.Execute(p, types.Signal{Bar: b0, Action: types.Buy, Qty: 1, OrderType: types.LimitOrder, LimitPrice: 0})
+
+	require.Empty(t, tt.ProcessOrders(context.Background(), p, b1.Start))
+	require.Empty(t, tt.Orders().Open())
+	closed := tt.Orders().Closed()
+	require.Len(t, closed, 3)
+	require.Equal(t, types.OrderRejected, closed[0].Status, "limit without a price")
+	require.Equal(t, types.OrderCancelled, closed[1].Status, "DAY expired overnight")
+	require.Equal(t, types.OrderCancelled, closed[2].Status, "IOC not filled")
+}
+
+func TestBacktest_StampsFillsWithSimulatedTime(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	var bars []types.Bar
+	for i := range 3 {
+		bars = append(bars, testBar(start.Add(time.Duration(i)*time.Minute), 100, 100, 100, 100, 1000))
+	}
+	tt := NewTestTraderWithProvider(newMapProvider(time.Minute, bars...), time.Minute, start, start.Add(3*time.Minute))
+	p := NewMemoryPortfolio("UnitTestBacktestClock", 1000)
+	strat := &buyingStrategy{contextStrategy: contextStrategy{assets: []types.Asset{testAsset}}}
+	hours := types.TradingHours{OpenHour: 0, CloseHour: 23, CloseMinute: 59, ExchangeTZ: "UTC"}
+
+	require.NoError(t, Backtest(context.Background(), p, strat, tt, start, start.Add(3*time.Minute), hours))
+	require.Len(t, p.ExecutionHistory, 3)
+	for i, exec := range p.ExecutionHistory {
+		require.Equal(t, start.Add(time.Duration(i)*time.Minute), exec.Time, "filled on the tick, not the wall clock")
+	}
+	require.Equal(t, start.Add(2*time.Minute), tt.Clock.Now())
+	for _, rec := range p.PositionRecords() {
+		require.Equal(t, start.Add(2*time.Minute), rec.Time)
+	}
+}
+
+// liveProvider is a mapProvider that also serves a latest trade
+type liveProvider struct {
+	*mapProvider
+	sample types.Sample
+}
+
+func (lp *liveProvider) FetchSample(ctx context.Context, asset types.Asset) (types.Sample, error) {
+	return lp.sample, nil
+}
+func (lp *liveProvider) AddToStream(ctx context.Context, assets []types.Asset) error { return nil }
+
+func TestPaperTrader_FillsAtLatestSampleAndPersistsOrders(t *testing.T) {
+	now := time.Now().UTC()
+	bar := testBar(types.IntervalStart(now, time.Minute).Add(-time.Minute), 100, 101, 99, 100, 1000)
+	next := testBar(types.IntervalStart(now, time.Minute).Add(time.Minute), 97, 98, 94, 95, 1000)
+	prov := &liveProvider{
+		mapProvider: newMapProvider(time.Minute, bar, next),
+		sample:      types.NewSample(testAsset, now, 100.25, 10),
+	}
+	pt := NewPaperTraderWithProvider(prov)
+	p := NewPortfolio("UnitTestPaperTrader", 1000)
+
+	exec, ok := pt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 2})
+	require.True(t, ok)
+	require.Equal(t, 100.25, exec.Price)
+	require.InDelta(t, 1000-200.5, p.Cash, 1e-9)
+
+	// Resting order is saved, restored by a new trader and filled by a later bar
+	require.NoError(t, pt.TrackOrders(p.Name))
+	pt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 1, OrderType: types.LimitOrder, LimitPrice: 96, TIF: types.GTCTIF})
+	path := ds.AbsolutePath(fmt.Sprintf(OpenOrdersFilePath, p.Name))
+	defer os.Remove(path)
+
+	restored := NewPaperTraderWithProvider(prov)
+	require.NoError(t, restored.TrackOrders(p.Name))
+	open := restored.Orders().Open()
+	require.Len(t, open, 1)
+	require.Equal(t, 96.0, open[0].LimitPrice)
+
+	// New orders never reuse an ID from before the restart
+	again := restored.Orders().Submit(types.Order{Asset: testAsset, Action: types.Buy, Qty: 1, Type: types.MarketOrder}, now)
+	_, reused := pt.Orders().Get(again.ID)
+	require.False(t, reused)
+	require.NotEqual(t, open[0].ID, again.ID)
+	restored.Orders().Cancel(again.ID, "test over", now)
+
+	execs := restored.ProcessOrders(context.Background(), p, next.Start)
+	require.Len(t, execs, 1)
+	require.Equal(t, 96.0, execs[0].Price)
+	require.Equal(t, 3.0, p.Positions[testAsset])
+
+	// Nothing left to persist
+	loaded := NewOrderBook()
+	require.NoError(t, loaded.RestoreOpenOrders(p.Name))
+	require.Empty(t, loaded.Open())
+}
+
+func TestNewStreamProvider_BackfillsFromAlpacaIfConfigured(t *testing.T) {
+	t.Setenv("FINNHUB_API_KEY", "fh-token")
+	t.Setenv("FINNHUB_URL", "ws://localhost:9090")
+	t.Setenv("ALPACA_API_KEY", "")
+	cl := NewStreamProvider(time.Minute)
+	require.Equal(t, "fh-token", cl.Token)
+	require.Equal(t, "ws://localhost:9090", cl.URL)
+	require.Nil(t, cl.Backfill)
+	require.NotNil(t, cl.OnState)
+
+	t.Setenv("ALPACA_API_KEY", "key")
+	t.Setenv("ALPACA_API_SECRET", "secret")
+	cl = NewStreamProvider(time.Minute)
+	require.IsType(t, &alpaca.Client{}, cl.Backfill)
+}
+
+func TestLiveTrader_BooksFillsOnlyOnceConfirmed(t *testing.T) {
+	mock := broker.NewMockBroker(1000)
+	defer mock.Close()
+	mock.SetPrice("AAPL", 100)
+	mock.SetBehaviour("AAPL", broker.MockPartialFill)
+	lt := NewLiveTraderWithBroker(newMapProvider(time.Minute), mock.Client())
+	p := NewPortfolio("UnitTestLiveTrader", 1000)
+	ctx := context.Background()
+	bar := testBar(time.Now().UTC().Truncate(time.Minute), 100, 100, 100, 100, 1000)
+
+	_, ok := lt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 4})
+	require.False(t, ok, "accepted, not yet filled")
+	require.Equal(t, 1000.0, p.Cash)
+	open := lt.Orders().Open()
+	require.Len(t, open, 1)
+	require.NotEmpty(t, open[0].BrokerID)
+
+	execs := lt.ProcessOrders(ctx, p, time.Now())
+	require.Len(t, execs, 1)
+	require.Equal(t, 2.0, execs[0].Qty)
+	require.Equal(t, types.OrderPartiallyFilled, lt.Orders().Open()[0].Status)
+
+	execs = lt.ProcessOrders(ctx, p, time.Now())
+	require.Len(t, execs, 1)
+	require.Empty(t, lt.Orders().Open())
+	require.Equal(t, 4.0, p.Positions[testAsset])
+	require.InDelta(t, 600, p.Cash, 1e-9)
+
+	// Broker rejection
+	mock.SetBehaviour("AAPL", broker.MockReject)
+	_, ok = lt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 1})
+	require.False(t, ok)
+	closed := lt.Orders().Closed()
+	require.Equal(t, types.OrderRejected, closed[len(closed)-1].Status)
+	require.Contains(t, closed[len(closed)-1].Reason, "insufficient buying power")
+}
+
+func TestLiveTrader_CancelAndReconcile(t *testing.T) {
+	mock := broker.NewMockBroker(5000)
+	defer mock.Close()
+	mock.SetBehaviour("AAPL", broker.MockRest)
+	mock.SetPosition("AAPL", 7, 90)
+	lt := NewLiveTraderWithBroker(newMapProvider(time.Minute), mock.Client())
+	p := NewPortfolio("UnitTestLiveTraderReconcile", 1000)
+	p.Positions[testAsset] = 3
+
+	require.NoError(t, lt.Reconcile(context.Background(), p))
+	require.Equal(t, 7.0, p.Positions[testAsset])
+	require.Equal(t, 5000.0, p.Cash)
+
+	bar := testBar(time.Now().UTC().Truncate(time.Minute), 100, 100, 100, 100, 1000)
+	lt.Execute(p, types.Signal{Bar: bar, Action: types.Sell, Qty: 2, OrderType: types.LimitOrder, LimitPrice: 120, TIF: types.GTCTIF})
+	open := lt.Orders().Open()
+	require.Len(t, open, 1)
+
+	cancelled, execs, ok := lt.CancelOrder(open[0].ID, "test over")
+	require.True(t, ok)
+	require.Empty(t, execs)
+	require.Equal(t, "test over", cancelled.Reason)
+	remote, _ := mock.Order(open[0].BrokerID)
+	require.Equal(t, "canceled", remote.Status)
+	require.Equal(t, 7.0, p.Positions[testAsset])
+}
+
+func TestLiveTrader_CancelReturnsFillsThatRacedIt(t *testing.T) {
+	mock := broker.NewMockBroker(1000)
+	defer mock.Close()
+	mock.SetPrice("AAPL", 100)
+	mock.SetBehaviour("AAPL", broker.MockPartialFill)
+	lt := NewLiveTraderWithBroker(newMapProvider(time.Minute), mock.Client())
+	p := NewPortfolio("UnitTestLiveTraderCancelRace", 1000)
+	bar := testBar(time.Now().UTC().Truncate(time.Minute), 100, 100, 100, 100, 1000)
+
+	lt.Execute(p, types.Signal{Bar: bar, Action: types.Buy, Qty: 4})
+	open := lt.Orders().Open()
+	require.Len(t, open, 1)
+
+	// Half fills at the broker before the trader hears of it
+	_, err := mock.Client().GetOrder(context.Background(), open[0].BrokerID)
+	require.NoError(t, err)
+
+	cancelled, execs, ok := lt.CancelOrder(open[0].ID, "test over")
+	require.True(t, ok)
+	require.Equal(t, 2.0, cancelled.FilledQty)
+	require.Len(t, execs, 1)
+	require.Equal(t, 2.0, execs[0].Qty)
+	require.Equal(t, 2.0, p.Positions[testAsset])
+	require.Empty(t, p.ExecutionHistory, "left for the runner to record")
+}
@@ -0,0 +1,182 @@
+package indicators
+
+// ----------- SMA -----------
+
+// SMA is the simple moving average of the last Period values
+type SMA struct {
+	Period int
+	win    window
+	sum    float64
+}
+
+var _ Series = (*SMA)(nil)
+
+func NewSMA(period int) *SMA {
+	checkPeriod("SMA", period)
+	return &SMA{Period: period, win: newWindow(period)}
+}
+
+func (s *SMA) Update(x float64) float64 {
+	old, _ := s.win.push(x)
+	s.sum += x - old
+	return s.Value()
+}
+
+func (s *SMA) Ready() bool { return s.win.full() }
+
+func (s *SMA) Value() float64 {
+	if s.win.n == 0 {
+		return 0
+	}
+	return s.sum / float64(s.win.n)
+}
+
+func (s *SMA) State() State {
+	return State{stateKind: "sma", statePeriod: s.Period, "window": s.win.values()}
+}
+
+func (s *SMA) Restore(st State) error {
+	if err := st.check("sma", s.Period); err != nil {
+		return err
+	}
+	xs, err := st.floats("window")
+	if err != nil {
+		return err
+	}
+	s.win.load(xs)
+	s.sum = 0 // recomputed, shedding any drift
+	for _, x := range s.win.values() {
+		s.sum += x
+	}
+	return nil
+}
+
+// ----------- EMA -----------
+
+// EMA is the exponential moving average with smoothing 2/(Period+1),
+// seeded with the simple average of the first Period values
+type EMA struct {
+	Period int
+	kind   string // "ema" or "wilder"
+	alpha  float64
+	count  int
+	value  float64 // running sum while warming up
+}
+
+var _ Series = (*EMA)(nil)
+
+func NewEMA(period int) *EMA {
+	checkPeriod("EMA", period)
+	return &EMA{Period: period, kind: "ema", alpha: 2 / float64(period+1)}
+}
+
+// newWilder is the EMA variant Wilder used for RSI & ATR: smoothing 1/Period
+func newWilder(period int) *EMA {
+	checkPeriod("Wilder average", period)
+	return &EMA{Period: period, kind: "wilder", alpha: 1 / float64(period)}
+}
+
+func (e *EMA) Update(x float64) float64 {
+	e.count++
+	switch {
+	case e.count < e.Period:
+		e.value += x
+	case e.count == e.Period:
+		e.value = (e.value + x) / float64(e.Period)
+	default:
+		e.value += e.alpha * (x - e.value)
+	}
+	return e.Value()
+}
+
+func (e *EMA) Ready() bool { return e.count >= e.Period }
+
+func (e *EMA) Value() float64 {
+	if !e.Ready() {
+		if e.count == 0 {
+			return 0
+		}
+		return e.value / float64(e.count)
+	}
+	return e.value
+}
+
+func (e *EMA) State() State {
+	return State{stateKind: e.kind, statePeriod: e.Period, "count": e.count, "value": e.value}
+}
+
+func (e *EMA) Restore(st State) error {
+	if err := st.check(e.kind, e.Period); err != nil {
+		return err
+	}
+	var err error
+	if e.count, err = st.int("count"); err != nil {
+		return err
+	}
+	e.value, err = st.float("value")
+	return err
+}
+
+// ----------- WMA -----------
+
+// WMA is the linearly weighted moving average of the last Period values,
+// the newest weighted Period and the oldest 1
+type WMA struct {
+	Period   int
+	win      window
+	sum      float64 // plain sum of the window
+	weighted float64 // weighted sum of the window
+}
+
+var _ Series = (*WMA)(nil)
+
+func NewWMA(period int) *WMA {
+	checkPeriod("WMA", period)
+	return &WMA{Period: period, win: newWindow(period)}
+}
+
+func (w *WMA) Update(x float64) float64 {
+	n := float64(w.win.n)
+	if w.win.full() {
+		// Every value's weight drops by one; the oldest (weight 1) leaves
+		w.weighted += n*x - w.sum
+		old, _ := w.win.push(x)
+		w.sum += x - old
+	} else {
+		w.weighted += (n + 1) * x
+		w.sum += x
+		w.win.push(x)
+	}
+	return w.Value()
+}
+
+func (w *WMA) Ready() bool { return w.win.full() }
+
+func (w *WMA) Value() float64 {
+	n := float64(w.win.n)
+	if n == 0 {
+		return 0
+	}
+	return w.weighted / (n * (n + 1) / 2)
+}
+
+func (w *WMA) State() State {
+	return State{stateKind: "wma", statePeriod: w.Period, "window": w.win.values()}
+}
+
+func (w *WMA) Restore(st State) error {
+	if err := st.check("wma", w.Period); err != nil {
+		return err
+	}
+	xs, err := st.floats("window")
+	if err != nil {
+		return err
+	}
+	w.win.load(xs)
+	w.sum, w.weighted = 0, 0
+	for i, x := range w.win.values() {
+		w.sum += x
+		w.weighted += float64(i+1) * x
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Package indicators provides streaming technical indicators. Each update is
+// O(1) however long the period, and every indicator's state can be saved
+// (e.g. into a strategy checkpoint) and restored after a restart.
+package indicators
+
+import (
+	"encoding/json"
+	"fmt"
+
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// Indicator is the common surface of every indicator
+type Indicator interface {
+	Ready() bool // warmed up: Value is meaningful
+	Value() float64
+	State() State // snapshot for checkpoints
+	Restore(s State) error
+}
+
+// Series indicators update from one value per step (usually a close)
+type Series interface {
+	Indicator
+	Update(x float64) float64
+}
+
+// BarSeries indicators update from a whole bar
+type BarSeries interface {
+	Indicator
+	Update(b t.Bar) float64
+}
+
+// State is an indicator's serialisable state. It survives a JSON round trip:
+// Restore accepts the json.Number / []any values a checkpoint loads back.
+type State map[string]any
+
+// State keys shared by all indicators
+const (
+	stateKind   = "kind"
+	statePeriod = "period"
+)
+
+// check confirms s was saved by the same kind of indicator with the same period
+func (s State) check(kind string, period int) error {
+	if k, _ := s[stateKind].(string); k != kind {
+		return fmt.Errorf("indicators: state is for %q, not %q", s[stateKind], kind)
+	}
+	if p, err := s.int(statePeriod); err != nil || p != period {
+		return fmt.Errorf("indicators: %s state has period %v, want %d", kind, s[statePeriod], period)
+	}
+	return nil
+}
+
+func (s State) float(key string) (float64, error) {
+	f, err := toFloat(s[key])
+	if err != nil {
+		return 0, fmt.Errorf("indicators: %s: %w", key, err)
+	}
+	return f, nil
+}
+
+func (s State) int(key string) (int, error) {
+	f, err := s.float(key)
+	return int(f), err
+}
+
+func (s State) floats(key string) ([]float64, error) {
+	switch xs := s[key].(type) {
+	case nil:
+		return nil, nil
+	case []float64:
+		return append([]float64(nil), xs...), nil
+	case []any:
+		out := make([]float64, len(xs))
+		for i, x := range xs {
+			f, err := toFloat(x)
+			if err != nil {
+				return nil, fmt.Errorf("indicators: %s[%d]: %w", key, i, err)
+			}
+			out[i] = f
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("indicators: %s: cannot use %T as []float64", key, s[key])
+}
+
+// Window returns the values a windowed indicator (SMA, WMA) holds, oldest first
+func (s State) Window() ([]float64, error) {
+	return s.floats("window")
+}
+
+// sub returns a nested indicator's state
+func (s State) sub(key string) (State, error) {
+	switch v := s[key].(type) {
+	case State:
+		return v, nil
+	case map[string]any:
+		return State(v), nil
+	}
+	return nil, fmt.Errorf("indicators: %s: cannot use %T as State", key, s[key])
+}
+
+func toFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case json.Number:
+		return n.Float64()
+	}
+	return 0, fmt.Errorf("cannot use %T as a number", v)
+}
+
+// ----------- ROLLING WINDOW -----------
+
+// window is a fixed-size ring buffer of the latest values
+type window struct {
+	buf  []float64
+	head int // index of the oldest value once full
+	n    int
+}
+
+func newWindow(size int) window {
+	return window{buf: make([]float64, size)}
+}
+
+func (w *window) full() bool { return w.n == len(w.buf) }
+
+// push adds x, returning the value it evicted (if the window was full)
+func (w *window) push(x float64) (old float64, evicted bool) {
+	if w.full() {
+		old, evicted = w.buf[w.head], true
+		w.buf[w.head] = x
+		w.head = (w.head + 1) % len(w.buf)
+		return old, evicted
+	}
+	w.buf[(w.head+w.n)%len(w.buf)] = x
+	w.n++
+	return 0, false
+}
+
+// values returns the window's contents, oldest first
+func (w *window) values() []float64 {
+	out := make([]float64, w.n)
+	for i := range out {
+		out[i] = w.buf[(w.head+i)%len(w.buf)]
+	}
+	return out
+}
+
+// load replaces the contents with xs (oldest first), keeping the newest if too many
+func (w *window) load(xs []float64) {
+	if extra := len(xs) - len(w.buf); extra > 0 {
+		xs = xs[extra:]
+	}
+	w.head, w.n = 0, 0
+	for _, x := range xs {
+		w.push(x)
+	}
+}
+
+func checkPeriod(name string, period int) {
+	if period < 1 {
+		panic(fmt.Sprintf("indicators: %s period must be at least 1, got %d", name, period))
+	}
+}
@@ -0,0 +1,186 @@
+package indicators
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+// Closes from the StockCharts moving average worked examples
+var closes = []float64{
+	22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29,
+	22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63,
+}
+
+// Closes from the StockCharts RSI worked example
+var rsiCloses = []float64{
+	44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+	45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+}
+
+func TestSeriesReferenceValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		new    func() Series
+		value  func(Series) float64 // defaults to Value
+		inputs []float64
+		want   []float64 // once Ready, one per remaining input
+	}{
+		{
+			name: "SMA10", new: func() Series { return NewSMA(10) }, inputs: closes,
+			want: []float64{22.221, 22.209, 22.229, 22.259, 22.303, 22.421, 22.613, 22.765, 22.905, 23.076, 23.21},
+		},
+		{
+			name: "EMA10", new: func() Series { return NewEMA(10) }, inputs: closes,
+			want: []float64{22.221, 22.2081, 22.2412, 22.2664, 22.3289, 22.5164, 22.7952, 22.9688, 23.1254, 23.2753, 23.3398},
+		},
+		{
+			name: "WMA10", new: func() Series { return NewWMA(10) }, inputs: closes,
+			want: []float64{22.2429, 22.23, 22.2629, 22.2904, 22.3542, 22.5464, 22.8425, 23.0493, 23.2429, 23.4329, 23.5336},
+		},
+		{
+			name: "StdDev10", new: func() Series { return NewStdDev(10) }, inputs: closes,
+			want: []float64{0.092, 0.0927, 0.1069, 0.1029, 0.1421, 0.3413, 0.5801, 0.6542, 0.7146, 0.7392, 0.7052},
+		},
+		{
+			name: "ZScore10", new: func() Series { return NewZScore(10) }, inputs: closes,
+			want: []float64{0.7498, -0.6366, 1.506, 1.1759, 2.1611, 2.7514, 2.4772, 1.5056, 1.2945, 1.1824, 0.5956},
+		},
+		{
+			name: "Bollinger10x2 upper", new: func() Series { return NewBollinger(10, 2) }, inputs: closes,
+			value: func(s Series) float64 { return s.(*Bollinger).Upper() },
+			want:  []float64{22.4051, 22.3944, 22.4428, 22.4648, 22.5871, 23.1036, 23.7732, 24.0734, 24.3341, 24.5543, 24.6204},
+		},
+		{
+			name: "RSI14", new: func() Series { return NewRSI(14) }, inputs: rsiCloses,
+			want: []float64{70.4641, 66.2496, 66.4809, 69.3469, 66.2947, 57.915},
+		},
+		{
+			name: "MACD3,6,4 signal", new: func() Series { return NewMACD(3, 6, 4) }, inputs: closes,
+			value: func(s Series) float64 { return s.(*MACD).Signal() },
+			want:  []float64{0.0166, 0.018, 0.0051, 0.0139, 0.0227, 0.0468, 0.1276, 0.2447, 0.2897, 0.2942, 0.2819, 0.2267},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := tt.value
+			if value == nil {
+				value = Series.Value
+			}
+			ind := tt.new()
+			var got []float64
+			for _, x := range tt.inputs {
+				ind.Update(x)
+				if ind.Ready() {
+					got = append(got, value(ind))
+				}
+			}
+			require.Len(t, got, len(tt.want))
+			for i := range tt.want {
+				require.InDelta(t, tt.want[i], got[i], 1e-4, "value %d", i)
+			}
+		})
+	}
+}
+
+func TestMACDLineAndHistogram(t *testing.T) {
+	m := NewMACD(3, 6, 4)
+	for _, x := range closes {
+		m.Update(x)
+	}
+	require.InDelta(t, 0.1438, m.Value(), 1e-4)
+	require.InDelta(t, 0.1438-0.2267, m.Histogram(), 1e-4)
+}
+
+func TestBarSeriesReferenceValues(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	hlc := [][3]float64{
+		{48.70, 47.79, 48.16}, {48.72, 48.14, 48.61}, {48.90, 48.39, 48.75}, {48.87, 48.37, 48.63},
+		{48.82, 48.24, 48.74}, {49.05, 48.64, 49.03}, {49.20, 48.94, 49.07}, {49.35, 48.86, 49.32},
+	}
+	atr := NewATR(3)
+	var got []float64
+	for i, p := range hlc {
+		atr.Update(types.Bar{Start: start.Add(time.Duration(i) * time.Minute), High: p[0], Low: p[1], Close: p[2]})
+		if atr.Ready() {
+			got = append(got, atr.Value())
+		}
+	}
+	want := []float64{0.6667, 0.6111, 0.6007, 0.5372, 0.4448, 0.4598}
+	require.Len(t, got, len(want))
+	for i := range want {
+		require.InDelta(t, want[i], got[i], 1e-4, "ATR %d", i)
+	}
+
+	// VWAP: notional where the bar has it, typical price otherwise; resets each trading day
+	v := NewVWAP()
+	v.Update(types.Bar{Start: start, High: 11, Low: 9, Close: 10, Volume: 100})                    // 10 * 100
+	v.Update(types.Bar{Start: start.Add(time.Minute), Close: 13, Volume: 300, Notional: 300 * 12}) // 12 * 300
+	require.InDelta(t, 11.5, v.Value(), 1e-9)
+	v.Update(types.Bar{Start: start.Add(24 * time.Hour), High: 20, Low: 20, Close: 20, Volume: 5})
+	require.InDelta(t, 20.0, v.Value(), 1e-9)
+}
+
+// Saving state part way, round-tripping it through JSON as a checkpoint would,
+// and restoring into a fresh indicator must match an uninterrupted run
+func TestStateRoundTrip(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	bar := func(i int) types.Bar {
+		c := closes[i]
+		return types.Bar{Start: start.Add(time.Duration(i) * time.Minute), High: c + 0.2, Low: c - 0.3, Close: c, Volume: float64(100 + i)}
+	}
+	tests := []struct {
+		name   string
+		new    func() Indicator
+		update func(Indicator, int)
+	}{
+		{"SMA", func() Indicator { return NewSMA(5) }, nil},
+		{"EMA", func() Indicator { return NewEMA(5) }, nil},
+		{"WMA", func() Indicator { return NewWMA(5) }, nil},
+		{"StdDev", func() Indicator { return NewStdDev(5) }, nil},
+		{"ZScore", func() Indicator { return NewZScore(5) }, nil},
+		{"Bollinger", func() Indicator { return NewBollinger(5, 2) }, nil},
+		{"RSI", func() Indicator { return NewRSI(5) }, nil},
+		{"MACD", func() Indicator { return NewMACD(3, 6, 4) }, nil},
+		{"ATR", func() Indicator { return NewATR(5) }, func(ind Indicator, i int) { ind.(BarSeries).Update(bar(i)) }},
+		{"VWAP", func() Indicator { return NewVWAP() }, func(ind Indicator, i int) { ind.(BarSeries).Update(bar(i)) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update := tt.update
+			if update == nil {
+				update = func(ind Indicator, i int) { ind.(Series).Update(closes[i]) }
+			}
+			full, resumed := tt.new(), tt.new()
+			for i := range 8 {
+				update(full, i)
+			}
+
+			data, err := json.Marshal(full.State())
+			require.NoError(t, err)
+			dec := json.NewDecoder(strings.NewReader(string(data)))
+			dec.UseNumber()
+			var st State
+			require.NoError(t, dec.Decode(&st))
+			require.NoError(t, resumed.Restore(st))
+
+			for i := 8; i < len(closes); i++ {
+				update(full, i)
+				update(resumed, i)
+				require.Equal(t, full.Ready(), resumed.Ready())
+				require.InDelta(t, full.Value(), resumed.Value(), 1e-9, "step %d", i)
+			}
+		})
+	}
+}
+
+func TestRestoreRejectsMismatchedState(t *testing.T) {
+	require.Error(t, NewSMA(5).Restore(NewSMA(6).State()))
+	require.Error(t, NewSMA(5).Restore(NewEMA(5).State()))
+	require.Error(t, NewBollinger(5, 2).Restore(NewBollinger(5, 2.5).State()))
+	require.Error(t, NewRSI(5).Restore(State{"kind": "rsi", "period": 5}))
+}
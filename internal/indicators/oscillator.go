@@ -0,0 +1,141 @@
+package indicators
+
+import "fmt"
+
+// ----------- RSI -----------
+
+// RSI is Wilder's relative strength index over Period changes, 0-100
+type RSI struct {
+	Period  int
+	gains   *EMA
+	losses  *EMA
+	prev    float64
+	hasPrev bool
+}
+
+var _ Series = (*RSI)(nil)
+
+func NewRSI(period int) *RSI {
+	checkPeriod("RSI", period)
+	return &RSI{Period: period, gains: newWilder(period), losses: newWilder(period)}
+}
+
+func (r *RSI) Update(x float64) float64 {
+	if r.hasPrev {
+		change := x - r.prev
+		r.gains.Update(max(change, 0))
+		r.losses.Update(max(-change, 0))
+	}
+	r.prev, r.hasPrev = x, true
+	return r.Value()
+}
+
+func (r *RSI) Ready() bool { return r.gains.Ready() }
+
+func (r *RSI) Value() float64 {
+	gain, loss := r.gains.Value(), r.losses.Value()
+	switch {
+	case gain == 0 && loss == 0:
+		return 50 // no movement
+	case loss == 0:
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
+
+func (r *RSI) State() State {
+	return State{
+		stateKind: "rsi", statePeriod: r.Period,
+		"prev": r.prev, "has_prev": r.hasPrev,
+		"gains": r.gains.State(), "losses": r.losses.State(),
+	}
+}
+
+func (r *RSI) Restore(st State) error {
+	if err := st.check("rsi", r.Period); err != nil {
+		return err
+	}
+	prev, err := st.float("prev")
+	if err != nil {
+		return err
+	}
+	for key, avg := range map[string]*EMA{"gains": r.gains, "losses": r.losses} {
+		sub, err := st.sub(key)
+		if err != nil {
+			return err
+		}
+		if err := avg.Restore(sub); err != nil {
+			return err
+		}
+	}
+	r.prev = prev
+	r.hasPrev, _ = st["has_prev"].(bool)
+	return nil
+}
+
+// ----------- MACD -----------
+
+// MACD is the gap between a fast & slow EMA (the MACD line, Value), with a
+// signal line EMA of that gap and their difference (the histogram)
+type MACD struct {
+	Fast, Slow, SignalPeriod int
+	fast, slow, signal       *EMA
+}
+
+var _ Series = (*MACD)(nil)
+
+// NewMACD(12, 26, 9) is the classic configuration
+func NewMACD(fast, slow, signal int) *MACD {
+	if fast >= slow {
+		panic(fmt.Sprintf("indicators: MACD fast period (%d) must be shorter than slow (%d)", fast, slow))
+	}
+	return &MACD{
+		Fast: fast, Slow: slow, SignalPeriod: signal,
+		fast: NewEMA(fast), slow: NewEMA(slow), signal: NewEMA(signal),
+	}
+}
+
+func (m *MACD) Update(x float64) float64 {
+	m.fast.Update(x)
+	m.slow.Update(x)
+	if m.slow.Ready() {
+		m.signal.Update(m.Value())
+	}
+	return m.Value()
+}
+
+// Ready once the signal line has warmed up
+func (m *MACD) Ready() bool { return m.signal.Ready() }
+
+func (m *MACD) Value() float64 {
+	if !m.slow.Ready() {
+		return 0
+	}
+	return m.fast.Value() - m.slow.Value()
+}
+
+func (m *MACD) Signal() float64    { return m.signal.Value() }
+func (m *MACD) Histogram() float64 { return m.Value() - m.Signal() }
+
+func (m *MACD) State() State {
+	return State{
+		stateKind: "macd", statePeriod: m.Slow,
+		"fast": m.fast.State(), "slow": m.slow.State(), "signal": m.signal.State(),
+	}
+}
+
+func (m *MACD) Restore(st State) error {
+	if err := st.check("macd", m.Slow); err != nil {
+		return err
+	}
+	for key, avg := range map[string]*EMA{"fast": m.fast, "slow": m.slow, "signal": m.signal} {
+		sub, err := st.sub(key)
+		if err != nil {
+			return err
+		}
+		if err := avg.Restore(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package indicators
+
+import (
+	"fmt"
+	"math"
+
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// ----------- ROLLING STANDARD DEVIATION -----------
+
+// StdDev is the population standard deviation of the last Period values
+type StdDev struct {
+	Period int
+	win    window
+	sum    float64
+	sumSq  float64
+}
+
+var _ Series = (*StdDev)(nil)
+
+func NewStdDev(period int) *StdDev {
+	checkPeriod("StdDev", period)
+	return &StdDev{Period: period, win: newWindow(period)}
+}
+
+func (s *StdDev) Update(x float64) float64 {
+	old, _ := s.win.push(x)
+	s.sum += x - old
+	s.sumSq += x*x - old*old
+	return s.Value()
+}
+
+func (s *StdDev) Ready() bool { return s.win.full() }
+
+// Mean of the window
+func (s *StdDev) Mean() float64 {
+	if s.win.n == 0 {
+		return 0
+	}
+	return s.sum / float64(s.win.n)
+}
+
+func (s *StdDev) Value() float64 {
+	if s.win.n == 0 {
+		return 0
+	}
+	mean := s.Mean()
+	// Clamped: rounding can take a flat window's variance just below zero
+	return math.Sqrt(math.Max(s.sumSq/float64(s.win.n)-mean*mean, 0))
+}
+
+func (s *StdDev) State() State {
+	return State{stateKind: "stddev", statePeriod: s.Period, "window": s.win.values()}
+}
+
+func (s *StdDev) Restore(st State) error {
+	if err := st.check("stddev", s.Period); err != nil {
+		return err
+	}
+	xs, err := st.floats("window")
+	if err != nil {
+		return err
+	}
+	s.win.load(xs)
+	s.sum, s.sumSq = 0, 0
+	for _, x := range s.win.values() {
+		s.sum += x
+		s.sumSq += x * x
+	}
+	return nil
+}
+
+// ----------- Z-SCORE -----------
+
+// ZScore is how many standard deviations the latest value sits from the
+// mean of the last Period values (itself included). 0 for a flat window.
+type ZScore struct {
+	Period int
+	dev    *StdDev
+	last   float64
+}
+
+var _ Series = (*ZScore)(nil)
+
+func NewZScore(period int) *ZScore {
+	checkPeriod("ZScore", period)
+	return &ZScore{Period: period, dev: NewStdDev(period)}
+}
+
+func (z *ZScore) Update(x float64) float64 {
+	z.last = x
+	z.dev.Update(x)
+	return z.Value()
+}
+
+func (z *ZScore) Ready() bool { return z.dev.Ready() }
+
+func (z *ZScore) Value() float64 {
+	sd := z.dev.Value()
+	if sd == 0 {
+		return 0
+	}
+	return (z.last - z.dev.Mean()) / sd
+}
+
+func (z *ZScore) State() State {
+	return State{stateKind: "zscore", statePeriod: z.Period, "last": z.last, "stddev": z.dev.State()}
+}
+
+func (z *ZScore) Restore(st State) error {
+	if err := st.check("zscore", z.Period); err != nil {
+		return err
+	}
+	last, err := st.float("last")
+	if err != nil {
+		return err
+	}
+	dev, err := st.sub("stddev")
+	if err != nil {
+		return err
+	}
+	if err := z.dev.Restore(dev); err != nil {
+		return err
+	}
+	z.last = last
+	return nil
+}
+
+// ----------- BOLLINGER BANDS -----------
+
+// Bollinger bands sit K standard deviations either side of the Period SMA.
+// Value is the middle band.
+type Bollinger struct {
+	Period int
+	K      float64
+	dev    *StdDev
+}
+
+var _ Series = (*Bollinger)(nil)
+
+func NewBollinger(period int, k float64) *Bollinger {
+	checkPeriod("Bollinger", period)
+	return &Bollinger{Period: period, K: k, dev: NewStdDev(period)}
+}
+
+func (b *Bollinger) Update(x float64) float64 {
+	b.dev.Update(x)
+	return b.Value()
+}
+
+func (b *Bollinger) Ready() bool     { return b.dev.Ready() }
+func (b *Bollinger) Value() float64  { return b.Middle() }
+func (b *Bollinger) Middle() float64 { return b.dev.Mean() }
+func (b *Bollinger) Upper() float64  { return b.dev.Mean() + b.K*b.dev.Value() }
+func (b *Bollinger) Lower() float64  { return b.dev.Mean() - b.K*b.dev.Value() }
+
+// PercentB locates x within the bands: 0 at the lower band, 1 at the upper
+func (b *Bollinger) PercentB(x float64) float64 {
+	width := b.Upper() - b.Lower()
+	if width == 0 {
+		return 0.5
+	}
+	return (x - b.Lower()) / width
+}
+
+func (b *Bollinger) State() State {
+	return State{stateKind: "bollinger", statePeriod: b.Period, "k": b.K, "stddev": b.dev.State()}
+}
+
+func (b *Bollinger) Restore(st State) error {
+	if err := st.check("bollinger", b.Period); err != nil {
+		return err
+	}
+	k, err := st.float("k")
+	if err != nil {
+		return err
+	}
+	if k != b.K {
+		return fmt.Errorf("indicators: bollinger state has k %v, want %v", k, b.K)
+	}
+	dev, err := st.sub("stddev")
+	if err != nil {
+		return err
+	}
+	return b.dev.Restore(dev)
+}
+
+// ----------- ATR -----------
+
+// ATR is Wilder's average true range over Period bars
+type ATR struct {
+	Period    int
+	avg       *EMA
+	prevClose float64
+	hasPrev   bool
+}
+
+var _ BarSeries = (*ATR)(nil)
+
+func NewATR(period int) *ATR {
+	checkPeriod("ATR", period)
+	return &ATR{Period: period, avg: newWilder(period)}
+}
+
+func (a *ATR) Update(b t.Bar) float64 {
+	tr := b.High - b.Low
+	if a.hasPrev {
+		tr = math.Max(tr, math.Max(math.Abs(b.High-a.prevClose), math.Abs(b.Low-a.prevClose)))
+	}
+	a.prevClose, a.hasPrev = b.Close, true
+	return a.avg.Update(tr)
+}
+
+func (a *ATR) Ready() bool    { return a.avg.Ready() }
+func (a *ATR) Value() float64 { return a.avg.Value() }
+
+func (a *ATR) State() State {
+	return State{stateKind: "atr", statePeriod: a.Period, "prev_close": a.prevClose, "has_prev": a.hasPrev, "avg": a.avg.State()}
+}
+
+func (a *ATR) Restore(st State) error {
+	if err := st.check("atr", a.Period); err != nil {
+		return err
+	}
+	prev, err := st.float("prev_close")
+	if err != nil {
+		return err
+	}
+	avg, err := st.sub("avg")
+	if err != nil {
+		return err
+	}
+	if err := a.avg.Restore(avg); err != nil {
+		return err
+	}
+	a.prevClose = prev
+	a.hasPrev, _ = st["has_prev"].(bool)
+	return nil
+}
@@ -0,0 +1,77 @@
+package indicators
+
+import (
+	"time"
+
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// VWAP is the volume-weighted average price since the start of the trading
+// day (exchange time). Bars carrying trade notional use it; official bars
+// fall back to their typical price (H+L+C)/3.
+type VWAP struct {
+	notional float64
+	volume   float64
+	last     float64 // latest price, reported until there is volume
+	session  string  // trading day of the running totals, "2006-01-02"
+	loc      *time.Location
+}
+
+var _ BarSeries = (*VWAP)(nil)
+
+func NewVWAP() *VWAP {
+	loc, err := time.LoadLocation(cfg.ExchangeTimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return &VWAP{loc: loc}
+}
+
+func (v *VWAP) Update(b t.Bar) float64 {
+	if day := b.Start.In(v.loc).Format(time.DateOnly); day != v.session {
+		v.notional, v.volume, v.session = 0, 0, day
+	}
+	notional := b.Notional
+	if notional <= 0 {
+		notional = (b.High + b.Low + b.Close) / 3 * b.Volume
+	}
+	v.notional += notional
+	v.volume += b.Volume
+	v.last = b.Close
+	return v.Value()
+}
+
+func (v *VWAP) Ready() bool { return v.volume > 0 }
+
+func (v *VWAP) Value() float64 {
+	if v.volume == 0 {
+		return v.last
+	}
+	return v.notional / v.volume
+}
+
+func (v *VWAP) State() State {
+	return State{
+		stateKind: "vwap", statePeriod: 0,
+		"notional": v.notional, "volume": v.volume, "last": v.last, "session": v.session,
+	}
+}
+
+func (v *VWAP) Restore(st State) error {
+	if err := st.check("vwap", 0); err != nil {
+		return err
+	}
+	var err error
+	if v.notional, err = st.float("notional"); err != nil {
+		return err
+	}
+	if v.volume, err = st.float("volume"); err != nil {
+		return err
+	}
+	if v.last, err = st.float("last"); err != nil {
+		return err
+	}
+	v.session, _ = st["session"].(string)
+	return nil
+}
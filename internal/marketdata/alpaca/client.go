@@ -12,17 +12,13 @@ import (
 	t "github.com/joshskilla/trading-bot/internal/types"
 )
 
-// Ensure *Client implements marketdata.BarProvider
-var _ md.BarProvider = (*Client)(nil)
+// Ensure *Client implements marketdata.HistoricalProvider
+var _ md.HistoricalProvider = (*Client)(nil)
+var _ md.FeedProvider = (*Client)(nil)
 
 type Client struct {
-	api *alpacaMD.Client
-
-	barInterval time.Duration
-	start       time.Time // inclusive, UTC
-	end         time.Time // exclusive, UTC
-
-	cache map[t.Asset]map[time.Time]t.Bar // asset -> start time -> bar
+	api    *alpacaMD.Client
+	window *md.Window // the backtest window's bars, fetched per asset on first use
 }
 
 // NewClient builds an Alpaca market data client.
@@ -32,39 +28,13 @@ func NewClient(apiKey, apiSecret string, barInterval time.Duration, start, end t
 		APISecret: apiSecret,
 		// Feed: alpacaAPI.IEX, // default feed is IEX
 	}
-	return &Client{
-		api:         alpacaMD.NewClient(opts),
-		barInterval: barInterval,
-		start:       start,
-		end:         end,
-		cache:       make(map[t.Asset]map[time.Time]t.Bar),
-	}
+	c := &Client{api: alpacaMD.NewClient(opts)}
+	c.window = md.NewWindow(c, barInterval, start, end)
+	return c
 }
 
 func (c *Client) Preload(ctx context.Context, assets []t.Asset) error {
-	s := t.IntervalStart(c.start, c.barInterval)
-	e := c.end.Add(c.barInterval) // pad end (end-exclusive guard)
-
-	for _, a := range assets {
-		if err := c.preloadAsset(ctx, a, s, e); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (c *Client) preloadAsset(ctx context.Context, a t.Asset, s, e time.Time) error {
-	bars, err := c.FetchBars(ctx, a, s, e, c.barInterval)
-	if err != nil {
-		return err
-	}
-	if _, ok := c.cache[a]; !ok {
-		c.cache[a] = make(map[time.Time]t.Bar, len(bars))
-	}
-	for _, b := range bars {
-		c.cache[a][b.Start.UTC()] = b
-	}
-	return nil
+	return c.window.Preload(ctx, assets)
 }
 
 // FetchBars implements BarProvider with explicit start/end and bar interval.
@@ -84,13 +54,9 @@ func (client *Client) FetchBars(
 		return nil, err
 	}
 
-	feed, err := StringToFeed(asset.Exchange)
+	feed, err := feedFor(asset)
 	if err != nil {
-		defaultFeed, err2 := StringToFeed(cfg.Feed)
-		if err2 != nil {
-			return nil, fmt.Errorf("alpaca: invalid default feed %q: %w", cfg.Feed, err2)
-		}
-		feed = defaultFeed
+		return nil, err
 	}
 
 	req := alpacaMD.GetBarsRequest{
@@ -118,11 +84,33 @@ func (client *Client) FetchBars(
 			Low:      b.Low,
 			Close:    b.Close,
 			Volume:   float64(b.Volume),
+			Status:   t.BarStatusOfficial, // historical bars are final
 		})
 	}
 	return out, nil
 }
 
+// Feed names the data feed the asset's bars are fetched from
+func (client *Client) Feed(asset t.Asset) string {
+	feed, err := feedFor(asset)
+	if err != nil {
+		return ""
+	}
+	return string(feed)
+}
+
+// The asset's exchange if it names a feed, else the configured default feed
+func feedFor(asset t.Asset) (alpacaMD.Feed, error) {
+	if feed, err := StringToFeed(asset.Exchange); err == nil {
+		return feed, nil
+	}
+	feed, err := StringToFeed(cfg.Feed)
+	if err != nil {
+		return "", fmt.Errorf("alpaca: invalid default feed %q: %w", cfg.Feed, err)
+	}
+	return feed, nil
+}
+
 func timeFrameFromDuration(d time.Duration) (alpacaMD.TimeFrame, error) {
 	switch {
 	case d%time.Minute == 0 && d < time.Hour:
@@ -155,29 +143,7 @@ func StringToFeed(s string) (alpacaMD.Feed, error) {
 // --- BarProvider interface ---
 
 func (c *Client) FetchBarAt(ctx context.Context, asset t.Asset, now time.Time) (t.Bar, bool, error) {
-	aligned := t.IntervalStart(now.UTC(), c.barInterval)
-
-	// If we already have this asset cached, fast path
-	if m, ok := c.cache[asset]; ok {
-		if b, ok := m[aligned]; ok {
-			return b, true, nil
-		}
-		// Asset is cached for full window; missing bucket => no data
-		return t.Bar{}, false, nil
-	}
-
-	// Asset not cached yet: preload full window for this asset
-	s := t.IntervalStart(c.start, c.barInterval)
-	e := c.end.Add(c.barInterval)
-	if err := c.preloadAsset(ctx, asset, s, e); err != nil {
-		return t.Bar{}, false, err
-	}
-
-	// Serve after preload
-	if b, ok := c.cache[asset][aligned]; ok {
-		return b, true, nil
-	}
-	return t.Bar{}, false, nil
+	return c.window.BarAt(ctx, asset, now)
 }
 
 func (c *Client) IncludeAssets(ctx context.Context, assets []t.Asset) error {
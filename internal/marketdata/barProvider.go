@@ -17,4 +17,19 @@ type BarProvider interface {
 
 	// Releases stream/resources (idempotent)
 	Close() error
-}
\ No newline at end of file
+}
+
+// HistoricalProvider is a BarProvider that can also serve arbitrary historical ranges.
+type HistoricalProvider interface {
+	BarProvider
+
+	// Fetches historical bars of length interval for the given asset and [start, end) range.
+	FetchBars(ctx context.Context, asset t.Asset, start, end time.Time, interval time.Duration) ([]t.Bar, error)
+}
+
+// FeedProvider is a provider whose bars for an asset depend on the data feed
+// they're fetched from (e.g. Alpaca's IEX vs SIP), so caches keep them apart.
+type FeedProvider interface {
+	// Names the feed the asset's bars come from ("" => the provider's only feed)
+	Feed(asset t.Asset) string
+}
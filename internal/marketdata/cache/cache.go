@@ -0,0 +1,309 @@
+// internal/marketdata/cache/cache.go
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	md "github.com/joshskilla/trading-bot/internal/marketdata"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// Ensure *Provider implements marketdata.HistoricalProvider
+var _ md.HistoricalProvider = (*Provider)(nil)
+
+const (
+	DefaultDir = "data/bars" // relative to BOT_PATH
+	dayLayout  = "2006-01-02"
+	dayFileExt = ".jsonl"
+	day        = 24 * time.Hour
+)
+
+// Days ending within this delay of now are not persisted,
+// as the source may still be revising their bars.
+const SettleDelay = time.Hour
+
+// Provider is a BarProvider decorator persisting fetched bars on disk under
+// <dir>/<exchange>/<feed>/<symbol>/<interval>/<YYYY-MM-DD>.jsonl. A day file
+// (possibly empty) marks that day as fully stored, so only missing days hit the source.
+type Provider struct {
+	source md.HistoricalProvider
+	dir    string
+	window *md.Window // the backtest window's bars, served from disk per asset on first use
+
+	SourceCalls int // number of FetchBars calls made to the source
+}
+
+// NewProvider wraps source with an on-disk cache rooted at dir.
+func NewProvider(source md.HistoricalProvider, dir string, barInterval time.Duration, start, end time.Time) *Provider {
+	p := &Provider{source: source, dir: dir}
+	p.window = md.NewWindow(p, barInterval, start, end)
+	return p
+}
+
+// FetchBars serves [start, end) from disk, fetching only the missing days from the source.
+func (p *Provider) FetchBars(
+	ctx context.Context,
+	asset t.Asset,
+	start, end time.Time,
+	interval time.Duration,
+) ([]t.Bar, error) {
+
+	if start.IsZero() || end.IsZero() || !end.After(start) {
+		return nil, fmt.Errorf("cache: invalid time window (start=%v end=%v)", start, end)
+	}
+	start, end = start.UTC(), end.UTC()
+	dir := p.seriesDir(asset, interval)
+
+	var out []t.Bar
+	for _, gap := range MissingRanges(dir, start, end) {
+		p.SourceCalls++
+		fetched, err := p.source.FetchBars(ctx, asset, gap.Start, gap.End, interval)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.storeDays(dir, gap, fetched); err != nil {
+			return nil, err
+		}
+		out = append(out, fetched...)
+	}
+
+	stored, err := loadDays(dir, asset, interval, start, end)
+	if err != nil {
+		return nil, err
+	}
+	out = mergeBars(out, stored)
+
+	// Trim to requested window
+	inWindow := out[:0]
+	for _, b := range out {
+		if !b.Start.Before(start) && b.Start.Before(end) {
+			inWindow = append(inWindow, b)
+		}
+	}
+	return inWindow, nil
+}
+
+// Bars of one symbol may differ by exchange & feed, so each gets its own series
+func (p *Provider) seriesDir(asset t.Asset, interval time.Duration) string {
+	feed := ""
+	if fp, ok := p.source.(md.FeedProvider); ok {
+		feed = fp.Feed(asset)
+	}
+	return filepath.Join(p.dir, pathPart(asset.Exchange), pathPart(feed), asset.Symbol, IntervalLabel(interval))
+}
+
+// Stands in for an unset exchange or feed in a series path
+const defaultPart = "default"
+
+func pathPart(s string) string {
+	if s == "" {
+		return defaultPart
+	}
+	return s
+}
+
+// storeDays writes one file per complete day in gap, including empty days.
+func (p *Provider) storeDays(dir string, gap Range, bars []t.Bar) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	byDay := make(map[time.Time][]t.Bar)
+	for _, b := range bars {
+		d := b.Start.UTC().Truncate(day)
+		byDay[d] = append(byDay[d], b)
+	}
+	settled := time.Now().UTC().Add(-SettleDelay)
+	for d := gap.Start; d.Before(gap.End); d = d.Add(day) {
+		if d.Add(day).After(settled) {
+			break // day incomplete at source: keep fetching it until it settles
+		}
+		if err := writeDay(filepath.Join(dir, d.Format(dayLayout)+dayFileExt), byDay[d]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- Gap detection ---
+
+// Range is a half-open [Start, End) span of whole UTC days.
+type Range struct {
+	Start time.Time
+	End   time.Time
+}
+
+// MissingRanges returns the contiguous day ranges covering [start, end)
+// that have no day file in dir.
+func MissingRanges(dir string, start, end time.Time) []Range {
+	var gaps []Range
+	first := start.UTC().Truncate(day)
+	for d := first; d.Before(end); d = d.Add(day) {
+		path := filepath.Join(dir, d.Format(dayLayout)+dayFileExt)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if n := len(gaps); n > 0 && gaps[n-1].End.Equal(d) {
+			gaps[n-1].End = d.Add(day)
+			continue
+		}
+		gaps = append(gaps, Range{Start: d, End: d.Add(day)})
+	}
+	return gaps
+}
+
+// --- Day files ---
+
+// storedBar is the on-disk form of a bar (asset & interval come from the path)
+type storedBar struct {
+	Start      time.Time   `json:"t"`
+	Open       float64     `json:"o"`
+	High       float64     `json:"h"`
+	Low        float64     `json:"l"`
+	Close      float64     `json:"c"`
+	Volume     float64     `json:"v"`
+	Notional   float64     `json:"nv,omitempty"`
+	TradeCount int         `json:"n,omitempty"`
+	Status     t.BarStatus `json:"s,omitempty"`
+}
+
+func writeDay(path string, bars []t.Bar) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, b := range bars {
+		if err := enc.Encode(storedBar{
+			Start: b.Start.UTC(), Open: b.Open, High: b.High, Low: b.Low, Close: b.Close,
+			Volume: b.Volume, Notional: b.Notional, TradeCount: b.TradeCount, Status: b.Status,
+		}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// Rename so a crashed write never marks a day as stored
+	return os.Rename(tmp, path)
+}
+
+func loadDays(dir string, asset t.Asset, interval time.Duration, start, end time.Time) ([]t.Bar, error) {
+	var out []t.Bar
+	for d := start.Truncate(day); d.Before(end); d = d.Add(day) {
+		path := filepath.Join(dir, d.Format(dayLayout)+dayFileExt)
+		bars, err := readDay(path, asset, interval)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, bars...)
+	}
+	return out, nil
+}
+
+func readDay(path string, asset t.Asset, interval time.Duration) ([]t.Bar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []t.Bar
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var sb storedBar
+		if err := dec.Decode(&sb); err != nil {
+			return nil, fmt.Errorf("cache: %s: %w", path, err)
+		}
+		out = append(out, t.Bar{
+			Asset: asset, Start: sb.Start.UTC(), End: sb.Start.UTC().Add(interval), Interval: interval,
+			Open: sb.Open, High: sb.High, Low: sb.Low, Close: sb.Close,
+			Volume: sb.Volume, Notional: sb.Notional, TradeCount: sb.TradeCount, Status: sb.Status,
+		})
+	}
+	return out, nil
+}
+
+// mergeBars combines fetched & stored bars, de-duplicated by start and sorted.
+func mergeBars(a, b []t.Bar) []t.Bar {
+	seen := make(map[time.Time]struct{}, len(a)+len(b))
+	out := make([]t.Bar, 0, len(a)+len(b))
+	for _, bars := range [][]t.Bar{a, b} {
+		for _, bar := range bars {
+			if _, ok := seen[bar.Start]; ok {
+				continue
+			}
+			seen[bar.Start] = struct{}{}
+			out = append(out, bar)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+// --- Interval labels ---
+
+// IntervalLabel gives a compact directory name for an interval (e.g. 1m, 4h, 1d).
+func IntervalLabel(d time.Duration) string {
+	switch {
+	case d%day == 0:
+		return strconv.Itoa(int(d/day)) + "d"
+	case d%time.Hour == 0:
+		return strconv.Itoa(int(d/time.Hour)) + "h"
+	case d%time.Minute == 0:
+		return strconv.Itoa(int(d/time.Minute)) + "m"
+	default:
+		return strconv.Itoa(int(d/time.Second)) + "s"
+	}
+}
+
+// ParseInterval is the inverse of IntervalLabel, also accepting Go durations (e.g. 1m0s).
+func ParseInterval(s string) (time.Duration, error) {
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		days, err := strconv.Atoi(n)
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid interval %q", s)
+		}
+		return time.Duration(days) * day, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+	return d, nil
+}
+
+// --- BarProvider interface ---
+
+func (p *Provider) Preload(ctx context.Context, assets []t.Asset) error {
+	return p.window.Preload(ctx, assets)
+}
+
+func (p *Provider) FetchBarAt(ctx context.Context, asset t.Asset, now time.Time) (t.Bar, bool, error) {
+	return p.window.BarAt(ctx, asset, now)
+}
+
+func (p *Provider) IncludeAssets(ctx context.Context, assets []t.Asset) error {
+	return p.Preload(ctx, assets)
+}
+
+func (p *Provider) Close() error { return p.source.Close() }
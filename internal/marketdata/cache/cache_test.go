@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	types "github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource serves one bar per hour and records requested ranges
+type fakeSource struct {
+	calls []Range
+	feed  string
+}
+
+func (f *fakeSource) FetchBars(ctx context.Context, asset types.Asset, start, end time.Time, interval time.Duration) ([]types.Bar, error) {
+	f.calls = append(f.calls, Range{Start: start, End: end})
+	var out []types.Bar
+	for ts := start; ts.Before(end); ts = ts.Add(interval) {
+		out = append(out, types.Bar{
+			Asset: asset, Start: ts, End: ts.Add(interval), Interval: interval,
+			Open: 1, High: 2, Low: 0.5, Close: float64(ts.Hour()), Volume: 10,
+			Status: types.BarStatusOfficial,
+		})
+	}
+	return out, nil
+}
+func (f *fakeSource) FetchBarAt(ctx context.Context, asset types.Asset, ts time.Time) (types.Bar, bool, error) {
+	return types.Bar{}, false, nil
+}
+func (f *fakeSource) IncludeAssets(ctx context.Context, assets []types.Asset) error { return nil }
+func (f *fakeSource) Close() error                                                  { return nil }
+func (f *fakeSource) Feed(asset types.Asset) string                                 { return f.feed }
+
+func TestCache_SecondRunHitsDiskOnly(t *testing.T) {
+	dir := t.TempDir()
+	asset := types.NewAsset("AAPL", "IEX", "stock")
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	end := start.Add(3 * 24 * time.Hour)
+
+	src := &fakeSource{}
+	p := NewProvider(src, dir, time.Hour, start, end)
+	bar, ok, err := p.FetchBarAt(context.Background(), asset, start.Add(26*time.Hour+5*time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 2.0, bar.Close)
+	require.Len(t, src.calls, 1)
+
+	// A fresh provider over the same window makes zero source calls
+	src2 := &fakeSource{}
+	p2 := NewProvider(src2, dir, time.Hour, start, end)
+	bar2, ok, err := p2.FetchBarAt(context.Background(), asset, start.Add(26*time.Hour+5*time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, bar, bar2)
+	require.Empty(t, src2.calls)
+}
+
+func TestCache_FetchesOnlyGaps(t *testing.T) {
+	dir := t.TempDir()
+	asset := types.NewAsset("MSFT", "IEX", "stock")
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	end := start.Add(5 * 24 * time.Hour)
+
+	src := &fakeSource{}
+	p := NewProvider(src, dir, time.Hour, start, end)
+	_, err := p.FetchBars(context.Background(), asset, start, end, time.Hour)
+	require.NoError(t, err)
+
+	// Remove the middle day: only it should be re-fetched
+	series := filepath.Join(dir, "IEX", "default", "MSFT", "1h")
+	require.NoError(t, os.Remove(filepath.Join(series, "2024-03-06.jsonl")))
+	require.Equal(t, []Range{{start.Add(48 * time.Hour), start.Add(72 * time.Hour)}}, MissingRanges(series, start, end))
+
+	src.calls = nil
+	bars, err := p.FetchBars(context.Background(), asset, start, end, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, bars, 5*24)
+	require.Equal(t, []Range{{start.Add(48 * time.Hour), start.Add(72 * time.Hour)}}, src.calls)
+}
+
+func TestCache_ListAndPrune(t *testing.T) {
+	dir := t.TempDir()
+	asset := types.NewAsset("GME", "IEX", "stock")
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	end := start.Add(4 * 24 * time.Hour)
+
+	p := NewProvider(&fakeSource{}, dir, 30*time.Minute, start, end)
+	_, err := p.FetchBars(context.Background(), asset, start, end, 30*time.Minute)
+	require.NoError(t, err)
+
+	series, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	require.Equal(t, "IEX", series[0].Exchange)
+	require.Equal(t, "default", series[0].Feed)
+	require.Equal(t, "GME", series[0].Symbol)
+	require.Equal(t, "30m", series[0].Interval)
+	require.Equal(t, 4, series[0].Days)
+	require.Equal(t, start, series[0].First)
+
+	removed, err := Prune(dir, "gme", "", start.Add(48*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+
+	series, err = List(dir)
+	require.NoError(t, err)
+	require.Equal(t, 2, series[0].Days)
+}
+
+func TestCache_KeepsFeedsApart(t *testing.T) {
+	dir := t.TempDir()
+	asset := types.NewAsset("AAPL", "NASDAQ", "stock")
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	iex := &fakeSource{feed: "iex"}
+	_, err := NewProvider(iex, dir, time.Hour, start, end).FetchBars(context.Background(), asset, start, end, time.Hour)
+	require.NoError(t, err)
+
+	// The same symbol & interval from another feed isn't served the first feed's bars
+	sip := &fakeSource{feed: "sip"}
+	_, err = NewProvider(sip, dir, time.Hour, start, end).FetchBars(context.Background(), asset, start, end, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, sip.calls, 1)
+
+	series, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	require.Equal(t, []string{"iex", "sip"}, []string{series[0].Feed, series[1].Feed})
+	require.Equal(t, "NASDAQ", series[0].Exchange)
+
+	// Pruning a series tidies away its emptied directories
+	_, err = Prune(dir, "", "", time.Time{})
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestIntervalLabelRoundTrip(t *testing.T) {
+	for _, d := range []time.Duration{30 * time.Second, time.Minute, 15 * time.Minute, time.Hour, 24 * time.Hour} {
+		got, err := ParseInterval(IntervalLabel(d))
+		require.NoError(t, err)
+		require.Equal(t, d, got)
+	}
+}
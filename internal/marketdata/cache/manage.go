@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Series summarises the stored days of one symbol & interval from an exchange & feed.
+type Series struct {
+	Exchange string
+	Feed     string
+	Symbol   string
+	Interval string
+	Days     int
+	First    time.Time
+	Last     time.Time
+	Bytes    int64
+}
+
+// Path of the series' directory under dir
+func (s Series) dir(dir string) string {
+	return filepath.Join(dir, s.Exchange, s.Feed, s.Symbol, s.Interval)
+}
+
+// List walks dir and summarises every stored series, sorted by exchange, feed,
+// symbol then interval.
+func List(dir string) ([]Series, error) {
+	var out []Series
+	err := forEachSeries(dir, func(s Series) error {
+		err := forEachDay(s.dir(dir), func(d time.Time, info os.FileInfo) error {
+			if s.Days == 0 || d.Before(s.First) {
+				s.First = d
+			}
+			if s.Days == 0 || d.After(s.Last) {
+				s.Last = d
+			}
+			s.Days++
+			s.Bytes += info.Size()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		out = append(out, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Exchange != b.Exchange {
+			return a.Exchange < b.Exchange
+		}
+		if a.Feed != b.Feed {
+			return a.Feed < b.Feed
+		}
+		if a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		return a.Interval < b.Interval
+	})
+	return out, nil
+}
+
+// Prune deletes stored days matching the filters, returning how many were removed.
+// Empty symbol/interval match everything; a zero before matches every day.
+func Prune(dir, symbol, interval string, before time.Time) (int, error) {
+	series, err := List(dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, s := range series {
+		if symbol != "" && !strings.EqualFold(s.Symbol, symbol) {
+			continue
+		}
+		if interval != "" && s.Interval != interval {
+			continue
+		}
+		seriesDir := s.dir(dir)
+		err := forEachDay(seriesDir, func(d time.Time, info os.FileInfo) error {
+			if !before.IsZero() && !d.Before(before) {
+				return nil
+			}
+			if err := os.Remove(filepath.Join(seriesDir, info.Name())); err != nil {
+				return err
+			}
+			removed++
+			return nil
+		})
+		if err != nil {
+			return removed, err
+		}
+		// Tidy up emptied directories, innermost first (errors ignored: still has files)
+		for d := seriesDir; d != filepath.Clean(dir); d = filepath.Dir(d) {
+			_ = os.Remove(d)
+		}
+	}
+	return removed, nil
+}
+
+// forEachSeries calls fn for every <exchange>/<feed>/<symbol>/<interval> directory under dir.
+func forEachSeries(dir string, fn func(s Series) error) error {
+	exchanges, err := subdirs(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, ex := range exchanges {
+		feeds, err := subdirs(filepath.Join(dir, ex))
+		if err != nil {
+			return err
+		}
+		for _, feed := range feeds {
+			symbols, err := subdirs(filepath.Join(dir, ex, feed))
+			if err != nil {
+				return err
+			}
+			for _, sym := range symbols {
+				intervals, err := subdirs(filepath.Join(dir, ex, feed, sym))
+				if err != nil {
+					return err
+				}
+				for _, iv := range intervals {
+					if err := fn(Series{Exchange: ex, Feed: feed, Symbol: sym, Interval: iv}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// subdirs names the directories in dir.
+func subdirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() {
+			out = append(out, e.Name())
+		}
+	}
+	return out, nil
+}
+
+// forEachDay calls fn for every well-formed day file in seriesDir.
+func forEachDay(seriesDir string, fn func(d time.Time, info os.FileInfo) error) error {
+	entries, err := os.ReadDir(seriesDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), dayFileExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		d, err := time.Parse(dayLayout, name)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		if err := fn(d, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,33 +2,55 @@ package finnhub
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 
-	cfg "github.com/joshskilla/trading-bot/internal/config"
 	md "github.com/joshskilla/trading-bot/internal/marketdata"
 	t "github.com/joshskilla/trading-bot/internal/types"
 )
 
-// Compile-time check to see if Client implements SampleProvider
+// Compile-time check to see if Client implements BarProvider & SampleProvider
 var _ md.BarProvider = (*Client)(nil)
+var _ md.SampleProvider = (*Client)(nil)
 
 // finnhub.Client is a Finnhub adapter
 type Client struct {
 	Token string
+	URL   string // websocket endpoint (DefaultURL if empty)
+
+	// Backfill fetches bars for intervals the stream missed while
+	// disconnected; without it they are carried forward as BarStatusNoTrades
+	Backfill Backfiller
+
+	// OnState is told of every connection state change (with the error that
+	// caused it, if any). It is called with the stream locked, so must not
+	// call back into the Client.
+	OnState func(ConnState, error)
+
+	// Recorder, if set, keeps every trade message received (see Replay)
+	Recorder *Recorder
+
+	// Reconnect & liveness policy
+	Backoff      Backoff
+	PingInterval time.Duration
+	PongWait     time.Duration
 
 	// WS internals (the stream)
 	wsMu   sync.Mutex
-	wsConn *websocket.Conn
-	start  sync.Once
+	wsConn *websocket.Conn // nil whilst reconnecting
+	stop   func()          // stops the supervisor; nil when not streaming
 
 	// Subscriptions (symbols)
 	subs map[string]struct{}
 
+	// Outages, for backfill
+	gapMu sync.Mutex
+	gaps  []gap
+	now   func() time.Time
+
 	// Latest CLOSED bar per symbol
 	barMu       sync.RWMutex
 	latestBar   map[string]t.Bar // by symbol
@@ -45,13 +67,22 @@ type Client struct {
 	// Dont hold locks together but if needed, aggMu then barMu then sampleMu
 }
 
+// Backfiller serves official bars over REST (e.g. an alpaca.Client)
+type Backfiller interface {
+	FetchBars(ctx context.Context, asset t.Asset, start, end time.Time, interval time.Duration) ([]t.Bar, error)
+}
+
 func NewClient(token string, interval time.Duration) *Client {
 	if interval <= 0 {
 		interval = time.Minute
 	}
 	return &Client{
 		Token:        token,
+		Backoff:      DefaultBackoff(),
+		PingInterval: defaultPingInterval,
+		PongWait:     defaultPongWait,
 		subs:         make(map[string]struct{}),
+		now:          time.Now,
 		latestSample: make(map[string]t.Sample),
 		barInterval:  interval,
 		agg:          t.NewAggregator(interval),
@@ -68,129 +99,56 @@ func NewClientWithAssets(ctx context.Context, token string, interval time.Durati
 }
 
 // AddToStream starts the WS (on the first call) and subscribes any new assets.
-// Safe to call multiple times; re-subs are ignored.
+// Safe to call multiple times; re-subs are ignored. Whilst reconnecting,
+// new assets are subscribed once the stream is back.
 func (c *Client) addToStream(ctx context.Context, assets []t.Asset) error {
 	if len(assets) == 0 {
 		return nil
 	}
 
+	c.wsMu.Lock()
+	defer c.wsMu.Unlock()
+
 	// ensure connection (lazy start)
 	if err := c.ensureConn(ctx); err != nil {
 		return err
 	}
 
 	// subscribe any new symbols
-	c.wsMu.Lock()
-	defer c.wsMu.Unlock()
-
 	for _, a := range assets {
 		sym := a.Symbol
 		if _, exists := c.subs[sym]; exists {
 			continue
 		}
-		msg := fmt.Sprintf(`{"type":"subscribe","symbol":"%s"}`, sym)
-		if err := c.wsConn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
-			return err
+		if c.wsConn != nil {
+			if err := subscribe(c.wsConn, sym); err != nil {
+				// the supervisor reconnects & resubscribes
+				fmt.Printf("finnhub: subscribe %s: %v\n", sym, err)
+			}
 		}
 		c.subs[sym] = struct{}{}
 	}
 	return nil
 }
 
-// Close stream (WS connection)
+// Close stream (WS connection) and stop reconnecting. A later
+// subscription starts it again.
 func (c *Client) Close() error {
 	c.wsMu.Lock()
 	defer c.wsMu.Unlock()
+	if c.stop == nil {
+		return nil
+	}
+	c.stop()
+	c.stop = nil
 	if c.wsConn != nil {
 		_ = c.wsConn.Close()
 		c.wsConn = nil
 	}
+	c.setState(StateClosed, nil)
 	return nil
 }
 
-func (c *Client) getConn() *websocket.Conn {
-	c.wsMu.Lock()
-	defer c.wsMu.Unlock()
-	return c.wsConn
-}
-
-// ensureConn connects the WS if not already connected.
-func (c *Client) ensureConn(ctx context.Context) error {
-	var dialErr error
-	c.start.Do(func() {
-		url := fmt.Sprintf("wss://ws.finnhub.io?token=%s", c.Token)
-		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
-		if err != nil {
-			dialErr = err
-			return
-		}
-		c.wsMu.Lock()
-		c.wsConn = conn
-		c.wsMu.Unlock()
-		go c.readLoop(ctx)
-	})
-	if dialErr != nil {
-		return dialErr
-	}
-	// If start.Do already ran before, make sure conn still exists; if it was closed, re-dial.
-	if c.getConn() == nil {
-		c.start = sync.Once{} // reset so conn can be restarted
-		return c.ensureConn(ctx)
-	}
-	return nil
-}
-
-// --- WS stream support ---
-
-type wsTradeMsg struct {
-	Type string `json:"type"`
-	Data []struct {
-		S string  `json:"s"` // symbol
-		P float64 `json:"p"` // price
-		T int64   `json:"t"` // ms since epoch
-		V float64 `json:"v"` // volume
-	} `json:"data"`
-}
-
-// goroutine: read messages, parse, and update latest sample & bars
-// Usually uses trades to update the building bar in aggregator,
-// but can also patch the last closed bar if a late trade arrives.
-func (c *Client) readLoop(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			_ = c.Close()
-			return
-		default:
-			c.wsMu.Lock()
-			conn := c.wsConn
-			c.wsMu.Unlock()
-			if conn == nil {
-				return
-			}
-			_, msg, err := conn.ReadMessage()
-			if err != nil {
-				_ = c.Close()
-				return // simple: exit (reconnect policy can be added later)
-			}
-			var m wsTradeMsg
-			if err := json.Unmarshal(msg, &m); err != nil || m.Type != "trade" {
-				continue
-			}
-			for _, d := range m.Data {
-				asset := t.NewAsset(d.S, cfg.Exchange, cfg.AssetType)
-				ts := time.Unix(0, d.T*int64(time.Millisecond))
-
-				// Update latest trade
-				c.setLatestSample(t.NewSample(asset, ts, d.P, d.V))
-
-				// Updates latestBar or new bar being built
-				c.applyTradeToBar(asset, ts, d.P, d.V)
-			}
-		}
-	}
-}
-
 // applyTradeToBar routes a trade to the correct place under locks:
 // - if same interval as current building bar → update building bar
 // - if late for the latest closed bar → patch last closed (latest) bar
@@ -277,7 +235,8 @@ func (c *Client) peekLastClosedBar(symbol string) (t.Bar, bool) {
 
 // GetLatestBar returns the most recent closed bar for a symbol.
 // If we have crossed interval boundaries with no trades, it will use
-// zero-volume carry-forward bars up to now, using the last known price.
+// zero-volume carry-forward bars up to now, using the last known price,
+// unless the stream was down and Backfill has the official bar.
 // For users of client to ensure correctness.
 func (c *Client) GetLatestBar(ctx context.Context, asset t.Asset, now time.Time) (t.Bar, bool, error) {
 	// Ensure the asset is added to the stream if not already there
@@ -291,12 +250,20 @@ func (c *Client) GetLatestBar(ctx context.Context, asset t.Asset, now time.Time)
 		}
 	}
 
+	bar, ok := c.barAt(ctx, asset, now)
+	return bar, ok, nil
+}
+
+// The last closed bar as of now, from the trades handled so far
+func (c *Client) barAt(ctx context.Context, asset t.Asset, now time.Time) (t.Bar, bool) {
 	// Finalise building bar if required
 	_, _ = c.finalizeBuildingIfElapsed(asset, now)
 
+	// Replace the last closed bar from REST if the stream was down during it
+	c.backfillIfMissed(ctx, asset, now)
+
 	// Ensure bars are up-to-date to for last closed interval
-	bar, ok := c.ensureBarsUpToNow(asset.Symbol, now)
-	return bar, ok, nil
+	return c.ensureBarsUpToNow(asset.Symbol, now)
 }
 
 // Will ensure bars are up-to-date to now, filling in missed last close interval if necessary with
@@ -321,8 +288,9 @@ func (c *Client) ensureBarsUpToNow(symbol string, now time.Time) (t.Bar, bool) {
 		// no bars and no samples
 		return t.Bar{}, false
 	}
-	if !ok && has {
+	if has && (!ok || sm.Time.Before(last.End)) {
 		// fabricate a 0-volume "sample" using last bar close price
+		// (also when the bar is newer, e.g. backfilled)
 		sm = t.NewSample(last.Asset, validLastStart, last.Close, 0)
 	}
 
@@ -332,6 +300,32 @@ func (c *Client) ensureBarsUpToNow(symbol string, now time.Time) (t.Bar, bool) {
 	return b, true
 }
 
+// Sets the official last closed bar for the asset if the stream missed
+// (some of) its interval. Falls back to the streamed/carried-forward bar
+// if there is no Backfill or it has no bar.
+func (c *Client) backfillIfMissed(ctx context.Context, asset t.Asset, now time.Time) {
+	currStart := t.IntervalStart(now, c.barInterval)
+	lastStart := currStart.Add(-c.barInterval)
+	if c.Backfill == nil || !c.missed(lastStart, currStart) {
+		return
+	}
+	if last, ok := c.peekLastClosedBar(asset.Symbol); ok && last.Start.Equal(lastStart) && last.IsOfficial() {
+		return // already backfilled
+	}
+	bars, err := c.Backfill.FetchBars(ctx, asset, lastStart, currStart, c.barInterval)
+	if err != nil {
+		fmt.Printf("finnhub: backfill %s %s: %v\n", asset.Symbol, lastStart.Format(time.RFC3339), err)
+		return
+	}
+	for _, b := range bars {
+		if b.Start.Equal(lastStart) {
+			b.SetStatus(t.BarStatusOfficial)
+			c.setLatestBar(b)
+			return
+		}
+	}
+}
+
 // Close, set & return the current building bar its interval has completed
 func (c *Client) finalizeBuildingIfElapsed(asset t.Asset, now time.Time) (t.Bar, bool) {
 	c.aggMu.Lock()
@@ -381,6 +375,25 @@ func (c *Client) setLatestSample(s t.Sample) {
 	c.sampleMu.Unlock()
 }
 
+// --- SampleProvider interface ---
+
+// FetchSample returns the latest trade seen on the stream for the asset.
+// Subscribes the asset if needed; errors if no trade has arrived yet.
+func (c *Client) FetchSample(ctx context.Context, asset t.Asset) (t.Sample, error) {
+	if err := c.addToStream(ctx, []t.Asset{asset}); err != nil {
+		return t.Sample{}, err
+	}
+	sm, ok := c.getLatestSample(asset.Symbol)
+	if !ok {
+		return t.Sample{}, fmt.Errorf("finnhub: no trades received yet for %s", asset.Symbol)
+	}
+	return sm, nil
+}
+
+func (c *Client) AddToStream(ctx context.Context, assets []t.Asset) error {
+	return c.addToStream(ctx, assets)
+}
+
 // --- BarProvider interface ---
 
 func (c *Client) IncludeAssets(ctx context.Context, assets []t.Asset) error {
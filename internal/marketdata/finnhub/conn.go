@@ -0,0 +1,319 @@
+package finnhub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// DefaultURL is Finnhub's trade stream
+const DefaultURL = "wss://ws.finnhub.io"
+
+const (
+	defaultPingInterval = 15 * time.Second
+	defaultPongWait     = 30 * time.Second // silence (no messages or pongs) before the link is presumed dead
+	writeWait           = 5 * time.Second
+	maxGaps             = 64 // outages remembered for backfill
+)
+
+// ConnState is the websocket's connection state, as reported to OnState
+type ConnState int
+
+const (
+	StateConnecting   ConnState = iota // first dial
+	StateConnected                     // streaming, all subscriptions sent
+	StateReconnecting                  // link lost, redialling with backoff
+	StateClosed                        // Close called or context done
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("ConnState(%d)", int(s))
+	}
+}
+
+// Backoff spaces out redials: the delay doubles from Min up to Max, with
+// each wait jittered down by up to half so clients don't redial in step
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+func DefaultBackoff() Backoff {
+	return Backoff{Min: 500 * time.Millisecond, Max: 30 * time.Second}
+}
+
+// Delay before redial attempt n (from 0)
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := b.Min
+	for i := 0; i < attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	d = min(d, b.Max)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// Outage window [from, to); to is zero while still disconnected
+type gap struct {
+	from, to time.Time
+}
+
+func (g gap) overlaps(start, end time.Time) bool {
+	return g.from.Before(end) && (g.to.IsZero() || g.to.After(start))
+}
+
+// ----------- CONNECTING -----------
+
+func (c *Client) url() string {
+	base := c.URL
+	if base == "" {
+		base = DefaultURL
+	}
+	return fmt.Sprintf("%s?token=%s", base, c.Token)
+}
+
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, c.url(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("finnhub: dial: %w", err)
+	}
+	return conn, nil
+}
+
+// ensureConn dials the stream and starts its supervisor if not already
+// running. Call with wsMu held. Whilst the supervisor is redialling there
+// is no conn: new subscriptions are sent once it reconnects.
+func (c *Client) ensureConn(ctx context.Context) error {
+	if c.stop != nil {
+		return nil
+	}
+	c.setState(StateConnecting, nil)
+	conn, err := c.dial(ctx)
+	if err != nil {
+		c.setState(StateClosed, err)
+		return err
+	}
+	c.wsConn = conn
+
+	// ctx outlives this call: it bounds the stream, as Close does
+	sctx, cancel := context.WithCancel(ctx)
+	unwatch := context.AfterFunc(ctx, func() { _ = c.Close() })
+	c.stop = func() {
+		unwatch()
+		cancel()
+	}
+	c.setState(StateConnected, nil)
+	go c.supervise(sctx, conn)
+	return nil
+}
+
+// goroutine: reads the stream and, whenever the link drops, redials with
+// backoff, resubscribes and records the outage so its bars are backfilled
+func (c *Client) supervise(ctx context.Context, conn *websocket.Conn) {
+	for {
+		err := c.readLoop(conn)
+		if ctx.Err() != nil {
+			return // closed
+		}
+		down := c.now()
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			down = down.Add(-c.PongWait) // silent since at least then
+		}
+		c.gapOpened(down)
+		c.wsMu.Lock()
+		if c.wsConn == conn {
+			c.wsConn = nil
+		}
+		c.wsMu.Unlock()
+		_ = conn.Close()
+		c.setState(StateReconnecting, err)
+
+		if conn = c.reconnect(ctx); conn == nil {
+			return
+		}
+		c.gapClosed(c.now())
+		c.setState(StateConnected, nil)
+	}
+}
+
+// Redials until connected & resubscribed, or ctx is done (nil)
+func (c *Client) reconnect(ctx context.Context) *websocket.Conn {
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.Backoff.Delay(attempt)):
+		}
+		conn, err := c.dial(ctx)
+		if err == nil {
+			c.wsMu.Lock()
+			if ctx.Err() != nil {
+				c.wsMu.Unlock()
+				_ = conn.Close()
+				return nil
+			}
+			if err = c.resubscribe(conn); err == nil {
+				c.wsConn = conn
+				c.wsMu.Unlock()
+				return conn
+			}
+			c.wsMu.Unlock()
+			_ = conn.Close()
+		}
+		c.setState(StateReconnecting, err)
+	}
+}
+
+// Sends every subscription on a new conn. Call with wsMu held.
+func (c *Client) resubscribe(conn *websocket.Conn) error {
+	for sym := range c.subs {
+		if err := subscribe(conn, sym); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func subscribe(conn *websocket.Conn, symbol string) error {
+	msg := fmt.Sprintf(`{"type":"subscribe","symbol":"%s"}`, symbol)
+	return conn.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+func (c *Client) setState(s ConnState, err error) {
+	if c.OnState != nil {
+		c.OnState(s, err)
+	}
+}
+
+// ----------- READING -----------
+
+// --- WS stream support ---
+
+type wsTradeMsg struct {
+	Type string    `json:"type"`
+	Data []wsTrade `json:"data"`
+}
+
+type wsTrade struct {
+	S string  `json:"s"` // symbol
+	P float64 `json:"p"` // price
+	T int64   `json:"t"` // ms since epoch
+	V float64 `json:"v"` // volume
+}
+
+// read messages, parse, and update latest sample & bars until the conn fails.
+// Usually uses trades to update the building bar in aggregator,
+// but can also patch the last closed bar if a late trade arrives.
+// Any message (Finnhub's own pings included) or pong proves the link is
+// alive; PongWait without one fails the read.
+func (c *Client) readLoop(conn *websocket.Conn) error {
+	done := make(chan struct{})
+	defer close(done)
+	go c.pingLoop(conn, done)
+
+	alive := func() error { return conn.SetReadDeadline(time.Now().Add(c.PongWait)) }
+	conn.SetPongHandler(func(string) error { return alive() })
+	for {
+		if err := alive(); err != nil {
+			return err
+		}
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if c.handleMessage(msg) && c.Recorder != nil {
+			if err := c.Recorder.Record(c.now(), msg); err != nil {
+				fmt.Printf("finnhub: recording stopped: %v\n", err)
+			}
+		}
+	}
+}
+
+// Applies a trade message to the latest samples & bars (false if it isn't one)
+func (c *Client) handleMessage(msg []byte) bool {
+	var m wsTradeMsg
+	if err := json.Unmarshal(msg, &m); err != nil || m.Type != "trade" {
+		return false
+	}
+	for _, d := range m.Data {
+		asset := t.NewAsset(d.S, cfg.Exchange, cfg.AssetType)
+		ts := time.Unix(0, d.T*int64(time.Millisecond))
+
+		// Update latest trade
+		c.setLatestSample(t.NewSample(asset, ts, d.P, d.V))
+
+		// Updates latestBar or new bar being built
+		c.applyTradeToBar(asset, ts, d.P, d.V)
+	}
+	return true
+}
+
+// goroutine: pings the server every PingInterval until done
+func (c *Client) pingLoop(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(c.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			// WriteControl is safe alongside subscribe writes
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			if err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+				return // the read fails too
+			}
+		}
+	}
+}
+
+// ----------- OUTAGES -----------
+
+func (c *Client) gapOpened(ts time.Time) {
+	c.gapMu.Lock()
+	defer c.gapMu.Unlock()
+	c.gaps = append(c.gaps, gap{from: ts})
+	if len(c.gaps) > maxGaps {
+		c.gaps = c.gaps[len(c.gaps)-maxGaps:]
+	}
+}
+
+func (c *Client) gapClosed(ts time.Time) {
+	c.gapMu.Lock()
+	defer c.gapMu.Unlock()
+	if n := len(c.gaps); n > 0 && c.gaps[n-1].to.IsZero() {
+		c.gaps[n-1].to = ts
+	}
+}
+
+// Whether the stream was down at any point in [start, end)
+func (c *Client) missed(start, end time.Time) bool {
+	c.gapMu.Lock()
+	defer c.gapMu.Unlock()
+	for _, g := range c.gaps {
+		if g.overlaps(start, end) {
+			return true
+		}
+	}
+	return false
+}
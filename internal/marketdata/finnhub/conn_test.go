@@ -0,0 +1,259 @@
+package finnhub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	"github.com/joshskilla/trading-bot/internal/types"
+)
+
+// wsServer is a local Finnhub stream. Each connection reports its
+// subscriptions on subs; serve decides what happens to it after that.
+type wsServer struct {
+	*httptest.Server
+	subs  chan []string                     // per connection, once len(want) are in
+	serve func(n int, conn *websocket.Conn) // after subscribing; returning drops the conn
+	want  int                               // subscriptions per connection
+	mu    sync.Mutex
+	conns int
+}
+
+func newWSServer(t *testing.T, want int, serve func(n int, conn *websocket.Conn)) *wsServer {
+	s := &wsServer{subs: make(chan []string, 8), serve: serve, want: want}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.mu.Lock()
+		s.conns++
+		n := s.conns
+		s.mu.Unlock()
+
+		var syms []string
+		for len(syms) < s.want {
+			var m struct{ Type, Symbol string }
+			if err := conn.ReadJSON(&m); err != nil {
+				return
+			}
+			syms = append(syms, m.Symbol)
+		}
+		sort.Strings(syms)
+		s.subs <- syms
+		s.serve(n, conn)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *wsServer) url() string { return "ws" + strings.TrimPrefix(s.URL, "http") }
+
+func trade(conn *websocket.Conn, sym string, ts time.Time, price float64) error {
+	msg := fmt.Sprintf(`{"type":"trade","data":[{"s":%q,"p":%v,"t":%d,"v":10}]}`, sym, price, ts.UnixMilli())
+	return conn.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+// restBars serves one official bar per requested interval
+type restBars struct{ close float64 }
+
+func (r restBars) FetchBars(ctx context.Context, asset types.Asset, start, end time.Time, interval time.Duration) ([]types.Bar, error) {
+	return []types.Bar{{
+		Asset: asset, Start: start.UTC(), End: start.UTC().Add(interval), Interval: interval,
+		Open: r.close, High: r.close, Low: r.close, Close: r.close, Volume: 500,
+	}}, nil
+}
+
+func testClient(url string) (*Client, <-chan ConnState) {
+	states := make(chan ConnState, 32)
+	c := NewClient("test", time.Minute)
+	c.URL = url
+	c.Backoff = Backoff{Min: 10 * time.Millisecond, Max: 40 * time.Millisecond}
+	c.OnState = func(s ConnState, err error) { states <- s }
+	return c, states
+}
+
+func waitState(t *testing.T, states <-chan ConnState, want ConnState) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case s := <-states:
+			if s == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("never %s", want)
+		}
+	}
+}
+
+func waitSubs(t *testing.T, s *wsServer) []string {
+	t.Helper()
+	select {
+	case syms := <-s.subs:
+		return syms
+	case <-time.After(5 * time.Second):
+		t.Fatal("no subscriptions")
+		return nil
+	}
+}
+
+func TestClient_ReconnectsResubscribesAndBackfills(t *testing.T) {
+	aapl := types.NewAsset("AAPL", cfg.Exchange, cfg.AssetType)
+	msft := types.NewAsset("MSFT", cfg.Exchange, cfg.AssetType)
+	base := time.Date(2024, 1, 2, 14, 29, 0, 0, time.UTC)
+
+	drop := make(chan struct{})
+	srv := newWSServer(t, 2, func(n int, conn *websocket.Conn) {
+		if n == 1 {
+			_ = trade(conn, "AAPL", base.Add(10*time.Second), 100)
+			_ = trade(conn, "MSFT", base.Add(20*time.Second), 200)
+			<-drop
+			return
+		}
+		for { // keep the link up until the client leaves
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	c, states := testClient(srv.url())
+	var clockMu sync.Mutex
+	clock := base
+	c.now = func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return clock
+	}
+	c.Backfill = restBars{close: 123}
+	t.Cleanup(func() { _ = c.Close() })
+
+	ctx := context.Background()
+	require.NoError(t, c.IncludeAssets(ctx, []types.Asset{aapl, msft}))
+	require.Equal(t, []string{"AAPL", "MSFT"}, waitSubs(t, srv))
+	require.Eventually(t, func() bool {
+		_, err := c.FetchSample(ctx, msft)
+		return err == nil
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// Streamed bar from before the outage
+	bar, ok, err := c.FetchBarAt(ctx, aapl, base.Add(time.Minute+5*time.Second))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, types.BarStatusAggregated, bar.Status)
+	require.Equal(t, 100.0, bar.Close)
+
+	// Down from 14:30:30
+	clockMu.Lock()
+	clock = base.Add(90 * time.Second)
+	clockMu.Unlock()
+	close(drop)
+	waitState(t, states, StateReconnecting)
+	waitState(t, states, StateConnected)
+	require.Equal(t, []string{"AAPL", "MSFT"}, waitSubs(t, srv), "resubscribed on the new conn")
+
+	// 14:30-14:31 was missed: official bars from REST
+	for _, a := range []types.Asset{aapl, msft} {
+		bar, ok, err = c.FetchBarAt(ctx, a, base.Add(2*time.Minute+5*time.Second))
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, types.BarStatusOfficial, bar.Status, a.Symbol)
+		require.Equal(t, 123.0, bar.Close)
+		require.Equal(t, base.Add(time.Minute), bar.Start)
+	}
+
+	// 14:31-14:32 was streamed, just quiet: carried forward
+	bar, ok, err = c.FetchBarAt(ctx, aapl, base.Add(3*time.Minute+5*time.Second))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, types.BarStatusNoTrades, bar.Status)
+	require.Equal(t, 123.0, bar.Close)
+
+	require.NoError(t, c.Close())
+	waitState(t, states, StateClosed)
+	require.NoError(t, c.Close())
+}
+
+func TestClient_ReconnectsWhenPongsStop(t *testing.T) {
+	srv := newWSServer(t, 1, func(n int, conn *websocket.Conn) {
+		if n == 1 {
+			time.Sleep(time.Second) // stops reading: pings go unanswered
+			return
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	c, states := testClient(srv.url())
+	c.PingInterval = 20 * time.Millisecond
+	c.PongWait = 100 * time.Millisecond
+	t.Cleanup(func() { _ = c.Close() })
+
+	aapl := types.NewAsset("AAPL", cfg.Exchange, cfg.AssetType)
+	require.NoError(t, c.IncludeAssets(context.Background(), []types.Asset{aapl}))
+	require.Equal(t, []string{"AAPL"}, waitSubs(t, srv))
+	waitState(t, states, StateReconnecting)
+	require.Equal(t, []string{"AAPL"}, waitSubs(t, srv))
+	waitState(t, states, StateConnected)
+
+	// Live links are kept: the second conn answers pings
+	time.Sleep(300 * time.Millisecond)
+	select {
+	case s := <-states:
+		t.Fatalf("unexpected %s", s)
+	default:
+	}
+}
+
+func TestClient_ClosesWithContext(t *testing.T) {
+	srv := newWSServer(t, 1, func(n int, conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	c, states := testClient(srv.url())
+	ctx, cancel := context.WithCancel(context.Background())
+	aapl := types.NewAsset("AAPL", cfg.Exchange, cfg.AssetType)
+	require.NoError(t, c.IncludeAssets(ctx, []types.Asset{aapl}))
+	waitSubs(t, srv)
+
+	cancel()
+	waitState(t, states, StateClosed)
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case s := <-states:
+		t.Fatalf("unexpected %s after close", s)
+	default:
+	}
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Min: 100 * time.Millisecond, Max: time.Second}
+	for attempt, ceil := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		ceil *= time.Millisecond
+		for range 20 {
+			d := b.Delay(attempt)
+			require.GreaterOrEqual(t, d, ceil/2)
+			require.LessOrEqual(t, d, ceil)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// internal/marketdata/finnhub/mock.go
+package finnhub
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// MockTrade is one trade sent by the mock stream
+type MockTrade struct {
+	Symbol string
+	Price  float64
+	Volume float64
+	Time   time.Time
+}
+
+// MockFaults are the odds that a trade sent by Replay or RandomWalk is
+// misdelivered (see SetFaults). For one-off faults use Publish (any timestamp), SendRaw
+// and Disconnect directly.
+type MockFaults struct {
+	Late      float64       // stamped LateBy in the past
+	LateBy    time.Duration // defaults to a minute
+	Duplicate float64       // sent twice
+	Malformed float64       // preceded by a garbage frame
+}
+
+// MockStream is an in-process stand-in for Finnhub's trade stream, speaking
+// its subscribe/trade JSON over a websocket. Each connection receives trades
+// for the symbols it has subscribed to.
+type MockStream struct {
+	Server *httptest.Server
+	Now    func() time.Time // stamps generated & restamped trades (time.Now)
+
+	mu     sync.Mutex
+	faults MockFaults
+	conns  map[*mockConn]struct{}
+	rng    *rand.Rand
+	seen   int // connections ever accepted
+}
+
+type mockConn struct {
+	ws   *websocket.Conn
+	mu   sync.Mutex // one writer at a time
+	subs map[string]struct{}
+}
+
+// NewMockStream serves the mock on a random local port
+func NewMockStream() *MockStream {
+	m := newMockStream()
+	m.Server = httptest.NewServer(http.HandlerFunc(m.handle))
+	return m
+}
+
+// NewMockStreamAt serves the mock on addr (e.g. "localhost:9090")
+func NewMockStreamAt(addr string) (*MockStream, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("finnhub mock: listen on %s: %w", addr, err)
+	}
+	m := newMockStream()
+	m.Server = httptest.NewUnstartedServer(http.HandlerFunc(m.handle))
+	m.Server.Listener.Close()
+	m.Server.Listener = ln
+	m.Server.Start()
+	return m, nil
+}
+
+func newMockStream() *MockStream {
+	return &MockStream{
+		Now:   time.Now,
+		conns: make(map[*mockConn]struct{}),
+		rng:   rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+}
+
+// Seed makes generated prices & faults repeatable
+func (m *MockStream) Seed(seed uint64) {
+	m.mu.Lock()
+	m.rng = rand.New(rand.NewPCG(seed, seed))
+	m.mu.Unlock()
+}
+
+func (m *MockStream) SetFaults(f MockFaults) {
+	m.mu.Lock()
+	m.faults = f
+	m.mu.Unlock()
+}
+
+// URL is the websocket endpoint to set as Client.URL
+func (m *MockStream) URL() string {
+	return "ws" + strings.TrimPrefix(m.Server.URL, "http")
+}
+
+// Client returns a stream client pointed at the mock.
+func (m *MockStream) Client(interval time.Duration) *Client {
+	cl := NewClient("mock-token", interval)
+	cl.URL = m.URL()
+	return cl
+}
+
+func (m *MockStream) Close() {
+	m.Disconnect()
+	m.Server.Close()
+}
+
+// Subscribers counts the open connections subscribed to symbol
+func (m *MockStream) Subscribers(symbol string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for c := range m.conns {
+		c.mu.Lock()
+		if _, ok := c.subs[symbol]; ok {
+			n++
+		}
+		c.mu.Unlock()
+	}
+	return n
+}
+
+// Connections counts the connections accepted so far, dropped ones included
+func (m *MockStream) Connections() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.seen
+}
+
+// ----------- CONNECTIONS -----------
+
+func (m *MockStream) handle(w http.ResponseWriter, r *http.Request) {
+	ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &mockConn{ws: ws, subs: make(map[string]struct{})}
+	m.mu.Lock()
+	m.conns[c] = struct{}{}
+	m.seen++
+	m.mu.Unlock()
+	defer m.drop(c)
+
+	for {
+		var msg struct {
+			Type   string `json:"type"`
+			Symbol string `json:"symbol"`
+		}
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		c.mu.Lock()
+		switch msg.Type {
+		case "subscribe":
+			c.subs[msg.Symbol] = struct{}{}
+		case "unsubscribe":
+			delete(c.subs, msg.Symbol)
+		default:
+			_ = c.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","msg":"Unknown message type"}`))
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (m *MockStream) drop(c *mockConn) {
+	m.mu.Lock()
+	delete(m.conns, c)
+	m.mu.Unlock()
+	_ = c.ws.Close()
+}
+
+// Disconnect drops every open connection, as if the link failed
+func (m *MockStream) Disconnect() {
+	m.mu.Lock()
+	conns := make([]*mockConn, 0, len(m.conns))
+	for c := range m.conns {
+		conns = append(conns, c)
+	}
+	m.mu.Unlock()
+	for _, c := range conns {
+		m.drop(c)
+	}
+}
+
+func (m *MockStream) each(fn func(c *mockConn)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for c := range m.conns {
+		c.mu.Lock()
+		fn(c)
+		c.mu.Unlock()
+	}
+}
+
+// ----------- SENDING -----------
+
+// Publish sends the trades, as one frame per connection, to connections
+// subscribed to their symbols
+func (m *MockStream) Publish(trades ...MockTrade) {
+	m.each(func(c *mockConn) {
+		msg := wsTradeMsg{Type: "trade"}
+		for _, tr := range trades {
+			if _, ok := c.subs[tr.Symbol]; ok {
+				msg.Data = append(msg.Data, wsTrade{S: tr.Symbol, P: tr.Price, T: tr.Time.UnixMilli(), V: tr.Volume})
+			}
+		}
+		if len(msg.Data) == 0 {
+			return
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return
+		}
+		_ = c.ws.WriteMessage(websocket.TextMessage, data)
+	})
+}
+
+// SendRaw sends a frame as is to every connection (e.g. malformed JSON)
+func (m *MockStream) SendRaw(frame []byte) {
+	m.each(func(c *mockConn) {
+		_ = c.ws.WriteMessage(websocket.TextMessage, frame)
+	})
+}
+
+// Sends a generated or replayed trade, subject to Faults
+func (m *MockStream) send(tr MockTrade) {
+	m.mu.Lock()
+	f := m.faults
+	late, dup, bad := m.rng.Float64() < f.Late, m.rng.Float64() < f.Duplicate, m.rng.Float64() < f.Malformed
+	m.mu.Unlock()
+
+	if late {
+		by := f.LateBy
+		if by <= 0 {
+			by = time.Minute
+		}
+		tr.Time = tr.Time.Add(-by)
+	}
+	if bad {
+		m.SendRaw([]byte(`{"type":"trade","data":[{"s":`))
+	}
+	m.Publish(tr)
+	if dup {
+		m.Publish(tr)
+	}
+}
+
+// RandomWalk sends trades in symbol at rate per second until ctx is done,
+// from price, each moving it by a normal step of volatility (a fraction
+// of price)
+func (m *MockStream) RandomWalk(ctx context.Context, symbol string, price, rate, volatility float64) {
+	if rate <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			price *= math.Exp(volatility * m.rng.NormFloat64())
+			volume := float64(1 + m.rng.IntN(100))
+			m.mu.Unlock()
+			m.send(MockTrade{Symbol: symbol, Price: math.Round(price*100) / 100, Volume: volume, Time: m.Now()})
+		}
+	}
+}
+
+// Replay sends recorded trades in order. With speed > 0 they are paced
+// by their recorded gaps (divided by speed) and restamped from Now, so a
+// live client takes them as current; otherwise they are sent at once with
+// their recorded times.
+func (m *MockStream) Replay(ctx context.Context, trades []MockTrade, speed float64) error {
+	if len(trades) == 0 {
+		return nil
+	}
+	first, start, began := trades[0].Time, m.Now(), time.Now()
+	for _, tr := range trades {
+		if speed > 0 {
+			offset := time.Duration(float64(tr.Time.Sub(first)) / speed)
+			if wait := time.Until(began.Add(offset)); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+			tr.Time = start.Add(offset)
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		m.send(tr)
+	}
+	return nil
+}
+
+// ReadTrades reads recorded trades, one JSON object per line: either a
+// Finnhub trade frame ({"type":"trade","data":[...]}) or a single trade
+// ({"s":"AAPL","p":187.2,"t":1704205800000,"v":10})
+func ReadTrades(r io.Reader) ([]MockTrade, error) {
+	var trades []MockTrade
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var msg struct {
+			wsTradeMsg
+			wsTrade
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		data := msg.Data
+		if msg.Type == "" {
+			data = []wsTrade{msg.wsTrade}
+		}
+		for _, d := range data {
+			if d.S == "" {
+				return nil, fmt.Errorf("line %d: trade without a symbol", n)
+			}
+			trades = append(trades, MockTrade{Symbol: d.S, Price: d.P, Volume: d.V, Time: time.UnixMilli(d.T)})
+		}
+	}
+	return trades, sc.Err()
+}
@@ -0,0 +1,149 @@
+package finnhub
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	"github.com/joshskilla/trading-bot/internal/types"
+)
+
+// Subscribes a bare websocket to the mock and returns its next frames
+func rawFrames(t *testing.T, m *MockStream, symbol string) func(n int) []string {
+	conn, _, err := websocket.DefaultDialer.Dial(m.URL()+"?token=test", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, subscribe(conn, symbol))
+	require.Eventually(t, func() bool { return m.Subscribers(symbol) == 1 }, 5*time.Second, 5*time.Millisecond)
+
+	return func(n int) []string {
+		t.Helper()
+		frames := make([]string, n)
+		for i := range frames {
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, msg, err := conn.ReadMessage()
+			require.NoError(t, err)
+			frames[i] = string(msg)
+		}
+		return frames
+	}
+}
+
+func decodeTrade(t *testing.T, frame string) wsTrade {
+	t.Helper()
+	var msg wsTradeMsg
+	require.NoError(t, json.Unmarshal([]byte(frame), &msg))
+	require.Equal(t, "trade", msg.Type)
+	require.Len(t, msg.Data, 1)
+	return msg.Data[0]
+}
+
+func TestMockStream_ClientEndToEnd(t *testing.T) {
+	m := NewMockStream()
+	defer m.Close()
+	c := m.Client(time.Minute)
+	defer c.Close()
+	c.Backoff = Backoff{Min: 10 * time.Millisecond, Max: 40 * time.Millisecond}
+
+	ctx := context.Background()
+	aapl := types.NewAsset("AAPL", cfg.Exchange, cfg.AssetType)
+	base := time.Date(2024, 1, 2, 14, 29, 0, 0, time.UTC)
+	require.NoError(t, c.IncludeAssets(ctx, []types.Asset{aapl}))
+	require.Eventually(t, func() bool { return m.Subscribers("AAPL") == 1 }, 5*time.Second, 5*time.Millisecond)
+
+	m.SendRaw([]byte(`{"type":"trade","data":[`)) // ignored
+	m.Publish(
+		MockTrade{Symbol: "AAPL", Price: 100, Volume: 10, Time: base.Add(10 * time.Second)},
+		MockTrade{Symbol: "MSFT", Price: 400, Volume: 10, Time: base.Add(15 * time.Second)}, // not subscribed
+		MockTrade{Symbol: "AAPL", Price: 101, Volume: 10, Time: base.Add(20 * time.Second)},
+	)
+	require.Eventually(t, func() bool {
+		sm, err := c.FetchSample(ctx, aapl)
+		return err == nil && sm.Price == 101
+	}, 5*time.Second, 5*time.Millisecond)
+	_, ok := c.getLatestSample("MSFT")
+	require.False(t, ok)
+
+	bar, ok, err := c.FetchBarAt(ctx, aapl, base.Add(time.Minute+5*time.Second))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 20.0, bar.Volume)
+
+	// A late trade patches the closed bar
+	m.Publish(MockTrade{Symbol: "AAPL", Price: 99, Volume: 5, Time: base.Add(50 * time.Second)})
+	require.Eventually(t, func() bool {
+		bar, _, _ := c.FetchBarAt(ctx, aapl, base.Add(time.Minute+5*time.Second))
+		return bar.Volume == 25 && bar.Low == 99
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// Drops are redialled & resubscribed
+	m.Disconnect()
+	require.Eventually(t, func() bool {
+		return m.Connections() == 2 && m.Subscribers("AAPL") == 1
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestMockStream_RandomWalkFaults(t *testing.T) {
+	m := NewMockStream()
+	defer m.Close()
+	now := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	m.Now = func() time.Time { return now }
+	m.Seed(1)
+	m.SetFaults(MockFaults{Late: 1, LateBy: 30 * time.Second, Duplicate: 1, Malformed: 1})
+	next := rawFrames(t, m, "AAPL")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.RandomWalk(ctx, "AAPL", 100, 100, 0.001)
+
+	frames := next(3)
+	cancel()
+	require.False(t, json.Valid([]byte(frames[0])), "malformed first")
+	require.Equal(t, frames[1], frames[2], "then duplicated")
+	tr := decodeTrade(t, frames[1])
+	require.Equal(t, now.Add(-30*time.Second).UnixMilli(), tr.T, "stamped late")
+	require.InDelta(t, 100, tr.P, 1)
+	require.Positive(t, tr.V)
+}
+
+func TestMockStream_ReplayRecordedTrades(t *testing.T) {
+	recorded := strings.Join([]string{
+		`{"type":"trade","data":[{"s":"AAPL","p":187.2,"t":1704205800000,"v":10},{"s":"MSFT","p":370,"t":1704205800500,"v":3}]}`,
+		``,
+		`{"s":"AAPL","p":187.5,"t":1704205801000,"v":20}`,
+	}, "\n")
+	trades, err := ReadTrades(strings.NewReader(recorded))
+	require.NoError(t, err)
+	require.Len(t, trades, 3)
+	require.Equal(t, MockTrade{Symbol: "AAPL", Price: 187.5, Volume: 20, Time: time.UnixMilli(1704205801000)}, trades[2])
+
+	_, err = ReadTrades(strings.NewReader(`{"p":1}`))
+	require.ErrorContains(t, err, "line 1: trade without a symbol")
+
+	m := NewMockStream()
+	defer m.Close()
+	now := time.Date(2024, 6, 3, 15, 0, 0, 0, time.UTC)
+	m.Now = func() time.Time { return now }
+	next := rawFrames(t, m, "AAPL")
+	ctx := context.Background()
+
+	// As recorded
+	require.NoError(t, m.Replay(ctx, trades, 0))
+	frames := next(2)
+	require.Equal(t, int64(1704205800000), decodeTrade(t, frames[0]).T)
+	require.Equal(t, int64(1704205801000), decodeTrade(t, frames[1]).T)
+
+	// Paced & restamped: 1s apart at 10x
+	began := time.Now()
+	require.NoError(t, m.Replay(ctx, trades, 10))
+	require.GreaterOrEqual(t, time.Since(began), 100*time.Millisecond)
+	frames = next(2)
+	require.Equal(t, now.UnixMilli(), decodeTrade(t, frames[0]).T)
+	require.Equal(t, now.Add(100*time.Millisecond).UnixMilli(), decodeTrade(t, frames[1]).T)
+}
@@ -0,0 +1,117 @@
+package finnhub
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RecordingFilePath is where a session's trade stream is recorded, by its
+// UTC start time in RecordingTimeFormat. The day's recordings sort in order.
+const (
+	RecordingFilePath   = "recordings/trades_%s.jsonl.gz"
+	RecordingTimeFormat = "2006-01-02T150405Z"
+)
+
+// Recorded trade messages are flushed to disk at least this often, so little
+// is lost if the bot is killed
+const recordFlushEvery = time.Second
+
+// RecordedMessage is one raw stream message and when it arrived
+type RecordedMessage struct {
+	Received time.Time       `json:"received"`
+	Msg      json.RawMessage `json:"msg"`
+}
+
+// Recorder writes stream messages to a gzipped JSON lines file
+type Recorder struct {
+	mu        sync.Mutex
+	path      string
+	f         *os.File
+	gz        *gzip.Writer
+	lastFlush time.Time
+	err       error // first write error; later Records are dropped
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	return &Recorder{path: path, f: f, gz: gzip.NewWriter(f), lastFlush: time.Now()}, nil
+}
+
+func (r *Recorder) Path() string { return r.path }
+
+// Record appends msg as received at ts. It returns the first write error
+// only; the recording stops there.
+func (r *Recorder) Record(ts time.Time, msg []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil || r.gz == nil {
+		return nil
+	}
+	line, err := json.Marshal(RecordedMessage{Received: ts.UTC(), Msg: msg})
+	if err == nil {
+		_, err = r.gz.Write(append(line, '\n'))
+	}
+	if err == nil && time.Since(r.lastFlush) >= recordFlushEvery {
+		err = r.gz.Flush()
+		r.lastFlush = time.Now()
+	}
+	r.err = err
+	return err
+}
+
+// Close ends the recording (idempotent)
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gz == nil {
+		return nil
+	}
+	err := errors.Join(r.gz.Close(), r.f.Close())
+	r.gz, r.f = nil, nil
+	return err
+}
+
+// ReadRecording reads every message in a recording, in the order received.
+// A recording cut short (e.g. the bot was killed) is read up to where it
+// stops.
+func ReadRecording(path string) ([]RecordedMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	defer gz.Close()
+
+	var msgs []RecordedMessage
+	sc := bufio.NewScanner(gz)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var m RecordedMessage
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			break // partial last line
+		}
+		msgs = append(msgs, m)
+	}
+	if err := sc.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return msgs, nil
+}
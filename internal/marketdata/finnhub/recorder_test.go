@@ -0,0 +1,129 @@
+package finnhub
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	"github.com/joshskilla/trading-bot/internal/types"
+)
+
+func TestReplay_RebuildsLiveBars(t *testing.T) {
+	m := NewMockStream()
+	defer m.Close()
+	c := m.Client(time.Minute)
+	defer c.Close()
+
+	base := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	var clockMu sync.Mutex
+	clock := base
+	c.now = func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return clock
+	}
+	setClock := func(ts time.Time) {
+		clockMu.Lock()
+		clock = ts
+		clockMu.Unlock()
+	}
+
+	path := filepath.Join(t.TempDir(), "trades.jsonl.gz")
+	rec, err := NewRecorder(path)
+	require.NoError(t, err)
+	c.Recorder = rec
+
+	ctx := context.Background()
+	aapl := types.NewAsset("AAPL", cfg.Exchange, cfg.AssetType)
+	require.NoError(t, c.IncludeAssets(ctx, []types.Asset{aapl}))
+	require.Eventually(t, func() bool { return m.Subscribers("AAPL") == 1 }, 5*time.Second, 5*time.Millisecond)
+
+	// Trades arrive at received; bars are asked for at asked
+	steps := []struct {
+		received time.Time
+		trades   []MockTrade
+		asked    time.Time
+	}{
+		{base.Add(5 * time.Second), []MockTrade{
+			{Symbol: "AAPL", Price: 100, Volume: 10, Time: base.Add(time.Second)},
+			{Symbol: "AAPL", Price: 101, Volume: 5, Time: base.Add(3 * time.Second)},
+		}, base.Add(30 * time.Second)},
+		{base.Add(62 * time.Second), []MockTrade{{Symbol: "AAPL", Price: 102, Volume: 1, Time: base.Add(61 * time.Second)}}, base.Add(62 * time.Second)},
+		{base.Add(90 * time.Second), []MockTrade{{Symbol: "AAPL", Price: 99, Volume: 2, Time: base.Add(59 * time.Second)}}, base.Add(100 * time.Second)}, // late
+		{base.Add(125 * time.Second), nil, base.Add(190 * time.Second)}, // quiet: carried forward
+	}
+	var live []types.Bar
+	for _, s := range steps {
+		setClock(s.received)
+		if len(s.trades) > 0 {
+			last := s.trades[len(s.trades)-1]
+			m.Publish(s.trades...)
+			require.Eventually(t, func() bool {
+				sm, ok := c.getLatestSample("AAPL")
+				return ok && sm.Price == last.Price
+			}, 5*time.Second, 5*time.Millisecond)
+		}
+		bar, ok, err := c.FetchBarAt(ctx, aapl, s.asked)
+		require.NoError(t, err)
+		if ok {
+			live = append(live, bar)
+		}
+	}
+	require.Len(t, live, 4)
+	require.Equal(t, types.BarStatusNoTrades, live[0].Status)
+	require.Equal(t, 99.0, live[2].Low, "late trade patched the closed bar")
+	require.Equal(t, 102.0, live[3].Close)
+	require.NoError(t, c.Close())
+	require.NoError(t, rec.Close())
+
+	replay, err := LoadReplay(time.Minute, path)
+	require.NoError(t, err)
+	start, end := replay.Span()
+	require.Equal(t, steps[0].received, start)
+	require.Equal(t, steps[2].received, end)
+
+	var replayed []types.Bar
+	for _, s := range steps {
+		bar, ok, err := replay.FetchBarAt(ctx, aapl, s.asked)
+		require.NoError(t, err)
+		if ok {
+			replayed = append(replayed, bar)
+		}
+	}
+	require.Equal(t, live, replayed)
+
+	sm, err := replay.FetchSample(ctx, aapl)
+	require.NoError(t, err)
+	require.Equal(t, 99.0, sm.Price)
+	_, err = replay.FetchSample(ctx, types.NewAsset("MSFT", cfg.Exchange, cfg.AssetType))
+	require.ErrorContains(t, err, "no trades recorded for MSFT")
+}
+
+func TestReadRecording_CutShort(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.jsonl.gz")
+	rec, err := NewRecorder(path)
+	require.NoError(t, err)
+	ts := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	for i := range 3 {
+		require.NoError(t, rec.Record(ts.Add(time.Duration(i)*time.Second), []byte(`{"type":"trade","data":[]}`)))
+	}
+	require.NoError(t, rec.Close())
+	require.NoError(t, rec.Close())
+
+	// Lose the gzip footer, as if the bot were killed
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-8))
+
+	msgs, err := ReadRecording(path)
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+	require.Equal(t, ts.Add(2*time.Second), msgs[2].Received)
+	require.JSONEq(t, `{"type":"trade","data":[]}`, string(msgs[2].Msg))
+}
@@ -0,0 +1,349 @@
+// internal/marketdata/local/client.go
+package local
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	md "github.com/joshskilla/trading-bot/internal/marketdata"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// Ensure *Client implements marketdata.HistoricalProvider
+var _ md.HistoricalProvider = (*Client)(nil)
+
+// Supported file extensions, in lookup order
+var fileExtensions = []string{".csv", ".jsonl", ".json"}
+
+// Client serves OHLCV bars from local files, one file per asset:
+// <dir>/<SYMBOL>.csv, or <dir>/<SYMBOL>.jsonl or .json (JSON Lines).
+type Client struct {
+	dir    string
+	window *md.Window // the backtest window's bars, read per asset on first use
+}
+
+// NewClient builds a file backed bar provider reading from dir.
+func NewClient(dir string, barInterval time.Duration, start, end time.Time) *Client {
+	c := &Client{dir: dir}
+	c.window = md.NewWindow(c, barInterval, start, end)
+	return c
+}
+
+func (c *Client) Preload(ctx context.Context, assets []t.Asset) error {
+	return c.window.Preload(ctx, assets)
+}
+
+// FetchBars reads the asset's file and returns bars in [start, end),
+// resampled into aligned buckets of the given interval.
+func (c *Client) FetchBars(
+	ctx context.Context,
+	asset t.Asset,
+	start, end time.Time,
+	interval time.Duration,
+) ([]t.Bar, error) {
+
+	if start.IsZero() || end.IsZero() || !end.After(start) {
+		return nil, fmt.Errorf("local: invalid time window (start=%v end=%v)", start, end)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("local: invalid interval %s", interval)
+	}
+
+	path, err := c.findFile(asset)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := readBarFile(path, asset)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end = start.UTC(), end.UTC()
+	inWindow := raw[:0]
+	for _, b := range raw {
+		if b.Start.Before(start) || !b.Start.Before(end) {
+			continue
+		}
+		inWindow = append(inWindow, b)
+	}
+	return Resample(inWindow, interval)
+}
+
+// findFile returns the first existing file for the asset's symbol.
+func (c *Client) findFile(asset t.Asset) (string, error) {
+	for _, ext := range fileExtensions {
+		path := filepath.Join(c.dir, asset.Symbol+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("local: no bar file for %s in %s (expected %s.csv, %s.jsonl or %s.json)", asset.Symbol, c.dir, asset.Symbol, asset.Symbol, asset.Symbol)
+}
+
+// Resample merges bars into aligned buckets of interval, ordered by start time.
+// Bars already at the interval pass through unchanged (apart from alignment).
+// Bars coarser than interval (e.g. daily bars asked for at 1m) can't be split,
+// so they're an error rather than passed off as finer bars.
+func Resample(bars []t.Bar, interval time.Duration) ([]t.Bar, error) {
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Start.Before(bars[j].Start) })
+	if step := spacing(bars); step > interval {
+		return nil, fmt.Errorf("local: bars are %s apart, coarser than the %s interval asked for", step, interval)
+	}
+
+	var out []t.Bar
+	for _, b := range bars {
+		bucket := t.IntervalStart(b.Start, interval)
+		if n := len(out); n > 0 && out[n-1].Start.Equal(bucket) {
+			last := &out[n-1]
+			if b.High > last.High {
+				last.High = b.High
+			}
+			if b.Low < last.Low {
+				last.Low = b.Low
+			}
+			last.Close = b.Close
+			last.Volume += b.Volume
+			last.Notional += b.Notional
+			last.TradeCount += b.TradeCount
+			last.LastTradedVolume = b.LastTradedVolume
+			continue
+		}
+		b.Start = bucket
+		b.End = bucket.Add(interval)
+		b.Interval = interval
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// spacing is the least time between sorted bars' starts (0 => fewer than two bars)
+func spacing(bars []t.Bar) time.Duration {
+	var least time.Duration
+	for i := 1; i < len(bars); i++ {
+		if d := bars[i].Start.Sub(bars[i-1].Start); d > 0 && (least == 0 || d < least) {
+			least = d
+		}
+	}
+	return least
+}
+
+// --- File parsing ---
+
+func readBarFile(path string, asset t.Asset) ([]t.Bar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var bars []t.Bar
+	if strings.HasSuffix(path, ".csv") {
+		bars, err = readCSV(f, asset)
+	} else {
+		bars, err = readJSONLines(f, asset)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("local: %s: %w", filepath.Base(path), err)
+	}
+	return bars, nil
+}
+
+// readCSV expects a header row naming the columns (any order, case-insensitive).
+func readCSV(r io.Reader, asset t.Asset) ([]t.Bar, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+
+	var bars []t.Bar
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return bars, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := parseBar(asset, func(key string) (string, bool) {
+			i, ok := cols[key]
+			if !ok || i >= len(row) {
+				return "", false
+			}
+			return row[i], row[i] != ""
+		})
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		bars = append(bars, b)
+	}
+}
+
+// readJSONLines expects one JSON object per line, blank lines ignored.
+func readJSONLines(r io.Reader, asset t.Asset) ([]t.Bar, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var bars []t.Bar
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.UseNumber()
+		var obj map[string]any
+		if err := dec.Decode(&obj); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		lower := make(map[string]any, len(obj))
+		for k, v := range obj {
+			lower[strings.ToLower(k)] = v
+		}
+		b, err := parseBar(asset, func(key string) (string, bool) {
+			v, ok := lower[key]
+			if !ok || v == nil {
+				return "", false
+			}
+			return fmt.Sprint(v), true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		bars = append(bars, b)
+	}
+	return bars, sc.Err()
+}
+
+// Accepted column names, first match wins (long names, then Alpaca style short names)
+var (
+	timeKeys   = []string{"time", "timestamp", "start", "date", "t"}
+	openKeys   = []string{"open", "o"}
+	highKeys   = []string{"high", "h"}
+	lowKeys    = []string{"low", "l"}
+	closeKeys  = []string{"close", "c"}
+	volumeKeys = []string{"volume", "v"}
+	countKeys  = []string{"trade_count", "trades", "n"}
+	vwapKeys   = []string{"vwap", "vw"}
+)
+
+func parseBar(asset t.Asset, get func(key string) (string, bool)) (t.Bar, error) {
+	lookup := func(keys []string) (string, bool) {
+		for _, k := range keys {
+			if v, ok := get(k); ok {
+				return strings.TrimSpace(v), true
+			}
+		}
+		return "", false
+	}
+	number := func(name string, keys []string, required bool) (float64, error) {
+		v, ok := lookup(keys)
+		if !ok {
+			if required {
+				return 0, fmt.Errorf("missing %s", name)
+			}
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q", name, v)
+		}
+		return f, nil
+	}
+
+	ts, ok := lookup(timeKeys)
+	if !ok {
+		return t.Bar{}, fmt.Errorf("missing time")
+	}
+	start, err := parseTime(ts)
+	if err != nil {
+		return t.Bar{}, err
+	}
+
+	var b t.Bar
+	b.Asset = asset
+	b.Start = start
+	b.Status = t.BarStatusOfficial
+	if b.Open, err = number("open", openKeys, true); err != nil {
+		return t.Bar{}, err
+	}
+	if b.High, err = number("high", highKeys, true); err != nil {
+		return t.Bar{}, err
+	}
+	if b.Low, err = number("low", lowKeys, true); err != nil {
+		return t.Bar{}, err
+	}
+	if b.Close, err = number("close", closeKeys, true); err != nil {
+		return t.Bar{}, err
+	}
+	if b.Volume, err = number("volume", volumeKeys, false); err != nil {
+		return t.Bar{}, err
+	}
+	count, err := number("trade count", countKeys, false)
+	if err != nil {
+		return t.Bar{}, err
+	}
+	b.TradeCount = int(count)
+	vwap, err := number("vwap", vwapKeys, false)
+	if err != nil {
+		return t.Bar{}, err
+	}
+	if vwap == 0 {
+		vwap = b.Close // best estimate without trade data
+	}
+	b.Notional = vwap * b.Volume
+	return b, nil
+}
+
+// Accepted timestamp formats; zone-less layouts are read as UTC
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTime accepts the layouts above or a unix timestamp in seconds or milliseconds.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if ts, err := time.Parse(layout, s); err == nil {
+			return ts.UTC(), nil
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > 1e11 { // too large for seconds in any sane range: milliseconds
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// --- BarProvider interface ---
+
+func (c *Client) FetchBarAt(ctx context.Context, asset t.Asset, now time.Time) (t.Bar, bool, error) {
+	return c.window.BarAt(ctx, asset, now)
+}
+
+func (c *Client) IncludeAssets(ctx context.Context, assets []t.Asset) error {
+	return c.Preload(ctx, assets)
+}
+
+func (c *Client) Close() error { return nil }
@@ -0,0 +1,105 @@
+package local
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	types "github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
+
+func TestLocal_FetchBarAt_CSV(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "AAPL.csv", `time,open,high,low,close,volume
+2024-01-02T14:30:00Z,100,101,99,100.5,1000
+2024-01-02T14:31:00Z,100.5,102,100,101.5,2000
+2024-01-02T14:32:00Z,101.5,101.5,98,99,500
+`)
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	c := NewClient(dir, time.Minute, start, end)
+	asset := types.NewAsset("AAPL", "IEX", "stock")
+
+	require.NoError(t, c.IncludeAssets(context.Background(), []types.Asset{asset}))
+
+	// Any time within the bucket resolves to the aligned bar
+	bar, ok, err := c.FetchBarAt(context.Background(), asset, start.Add(90*time.Second))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, start.Add(time.Minute), bar.Start)
+	require.Equal(t, start.Add(2*time.Minute), bar.End)
+	require.Equal(t, 101.5, bar.Close)
+	require.Equal(t, 2000.0, bar.Volume)
+	require.Equal(t, types.BarStatusOfficial, bar.Status)
+
+	// Missing bucket => no data
+	_, ok, err = c.FetchBarAt(context.Background(), asset, start.Add(10*time.Minute))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestLocal_FetchBarAt_JSONLinesResampled(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "MSFT.jsonl", `{"t":"2024-01-02T14:30:00Z","o":10,"h":11,"l":9,"c":10.5,"v":100,"n":3}
+
+{"t":"2024-01-02T14:31:00Z","o":10.5,"h":12,"l":10,"c":11,"v":200,"n":4}
+{"t":"2024-01-02T14:35:00Z","o":11,"h":11,"l":8,"c":8.5,"v":50,"n":1}
+`)
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	c := NewClient(dir, 5*time.Minute, start, start.Add(time.Hour))
+	asset := types.NewAsset("MSFT", "IEX", "stock")
+
+	bar, ok, err := c.FetchBarAt(context.Background(), asset, start.Add(4*time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, start, bar.Start)
+	require.Equal(t, 5*time.Minute, bar.Interval)
+	require.Equal(t, 10.0, bar.Open)
+	require.Equal(t, 12.0, bar.High)
+	require.Equal(t, 9.0, bar.Low)
+	require.Equal(t, 11.0, bar.Close)
+	require.Equal(t, 300.0, bar.Volume)
+	require.Equal(t, 7, bar.TradeCount)
+
+	bar, ok, err = c.FetchBarAt(context.Background(), asset, start.Add(5*time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 8.5, bar.Close)
+}
+
+func TestLocal_MissingFileAndBadRows(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	c := NewClient(dir, time.Minute, start, start.Add(time.Hour))
+
+	err := c.IncludeAssets(context.Background(), []types.Asset{types.NewAsset("NOPE", "IEX", "stock")})
+	require.ErrorContains(t, err, "NOPE.json)")
+
+	writeFile(t, dir, "BAD.csv", "time,open,high,low,close\n2024-01-02T14:30:00Z,1,2,abc,1\n")
+	err = c.IncludeAssets(context.Background(), []types.Asset{types.NewAsset("BAD", "IEX", "stock")})
+	require.ErrorContains(t, err, "line 2")
+}
+
+func TestLocal_CoarserBarsAreNotResampledFiner(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "AAPL.csv", "date,open,high,low,close\n2024-01-02,100,105,99,104\n2024-01-03,104,106,101,102\n")
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	asset := types.NewAsset("AAPL", "IEX", "stock")
+
+	// Daily bars can't stand in for minute bars
+	_, _, err := NewClient(dir, time.Minute, start, start.Add(48*time.Hour)).FetchBarAt(context.Background(), asset, start)
+	require.ErrorContains(t, err, "coarser than the 1m0s interval")
+
+	bar, ok, err := NewClient(dir, 24*time.Hour, start, start.Add(48*time.Hour)).FetchBarAt(context.Background(), asset, start)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 104.0, bar.Close)
+}
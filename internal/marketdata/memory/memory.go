@@ -0,0 +1,107 @@
+// internal/marketdata/memory/memory.go
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	md "github.com/joshskilla/trading-bot/internal/marketdata"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// Ensure *Provider implements marketdata.HistoricalProvider
+var _ md.HistoricalProvider = (*Provider)(nil)
+
+// Provider serves a fixed set of bars loaded up front. It is read-only once
+// built, so any number of concurrent backtests can share one instance.
+type Provider struct {
+	barInterval time.Duration
+	start       time.Time // inclusive, UTC
+	end         time.Time // exclusive, UTC
+
+	bars map[t.Asset]map[time.Time]t.Bar // asset -> start time -> bar
+}
+
+// Load fetches every asset's bars for [start, end) from source once.
+// The source is closed afterwards.
+func Load(ctx context.Context, source md.HistoricalProvider, assets []t.Asset, barInterval time.Duration, start, end time.Time) (*Provider, error) {
+	defer source.Close()
+
+	p := &Provider{
+		barInterval: barInterval,
+		start:       start.UTC(),
+		end:         end.UTC(),
+		bars:        make(map[t.Asset]map[time.Time]t.Bar, len(assets)),
+	}
+	s := t.IntervalStart(p.start, barInterval)
+	e := p.end.Add(barInterval) // pad end (end-exclusive guard)
+	for _, a := range assets {
+		bars, err := source.FetchBars(ctx, a, s, e, barInterval)
+		if err != nil {
+			return nil, fmt.Errorf("memory: load %s: %w", a.Symbol, err)
+		}
+		p.bars[a] = make(map[time.Time]t.Bar, len(bars))
+		for _, b := range bars {
+			p.bars[a][b.Start.UTC()] = b
+		}
+	}
+	return p, nil
+}
+
+// NewProvider builds a provider from bars already in hand (e.g. tests)
+func NewProvider(barInterval time.Duration, bars ...t.Bar) *Provider {
+	p := &Provider{barInterval: barInterval, bars: make(map[t.Asset]map[time.Time]t.Bar)}
+	for _, b := range bars {
+		if p.bars[b.Asset] == nil {
+			p.bars[b.Asset] = make(map[time.Time]t.Bar)
+		}
+		p.bars[b.Asset][b.Start.UTC()] = b
+		if p.start.IsZero() || b.Start.Before(p.start) {
+			p.start = b.Start.UTC()
+		}
+		if b.End.After(p.end) {
+			p.end = b.End.UTC()
+		}
+	}
+	return p
+}
+
+// Count returns the number of bars held for asset
+func (p *Provider) Count(asset t.Asset) int {
+	return len(p.bars[asset])
+}
+
+// --- BarProvider interface ---
+
+func (p *Provider) FetchBarAt(ctx context.Context, asset t.Asset, now time.Time) (t.Bar, bool, error) {
+	b, ok := p.bars[asset][t.IntervalStart(now.UTC(), p.barInterval)]
+	return b, ok, nil
+}
+
+// FetchBars returns the loaded bars in [start, end), oldest first
+func (p *Provider) FetchBars(ctx context.Context, asset t.Asset, start, end time.Time, interval time.Duration) ([]t.Bar, error) {
+	if interval != p.barInterval {
+		return nil, fmt.Errorf("memory: holds %s bars, not %s", p.barInterval, interval)
+	}
+	var out []t.Bar
+	for ts := t.IntervalStart(start.UTC(), interval); ts.Before(end); ts = ts.Add(interval) {
+		if b, ok := p.bars[asset][ts]; ok {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+// IncludeAssets only checks the assets were loaded: the bar set is fixed
+func (p *Provider) IncludeAssets(ctx context.Context, assets []t.Asset) error {
+	for _, a := range assets {
+		if _, ok := p.bars[a]; !ok {
+			return fmt.Errorf("memory: %s was not loaded", a.Symbol)
+		}
+	}
+	return nil
+}
+
+// Close is a no-op: sessions sharing the provider close it independently
+func (p *Provider) Close() error { return nil }
@@ -0,0 +1,100 @@
+package marketdata
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// Shared lets several traders use one BarProvider (e.g. a single Finnhub
+// websocket). Each trader acquires its own handle; calls through the handles
+// are serialised, so providers need not be safe for concurrent use, and the
+// provider is closed once the last handle is.
+type Shared struct {
+	mu   sync.Mutex // serialises calls to prov
+	prov BarProvider
+
+	refMu sync.Mutex
+	refs  int
+}
+
+func NewShared(prov BarProvider) *Shared {
+	return &Shared{prov: prov}
+}
+
+// Acquire returns a new handle on the provider. The handle also provides
+// samples if the underlying provider does.
+func (s *Shared) Acquire() BarProvider {
+	s.refMu.Lock()
+	s.refs++
+	s.refMu.Unlock()
+
+	h := &sharedHandle{shared: s}
+	if _, ok := s.prov.(SampleProvider); ok {
+		return &sharedSampleHandle{h}
+	}
+	return h
+}
+
+func (s *Shared) release() error {
+	s.refMu.Lock()
+	s.refs--
+	last := s.refs == 0
+	s.refMu.Unlock()
+	if !last {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prov.Close()
+}
+
+// ----------- HANDLES -----------
+
+type sharedHandle struct {
+	shared *Shared
+	once   sync.Once
+}
+
+// Ensure handles implement the provider interfaces
+var (
+	_ BarProvider    = (*sharedHandle)(nil)
+	_ SampleProvider = (*sharedSampleHandle)(nil)
+)
+
+func (h *sharedHandle) FetchBarAt(ctx context.Context, asset t.Asset, ts time.Time) (t.Bar, bool, error) {
+	h.shared.mu.Lock()
+	defer h.shared.mu.Unlock()
+	return h.shared.prov.FetchBarAt(ctx, asset, ts)
+}
+
+func (h *sharedHandle) IncludeAssets(ctx context.Context, assets []t.Asset) error {
+	h.shared.mu.Lock()
+	defer h.shared.mu.Unlock()
+	return h.shared.prov.IncludeAssets(ctx, assets)
+}
+
+// Close releases this handle (idempotent); the last one closes the provider
+func (h *sharedHandle) Close() error {
+	var err error
+	h.once.Do(func() { err = h.shared.release() })
+	return err
+}
+
+type sharedSampleHandle struct {
+	*sharedHandle
+}
+
+func (h *sharedSampleHandle) FetchSample(ctx context.Context, asset t.Asset) (t.Sample, error) {
+	h.shared.mu.Lock()
+	defer h.shared.mu.Unlock()
+	return h.shared.prov.(SampleProvider).FetchSample(ctx, asset)
+}
+
+func (h *sharedSampleHandle) AddToStream(ctx context.Context, assets []t.Asset) error {
+	h.shared.mu.Lock()
+	defer h.shared.mu.Unlock()
+	return h.shared.prov.(SampleProvider).AddToStream(ctx, assets)
+}
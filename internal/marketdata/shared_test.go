@@ -0,0 +1,78 @@
+package marketdata
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	types "github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+// countingProvider records the calls made to it
+type countingProvider struct {
+	fetches int
+	closes  int
+	assets  []types.Asset
+}
+
+func (p *countingProvider) FetchBarAt(ctx context.Context, asset types.Asset, ts time.Time) (types.Bar, bool, error) {
+	p.fetches++ // unguarded: the shared wrapper serialises calls
+	return types.Bar{Asset: asset, Start: ts, Close: 100}, true, nil
+}
+func (p *countingProvider) IncludeAssets(ctx context.Context, assets []types.Asset) error {
+	p.assets = append(p.assets, assets...)
+	return nil
+}
+func (p *countingProvider) Close() error { p.closes++; return nil }
+
+// samplingProvider also streams trades
+type samplingProvider struct{ countingProvider }
+
+func (p *samplingProvider) FetchSample(ctx context.Context, asset types.Asset) (types.Sample, error) {
+	return types.Sample{Asset: asset, Price: 101}, nil
+}
+func (p *samplingProvider) AddToStream(ctx context.Context, assets []types.Asset) error { return nil }
+
+func TestShared_ClosesWithLastHandle(t *testing.T) {
+	prov := &countingProvider{}
+	shared := NewShared(prov)
+	a, b := shared.Acquire(), shared.Acquire()
+	_, isSampler := a.(SampleProvider)
+	require.False(t, isSampler)
+
+	aapl := types.NewAsset("AAPL", "IEX", "stock")
+	msft := types.NewAsset("MSFT", "IEX", "stock")
+	require.NoError(t, a.IncludeAssets(context.Background(), []types.Asset{aapl}))
+	require.NoError(t, b.IncludeAssets(context.Background(), []types.Asset{msft}))
+	require.Equal(t, []types.Asset{aapl, msft}, prov.assets)
+
+	var wg sync.WaitGroup
+	for _, h := range []BarProvider{a, b} {
+		wg.Go(func() {
+			for range 100 {
+				_, ok, err := h.FetchBarAt(context.Background(), aapl, time.Now())
+				require.NoError(t, err)
+				require.True(t, ok)
+			}
+		})
+	}
+	wg.Wait()
+	require.Equal(t, 200, prov.fetches)
+
+	require.NoError(t, a.Close())
+	require.NoError(t, a.Close()) // idempotent: doesn't release b's reference
+	require.Zero(t, prov.closes)
+	require.NoError(t, b.Close())
+	require.Equal(t, 1, prov.closes)
+}
+
+func TestShared_ForwardsSamples(t *testing.T) {
+	shared := NewShared(&samplingProvider{})
+	h, ok := shared.Acquire().(SampleProvider)
+	require.True(t, ok)
+	s, err := h.FetchSample(context.Background(), types.NewAsset("AAPL", "IEX", "stock"))
+	require.NoError(t, err)
+	require.Equal(t, 101.0, s.Price)
+}
@@ -0,0 +1,68 @@
+package marketdata
+
+import (
+	"context"
+	"time"
+
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// Window serves a historical provider's bars over its backtest window from
+// memory. Each asset's bars for the whole window are fetched from the source
+// once, the first time they're wanted; after that a missing bar means there
+// was no data. Not safe for concurrent use (see Shared).
+type Window struct {
+	source   HistoricalProvider
+	interval time.Duration
+	start    time.Time // inclusive, UTC
+	end      time.Time // exclusive, UTC
+
+	bars map[t.Asset]map[time.Time]t.Bar // asset -> start time -> bar
+}
+
+func NewWindow(source HistoricalProvider, interval time.Duration, start, end time.Time) *Window {
+	return &Window{
+		source:   source,
+		interval: interval,
+		start:    start.UTC(),
+		end:      end.UTC(),
+		bars:     make(map[t.Asset]map[time.Time]t.Bar),
+	}
+}
+
+// Preload fetches each asset's bars for the whole window
+func (w *Window) Preload(ctx context.Context, assets []t.Asset) error {
+	for _, a := range assets {
+		if err := w.load(ctx, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BarAt returns the asset's bar holding ts, loading the asset's window first if need be
+func (w *Window) BarAt(ctx context.Context, asset t.Asset, ts time.Time) (t.Bar, bool, error) {
+	if _, ok := w.bars[asset]; !ok {
+		if err := w.load(ctx, asset); err != nil {
+			return t.Bar{}, false, err
+		}
+	}
+	b, ok := w.bars[asset][t.IntervalStart(ts.UTC(), w.interval)]
+	return b, ok, nil
+}
+
+func (w *Window) load(ctx context.Context, a t.Asset) error {
+	s := t.IntervalStart(w.start, w.interval)
+	e := w.end.Add(w.interval) // pad end (end-exclusive guard)
+	bars, err := w.source.FetchBars(ctx, a, s, e, w.interval)
+	if err != nil {
+		return err
+	}
+	if _, ok := w.bars[a]; !ok {
+		w.bars[a] = make(map[time.Time]t.Bar, len(bars))
+	}
+	for _, b := range bars {
+		w.bars[a][b.Start.UTC()] = b
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package optimize
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/engine"
+	"github.com/joshskilla/trading-bot/internal/report"
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+const (
+	ResultsFilePath     = "results/optimize_%s.csv"
+	WalkForwardFilePath = "results/walkforward_%s.csv"
+)
+
+// Trial is one parameter combination to backtest
+type Trial struct {
+	Params   map[string]any // as swept, before schema validation
+	Strategy st.Strategy
+	Err      error // the combination is invalid (e.g. fast >= slow)
+}
+
+// Build validates each combination against the strategy's schema and
+// constructs its strategy; invalid combinations keep their error.
+func Build(def st.Definition, combos []map[string]any) []Trial {
+	trials := make([]Trial, len(combos))
+	for i, combo := range combos {
+		trials[i].Params = combo
+		params, err := def.Params.Validate(combo)
+		if err != nil {
+			trials[i].Err = err
+			continue
+		}
+		trials[i].Strategy, trials[i].Err = def.New(params)
+	}
+	return trials
+}
+
+// Assets lists every asset the valid trials trade
+func Assets(trials []Trial) []t.Asset {
+	seen := make(map[t.Asset]bool)
+	var assets []t.Asset
+	for _, tr := range trials {
+		if tr.Strategy == nil {
+			continue
+		}
+		for _, a := range engine.MarketAssets(engine.NewMemoryPortfolio("", 0), tr.Strategy) {
+			if !seen[a] {
+				seen[a] = true
+				assets = append(assets, a)
+			}
+		}
+	}
+	return assets
+}
+
+// Config is shared by every trial of a sweep
+type Config struct {
+	Name       string // prefix for the trials' portfolio names
+	Start, End time.Time
+	Hours      t.TradingHours
+	Cash       float64
+	Workers    int // concurrent backtests, at least 1
+	// NewTrader builds a fresh trader per backtest, typically over one shared, preloaded provider
+	NewTrader func(start, end time.Time) engine.Trader
+	Report    report.Options
+}
+
+// Result is a trial's outcome
+type Result struct {
+	Trial
+	Report report.Report
+}
+
+// Run backtests the trials on a bounded pool of workers. Results keep the
+// trials' order; cancelling ctx stops the sweep (unfinished trials carry ctx's error).
+func Run(ctx context.Context, cfg Config, trials []Trial) []Result {
+	results := make([]Result, len(trials))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(cfg.Workers, 1) {
+		wg.Go(func() {
+			for i := range jobs {
+				results[i] = runTrial(ctx, cfg, i, trials[i])
+			}
+		})
+	}
+	for i := range trials {
+		if ctx.Err() != nil {
+			results[i] = Result{Trial: trials[i]}
+			results[i].Err = ctx.Err()
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func runTrial(ctx context.Context, cfg Config, i int, trial Trial) Result {
+	res := Result{Trial: trial}
+	if trial.Err != nil {
+		return res
+	}
+	name := fmt.Sprintf("%s-%d", cfg.Name, i+1)
+	p := engine.NewMemoryPortfolio(name, cfg.Cash)
+	if err := engine.Backtest(ctx, p, trial.Strategy, cfg.NewTrader(cfg.Start, cfg.End), cfg.Start, cfg.End, cfg.Hours); err != nil {
+		res.Err = err
+		return res
+	}
+	if len(p.EquityHistory) == 0 {
+		res.Err = fmt.Errorf("no ticks in the period")
+		return res
+	}
+	res.Report = report.Compute(name, p.EquityHistory, p.ExecutionHistory, cfg.Report)
+	return res
+}
+
+// ----------- RANKING -----------
+
+// Metric scores a report for ranking
+type Metric struct {
+	Name        string
+	Value       func(r report.Report) float64
+	LowerBetter bool
+}
+
+var metrics = []Metric{
+	{Name: "sharpe", Value: func(r report.Report) float64 { return r.Sharpe }},
+	{Name: "sortino", Value: func(r report.Report) float64 { return r.Sortino }},
+	{Name: "return", Value: func(r report.Report) float64 { return r.TotalReturn }},
+	{Name: "annualised_return", Value: func(r report.Report) float64 { return r.AnnualisedReturn }},
+	{Name: "max_drawdown", Value: func(r report.Report) float64 { return r.MaxDrawdown }, LowerBetter: true},
+	{Name: "win_rate", Value: func(r report.Report) float64 { return r.WinRate }},
+	{Name: "realised_pnl", Value: func(r report.Report) float64 { return r.RealisedPnL }},
+}
+
+// ParseMetric looks up a ranking metric by name
+func ParseMetric(name string) (Metric, error) {
+	var names []string
+	for _, m := range metrics {
+		if m.Name == name {
+			return m, nil
+		}
+		names = append(names, m.Name)
+	}
+	return Metric{}, fmt.Errorf("optimize: unknown metric %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// Rank sorts results best first by metric; failed trials go last
+func Rank(results []Result, m Metric) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.Err == nil) != (b.Err == nil) {
+			return a.Err == nil
+		}
+		if a.Err != nil {
+			return false
+		}
+		if m.LowerBetter {
+			return m.Value(a.Report) < m.Value(b.Report)
+		}
+		return m.Value(a.Report) > m.Value(b.Report)
+	})
+}
+
+// WriteCSV writes ranked results, one row per trial: rank, the swept
+// parameters, the report's headline metrics and any error
+func WriteCSV(path string, params []Param, results []Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+
+	header := []string{"Rank"}
+	for _, p := range params {
+		header = append(header, p.Name)
+	}
+	header = append(header, "TotalReturn", "AnnualisedReturn", "Sharpe", "Sortino", "MaxDrawdown", "Trades", "WinRate", "Fees", "EndEquity", "Error")
+	w.Write(header)
+
+	num := func(f float64) string { return strconv.FormatFloat(f, 'f', 4, 64) }
+	for i, res := range results {
+		row := []string{strconv.Itoa(i + 1)}
+		for _, p := range params {
+			row = append(row, fmt.Sprint(res.Params[p.Name]))
+		}
+		if res.Err != nil {
+			row = append(row, "", "", "", "", "", "", "", "", "", res.Err.Error())
+		} else {
+			r := res.Report
+			row = append(row, num(r.TotalReturn), num(r.AnnualisedReturn), num(r.Sharpe), num(r.Sortino), num(r.MaxDrawdown),
+				strconv.Itoa(r.Trades), num(r.WinRate), num(r.Fees), num(r.EndEquity), "")
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
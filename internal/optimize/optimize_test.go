@@ -0,0 +1,195 @@
+package optimize
+
+import (
+	"context"
+	"encoding/csv"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/engine"
+	"github.com/joshskilla/trading-bot/internal/marketdata/memory"
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	"github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseParam(t *testing.T) {
+	p, err := ParseParam("fast=5:20:5", st.MomentumParams)
+	require.NoError(t, err)
+	require.Equal(t, st.ParamInt, p.Type)
+	require.Equal(t, []any{5, 10, 15, 20}, p.Values)
+
+	p, err = ParseParam("Allocation=0.1:0.3:0.1", st.MomentumParams)
+	require.NoError(t, err)
+	require.Equal(t, []any{0.1, 0.2, 0.3}, p.Values)
+
+	p, err = ParseParam("asset=AAPL,MSFT", st.MomentumParams)
+	require.NoError(t, err)
+	require.Equal(t, []any{"AAPL", "MSFT"}, p.Values)
+
+	for _, bad := range []string{"fast", "fast=", "fast=20:5", "fast=1:5:0", "fast=1.5:3", "fast=a,b", "nope=1"} {
+		_, err := ParseParam(bad, st.MomentumParams)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestGridAndRandom(t *testing.T) {
+	fast, _ := ParseParam("fast=2,3", st.MomentumParams)
+	slow, _ := ParseParam("slow=5:15:5", st.MomentumParams)
+	alloc, _ := ParseParam("Allocation=0.5:1", st.MomentumParams)
+
+	grid := Grid([]Param{fast, slow})
+	require.Len(t, grid, 6)
+	require.Equal(t, map[string]any{"fast": 2, "slow": 5}, grid[0])
+	require.Equal(t, map[string]any{"fast": 3, "slow": 15}, grid[5])
+
+	combos := Random([]Param{slow, alloc}, 50, rand.New(rand.NewSource(1)))
+	require.Len(t, combos, 50)
+	for _, c := range combos {
+		require.Contains(t, []any{5, 10, 15}, c["slow"])
+		a := c["Allocation"].(float64)
+		require.True(t, a >= 0.5 && a <= 1, a)
+	}
+}
+
+func TestRunRanksTrials(t *testing.T) {
+	asset := types.NewAsset("AAPL", "IEX", "stock")
+	// Today, in an always-open session: a dip then a rally
+	start := time.Now().UTC().Truncate(24 * time.Hour).Add(time.Hour)
+	var bars []types.Bar
+	for i := range 60 {
+		c := 100 + 10*math.Sin(float64(i)/6)
+		s := start.Add(time.Duration(i) * time.Minute)
+		bars = append(bars, types.Bar{
+			Asset: asset, Start: s, End: s.Add(time.Minute), Interval: time.Minute,
+			Open: c, High: c, Low: c, Close: c, Volume: 1000, Status: types.BarStatusOfficial,
+		})
+	}
+	prov := memory.NewProvider(time.Minute, bars...)
+	end := start.Add(60 * time.Minute)
+
+	def, ok := st.Lookup("momentum")
+	require.True(t, ok)
+	assetParam, _ := ParseParam("asset=AAPL:IEX:stock", def.Params)
+	fast, _ := ParseParam("fast=2,4,8", def.Params)
+	slow, _ := ParseParam("slow=4,8", def.Params)
+	params := []Param{assetParam, fast, slow}
+	trials := Build(def, Grid(params))
+	require.Len(t, trials, 6)
+	require.Equal(t, []types.Asset{asset}, Assets(trials))
+
+	results := Run(context.Background(), Config{
+		Name: "UnitTestOptimize", Start: start, End: end,
+		Hours: types.TradingHours{OpenHour: 0, CloseHour: 23, CloseMinute: 59, ExchangeTZ: "UTC"},
+		Cash:  1000, Workers: 3,
+		NewTrader: func(start, end time.Time) engine.Trader {
+			return engine.NewTestTraderWithProvider(prov, time.Minute, start, end)
+		},
+	}, trials)
+
+	metric, err := ParseMetric("return")
+	require.NoError(t, err)
+	Rank(results, metric)
+
+	invalid := 0
+	for i, res := range results {
+		if res.Err != nil {
+			invalid++ // fast >= slow
+			continue
+		}
+		require.Zero(t, invalid, "failed trials rank last")
+		require.Equal(t, 1000.0, res.Report.StartEquity)
+		if i > 0 {
+			require.GreaterOrEqual(t, results[i-1].Report.TotalReturn, res.Report.TotalReturn)
+		}
+	}
+	require.Equal(t, 3, invalid) // 4/4, 8/4, 8/8
+	require.Positive(t, results[0].Report.Trades)
+
+	path := filepath.Join(t.TempDir(), "results.csv")
+	require.NoError(t, WriteCSV(path, params, results))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 7)
+	require.Equal(t, []string{"Rank", "asset", "fast", "slow"}, rows[0][:4])
+	require.Equal(t, "1", rows[1][0])
+	require.NotEmpty(t, rows[6][len(rows[6])-1]) // error column
+}
+
+func TestWindows(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	windows, err := Windows(start, start.Add(25*day), 10*day, 5*day, false)
+	require.NoError(t, err)
+	require.Len(t, windows, 3)
+	require.Equal(t, Window{InStart: start, InEnd: start.Add(10 * day), OutEnd: start.Add(15 * day)}, windows[0])
+	require.Equal(t, Window{InStart: start.Add(10 * day), InEnd: start.Add(20 * day), OutEnd: start.Add(25 * day)}, windows[2])
+
+	// Anchored windows grow from the start; a short final window is kept
+	windows, err = Windows(start, start.Add(22*day), 10*day, 5*day, true)
+	require.NoError(t, err)
+	require.Len(t, windows, 3)
+	require.Equal(t, start, windows[2].InStart)
+	require.Equal(t, start.Add(22*day), windows[2].OutEnd)
+
+	_, err = Windows(start, start.Add(5*day), 10*day, 5*day, false)
+	require.Error(t, err)
+}
+
+func TestWalkForwardStitchesOutOfSample(t *testing.T) {
+	asset := types.NewAsset("AAPL", "IEX", "stock")
+	start := time.Now().UTC().Truncate(24 * time.Hour).Add(time.Hour)
+	var bars []types.Bar
+	for i := range 90 {
+		c := 100 + 10*math.Sin(float64(i)/5)
+		s := start.Add(time.Duration(i) * time.Minute)
+		bars = append(bars, types.Bar{
+			Asset: asset, Start: s, End: s.Add(time.Minute), Interval: time.Minute,
+			Open: c, High: c, Low: c, Close: c, Volume: 1000, Status: types.BarStatusOfficial,
+		})
+	}
+	prov := memory.NewProvider(time.Minute, bars...)
+	end := start.Add(90 * time.Minute)
+
+	def, _ := st.Lookup("momentum")
+	assetParam, _ := ParseParam("asset=AAPL:IEX:stock", def.Params)
+	fast, _ := ParseParam("fast=2,3", def.Params)
+	slow, _ := ParseParam("slow=5,8", def.Params)
+	cfg := Config{
+		Name: "UnitTestWalkForward", Start: start, End: end,
+		Hours: types.TradingHours{OpenHour: 0, CloseHour: 23, CloseMinute: 59, ExchangeTZ: "UTC"},
+		Cash:  1000, Workers: 2,
+		NewTrader: func(start, end time.Time) engine.Trader {
+			return engine.NewTestTraderWithProvider(prov, time.Minute, start, end)
+		},
+	}
+	windows, err := Windows(start, end, 30*time.Minute, 20*time.Minute, false)
+	require.NoError(t, err)
+	require.Len(t, windows, 3)
+
+	metric, _ := ParseMetric("return")
+	p := engine.NewMemoryPortfolio("UnitTestWalkForward", cfg.Cash)
+	steps := WalkForward(context.Background(), cfg, def, Grid([]Param{assetParam, fast, slow}), metric, windows, p)
+	require.Len(t, steps, 3)
+
+	for _, s := range steps {
+		require.NoError(t, s.Err)
+		require.NoError(t, s.Best.Err)
+	}
+	// One continuous out-of-sample curve: 60 ticks after the first in-sample window
+	require.Len(t, p.EquityHistory, 60)
+	require.Equal(t, windows[0].InEnd, p.EquityHistory[0].Time)
+	for i := 1; i < len(p.EquityHistory); i++ {
+		require.Equal(t, time.Minute, p.EquityHistory[i].Time.Sub(p.EquityHistory[i-1].Time))
+	}
+	// Each window's report covers only its own period
+	require.Equal(t, windows[1].InEnd, steps[1].OutSample.Start)
+	require.InDelta(t, p.EquityHistory[20].Equity, steps[1].OutSample.StartEquity, 1e-9)
+}
@@ -0,0 +1,154 @@
+// Package optimize sweeps a strategy's parameters over backtests and ranks the results.
+package optimize
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+)
+
+// Param is one swept parameter: a lo:hi:step range or a list of values
+type Param struct {
+	Name   string // as given, e.g. "fast" (aliases are resolved by the strategy's schema)
+	Type   st.ParamType
+	Values []any // grid points
+
+	// Ranges only, for random search
+	isRange      bool
+	lo, hi, step float64
+}
+
+// ParseParam parses a --param flag: name=lo:hi[:step], name=a,b,c or name=value.
+// Values are typed from the strategy's schema, which must know the name.
+func ParseParam(flag string, schema st.Schema) (Param, error) {
+	name, spec, ok := strings.Cut(flag, "=")
+	name, spec = strings.TrimSpace(name), strings.TrimSpace(spec)
+	if !ok || name == "" || spec == "" {
+		return Param{}, fmt.Errorf("optimize: invalid --param %q (want name=lo:hi:step or name=a,b,c)", flag)
+	}
+	sp, found := lookup(schema, name)
+	if !found {
+		return Param{}, fmt.Errorf("optimize: unknown parameter %q", name)
+	}
+	p := Param{Name: name, Type: sp.Type}
+	numeric := p.Type == st.ParamInt || p.Type == st.ParamFloat
+
+	if numeric && strings.Contains(spec, ":") {
+		if err := p.parseRange(spec); err != nil {
+			return Param{}, fmt.Errorf("optimize: --param %s: %w", name, err)
+		}
+		return p, nil
+	}
+	for _, s := range strings.Split(spec, ",") {
+		v, err := p.parseValue(strings.TrimSpace(s))
+		if err != nil {
+			return Param{}, fmt.Errorf("optimize: --param %s: %w", name, err)
+		}
+		p.Values = append(p.Values, v)
+	}
+	return p, nil
+}
+
+func (p *Param) parseRange(spec string) error {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("invalid range %q (want lo:hi or lo:hi:step)", spec)
+	}
+	nums := []float64{0, 0, 1}
+	for i, s := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return fmt.Errorf("invalid range %q: %w", spec, err)
+		}
+		nums[i] = f
+	}
+	p.isRange, p.lo, p.hi, p.step = true, nums[0], nums[1], nums[2]
+	switch {
+	case p.step <= 0:
+		return fmt.Errorf("range step must be positive, got %v", p.step)
+	case p.hi < p.lo:
+		return fmt.Errorf("range %q runs backwards", spec)
+	case p.Type == st.ParamInt && (p.lo != math.Trunc(p.lo) || p.step != math.Trunc(p.step)):
+		return fmt.Errorf("integer range %q needs whole numbers", spec)
+	}
+	for i := 0; ; i++ {
+		v := p.lo + float64(i)*p.step
+		if v > p.hi+p.step*1e-9 {
+			break
+		}
+		p.Values = append(p.Values, p.typed(v))
+	}
+	return nil
+}
+
+func (p *Param) parseValue(s string) (any, error) {
+	switch p.Type {
+	case st.ParamInt:
+		return strconv.Atoi(s)
+	case st.ParamFloat:
+		return strconv.ParseFloat(s, 64)
+	}
+	return s, nil
+}
+
+// typed converts a range point to the parameter's type, rounding off float noise
+func (p *Param) typed(v float64) any {
+	if p.Type == st.ParamInt {
+		return int(math.Round(v))
+	}
+	return math.Round(v*1e9) / 1e9
+}
+
+// sample draws a random value: anywhere within a float range, otherwise a grid point
+func (p *Param) sample(rng *rand.Rand) any {
+	if p.isRange && p.Type == st.ParamFloat {
+		return p.typed(p.lo + rng.Float64()*(p.hi-p.lo))
+	}
+	return p.Values[rng.Intn(len(p.Values))]
+}
+
+func lookup(schema st.Schema, name string) (st.Param, bool) {
+	for _, p := range schema {
+		if p.Name == name || slices.Contains(p.Aliases, name) {
+			return p, true
+		}
+	}
+	return st.Param{}, false
+}
+
+// Grid expands every combination of the parameters' values, the last parameter varying fastest
+func Grid(params []Param) []map[string]any {
+	combos := []map[string]any{{}}
+	for _, p := range params {
+		next := make([]map[string]any, 0, len(combos)*len(p.Values))
+		for _, c := range combos {
+			for _, v := range p.Values {
+				combo := make(map[string]any, len(c)+1)
+				for k, cv := range c {
+					combo[k] = cv
+				}
+				combo[p.Name] = v
+				next = append(next, combo)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// Random draws n combinations independently (random search)
+func Random(params []Param, n int, rng *rand.Rand) []map[string]any {
+	combos := make([]map[string]any, n)
+	for i := range combos {
+		combos[i] = make(map[string]any, len(params))
+		for _, p := range params {
+			combos[i][p.Name] = p.sample(rng)
+		}
+	}
+	return combos
+}
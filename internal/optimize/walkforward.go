@@ -0,0 +1,137 @@
+package optimize
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/engine"
+	"github.com/joshskilla/trading-bot/internal/report"
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+)
+
+// Window is one walk-forward step: parameters are chosen on [InStart, InEnd)
+// and traded on the out-of-sample period [InEnd, OutEnd) that follows
+type Window struct {
+	InStart, InEnd time.Time
+	OutEnd         time.Time
+}
+
+// Windows splits [start, end) into walk-forward windows. Each in-sample period
+// lasts inSample (or, anchored, grows from start) and is followed by outSample;
+// windows advance by outSample so the out-of-sample periods tile the range.
+// A final, shorter out-of-sample period is kept.
+func Windows(start, end time.Time, inSample, outSample time.Duration, anchored bool) ([]Window, error) {
+	if inSample <= 0 || outSample <= 0 {
+		return nil, errors.New("optimize: in-sample and out-of-sample periods must be positive")
+	}
+	var windows []Window
+	for inEnd := start.Add(inSample); inEnd.Before(end); inEnd = inEnd.Add(outSample) {
+		w := Window{InStart: inEnd.Add(-inSample), InEnd: inEnd, OutEnd: inEnd.Add(outSample)}
+		if anchored {
+			w.InStart = start
+		}
+		if w.OutEnd.After(end) {
+			w.OutEnd = end
+		}
+		windows = append(windows, w)
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("optimize: %s to %s is too short for a %s in-sample period", start.Format(time.RFC3339), end.Format(time.RFC3339), inSample)
+	}
+	return windows, nil
+}
+
+// Step is a window's outcome: the best in-sample result and how its
+// parameters then did out of sample
+type Step struct {
+	Window
+	Best      Result        // in-sample winner (Err set if no trial succeeded)
+	OutSample report.Report // the winner's out-of-sample window only
+	Err       error
+}
+
+// WalkForward optimises over each window's in-sample period and trades the
+// winner out of sample. The out-of-sample runs share one portfolio, carried
+// from window to window with only the strategy's parameters changing, so
+// together they form a single equity curve (left on portfolio p).
+func WalkForward(ctx context.Context, cfg Config, def st.Definition, combos []map[string]any, metric Metric, windows []Window, p *engine.Portfolio) []Step {
+	steps := make([]Step, len(windows))
+	for i, w := range windows {
+		steps[i].Window = w
+		if err := ctx.Err(); err != nil {
+			steps[i].Err = err
+			continue
+		}
+
+		// In sample: fresh strategies for every combination
+		inCfg := cfg
+		inCfg.Name = fmt.Sprintf("%s-w%d", cfg.Name, i+1)
+		inCfg.Start, inCfg.End = w.InStart, w.InEnd
+		results := Run(ctx, inCfg, Build(def, combos))
+		Rank(results, metric)
+		steps[i].Best = results[0]
+		if results[0].Err != nil {
+			steps[i].Err = fmt.Errorf("no in-sample result: %w", results[0].Err)
+			continue
+		}
+
+		// Out of sample: the winning parameters, on the running portfolio
+		trial := Build(def, []map[string]any{results[0].Params})[0]
+		from := len(p.EquityHistory)
+		fromExec := len(p.ExecutionHistory)
+		if err := engine.Backtest(ctx, p, trial.Strategy, cfg.NewTrader(w.InEnd, w.OutEnd), w.InEnd, w.OutEnd, cfg.Hours); err != nil {
+			steps[i].Err = err
+			continue
+		}
+		if len(p.EquityHistory) > from {
+			steps[i].OutSample = report.Compute(p.Name, p.EquityHistory[from:], p.ExecutionHistory[fromExec:], cfg.Report)
+		}
+	}
+	return steps
+}
+
+// WriteStepsCSV writes one row per window: its periods, the chosen
+// parameters, their in-sample score and out-of-sample performance
+func WriteStepsCSV(path string, params []Param, metric Metric, steps []Step) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+
+	header := []string{"Window", "InStart", "InEnd", "OutEnd"}
+	for _, p := range params {
+		header = append(header, p.Name)
+	}
+	header = append(header, "InSample_"+metric.Name, "OutReturn", "OutMaxDrawdown", "OutTrades", "Error")
+	w.Write(header)
+
+	num := func(f float64) string { return strconv.FormatFloat(f, 'f', 4, 64) }
+	for i, s := range steps {
+		row := []string{strconv.Itoa(i + 1), s.InStart.Format(time.RFC3339), s.InEnd.Format(time.RFC3339), s.OutEnd.Format(time.RFC3339)}
+		for _, p := range params {
+			if s.Best.Err != nil {
+				row = append(row, "")
+			} else {
+				row = append(row, fmt.Sprint(s.Best.Params[p.Name]))
+			}
+		}
+		if s.Err != nil {
+			row = append(row, "", "", "", "", s.Err.Error())
+		} else {
+			row = append(row, num(metric.Value(s.Best.Report)), num(s.OutSample.TotalReturn), num(s.OutSample.MaxDrawdown), strconv.Itoa(s.OutSample.Trades), "")
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,178 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	ds "github.com/joshskilla/trading-bot/internal/datastore"
+	"github.com/joshskilla/trading-bot/internal/engine"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// Generate rebuilds a portfolio's report from its saved equity curve and
+// orders, keeping records within [from, to] (zero times leave that end open).
+func Generate(name string, from, to time.Time, opts Options) (Report, error) {
+	equity, err := LoadEquity(name)
+	if err != nil {
+		return Report{}, err
+	}
+	execs, err := LoadExecutions(name)
+	if err != nil {
+		return Report{}, err
+	}
+
+	var inEquity []engine.EquityRecord
+	for _, e := range equity {
+		if inWindow(e.Time, from, to) {
+			inEquity = append(inEquity, e)
+		}
+	}
+	var inExecs []engine.ExecutionRecord
+	for _, e := range execs {
+		if inWindow(e.Time, from, to) {
+			inExecs = append(inExecs, e)
+		}
+	}
+	if len(inEquity) == 0 {
+		return Report{}, fmt.Errorf("report: no equity recorded for %s in the period", name)
+	}
+	return Compute(name, inEquity, inExecs, opts), nil
+}
+
+func inWindow(ts, from, to time.Time) bool {
+	return (from.IsZero() || !ts.Before(from)) && (to.IsZero() || !ts.After(to))
+}
+
+// Marshal the report to JSON and write to results/<name>_report.json
+func (r Report) SaveToJSON() error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ds.AbsolutePath(fmt.Sprintf(ReportFilePath, r.Portfolio)), data, 0644)
+}
+
+// Load a report from results/<name>_report.json
+func LoadFromJSON(name string) (Report, error) {
+	var r Report
+	data, err := os.ReadFile(ds.AbsolutePath(fmt.Sprintf(ReportFilePath, name)))
+	if err != nil {
+		return r, err
+	}
+	err = json.Unmarshal(data, &r)
+	return r, err
+}
+
+// LoadEquity reads results/<name>_equity.csv
+func LoadEquity(name string) ([]engine.EquityRecord, error) {
+	rows, err := readCSV(fmt.Sprintf(engine.EquityFilePath, name))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]engine.EquityRecord, 0, len(rows))
+	for _, row := range rows {
+		ts, err := row.time("Time")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, engine.EquityRecord{
+			Time:          ts,
+			Cash:          row.float("Cash"),
+			MarketValue:   row.float("MarketValue"),
+			Equity:        row.float("Equity"),
+			RealisedPnL:   row.float("RealisedPnL"),
+			UnrealisedPnL: row.float("UnrealisedPnL"),
+		})
+	}
+	return out, nil
+}
+
+// LoadExecutions reads results/<name>_orders.csv
+func LoadExecutions(name string) ([]engine.ExecutionRecord, error) {
+	rows, err := readCSV(fmt.Sprintf(engine.OrdersFilePath, name))
+	if os.IsNotExist(err) {
+		return nil, nil // nothing traded
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]engine.ExecutionRecord, 0, len(rows))
+	for _, row := range rows {
+		ts, err := row.time("Time")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, engine.ExecutionRecord{
+			Time:        ts,
+			Asset:       t.Asset{Symbol: row["Asset"]},
+			Action:      row.action("Action"),
+			Qty:         row.float("Qty"),
+			Price:       row.float("Price"),
+			Cash:        row.float("Cash"),
+			Fee:         row.float("Fee"),
+			Slippage:    row.float("Slippage"),
+			RealisedPnL: row.float("RealisedPnL"),
+		})
+	}
+	return out, nil
+}
+
+// csvRow maps header names to values
+type csvRow map[string]string
+
+func (r csvRow) float(col string) float64 {
+	f, _ := strconv.ParseFloat(r[col], 64)
+	return f
+}
+
+// action accepts both names ("SELL") and the enum values the CSV writer emits
+func (r csvRow) action(col string) t.Action {
+	if n, err := strconv.Atoi(r[col]); err == nil {
+		return t.Action(n)
+	}
+	return t.ParseAction(r[col])
+}
+
+func (r csvRow) time(col string) (time.Time, error) {
+	ts, err := time.Parse(time.RFC3339, r[col])
+	if err != nil {
+		return ts, fmt.Errorf("report: invalid %s %q: %w", col, r[col], err)
+	}
+	return ts, nil
+}
+
+func readCSV(path string) ([]csvRow, error) {
+	f, err := os.Open(ds.AbsolutePath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rd := csv.NewReader(f)
+	rd.FieldsPerRecord = -1
+	records, err := rd.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("report: %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	header := records[0]
+	rows := make([]csvRow, 0, len(records)-1)
+	for i, rec := range records[1:] {
+		if len(rec) > len(header) {
+			return nil, fmt.Errorf("report: %s: row %d has %d columns but the header %d", path, i+2, len(rec), len(header))
+		}
+		row := make(csvRow, len(header))
+		for i, col := range header {
+			if i < len(rec) {
+				row[col] = rec[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,235 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/engine"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+const ReportFilePath = "results/%s_report.json"
+
+// Report summarises a portfolio's performance over its equity curve
+type Report struct {
+	Portfolio string    `json:"portfolio"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+
+	StartEquity      float64 `json:"start_equity"`
+	EndEquity        float64 `json:"end_equity"`
+	TotalReturn      float64 `json:"total_return"`
+	AnnualisedReturn float64 `json:"annualised_return"`
+	Volatility       float64 `json:"volatility"` // annualised stddev of period returns
+	Sharpe           float64 `json:"sharpe"`
+	Sortino          float64 `json:"sortino"`
+
+	MaxDrawdown         float64  `json:"max_drawdown"`          // worst peak-to-trough fall, as a fraction of the peak
+	MaxDrawdownDuration Duration `json:"max_drawdown_duration"` // longest time spent below a previous peak
+
+	Trades      int     `json:"trades"`   // closing (sell) executions
+	WinRate     float64 `json:"win_rate"` // share of closing trades with positive realised PnL
+	AvgTradePnL float64 `json:"avg_trade_pnl"`
+	RealisedPnL float64 `json:"realised_pnl"`
+	Fees        float64 `json:"fees"`
+	Exposure    float64 `json:"exposure"` // average share of equity held in positions
+	Turnover    float64 `json:"turnover"` // traded notional / average equity
+}
+
+// Options tune metric calculations
+type Options struct {
+	RiskFreeRate float64 // annual, for Sharpe & Sortino
+}
+
+// Duration is a time.Duration that reads and writes JSON as "1h30m0s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+const yearDuration = 365.25 * 24 * time.Hour
+
+// Compute builds a report from an equity curve and the executions behind it.
+// Returns are taken between consecutive equity points and annualised at the
+// rate the points were recorded.
+func Compute(name string, equity []engine.EquityRecord, execs []engine.ExecutionRecord, opts Options) Report {
+	r := Report{Portfolio: name}
+	equity = sortedEquity(equity)
+	if len(equity) == 0 {
+		r.tradeStats(execs, 0)
+		return r
+	}
+	first, last := equity[0], equity[len(equity)-1]
+	r.Start, r.End = first.Time, last.Time
+	r.StartEquity, r.EndEquity = first.Equity, last.Equity
+	if first.Equity > 0 {
+		r.TotalReturn = last.Equity/first.Equity - 1
+	}
+
+	years := float64(last.Time.Sub(first.Time)) / float64(yearDuration)
+	if years > 0 && r.TotalReturn > -1 {
+		r.AnnualisedReturn = finite(math.Pow(1+r.TotalReturn, 1/years) - 1)
+	}
+
+	returns := periodReturns(equity)
+	if len(returns) > 1 && years > 0 {
+		periodsPerYear := float64(len(returns)) / years
+		rf := opts.RiskFreeRate / periodsPerYear
+		mean, std := meanStd(returns)
+		r.Volatility = std * math.Sqrt(periodsPerYear)
+		if std > 0 {
+			r.Sharpe = (mean - rf) / std * math.Sqrt(periodsPerYear)
+		}
+		if dd := downsideDeviation(returns, rf); dd > 0 {
+			r.Sortino = (mean - rf) / dd * math.Sqrt(periodsPerYear)
+		}
+	}
+
+	r.drawdown(equity)
+
+	avgEquity, exposure := 0.0, 0.0
+	for _, e := range equity {
+		avgEquity += e.Equity
+		if e.Equity > 0 {
+			exposure += math.Abs(e.MarketValue) / e.Equity
+		}
+	}
+	avgEquity /= float64(len(equity))
+	r.Exposure = exposure / float64(len(equity))
+	r.tradeStats(execs, avgEquity)
+	return r
+}
+
+func (r *Report) drawdown(equity []engine.EquityRecord) {
+	peak, peakTime := equity[0].Equity, equity[0].Time
+	for _, e := range equity {
+		if e.Equity >= peak {
+			peak, peakTime = e.Equity, e.Time
+			continue
+		}
+		if peak > 0 {
+			r.MaxDrawdown = math.Max(r.MaxDrawdown, (peak-e.Equity)/peak)
+		}
+		if d := Duration(e.Time.Sub(peakTime)); d > r.MaxDrawdownDuration {
+			r.MaxDrawdownDuration = d
+		}
+	}
+}
+
+func (r *Report) tradeStats(execs []engine.ExecutionRecord, avgEquity float64) {
+	wins, notional := 0, 0.0
+	for _, e := range execs {
+		notional += e.Qty * e.Price
+		r.Fees += e.Fee
+		if e.Action != t.Sell {
+			continue
+		}
+		r.Trades++
+		r.RealisedPnL += e.RealisedPnL
+		if e.RealisedPnL > 0 {
+			wins++
+		}
+	}
+	if r.Trades > 0 {
+		r.WinRate = float64(wins) / float64(r.Trades)
+		r.AvgTradePnL = r.RealisedPnL / float64(r.Trades)
+	}
+	if avgEquity > 0 {
+		r.Turnover = notional / avgEquity
+	}
+}
+
+// finite zeroes values that overflow, e.g. annualising a big return over a few minutes
+func finite(f float64) float64 {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0
+	}
+	return f
+}
+
+func sortedEquity(equity []engine.EquityRecord) []engine.EquityRecord {
+	out := append([]engine.EquityRecord(nil), equity...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
+
+func periodReturns(equity []engine.EquityRecord) []float64 {
+	returns := make([]float64, 0, len(equity))
+	for i := 1; i < len(equity); i++ {
+		if prev := equity[i-1].Equity; prev > 0 {
+			returns = append(returns, equity[i].Equity/prev-1)
+		}
+	}
+	return returns
+}
+
+func meanStd(xs []float64) (mean, std float64) {
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	for _, x := range xs {
+		std += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(xs)-1))
+}
+
+// downsideDeviation only penalises returns below the target
+func downsideDeviation(xs []float64, target float64) float64 {
+	sum := 0.0
+	for _, x := range xs {
+		if x < target {
+			sum += (x - target) * (x - target)
+		}
+	}
+	return math.Sqrt(sum / float64(len(xs)))
+}
+
+// Print writes the report as a two-column table
+func (r Report) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Portfolio\t%s\n", r.Portfolio)
+	fmt.Fprintf(tw, "Period\t%s → %s\n", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339))
+	fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 40))
+	fmt.Fprintf(tw, "Equity\t%.2f → %.2f\n", r.StartEquity, r.EndEquity)
+	fmt.Fprintf(tw, "Total return\t%s\n", pct(r.TotalReturn))
+	fmt.Fprintf(tw, "Annualised return\t%s\n", pct(r.AnnualisedReturn))
+	fmt.Fprintf(tw, "Volatility\t%s\n", pct(r.Volatility))
+	fmt.Fprintf(tw, "Sharpe\t%.2f\n", r.Sharpe)
+	fmt.Fprintf(tw, "Sortino\t%.2f\n", r.Sortino)
+	fmt.Fprintf(tw, "Max drawdown\t%s\n", pct(-r.MaxDrawdown))
+	fmt.Fprintf(tw, "Max drawdown duration\t%s\n", time.Duration(r.MaxDrawdownDuration))
+	fmt.Fprintf(tw, "%s\n", strings.Repeat("-", 40))
+	fmt.Fprintf(tw, "Trades\t%d\n", r.Trades)
+	fmt.Fprintf(tw, "Win rate\t%s\n", pct(r.WinRate))
+	fmt.Fprintf(tw, "Avg trade PnL\t%.2f\n", r.AvgTradePnL)
+	fmt.Fprintf(tw, "Realised PnL\t%.2f\n", r.RealisedPnL)
+	fmt.Fprintf(tw, "Fees\t%.2f\n", r.Fees)
+	fmt.Fprintf(tw, "Exposure\t%s\n", pct(r.Exposure))
+	fmt.Fprintf(tw, "Turnover\t%.2fx\n", r.Turnover)
+	tw.Flush()
+}
+
+func pct(f float64) string {
+	return fmt.Sprintf("%.2f%%", f*100)
+}
@@ -0,0 +1,127 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ds "github.com/joshskilla/trading-bot/internal/datastore"
+	"github.com/joshskilla/trading-bot/internal/engine"
+	"github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+func equityCurve(start time.Time, step time.Duration, values ...float64) []engine.EquityRecord {
+	out := make([]engine.EquityRecord, len(values))
+	for i, v := range values {
+		out[i] = engine.EquityRecord{Time: start.Add(time.Duration(i) * step), Cash: v / 2, MarketValue: v / 2, Equity: v}
+	}
+	return out
+}
+
+func TestCompute(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	equity := equityCurve(start, 24*time.Hour, 100, 110, 99, 104.5, 121)
+	asset := types.NewAsset("AAPL", "NASDAQ", "stock")
+	execs := []engine.ExecutionRecord{
+		{Time: start, Asset: asset, Action: types.Buy, Qty: 1, Price: 50, Fee: 1},
+		{Time: start.Add(24 * time.Hour), Asset: asset, Action: types.Sell, Qty: 1, Price: 60, Fee: 1, RealisedPnL: 8},
+		{Time: start.Add(48 * time.Hour), Asset: asset, Action: types.Sell, Qty: 1, Price: 40, RealisedPnL: -2},
+	}
+
+	r := Compute("demo", equity, execs, Options{})
+	require.InDelta(t, 0.21, r.TotalReturn, 1e-9)
+	require.InDelta(t, 0.1, r.MaxDrawdown, 1e-9) // 110 -> 99
+	require.Equal(t, 48*time.Hour, time.Duration(r.MaxDrawdownDuration))
+	require.Equal(t, 2, r.Trades)
+	require.InDelta(t, 0.5, r.WinRate, 1e-9)
+	require.InDelta(t, 3, r.AvgTradePnL, 1e-9)
+	require.InDelta(t, 2, r.Fees, 1e-9)
+	require.InDelta(t, 0.5, r.Exposure, 1e-9)
+	require.InDelta(t, 150/106.9, r.Turnover, 1e-9)
+
+	// Returns: +10%, -10%, +5.56%, +15.79% over 4 days -> 365.25 periods a year
+	require.Greater(t, r.Sharpe, 0.0)
+	require.Greater(t, r.Sortino, r.Sharpe, "only one losing period")
+	require.InDelta(t, math.Pow(1.21, 365.25/4)-1, r.AnnualisedReturn, 1e-6)
+
+	var sb strings.Builder
+	r.Print(&sb)
+	require.Contains(t, sb.String(), "Max drawdown")
+}
+
+func TestComputeFlatAndEmpty(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := Compute("flat", equityCurve(start, time.Hour, 100, 100, 100), nil, Options{})
+	require.Zero(t, r.TotalReturn)
+	require.Zero(t, r.Sharpe)
+	require.Zero(t, r.MaxDrawdown)
+
+	r = Compute("empty", nil, nil, Options{})
+	require.Zero(t, r.EndEquity)
+}
+
+func TestGenerateFromSavedResults(t *testing.T) {
+	name := "UnitTestReport"
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := engine.NewPortfolio(name, 0)
+	p.EquityHistory = equityCurve(start, time.Hour, 100, 90, 120)
+	p.ExecutionHistory = []engine.ExecutionRecord{
+		{Time: start.Add(time.Hour), Asset: types.NewAsset("AAPL", "NASDAQ", "stock"), Action: types.Sell, Qty: 1, Price: 10, RealisedPnL: 4},
+	}
+	require.NoError(t, p.FlushEquityToFile())
+	require.NoError(t, p.FlushOrdersToFile())
+	defer os.Remove(ds.AbsolutePath(fmt.Sprintf(engine.EquityFilePath, name)))
+	defer os.Remove(ds.AbsolutePath(fmt.Sprintf(engine.OrdersFilePath, name)))
+
+	r, err := Generate(name, start.Add(time.Hour), time.Time{}, Options{})
+	require.NoError(t, err)
+	require.Equal(t, 90.0, r.StartEquity)
+	require.InDelta(t, 1.0/3, r.TotalReturn, 1e-9)
+	require.Equal(t, 1, r.Trades)
+
+	require.NoError(t, r.SaveToJSON())
+	defer os.Remove(ds.AbsolutePath(fmt.Sprintf(ReportFilePath, name)))
+	loaded, err := LoadFromJSON(name)
+	require.NoError(t, err)
+	require.Equal(t, r.MaxDrawdownDuration, loaded.MaxDrawdownDuration)
+	require.InDelta(t, r.TotalReturn, loaded.TotalReturn, 1e-9)
+
+	_, err = Generate(name, start.Add(10*time.Hour), time.Time{}, Options{})
+	require.Error(t, err, "nothing in the period")
+}
+
+func TestLoadExecutionsAfterColumnsWereAdded(t *testing.T) {
+	name := "UnitTestReportOldColumns"
+	path := ds.AbsolutePath(fmt.Sprintf(engine.OrdersFilePath, name))
+	old := "Time,Asset,Action,Qty,Price,Cash\n2024-01-01T00:00:00Z,AAPL,0,1,10,90\n"
+	require.NoError(t, os.WriteFile(path, []byte(old), 0644))
+	defer os.Remove(path)
+
+	// Rows of the old & new layouts can't be read under one header
+	require.NoError(t, os.WriteFile(path, []byte(old+"2024-01-01T01:00:00Z,AAPL,1,1,12,102,1.00,0.10,0.90\n"), 0644))
+	_, err := LoadExecutions(name)
+	require.ErrorContains(t, err, "row 3 has 9 columns but the header 6")
+
+	// So the writer moves the old file aside rather than appending to it
+	require.NoError(t, os.WriteFile(path, []byte(old), 0644))
+	p := engine.NewPortfolio(name, 0)
+	p.ExecutionHistory = []engine.ExecutionRecord{
+		{Time: time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), Asset: types.NewAsset("AAPL", "NASDAQ", "stock"), Action: types.Sell, Qty: 1, Price: 12, Fee: 1, RealisedPnL: 0.9},
+	}
+	require.NoError(t, p.FlushOrdersToFile())
+	rotated, err := filepath.Glob(strings.TrimSuffix(path, ".csv") + ".*.csv")
+	require.NoError(t, err)
+	require.Len(t, rotated, 1)
+	defer os.Remove(rotated[0])
+
+	execs, err := LoadExecutions(name)
+	require.NoError(t, err)
+	require.Len(t, execs, 1)
+	require.Equal(t, 1.0, execs[0].Fee)
+	require.Equal(t, 0.9, execs[0].RealisedPnL)
+}
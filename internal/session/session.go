@@ -0,0 +1,497 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/calendar"
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	"github.com/joshskilla/trading-bot/internal/engine"
+	st "github.com/joshskilla/trading-bot/internal/strategy"
+	t "github.com/joshskilla/trading-bot/internal/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Session is a validated session file: everything `bot run` & `bot backtest`
+// otherwise take as flags or compiled-in constants, so a run can be
+// reproduced from a versioned file.
+//
+//	mode: backtest                 # backtest, paper or live
+//	start: 2024-01-02T14:30:00Z    # backtests
+//	end: 2024-01-31T21:00:00Z
+//	duration: 6h30m                # paper & live (default 10h)
+//	output: runs/january           # the session's BOT_PATH (portfolios, checkpoints, results)
+//	listen: localhost:8080         # optional: serve the HTTP status & control API
+//	data: {source: file, dir: data/history, cache: true}
+//	                               # paper & live: {source: finnhub, url: ws://localhost:9090, record: true}
+//	hours: {open: "09:30", close: "16:00", timezone: America/New_York, weekends: false, exchange: NYSE, extended: false}
+//	                               # exchange: holidays & half days (none => off); extended: pre & post-market too
+//	fees: {fill_at: close, commission: 1, commission_rate: 0.0005, slippage: "bps:5"}
+//	risk: {max_position: 5000, max_daily_loss: 250, no_shorting: true}
+//	breaker: {max_drawdown: 0.1, max_rejections: 3, max_data_age: 5m, flatten: true}
+//	runners:
+//	  - portfolio: demo
+//	    cash: 10000                # creates the portfolio if it doesn't exist
+//	    strategy: momentum
+//	    checkpoint: demo-momentum  # optional: restored from (if saved); paper & live save back to it
+//	    params: {asset: AAPL, fast: 5, slow: 20}
+//	    risk: {max_order_notional: 1000}   # replaces the session's limits
+//	    breaker: {max_drawdown: 0.05}      # likewise
+//
+// Relative paths are resolved against the file's directory.
+type Session struct {
+	Mode       string // backtest, paper or live
+	Start, End time.Time
+	Duration   time.Duration // paper & live: how long to trade
+	Output     string        // absolute; "" => BOT_PATH
+	Listen     string        // HTTP API address, "" => none
+	Data       Data
+	Hours      t.TradingHours
+	Fills      engine.FillModel
+	Risk       engine.RiskLimits
+	Breaker    engine.BreakerLimits
+	Runners    []Runner
+
+	path  string
+	lines map[string]int // key path (e.g. "runners[0].params.fast") => line
+}
+
+// Data is the session's market data source
+type Data struct {
+	Source string // backtests: alpaca or file; paper & live: finnhub
+	Dir    string // file source: absolute directory of bar files, "" => default
+	Cache  bool   // alpaca source: go through the on-disk bar cache
+	URL    string // finnhub source: websocket endpoint, "" => Finnhub's (e.g. a `bot mock-finnhub`)
+	Record bool   // finnhub source: record the trade stream for `bot replay`
+}
+
+// Runner is one portfolio traded by one strategy
+type Runner struct {
+	Portfolio  string
+	Cash       float64 // starting cash if the portfolio is created
+	Strategy   string
+	Checkpoint string         // "" => strategy state isn't saved
+	Params     map[string]any // validated against the strategy's schema, one by one
+	Risk       engine.RiskLimits
+	Breaker    engine.BreakerLimits
+}
+
+// ----------- FILE FORMAT -----------
+
+type fileSpec struct {
+	Mode     string       `yaml:"mode"`
+	Start    string       `yaml:"start"`
+	End      string       `yaml:"end"`
+	Duration string       `yaml:"duration"`
+	Output   string       `yaml:"output"`
+	Listen   string       `yaml:"listen"`
+	Data     dataSpec     `yaml:"data"`
+	Hours    hoursSpec    `yaml:"hours"`
+	Fees     Fees         `yaml:"fees"`
+	Risk     riskSpec     `yaml:"risk"`
+	Breaker  breakerSpec  `yaml:"breaker"`
+	Runners  []runnerSpec `yaml:"runners"`
+}
+
+type dataSpec struct {
+	Source string `yaml:"source"`
+	Dir    string `yaml:"dir"`
+	Cache  *bool  `yaml:"cache"`
+	URL    string `yaml:"url"`
+	Record *bool  `yaml:"record"`
+}
+
+type hoursSpec struct {
+	Open     string `yaml:"open"`
+	Close    string `yaml:"close"`
+	Timezone string `yaml:"timezone"`
+	Weekends bool   `yaml:"weekends"`
+	Exchange string `yaml:"exchange"`
+	Extended bool   `yaml:"extended"`
+}
+
+type runnerSpec struct {
+	Portfolio  string         `yaml:"portfolio"`
+	Cash       float64        `yaml:"cash"`
+	Strategy   string         `yaml:"strategy"`
+	Checkpoint string         `yaml:"checkpoint"`
+	Params     map[string]any `yaml:"params"`
+	Risk       *riskSpec      `yaml:"risk"`
+	Breaker    *breakerSpec   `yaml:"breaker"`
+}
+
+type riskSpec struct {
+	MaxPosition        float64 `yaml:"max_position"`
+	MaxGrossExposure   float64 `yaml:"max_gross_exposure"`
+	MaxOrderNotional   float64 `yaml:"max_order_notional"`
+	MaxOrdersPerMinute int     `yaml:"max_orders_per_minute"`
+	MaxDailyLoss       float64 `yaml:"max_daily_loss"`
+	NoShorting         bool    `yaml:"no_shorting"`
+}
+
+type breakerSpec struct {
+	MaxDrawdown   float64 `yaml:"max_drawdown"`
+	MaxRejections int     `yaml:"max_rejections"`
+	MaxDataAge    string  `yaml:"max_data_age"`
+	Flatten       bool    `yaml:"flatten"`
+}
+
+// Fees is the simulated fill model, as in the backtest flags
+type Fees struct {
+	FillAt         string  `yaml:"fill_at"`
+	Commission     float64 `yaml:"commission"`
+	CommissionRate float64 `yaml:"commission_rate"`
+	Slippage       string  `yaml:"slippage"`
+}
+
+// FillModel builds the fill model the fees describe
+func (f Fees) FillModel() (engine.FillModel, error) {
+	fm := engine.DefaultFillModel()
+	timing, err := engine.ParseFillTiming(f.FillAt)
+	if err != nil {
+		return fm, err
+	}
+	fm.Timing = timing
+
+	var commissions engine.Commissions
+	if f.Commission > 0 {
+		commissions = append(commissions, engine.FixedCommission{PerOrder: f.Commission})
+	}
+	if f.CommissionRate > 0 {
+		commissions = append(commissions, engine.PercentCommission{Rate: f.CommissionRate})
+	}
+	if len(commissions) > 0 {
+		fm.Commission = commissions
+	}
+
+	if fm.Slippage, err = engine.ParseSlippage(f.Slippage); err != nil {
+		return fm, err
+	}
+	return fm, nil
+}
+
+// ----------- LOADING -----------
+
+// Load reads and validates a session file
+func Load(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse validates a session file's contents; path names the file in errors
+// and anchors relative paths
+func Parse(path string, data []byte) (*Session, error) {
+	s := &Session{path: path, lines: make(map[string]int)}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	indexLines(&root, "", s.lines)
+
+	var spec fileSpec
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := s.load(spec); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Errorf reports a problem with the value at key, pointing at its line
+func (s *Session) Errorf(key, format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	if line, ok := s.lines[key]; ok {
+		return fmt.Errorf("%s:%d: %s: %s", s.path, line, key, msg)
+	}
+	return fmt.Errorf("%s: %s: %s", s.path, key, msg)
+}
+
+func (s *Session) load(spec fileSpec) error {
+	var errs []error
+	fail := func(key, format string, args ...any) { errs = append(errs, s.Errorf(key, format, args...)) }
+
+	s.Mode = spec.Mode
+	switch spec.Mode {
+	case "backtest":
+		var err error
+		if s.Start, err = time.Parse(time.RFC3339, spec.Start); err != nil {
+			fail("start", "want an RFC3339 time, e.g. 2024-01-02T14:30:00Z")
+		}
+		if s.End, err = time.Parse(time.RFC3339, spec.End); err != nil {
+			fail("end", "want an RFC3339 time, e.g. 2024-01-02T21:00:00Z")
+		} else if !s.End.After(s.Start) {
+			fail("end", "must be after start")
+		}
+		if spec.Duration != "" {
+			fail("duration", "only paper & live sessions run for a duration; backtests use start & end")
+		}
+	case "paper", "live":
+		if spec.Start != "" {
+			fail("start", "only backtests take start & end; use duration")
+		} else if spec.End != "" {
+			fail("end", "only backtests take start & end; use duration")
+		}
+		s.Duration = cfg.MaxLiveTradingDuration
+		if spec.Duration != "" {
+			d, err := time.ParseDuration(spec.Duration)
+			if err != nil || d <= 0 {
+				fail("duration", "want a positive duration, e.g. 6h30m")
+			}
+			s.Duration = d
+		}
+	case "":
+		fail("mode", "required: backtest, paper or live")
+	default:
+		fail("mode", "unknown mode %q (use backtest, paper or live)", spec.Mode)
+	}
+
+	if spec.Output != "" {
+		s.Output = s.resolve(spec.Output)
+	}
+	if s.Listen = spec.Listen; s.Listen != "" {
+		if _, _, err := net.SplitHostPort(s.Listen); err != nil {
+			fail("listen", "want host:port or :port, e.g. localhost:8080")
+		}
+	}
+
+	// Market data
+	s.Data = Data{Source: spec.Data.Source, Cache: true}
+	if spec.Data.Cache != nil {
+		s.Data.Cache = *spec.Data.Cache
+	}
+	if spec.Data.Dir != "" {
+		s.Data.Dir = s.resolve(spec.Data.Dir)
+	}
+	switch {
+	case s.Mode == "backtest" && s.Data.Source == "":
+		s.Data.Source = "alpaca"
+	case s.Mode == "backtest" && s.Data.Source != "alpaca" && s.Data.Source != "file":
+		fail("data.source", "unknown source %q for backtests (use alpaca or file)", s.Data.Source)
+	case s.Mode != "backtest" && s.Data.Source == "":
+		s.Data.Source = "finnhub"
+	case s.Mode != "backtest" && s.Data.Source != "finnhub":
+		fail("data.source", "unknown source %q for %s sessions (use finnhub)", s.Data.Source, s.Mode)
+	}
+	if s.Data.Source == "finnhub" {
+		s.Data.Record = spec.Data.Record == nil || *spec.Data.Record
+	} else if spec.Data.Record != nil {
+		fail("data.record", "only the finnhub source is recorded")
+	}
+	if s.Data.URL = spec.Data.URL; s.Data.URL != "" {
+		if s.Data.Source != "finnhub" {
+			fail("data.url", "only the finnhub source takes a url")
+		} else if u, err := url.Parse(s.Data.URL); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			fail("data.url", "want a websocket URL, e.g. ws://localhost:9090")
+		}
+	}
+
+	s.Hours = s.loadHours(spec.Hours, fail)
+
+	if _, err := engine.ParseFillTiming(spec.Fees.FillAt); err != nil {
+		fail("fees.fill_at", "%v", err)
+	}
+	if _, err := engine.ParseSlippage(spec.Fees.Slippage); err != nil {
+		fail("fees.slippage", "%v", err)
+	}
+	if spec.Fees.Commission < 0 {
+		fail("fees.commission", "must not be negative")
+	}
+	if spec.Fees.CommissionRate < 0 {
+		fail("fees.commission_rate", "must not be negative")
+	}
+	s.Fills, _ = spec.Fees.FillModel()
+	s.Risk = s.loadRisk("risk", spec.Risk, fail)
+	s.Breaker = s.loadBreaker("breaker", spec.Breaker, fail)
+
+	// Runners
+	if len(spec.Runners) == 0 {
+		fail("runners", "at least one runner is required")
+	}
+	if s.Mode == "live" && len(spec.Runners) > 1 {
+		fail("runners", "live mode reconciles each portfolio with the whole broker account; list one runner")
+	}
+	seen := make(map[string]bool)
+	for i, rs := range spec.Runners {
+		key := fmt.Sprintf("runners[%d]", i)
+		r := Runner{Portfolio: rs.Portfolio, Cash: rs.Cash, Strategy: rs.Strategy, Checkpoint: rs.Checkpoint, Params: rs.Params, Risk: s.Risk, Breaker: s.Breaker}
+		if rs.Risk != nil {
+			r.Risk = s.loadRisk(key+".risk", *rs.Risk, fail)
+		}
+		if rs.Breaker != nil {
+			r.Breaker = s.loadBreaker(key+".breaker", *rs.Breaker, fail)
+		}
+		switch {
+		case r.Portfolio == "":
+			fail(key, "portfolio is required")
+		case seen[r.Portfolio]:
+			fail(key+".portfolio", "portfolio %q is listed twice; each runner needs its own portfolio", r.Portfolio)
+		}
+		seen[r.Portfolio] = true
+		if r.Cash < 0 {
+			fail(key+".cash", "must not be negative")
+		}
+
+		def, ok := st.Lookup(r.Strategy)
+		if !ok {
+			fail(key+".strategy", "unknown strategy %q (available: %s)", r.Strategy, strings.Join(st.Names(), ", "))
+		} else {
+			s.checkParams(def, key+".params", r.Params, fail)
+		}
+		s.Runners = append(s.Runners, r)
+	}
+	return errors.Join(errs...)
+}
+
+// Checks each inline parameter against the strategy's schema on its own,
+// so a bad value is reported at its key. Required parameters may come
+// from the checkpoint, so missing ones are left to the strategy.
+func (s *Session) checkParams(def st.Definition, key string, params map[string]any, fail func(key, format string, args ...any)) {
+	for name, v := range params {
+		p, ok := def.Params.Lookup(name)
+		if !ok {
+			fail(key+"."+name, "%s takes no parameter %q", def.Name, name)
+			continue
+		}
+		p.Default = nil
+		if _, err := (st.Schema{p}).Validate(map[string]any{name: v}); err != nil {
+			fail(key+"."+name, "%v", strings.TrimPrefix(err.Error(), "invalid checkpoint: "))
+		}
+	}
+}
+
+func (s *Session) loadRisk(key string, spec riskSpec, fail func(key, format string, args ...any)) engine.RiskLimits {
+	limits := []struct {
+		name  string
+		value float64
+	}{
+		{"max_position", spec.MaxPosition},
+		{"max_gross_exposure", spec.MaxGrossExposure},
+		{"max_order_notional", spec.MaxOrderNotional},
+		{"max_orders_per_minute", float64(spec.MaxOrdersPerMinute)},
+		{"max_daily_loss", spec.MaxDailyLoss},
+	}
+	for _, l := range limits {
+		if l.value < 0 {
+			fail(key+"."+l.name, "must not be negative (0 => no limit)")
+		}
+	}
+	return engine.RiskLimits(spec)
+}
+
+func (s *Session) loadBreaker(key string, spec breakerSpec, fail func(key, format string, args ...any)) engine.BreakerLimits {
+	limits := engine.BreakerLimits{MaxDrawdown: spec.MaxDrawdown, MaxRejections: spec.MaxRejections, Flatten: spec.Flatten}
+	if spec.MaxDrawdown < 0 || spec.MaxDrawdown >= 1 {
+		fail(key+".max_drawdown", "must be a fraction of peak equity in [0, 1), e.g. 0.1 (0 => no limit)")
+	}
+	if spec.MaxRejections < 0 {
+		fail(key+".max_rejections", "must not be negative (0 => no limit)")
+	}
+	if spec.MaxDataAge != "" {
+		age, err := time.ParseDuration(spec.MaxDataAge)
+		switch {
+		case err != nil:
+			fail(key+".max_data_age", "invalid duration %q (e.g. 5m)", spec.MaxDataAge)
+		case age < 0:
+			fail(key+".max_data_age", "must not be negative (0 => no limit)")
+		}
+		limits.MaxDataAge = age
+	}
+	return limits
+}
+
+func (s *Session) loadHours(spec hoursSpec, fail func(key, format string, args ...any)) t.TradingHours {
+	hours := engine.RegularHours()
+	hours.WeekendsOff = !spec.Weekends
+	if spec.Timezone != "" {
+		if _, err := time.LoadLocation(spec.Timezone); err != nil {
+			fail("hours.timezone", "unknown time zone %q", spec.Timezone)
+		}
+		hours.ExchangeTZ = spec.Timezone
+	}
+	clock := func(key, v string) (int, int, bool) {
+		parsed, err := time.Parse("15:04", v)
+		if err != nil {
+			fail(key, "want a 24-hour time, e.g. \"09:30\"")
+			return 0, 0, false
+		}
+		return parsed.Hour(), parsed.Minute(), true
+	}
+	if spec.Open != "" {
+		if h, m, ok := clock("hours.open", spec.Open); ok {
+			hours.OpenHour, hours.OpenMinute = h, m
+		}
+	}
+	if spec.Close != "" {
+		if h, m, ok := clock("hours.close", spec.Close); ok {
+			hours.CloseHour, hours.CloseMinute = h, m
+		}
+	}
+	if hours.CloseHour*60+hours.CloseMinute <= hours.OpenHour*60+hours.OpenMinute {
+		fail("hours.close", "must be after the open")
+	}
+	switch {
+	case strings.EqualFold(spec.Exchange, "none"):
+		hours.Exchange = ""
+	case spec.Exchange != "":
+		if _, err := calendar.LookupExchange(spec.Exchange); err != nil {
+			fail("hours.exchange", "%v (or none)", err)
+		}
+		hours.Exchange = strings.ToUpper(spec.Exchange)
+	}
+	if spec.Extended && hours.Exchange == "" {
+		fail("hours.extended", "needs an exchange calendar for its pre & post-market hours")
+	}
+	hours.Extended = spec.Extended
+	return hours
+}
+
+func (s *Session) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	abs, err := filepath.Abs(filepath.Join(filepath.Dir(s.path), path))
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// Records the line of every key in the document, keyed by path
+func indexLines(n *yaml.Node, path string, lines map[string]int) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			indexLines(c, path, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			lines[key] = n.Content[i].Line
+			indexLines(n.Content[i+1], key, lines)
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			key := path + "[" + strconv.Itoa(i) + "]"
+			lines[key] = c.Line
+			indexLines(c, key, lines)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package session
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joshskilla/trading-bot/internal/engine"
+	"github.com/stretchr/testify/require"
+)
+
+const backtestFile = `mode: backtest
+start: 2024-01-02T14:30:00Z
+end: 2024-01-03T21:00:00Z
+output: runs/jan
+data:
+  source: file
+  dir: bars
+hours:
+  open: "10:00"
+  close: "15:30"
+fees:
+  commission_rate: 0.0005
+  slippage: bps:5
+risk:
+  max_position: 5000
+  no_shorting: true
+breaker:
+  max_drawdown: 0.1
+  max_data_age: 5m
+  flatten: true
+runners:
+  - portfolio: momentum-aapl
+    cash: 10000
+    strategy: momentum
+    checkpoint: aapl
+    params: {asset: AAPL, fast: 5, slow: 20}
+  - portfolio: momentum-msft
+    strategy: momentum
+    params: {asset: MSFT}
+    risk: {max_order_notional: 1000}
+    breaker: {max_rejections: 3}
+`
+
+func TestParse_Backtest(t *testing.T) {
+	s, err := Parse("/sessions/jan.yaml", []byte(backtestFile))
+	require.NoError(t, err)
+
+	require.Equal(t, "backtest", s.Mode)
+	require.Equal(t, time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC), s.Start)
+	require.Equal(t, filepath.FromSlash("/sessions/runs/jan"), s.Output)
+	require.Equal(t, Data{Source: "file", Dir: filepath.FromSlash("/sessions/bars"), Cache: true}, s.Data)
+
+	require.Equal(t, 10, s.Hours.OpenHour)
+	require.Equal(t, 0, s.Hours.OpenMinute)
+	require.Equal(t, 15, s.Hours.CloseHour)
+	require.Equal(t, 30, s.Hours.CloseMinute)
+	require.True(t, s.Hours.WeekendsOff)
+	require.Equal(t, engine.RegularHours().ExchangeTZ, s.Hours.ExchangeTZ)
+	require.Equal(t, "NYSE", s.Hours.Exchange, "regular hours keep the exchange's holidays")
+	require.False(t, s.Hours.Extended)
+
+	require.Len(t, s.Fills.Commission, 1)
+	require.Equal(t, engine.FixedBpsSlippage{Bps: 5}, s.Fills.Slippage)
+
+	require.Len(t, s.Runners, 2)
+	require.Equal(t, Runner{
+		Portfolio: "momentum-aapl", Cash: 10000, Strategy: "momentum", Checkpoint: "aapl",
+		Params:  map[string]any{"asset": "AAPL", "fast": 5, "slow": 20},
+		Risk:    engine.RiskLimits{MaxPosition: 5000, NoShorting: true},
+		Breaker: engine.BreakerLimits{MaxDrawdown: 0.1, MaxDataAge: 5 * time.Minute, Flatten: true},
+	}, s.Runners[0])
+	require.Equal(t, engine.RiskLimits{MaxOrderNotional: 1000}, s.Runners[1].Risk) // replaces the session's
+	require.Equal(t, engine.BreakerLimits{MaxRejections: 3}, s.Runners[1].Breaker)
+}
+
+func TestParse_Paper(t *testing.T) {
+	s, err := Parse("paper.yaml", []byte(`mode: paper
+duration: 2h
+data: {url: ws://localhost:9090}
+runners:
+  - {portfolio: demo, strategy: momentum, params: {asset: AAPL}}
+`))
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Hour, s.Duration)
+	require.Equal(t, "finnhub", s.Data.Source)
+	require.Equal(t, "ws://localhost:9090", s.Data.URL)
+	require.True(t, s.Data.Record)
+	require.Equal(t, engine.RegularHours(), s.Hours)
+}
+
+func TestParse_ErrorsPointAtKeys(t *testing.T) {
+	cases := []struct {
+		name, file, want string
+	}{
+		{"unknown key", "mode: backtest\nstrt: 2024-01-02T14:30:00Z\n", "line 2: field strt not found"},
+		{"bad time", "mode: backtest\nstart: yesterday\n", "s.yaml:2: start: want an RFC3339 time"},
+		{"end before start", "mode: backtest\nstart: 2024-01-02T14:30:00Z\nend: 2024-01-01T14:30:00Z\n", "s.yaml:3: end: must be after start"},
+		{"missing mode", "runners: []\n", "s.yaml: mode: required"},
+		{"bad hours", "mode: paper\nhours:\n  open: 9am\n", "s.yaml:3: hours.open: want a 24-hour time"},
+		{"unknown exchange calendar", "mode: paper\nhours: {exchange: LSE}\n", "s.yaml:2: hours.exchange: unknown exchange calendar \"LSE\""},
+		{"extended hours without a calendar", "mode: paper\nhours: {exchange: none, extended: true}\n", "s.yaml:2: hours.extended: needs an exchange calendar"},
+		{"bad fees", "mode: paper\nfees:\n  slippage: lots\n", "s.yaml:3: fees.slippage: invalid slippage"},
+		{"negative risk limit", "mode: paper\nrisk:\n  max_daily_loss: -5\n", "s.yaml:3: risk.max_daily_loss: must not be negative"},
+		{"bad stream url", "mode: paper\ndata: {url: localhost:9090}\n", "s.yaml:2: data.url: want a websocket URL"},
+		{"url for backtest data", "mode: backtest\nstart: 2024-01-02T14:30:00Z\nend: 2024-01-03T14:30:00Z\ndata: {url: ws://localhost:9090}\n", "data.url: only the finnhub source"},
+		{"record backtest data", "mode: backtest\nstart: 2024-01-02T14:30:00Z\nend: 2024-01-03T14:30:00Z\ndata: {record: true}\n", "data.record: only the finnhub source"},
+		{"bad listen address", "mode: paper\nlisten: 8080\n", "s.yaml:2: listen: want host:port"},
+		{"bad drawdown", "mode: paper\nbreaker:\n  max_drawdown: 10\n", "s.yaml:3: breaker.max_drawdown: must be a fraction"},
+		{"bad data age", "mode: paper\nbreaker: {max_data_age: soon}\n", "s.yaml:2: breaker.max_data_age: invalid duration"},
+		{"unknown strategy", "mode: paper\nrunners:\n  - portfolio: a\n    strategy: nope\n", "s.yaml:4: runners[0].strategy: unknown strategy \"nope\""},
+		{"unknown param", "mode: paper\nrunners:\n  - portfolio: a\n    strategy: momentum\n    params:\n      fats: 5\n", "s.yaml:6: runners[0].params.fats: momentum takes no parameter \"fats\""},
+		{"param out of bounds", "mode: paper\nrunners:\n  - portfolio: a\n    strategy: momentum\n    params: {fast: 0}\n", "s.yaml:5: runners[0].params.fast: FastWindow: 0 is below the minimum 1"},
+		{"duplicate portfolio", "mode: paper\nrunners:\n  - {portfolio: a, strategy: momentum}\n  - {portfolio: a, strategy: momentum}\n", "s.yaml:4: runners[1].portfolio: portfolio \"a\" is listed twice"},
+		{"live with two runners", "mode: live\nrunners:\n  - {portfolio: a, strategy: momentum}\n  - {portfolio: b, strategy: momentum}\n", "s.yaml:2: runners: live mode"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse("s.yaml", []byte(tc.file))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.want)
+		})
+	}
+}
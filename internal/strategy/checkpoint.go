@@ -6,8 +6,10 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	ds "github.com/joshskilla/trading-bot/internal/datastore"
+	"github.com/joshskilla/trading-bot/internal/indicators"
 	t "github.com/joshskilla/trading-bot/internal/types"
 )
 
@@ -179,6 +181,36 @@ var parserRegistry = map[string]func(any) (any, error){
 		return s, nil
 	},
 
+	"[]float64": func(x any) (any, error) {
+		xs, ok := x.([]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse %T as []float64", x)
+		}
+		out := make([]float64, len(xs))
+		for i, v := range xs {
+			switch f := v.(type) {
+			case float64:
+				out[i] = f
+			case json.Number:
+				n, err := f.Float64()
+				if err != nil {
+					return nil, err
+				}
+				out[i] = n
+			default:
+				return nil, fmt.Errorf("cannot parse %T in []float64", v)
+			}
+		}
+		return out, nil
+	},
+	"time.Time": func(x any) (any, error) {
+		s, ok := x.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse %T as time.Time", x)
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	},
+
 	// --- Custom Structs ---
 	"github.com/joshskilla/trading-bot/internal/types.Asset": func(x any) (any, error) {
 		m, ok := x.(map[string]any)
@@ -197,6 +229,13 @@ var parserRegistry = map[string]func(any) (any, error){
 		}
 		return a, nil
 	},
+	"github.com/joshskilla/trading-bot/internal/indicators.State": func(x any) (any, error) {
+		m, ok := x.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse %T as indicators.State", x)
+		}
+		return indicators.State(m), nil // numbers stay json.Number; Restore converts
+	},
 }
 
 // Applies parser if tag exists; otherwise returns raw value unchanged
@@ -0,0 +1,46 @@
+package strategy
+
+import (
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// Bars of history kept per asset unless the strategy asks otherwise
+const DefaultHistoryLength = 100
+
+// MarketContext is what a strategy can see at a tick: market data for its assets
+// and the state of its portfolio. The runner builds a fresh one every tick, the
+// same way in backtest, paper and live sessions; strategies must treat it as read-only.
+type MarketContext struct {
+	Tick      t.Tick
+	Bars      map[t.Asset]t.Bar    // latest closed bar per asset
+	History   map[t.Asset][]t.Bar  // recent closed bars per asset, oldest first (latest included)
+	Samples   map[t.Asset]t.Sample // latest trade per asset (backtests: the latest bar's close)
+	Positions map[t.Asset]float64
+	Cash      float64
+}
+
+// Bar returns the latest closed bar for asset
+func (mc *MarketContext) Bar(asset t.Asset) (t.Bar, bool) {
+	b, ok := mc.Bars[asset]
+	return b, ok
+}
+
+// LastBars returns up to the n most recent bars for asset, oldest first
+func (mc *MarketContext) LastBars(asset t.Asset, n int) []t.Bar {
+	h := mc.History[asset]
+	if n < len(h) {
+		h = h[len(h)-n:]
+	}
+	return h
+}
+
+// Sample returns the latest trade for asset
+func (mc *MarketContext) Sample(asset t.Asset) (t.Sample, bool) {
+	s, ok := mc.Samples[asset]
+	return s, ok
+}
+
+// Position returns the quantity of asset held
+func (mc *MarketContext) Position(asset t.Asset) float64 {
+	return mc.Positions[asset]
+}
@@ -1,76 +1,234 @@
 package strategy
 
 import (
-	"time"
-
 	"fmt"
+	"math"
+	"time"
 
+	"github.com/joshskilla/trading-bot/internal/indicators"
 	t "github.com/joshskilla/trading-bot/internal/types"
 )
 
+// MomentumStrategy trades a fast/slow simple moving average crossover:
+// buys when the fast average crosses above the slow one, sells the whole
+// position when it crosses back below.
 type MomentumStrategy struct {
-	asset  t.Asset
-	bar    t.Bar
-	fastMA float64
-	slowMA float64
+	asset      t.Asset
+	fastWindow int
+	slowWindow int
+	allocation float64        // share of cash spent per entry
+	market     *MarketContext // as of the latest tick
+
+	// Rolling state (checkpointed)
+	fast, slow         *indicators.SMA
+	lastFast, lastSlow float64 // averages as of the latest bar, to spot crosses
+	lastBarStart       time.Time
+	bar                t.Bar
+
+	pending t.Action // crossover seen on the latest bar, Hold if none
 }
 
+func init() {
+	Register(Definition{
+		Name:        "momentum",
+		Description: "Fast/slow moving-average crossover on a single asset",
+		Params:      MomentumParams,
+		New: func(params map[string]any) (Strategy, error) {
+			m, err := newMomentumFromParams(params)
+			if err != nil {
+				return nil, err // not a typed nil
+			}
+			return m, nil
+		},
+	})
+}
+
+// MomentumParams is the momentum strategy's checkpoint schema
+var MomentumParams = Schema{
+	{Name: "asset", Aliases: []string{"Asset"}, Type: ParamAsset, Description: "Asset to trade"},
+	{Name: "FastWindow", Aliases: []string{"fast", "fast_window"}, Type: ParamInt, Default: 10, Min: Bound(1), Description: "Bars in the fast moving average"},
+	{Name: "SlowWindow", Aliases: []string{"slow", "slow_window"}, Type: ParamInt, Default: 30, Min: Bound(2), Description: "Bars in the slow moving average"},
+	{Name: "Allocation", Type: ParamFloat, Default: 1.0, Min: Bound(0.01), Max: Bound(1), Description: "Share of cash spent on each entry"},
+}
+
+// Checkpoint keys for the rolling state
+const (
+	momentumFastSMA      = "FastSMA"
+	momentumSlowSMA      = "SlowSMA"
+	momentumLastBarStart = "LastBarStart"
+	momentumCloses       = "Closes" // older checkpoints saved the raw window
+)
+
 func NewMomentumStrategy(asset t.Asset) *MomentumStrategy {
-	return &MomentumStrategy{asset: asset, bar: t.Bar{}, fastMA: 0, slowMA: 0}
+	strat, _ := newMomentumFromParams(map[string]any{
+		"asset": asset, "FastWindow": 10, "SlowWindow": 30, "Allocation": 1.0,
+	})
+	return strat
 }
 
 func RestoreMomentumStrategy(checkpoint *Checkpoint) (*MomentumStrategy, error) {
-	asset, ok := checkpoint.Attributes["Asset"].(t.Asset)
-	if !ok {
-		return nil, fmt.Errorf("missing asset in checkpoint")
-	}
-	fastMA, ok := checkpoint.Attributes["FastMA"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("missing fastMA in checkpoint")
-	}
-	slowMA, ok := checkpoint.Attributes["SlowMA"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("missing slowMA in checkpoint")
-	}
-	return &MomentumStrategy{
-		asset:  asset,
-		bar:    t.Bar{},
-		fastMA: fastMA,
-		slowMA: slowMA,
-	}, nil
+	params, err := MomentumParams.Validate(checkpoint.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	return newMomentumFromParams(params)
+}
+
+// Expects params validated against MomentumParams; restores any saved rolling state
+func newMomentumFromParams(params map[string]any) (*MomentumStrategy, error) {
+	m := &MomentumStrategy{
+		asset:      params["asset"].(t.Asset),
+		fastWindow: params["FastWindow"].(int),
+		slowWindow: params["SlowWindow"].(int),
+		allocation: params["Allocation"].(float64),
+		pending:    t.Hold,
+	}
+	if m.fastWindow >= m.slowWindow {
+		return nil, fmt.Errorf("FastWindow (%d) must be shorter than SlowWindow (%d)", m.fastWindow, m.slowWindow)
+	}
+	m.fast, m.slow = indicators.NewSMA(m.fastWindow), indicators.NewSMA(m.slowWindow)
+
+	fastState, okFast := params[momentumFastSMA].(indicators.State)
+	slowState, okSlow := params[momentumSlowSMA].(indicators.State)
+	if okFast && okSlow {
+		if err := m.restoreAverages(fastState, slowState); err != nil {
+			return nil, err
+		}
+	} else {
+		closes, _ := params[momentumCloses].([]float64)
+		for _, c := range closes {
+			m.update(c)
+		}
+	}
+	if ts, ok := params[momentumLastBarStart].(time.Time); ok {
+		m.lastBarStart = ts
+	}
+	return m, nil
+}
+
+// restoreAverages restores both averages as saved. If the windows have changed
+// since (e.g. FastWindow set on a running session), they are re-seeded from
+// the longer of the saved windows' closes instead.
+func (m *MomentumStrategy) restoreAverages(fastState, slowState indicators.State) error {
+	err := m.fast.Restore(fastState)
+	if err == nil {
+		err = m.slow.Restore(slowState)
+	}
+	if err == nil {
+		if m.slow.Ready() {
+			m.lastFast, m.lastSlow = m.fast.Value(), m.slow.Value()
+		}
+		return nil
+	}
+
+	fastCloses, fastErr := fastState.Window()
+	slowCloses, slowErr := slowState.Window()
+	if fastErr != nil || slowErr != nil {
+		return err
+	}
+	closes := slowCloses
+	if len(fastCloses) > len(closes) {
+		closes = fastCloses
+	}
+	m.fast, m.slow = indicators.NewSMA(m.fastWindow), indicators.NewSMA(m.slowWindow)
+	for _, c := range closes {
+		m.update(c)
+	}
+	return nil
 }
 
 func (m *MomentumStrategy) Init() error {
 	return nil
 }
 
+func (m *MomentumStrategy) Assets() []t.Asset {
+	return []t.Asset{m.asset}
+}
+
 func (m *MomentumStrategy) TickInterval() time.Duration {
 	return time.Minute
 }
 
-func (m *MomentumStrategy) OnTick(tick t.Tick) {
+func (m *MomentumStrategy) OnTick(mc *MarketContext) {
+	m.pending = t.Hold
+	m.market = mc
+
 	// get updated asset information (bar)
-	// update fast & slow MA
+	bar, ok := mc.Bar(m.asset)
+	if !ok || !bar.IsClosed() || !bar.Start.After(m.lastBarStart) {
+		return // nothing new (e.g. ticks faster than bars)
+	}
+	m.bar, m.lastBarStart = bar, bar.Start
+	m.pending = m.update(bar.Close)
 }
 
-func (m *MomentumStrategy) GenerateSignals() []t.Signal {
-	// check for fast & slow crosses
+// update feeds a close to both averages, returning Buy/Sell if they crossed
+func (m *MomentumStrategy) update(price float64) t.Action {
+	m.fast.Update(price)
+	m.slow.Update(price)
+	if !m.slow.Ready() {
+		return t.Hold // warming up
+	}
+	fast, slow := m.fast.Value(), m.slow.Value()
+	prevFast, prevSlow := m.lastFast, m.lastSlow
+	m.lastFast, m.lastSlow = fast, slow
+	switch {
+	case prevSlow == 0:
+		return t.Hold // first full window: nothing to cross from
+	case prevFast <= prevSlow && fast > slow:
+		return t.Buy
+	case prevFast >= prevSlow && fast < slow:
+		return t.Sell
+	}
+	return t.Hold
+}
 
-	// if want to smooth out buying process make this apparent in generate signals
-	// (perhaps use shared functions that handle this)
-	// also consider the amount spent per signal - may need another attribute
+func (m *MomentumStrategy) GenerateSignals() []t.Signal {
+	if m.pending == t.Hold || m.market == nil || m.bar.Close <= 0 {
+		return nil
+	}
 
-	// placeholder
+	// Position-aware sizing: enter from flat with a share of cash, exit in full
+	held := m.market.Position(m.asset)
+	var qty float64
+	switch m.pending {
+	case t.Buy:
+		if held > 0 {
+			return nil
+		}
+		qty = math.Floor(m.market.Cash * m.allocation / m.bar.Close)
+	case t.Sell:
+		qty = held
+	}
+	if qty <= 0 {
+		return nil
+	}
 	return []t.Signal{
 		{
-			Time:       time.Now().UTC(),
+			Time:       m.bar.End,
 			Bar:        m.bar,
-			Action:     t.Buy,
-			Confidence: 0.9,
+			Action:     m.pending,
+			Qty:        qty,
+			Confidence: math.Min(math.Abs(m.lastFast-m.lastSlow)/m.lastSlow*100, 1),
 		},
 	}
 }
 
+// Checkpoint saves parameters and the averages' state, so a restart resumes without warming up again
+func (m *MomentumStrategy) Checkpoint(id string) *Checkpoint {
+	return &Checkpoint{ID: id, Attributes: map[string]any{
+		"asset":              m.asset,
+		"FastWindow":         m.fastWindow,
+		"SlowWindow":         m.slowWindow,
+		"Allocation":         m.allocation,
+		"FastMA":             m.lastFast,
+		"SlowMA":             m.lastSlow,
+		momentumFastSMA:      m.fast.State(),
+		momentumSlowSMA:      m.slow.State(),
+		momentumLastBarStart: m.lastBarStart,
+	}}
+}
+
 func (m *MomentumStrategy) Name() string {
 	return "Momentum"
 }
@@ -0,0 +1,142 @@
+package strategy
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"testing"
+	"time"
+
+	ds "github.com/joshskilla/trading-bot/internal/datastore"
+	types "github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMarket serves one close per minute from a price series
+type fakeMarket struct {
+	start     time.Time
+	closes    []float64
+	positions map[types.Asset]float64
+	cash      float64
+}
+
+// at builds the tick-i context the runner would hand the strategy
+func (d *fakeMarket) at(asset types.Asset, i int) *MarketContext {
+	start := d.start.Add(time.Duration(i) * time.Minute)
+	c := d.closes[i]
+	bar := types.Bar{Asset: asset, Start: start, End: start.Add(time.Minute), Open: c, High: c, Low: c, Close: c, Status: types.BarStatusOfficial}
+	return &MarketContext{
+		Tick:      types.NewTick(bar.End),
+		Bars:      map[types.Asset]types.Bar{asset: bar},
+		History:   map[types.Asset][]types.Bar{asset: {bar}},
+		Positions: maps.Clone(d.positions),
+		Cash:      d.cash,
+	}
+}
+
+func TestMomentumCrossovers(t *testing.T) {
+	asset := types.NewAsset("AAPL", "IEX", "stock")
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	data := &fakeMarket{
+		start:     start,
+		closes:    []float64{10, 10, 10, 10, 12, 14, 14, 14, 8, 6},
+		positions: map[types.Asset]float64{},
+		cash:      1000,
+	}
+	m, err := newMomentumFromParams(map[string]any{"asset": asset, "FastWindow": 2, "SlowWindow": 4, "Allocation": 0.5})
+	require.NoError(t, err)
+
+	var actions []types.Action
+	for i := range data.closes {
+		m.OnTick(data.at(asset, i))
+		signals := m.GenerateSignals()
+		m.OnTick(data.at(asset, i)) // a repeated bar signals nothing
+		require.Empty(t, m.GenerateSignals())
+		for _, sig := range signals {
+			actions = append(actions, sig.Action)
+			switch sig.Action {
+			case types.Buy:
+				require.Equal(t, 41.0, sig.Qty) // floor(500 / 12)
+				data.positions[asset] = sig.Qty
+			case types.Sell:
+				require.Equal(t, 41.0, sig.Qty) // whole position
+				data.positions[asset] = 0
+			}
+		}
+	}
+	require.Equal(t, []types.Action{types.Buy, types.Sell}, actions)
+}
+
+func TestMomentumCheckpointResumesWindow(t *testing.T) {
+	asset := types.NewAsset("AAPL", "IEX", "stock")
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	data := &fakeMarket{start: start, closes: []float64{1, 2, 3, 4, 5, 6}, positions: map[types.Asset]float64{}}
+	m, err := newMomentumFromParams(map[string]any{"asset": asset, "FastWindow": 2, "SlowWindow": 3, "Allocation": 1.0})
+	require.NoError(t, err)
+	for i := range data.closes {
+		m.OnTick(data.at(asset, i))
+	}
+
+	cp := m.Checkpoint("UnitTestMomentumCheckpoint")
+	require.NoError(t, cp.SaveToJSON())
+	defer os.Remove(ds.AbsolutePath(fmt.Sprintf(CheckpointFilePath, cp.ID)))
+
+	loaded, err := LoadCheckpointFromJSON(cp.ID)
+	require.NoError(t, err)
+	restored, err := RestoreMomentumStrategy(loaded)
+	require.NoError(t, err)
+	require.True(t, restored.lastBarStart.Equal(m.lastBarStart))
+	require.Equal(t, 5.5, restored.fast.Value())
+	require.Equal(t, 5.0, restored.slow.Value())
+
+	// Both spot the next cross the same way
+	require.Equal(t, types.Sell, m.update(1))
+	require.Equal(t, types.Sell, restored.update(1))
+	require.Equal(t, m.slow.Value(), restored.slow.Value())
+
+	// Checkpoints from before the indicator state still resume from their closes
+	legacy, err := RestoreMomentumStrategy(&Checkpoint{ID: "legacy", Attributes: map[string]any{
+		"asset": asset, "FastWindow": 2, "SlowWindow": 3, momentumCloses: []float64{3, 4, 5, 6},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, 5.5, legacy.fast.Value())
+	require.Equal(t, 5.0, legacy.slow.Value())
+	require.Equal(t, types.Sell, legacy.update(1))
+
+	_, err = newMomentumFromParams(map[string]any{"asset": asset, "FastWindow": 5, "SlowWindow": 5, "Allocation": 1.0})
+	require.Error(t, err)
+}
+
+func TestMomentumRestoreWithNewWindows(t *testing.T) {
+	asset := types.NewAsset("AAPL", "IEX", "stock")
+	m, err := newMomentumFromParams(map[string]any{"asset": asset, "FastWindow": 2, "SlowWindow": 4, "Allocation": 1.0})
+	require.NoError(t, err)
+	for _, c := range []float64{1, 2, 3, 4, 5, 6} {
+		m.update(c)
+	}
+
+	// Shorter windows re-seed from the saved closes, without warming up again
+	attrs := m.Checkpoint("resized").Attributes
+	attrs["FastWindow"], attrs["SlowWindow"] = 1, 3
+	resized, err := RestoreMomentumStrategy(&Checkpoint{ID: "resized", Attributes: attrs})
+	require.NoError(t, err)
+	require.Equal(t, 6.0, resized.fast.Value())
+	require.Equal(t, 5.0, resized.slow.Value())
+	require.True(t, resized.slow.Ready())
+}
+
+func TestMomentumResumeOverriddenByAlias(t *testing.T) {
+	asset := types.NewAsset("AAPL", "IEX", "stock")
+	m, err := newMomentumFromParams(map[string]any{"asset": asset, "FastWindow": 10, "SlowWindow": 20, "Allocation": 1.0})
+	require.NoError(t, err)
+
+	// A session file's fast: 5 wins over the checkpoint's FastWindow
+	attrs := m.Checkpoint("resumed").Attributes
+	def, ok := Lookup("momentum")
+	require.True(t, ok)
+	def.Params.Override(attrs, map[string]any{"fast": 5})
+	resumed, err := RestoreMomentumStrategy(&Checkpoint{ID: "resumed", Attributes: attrs})
+	require.NoError(t, err)
+	require.EqualValues(t, 5, resumed.Checkpoint("resumed").Attributes["FastWindow"])
+	require.EqualValues(t, 20, resumed.Checkpoint("resumed").Attributes["SlowWindow"])
+}
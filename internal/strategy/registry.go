@@ -0,0 +1,268 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	cfg "github.com/joshskilla/trading-bot/internal/config"
+	t "github.com/joshskilla/trading-bot/internal/types"
+)
+
+// ----------- PARAMETER SCHEMA -----------
+
+// ParamType is the kind of value a strategy parameter takes
+type ParamType string
+
+const (
+	ParamInt    ParamType = "int"
+	ParamFloat  ParamType = "float64"
+	ParamBool   ParamType = "bool"
+	ParamString ParamType = "string"
+	ParamAsset  ParamType = "asset"
+)
+
+// Param describes one checkpoint attribute a strategy reads
+type Param struct {
+	Name        string
+	Aliases     []string // other accepted checkpoint keys (e.g. older spellings)
+	Type        ParamType
+	Description string
+	Default     any      // nil => required
+	Min, Max    *float64 // numeric bounds (inclusive), nil => unbounded
+}
+
+// Bound is a helper for Param.Min/Max
+func Bound(v float64) *float64 { return &v }
+
+// Schema lists a strategy's parameters
+type Schema []Param
+
+// Lookup returns the parameter named name, or with name as an alias
+func (s Schema) Lookup(name string) (Param, bool) {
+	for _, p := range s {
+		if p.Name == name || slices.Contains(p.Aliases, name) {
+			return p, true
+		}
+	}
+	return Param{}, false
+}
+
+// Override sets params on attrs (e.g. a saved checkpoint's), each under its
+// parameter's name, so it replaces the saved value whichever spelling either
+// uses. Keys that aren't parameters are set as given.
+func (s Schema) Override(attrs, params map[string]any) {
+	for k, v := range params {
+		if p, ok := s.Lookup(k); ok {
+			for _, alias := range p.Aliases {
+				delete(attrs, alias)
+			}
+			k = p.Name
+		}
+		attrs[k] = v
+	}
+}
+
+// Validate resolves aliases, applies defaults, converts values to each
+// parameter's type and checks bounds. Attributes not in the schema (e.g.
+// saved strategy state) are passed through unchanged.
+func (s Schema) Validate(attrs map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(attrs))
+	for k, v := range attrs {
+		out[k] = v
+	}
+
+	var errs []string
+	for _, p := range s {
+		raw, ok := out[p.Name]
+		for _, alias := range p.Aliases {
+			if v, found := out[alias]; found {
+				if !ok {
+					raw, ok = v, true
+				}
+				delete(out, alias)
+			}
+		}
+		if !ok {
+			if p.Default == nil {
+				errs = append(errs, fmt.Sprintf("missing %s (%s)", p.Name, p.Type))
+				continue
+			}
+			raw = p.Default
+		}
+
+		v, err := p.convert(raw)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", p.Name, err))
+			continue
+		}
+		if err := p.checkBounds(v); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", p.Name, err))
+			continue
+		}
+		out[p.Name] = v
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid checkpoint: %s", strings.Join(errs, "; "))
+	}
+	return out, nil
+}
+
+func (p Param) convert(v any) (any, error) {
+	switch p.Type {
+	case ParamInt:
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if f != math.Trunc(f) {
+			return nil, fmt.Errorf("%v is not a whole number", v)
+		}
+		return int(f), nil
+	case ParamFloat:
+		return toFloat(v)
+	case ParamBool:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			return strconv.ParseBool(b)
+		}
+	case ParamString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case ParamAsset:
+		switch a := v.(type) {
+		case t.Asset:
+			return a, nil
+		case string:
+			if strings.Contains(a, ":") {
+				return t.AssetFromString(a), nil
+			}
+			return t.NewAsset(a, cfg.Exchange, cfg.AssetType), nil
+		case map[string]any:
+			return parserRegistry[typeTagOf(t.Asset{})](a)
+		}
+	default:
+		return nil, fmt.Errorf("unknown parameter type %q", p.Type)
+	}
+	return nil, fmt.Errorf("cannot use %T as %s", v, p.Type)
+}
+
+func toFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case json.Number:
+		return n.Float64()
+	case string:
+		return strconv.ParseFloat(n, 64)
+	}
+	return 0, fmt.Errorf("cannot use %T as a number", v)
+}
+
+func (p Param) checkBounds(v any) error {
+	var f float64
+	switch n := v.(type) {
+	case int:
+		f = float64(n)
+	case float64:
+		f = n
+	default:
+		return nil
+	}
+	if p.Min != nil && f < *p.Min {
+		return fmt.Errorf("%v is below the minimum %v", v, *p.Min)
+	}
+	if p.Max != nil && f > *p.Max {
+		return fmt.Errorf("%v is above the maximum %v", v, *p.Max)
+	}
+	return nil
+}
+
+// ----------- REGISTRY -----------
+
+// Definition is everything needed to build a strategy by name
+type Definition struct {
+	Name        string // as used on the command line, e.g. "momentum"
+	Description string
+	Params      Schema
+	// Builds the strategy from validated parameters
+	New func(params map[string]any) (Strategy, error)
+	// Restores from a checkpoint; nil => New with the checkpoint's validated attributes
+	Restore func(cp *Checkpoint) (Strategy, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Definition)
+)
+
+// Register makes a strategy available by name. Call from an init function;
+// registering a name twice panics.
+func Register(def Definition) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if def.Name == "" || def.New == nil {
+		panic("strategy: Register needs a name and constructor")
+	}
+	if _, dup := registry[def.Name]; dup {
+		panic("strategy: Register called twice for " + def.Name)
+	}
+	registry[def.Name] = def
+}
+
+// Lookup returns the definition registered under name
+func Lookup(name string) (Definition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	def, ok := registry[name]
+	return def, ok
+}
+
+// Registered returns all definitions, sorted by name
+func Registered() []Definition {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	defs := make([]Definition, 0, len(registry))
+	for _, def := range registry {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// Names returns the registered strategy names, sorted
+func Names() []string {
+	var names []string
+	for _, def := range Registered() {
+		names = append(names, def.Name)
+	}
+	return names
+}
+
+// RestoreFromCheckpoint builds the named strategy from a checkpoint
+func RestoreFromCheckpoint(strategyType string, checkpoint *Checkpoint) (Strategy, error) {
+	def, ok := Lookup(strategyType)
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy type: %s (available: %s)", strategyType, strings.Join(Names(), ", "))
+	}
+	if def.Restore != nil {
+		return def.Restore(checkpoint)
+	}
+	params, err := def.Params.Validate(checkpoint.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	return def.New(params)
+}
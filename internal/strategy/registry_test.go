@@ -0,0 +1,60 @@
+package strategy
+
+import (
+	"encoding/json"
+	"testing"
+
+	types "github.com/joshskilla/trading-bot/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema := Schema{
+		{Name: "asset", Aliases: []string{"Asset"}, Type: ParamAsset},
+		{Name: "window", Type: ParamInt, Default: 20, Min: Bound(2), Max: Bound(500)},
+		{Name: "threshold", Type: ParamFloat, Default: 0.5},
+		{Name: "enabled", Type: ParamBool, Default: true},
+	}
+
+	params, err := schema.Validate(map[string]any{
+		"Asset":     types.NewAsset("AAPL", "NASDAQ", "stock"),
+		"threshold": json.Number("2"), // numbers from JSON & CLI convert
+		"enabled":   "false",
+		"state":     []float64{1, 2}, // unknown keys pass through
+	})
+	require.NoError(t, err)
+	require.Equal(t, types.NewAsset("AAPL", "NASDAQ", "stock"), params["asset"])
+	require.NotContains(t, params, "Asset")
+	require.Equal(t, 20, params["window"])
+	require.Equal(t, 2.0, params["threshold"])
+	require.Equal(t, false, params["enabled"])
+	require.Equal(t, []float64{1, 2}, params["state"])
+
+	_, err = schema.Validate(map[string]any{"window": 1})
+	require.ErrorContains(t, err, "missing asset")
+	require.ErrorContains(t, err, "below the minimum")
+
+	_, err = schema.Validate(map[string]any{"asset": "AAPL", "window": 2.5})
+	require.ErrorContains(t, err, "not a whole number")
+}
+
+func TestRestoreFromCheckpointUsesRegistry(t *testing.T) {
+	require.Contains(t, Names(), "momentum")
+
+	strat, err := RestoreFromCheckpoint("momentum", &Checkpoint{ID: "cp", Attributes: map[string]any{
+		"Asset":      types.NewAsset("AAPL", "IEX", "stock"),
+		"FastWindow": 5.0, // whole floats are accepted for int parameters
+		"Allocation": 1,   // and ints for float parameters
+	}})
+	require.NoError(t, err)
+	m := strat.(*MomentumStrategy)
+	require.Equal(t, 5, m.fastWindow)
+	require.Equal(t, 30, m.slowWindow)
+	require.Equal(t, 1.0, m.allocation)
+
+	_, err = RestoreFromCheckpoint("momentum", &Checkpoint{ID: "cp", Attributes: map[string]any{}})
+	require.ErrorContains(t, err, "missing asset")
+
+	_, err = RestoreFromCheckpoint("nope", &Checkpoint{})
+	require.ErrorContains(t, err, "available: momentum")
+}
@@ -3,27 +3,32 @@ package strategy
 import (
 	t "github.com/joshskilla/trading-bot/internal/types"
 
-	"fmt"
 	"time"
 )
 
 // Strategy interface is implemented by any trading strategy
 type Strategy interface {
 	Init() error
-	OnTick(tick t.Tick) // Update internal state
+	OnTick(mc *MarketContext) // Update internal state
 	GenerateSignals() []t.Signal
 	Name() string
 	TickInterval() time.Duration
 }
 
-func RestoreFromCheckpoint(strategyType string, checkpoint *Checkpoint) (Strategy, error) {
-	var strat Strategy
-	var err error = nil
-	switch strategyType {
-	case "momentum":
-		strat, err = RestoreMomentumStrategy(checkpoint)
-	default:
-		return nil, fmt.Errorf("unknown strategy type: %s", strategyType)
-	}
-	return strat, err
+// AssetUniverse is implemented by strategies that trade a fixed set of assets,
+// so sessions fetch their data even before the portfolio holds them
+type AssetUniverse interface {
+	Assets() []t.Asset
+}
+
+// HistorySizer is implemented by strategies that need more (or less) bar
+// history in their MarketContext than DefaultHistoryLength
+type HistorySizer interface {
+	HistoryLength() int
+}
+
+// Checkpointer is implemented by strategies that can save their state,
+// so a restored strategy resumes where it left off
+type Checkpointer interface {
+	Checkpoint(id string) *Checkpoint
 }
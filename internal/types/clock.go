@@ -0,0 +1,96 @@
+package types
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits on it. Live sessions run on the wall clock;
+// backtests & replays run on simulated time, so everything they stamp and
+// wait for is in market time rather than when the bot happened to run.
+type Clock interface {
+	Now() time.Time
+	// After sends the clock's time once d has passed on it
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ensure the clocks implement Clock
+var _ Clock = RealClock{}
+var _ Clock = (*SimClock)(nil)
+var _ Clock = (*AcceleratedClock)(nil)
+
+// RealClock is the wall clock
+type RealClock struct{}
+
+func (RealClock) Now() time.Time                         { return time.Now() }
+func (RealClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SimClock is simulated time: it only moves when set, or when waited on
+// (waiting jumps straight to the deadline), so sessions on it run as fast as
+// they're processed. Safe for concurrent use.
+type SimClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewSimClock(start time.Time) *SimClock {
+	return &SimClock{now: start}
+}
+
+func (c *SimClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock on to ts; it never goes back
+func (c *SimClock) Set(ts time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ts.After(c.now) {
+		c.now = ts
+	}
+}
+
+// Advance moves the clock on by d
+func (c *SimClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+}
+
+// After moves the clock on by d and sends the new time straight away
+func (c *SimClock) After(d time.Duration) <-chan time.Time {
+	c.Advance(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+// AcceleratedClock runs speed times faster than the wall clock from start,
+// e.g. to replay a session in a fraction of the time it took
+type AcceleratedClock struct {
+	start time.Time
+	began time.Time // wall clock time at start
+	speed float64
+}
+
+// NewAcceleratedClock starts at start, now, running speed (> 0) times real time
+func NewAcceleratedClock(start time.Time, speed float64) *AcceleratedClock {
+	if speed <= 0 {
+		speed = 1
+	}
+	return &AcceleratedClock{start: start, began: time.Now(), speed: speed}
+}
+
+func (c *AcceleratedClock) Now() time.Time {
+	return c.start.Add(time.Duration(float64(time.Since(c.began)) * c.speed))
+}
+
+func (c *AcceleratedClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	time.AfterFunc(time.Duration(float64(d)/c.speed), func() { ch <- c.Now() })
+	return ch
+}
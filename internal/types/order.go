@@ -0,0 +1,197 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OrderType decides when and at what price an order may fill (enum-like)
+type OrderType uint8
+
+const (
+	MarketOrder    OrderType = iota // fill at the best available price
+	LimitOrder                      // fill at LimitPrice or better
+	StopOrder                       // becomes a market order once StopPrice trades
+	StopLimitOrder                  // becomes a limit order once StopPrice trades
+)
+
+func (ot OrderType) String() string {
+	switch ot {
+	case LimitOrder:
+		return "LIMIT"
+	case StopOrder:
+		return "STOP"
+	case StopLimitOrder:
+		return "STOP_LIMIT"
+	default:
+		return "MARKET"
+	}
+}
+
+func ParseOrderType(s string) (OrderType, error) {
+	switch strings.ToUpper(s) {
+	case "", "MARKET":
+		return MarketOrder, nil
+	case "LIMIT":
+		return LimitOrder, nil
+	case "STOP":
+		return StopOrder, nil
+	case "STOP_LIMIT", "STOPLIMIT":
+		return StopLimitOrder, nil
+	default:
+		return MarketOrder, fmt.Errorf("unknown order type %q", s)
+	}
+}
+
+// TimeInForce decides how long an unfilled order rests (enum-like)
+type TimeInForce uint8
+
+const (
+	DayTIF TimeInForce = iota // cancelled at the end of the trading day
+	GTCTIF                    // good till cancelled
+	IOCTIF                    // immediate or cancel: unfilled remainder cancelled after one match
+)
+
+func (tif TimeInForce) String() string {
+	switch tif {
+	case GTCTIF:
+		return "GTC"
+	case IOCTIF:
+		return "IOC"
+	default:
+		return "DAY"
+	}
+}
+
+func ParseTimeInForce(s string) (TimeInForce, error) {
+	switch strings.ToUpper(s) {
+	case "", "DAY":
+		return DayTIF, nil
+	case "GTC":
+		return GTCTIF, nil
+	case "IOC":
+		return IOCTIF, nil
+	default:
+		return DayTIF, fmt.Errorf("unknown time in force %q", s)
+	}
+}
+
+// OrderStatus tracks an order through its lifecycle (enum-like)
+type OrderStatus uint8
+
+const (
+	OrderNew             OrderStatus = iota // accepted, resting, nothing filled yet
+	OrderPartiallyFilled                    // some quantity filled, remainder resting
+	OrderFilled                             // fully filled (terminal)
+	OrderCancelled                          // cancelled or expired (terminal)
+	OrderRejected                           // refused by the broker/simulator (terminal)
+)
+
+func (s OrderStatus) String() string {
+	switch s {
+	case OrderPartiallyFilled:
+		return "PARTIALLY_FILLED"
+	case OrderFilled:
+		return "FILLED"
+	case OrderCancelled:
+		return "CANCELLED"
+	case OrderRejected:
+		return "REJECTED"
+	default:
+		return "NEW"
+	}
+}
+
+// IsOpen reports whether the order can still fill.
+func (s OrderStatus) IsOpen() bool {
+	return s == OrderNew || s == OrderPartiallyFilled
+}
+
+// Order is a request to trade that may fill over time
+type Order struct {
+	ID     string
+	Asset  Asset
+	Action Action
+	Type   OrderType
+	TIF    TimeInForce
+
+	Qty        float64
+	LimitPrice float64 // Limit & StopLimit only
+	StopPrice  float64 // Stop & StopLimit only
+
+	Status       OrderStatus
+	FilledQty    float64
+	AvgFillPrice float64
+	Triggered    bool   // Stop & StopLimit: stop price has traded
+	Reason       string // why the order was rejected or cancelled
+	BrokerID     string `json:",omitempty"` // the broker's ID when routed to a real broker
+
+	Created time.Time
+	Updated time.Time
+}
+
+// NewOrderFromSignal converts a strategy signal into an order request.
+func NewOrderFromSignal(sig Signal) Order {
+	return Order{
+		Asset:      sig.Bar.Asset,
+		Action:     sig.Action,
+		Type:       sig.OrderType,
+		TIF:        sig.TIF,
+		Qty:        sig.Qty,
+		LimitPrice: sig.LimitPrice,
+		StopPrice:  sig.StopPrice,
+		Status:     OrderNew,
+	}
+}
+
+// Validate checks the order is well-formed before it is accepted.
+func (o Order) Validate() error {
+	if o.Action != Buy && o.Action != Sell {
+		return fmt.Errorf("unsupported action %s", o.Action)
+	}
+	if o.Qty <= 0 {
+		return fmt.Errorf("invalid quantity %v", o.Qty)
+	}
+	if (o.Type == LimitOrder || o.Type == StopLimitOrder) && o.LimitPrice <= 0 {
+		return fmt.Errorf("%s order needs a positive limit price", o.Type)
+	}
+	if (o.Type == StopOrder || o.Type == StopLimitOrder) && o.StopPrice <= 0 {
+		return fmt.Errorf("%s order needs a positive stop price", o.Type)
+	}
+	return nil
+}
+
+// Remaining is the quantity still to fill.
+func (o Order) Remaining() float64 {
+	return o.Qty - o.FilledQty
+}
+
+// RecordFill adds a fill to the order, updating average price and status.
+func (o *Order) RecordFill(qty, price float64, ts time.Time) {
+	total := o.FilledQty + qty
+	if total > 0 {
+		o.AvgFillPrice = (o.AvgFillPrice*o.FilledQty + price*qty) / total
+	}
+	o.FilledQty = total
+	o.Updated = ts
+	if o.Remaining() <= 1e-9 {
+		o.Status = OrderFilled
+	} else {
+		o.Status = OrderPartiallyFilled
+	}
+}
+
+// Pretty returns a human-readable string representation of the order.
+func (o Order) Pretty() string {
+	desc := fmt.Sprintf("%s %s %s %v %s", o.ID, o.Action, o.Type, o.Qty, o.Asset.Symbol)
+	switch o.Type {
+	case LimitOrder:
+		desc += fmt.Sprintf(" @ %.2f", o.LimitPrice)
+	case StopOrder:
+		desc += fmt.Sprintf(" stop %.2f", o.StopPrice)
+	case StopLimitOrder:
+		desc += fmt.Sprintf(" stop %.2f limit %.2f", o.StopPrice, o.LimitPrice)
+	}
+	return fmt.Sprintf("%s %s | %s filled %v/%v", desc, o.TIF, o.Status, o.FilledQty, o.Qty)
+}
@@ -12,4 +12,10 @@ type Signal struct {
 	Action     Action
 	Qty        float64
 	Confidence float64
+
+	// Order details (zero values give a DAY market order)
+	OrderType  OrderType
+	TIF        TimeInForce
+	LimitPrice float64
+	StopPrice  float64
 }
@@ -11,7 +11,8 @@ type Tick struct {
 	// Metadata map[string]interface{} // Optional market related information: bear/bull?
 }
 
-type TickGenerator func(ctx ctx.Context, ticks chan Tick, start time.Time, end time.Time, tickInterval time.Duration, tradingHours TradingHours)
+// Generates ticks from start until end on clock (its own or simulated time)
+type TickGenerator func(ctx ctx.Context, clock Clock, ticks chan Tick, start time.Time, end time.Time, tickInterval time.Duration, tradingHours TradingHours)
 
 func NewTick(t time.Time) Tick {
 	return Tick{Time: t}
@@ -19,103 +20,86 @@ func NewTick(t time.Time) Tick {
 
 // Ticks channel closed outside the following functions:
 
-func GenerateTestTicks(ctx ctx.Context, ticks chan Tick, start time.Time, end time.Time, tickInterval time.Duration, th TradingHours) {
-	for t := start; t.Before(end); t = t.Add(tickInterval) {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if th.IsOpenAt(t) {
-				ticks <- NewTick(t)
-			} else {
-				t = th.getNextOpenTime(t)
-			}
-		}
+// GenerateTestTicks ticks every tickInterval through each session from start
+// (or an interval after the open) to its close, waiting on clock for each: on
+// a SimClock they come as fast as they're taken.
+func GenerateTestTicks(c ctx.Context, clock Clock, ticks chan Tick, start time.Time, end time.Time, tickInterval time.Duration, th TradingHours) {
+	cal, err := th.Calendar()
+	if err != nil {
+		panic(fmt.Errorf("failed to get trading hours: %w", err))
 	}
-}
-
-func GenerateLiveTicks(ctx ctx.Context, ticks chan Tick, start time.Time, end time.Time, tickInterval time.Duration, th TradingHours) {
-	// Wait until start
-	if now := time.Now(); now.Before(start) {
-		timer := time.NewTimer(start.Sub(now))
-		select {
-		case <-ctx.Done():
-			if !timer.Stop() {
-				<-timer.C
-			}
-			return
-		case <-timer.C:
+	for _, s := range cal.SessionsBetween(start, end) {
+		t := s.Start().Add(tickInterval)
+		if s.Contains(start) {
+			t = start
 		}
-	}
-
-	for {
-		now := time.Now().UTC()
-		if !now.Before(end) {
-			return
-		}
-
-		// Wait until market opens
-		if !th.IsOpenAt(now) {
-			nextOpen := th.getNextOpenTime(now)
-			if !nextOpen.Before(end) {
+		for ; !t.After(s.End()) && t.Before(end); t = t.Add(tickInterval) {
+			if !sleepUntil(c, clock, t) {
 				return
 			}
-			sleep := time.NewTimer(nextOpen.Sub(now))
 			select {
-			case <-ctx.Done():
-				if !sleep.Stop() {
-					<-sleep.C
-				}
+			case <-c.Done():
 				return
-			case <-sleep.C:
+			case ticks <- NewTick(t):
 			}
 		}
+	}
+}
 
-		// Market is open
-		_, closeTime, err := th.GetTradingHours()
-		if err != nil {
-			panic(fmt.Errorf("failed to get trading hours: %w", err))
+// GenerateLiveTicks ticks every tickInterval while the market is open, from
+// when it's started (or start, or the open) until end, as clock tells the time.
+func GenerateLiveTicks(c ctx.Context, clock Clock, ticks chan Tick, start time.Time, end time.Time, tickInterval time.Duration, th TradingHours) {
+	cal, err := th.Calendar()
+	if err != nil {
+		panic(fmt.Errorf("failed to get trading hours: %w", err))
+	}
+	now := clock.Now().UTC()
+	if now.Before(start) {
+		now = start
+	}
+	for {
+		// Wait until market opens
+		if !cal.IsOpenAt(now) {
+			now = cal.NextOpen(now)
+		}
+		if now.IsZero() || !now.Before(end) || !sleepUntil(c, clock, now) {
+			return
 		}
 
-		// Min of end and market closure
-		windowEnd := closeTime
+		// Market is open: min of end and market closure
+		session, _ := cal.SessionAt(now)
+		windowEnd := session.End()
 		if end.Before(windowEnd) {
 			windowEnd = end
 		}
 
-		ticker := time.NewTicker(tickInterval)
-		windowTimer := time.NewTimer(time.Until(windowEnd))
-
-		// Generates ticks until window closes or context ends
-		windowEnded := false
-		for !windowEnded {
+		// Generates ticks until window closes (the close included) or context ends
+		for next := now.Add(tickInterval); !next.After(session.End()) && next.Before(end); next = next.Add(tickInterval) {
+			if !sleepUntil(c, clock, next) {
+				return
+			}
 			select {
-			case <-ctx.Done():
-				ticker.Stop()
-				if !windowTimer.Stop() {
-					<-windowTimer.C
-				}
+			case <-c.Done():
 				return
-
-			case <-windowTimer.C:
-				ticker.Stop()
-				windowEnded = true
-
-			case tnow := <-ticker.C:
-				ticks <- NewTick(tnow)
+			case ticks <- NewTick(next):
 			}
 		}
+		now = cal.NextOpen(windowEnd)
 	}
 }
 
-func shiftToWorkingDay(t time.Time) time.Time {
-	if t.Weekday() == time.Saturday {
-		t = t.AddDate(0, 0, 2)
+// Waits on clock until ts, false if c ends first
+func sleepUntil(c ctx.Context, clock Clock, ts time.Time) bool {
+	d := ts.Sub(clock.Now())
+	if d <= 0 {
+		return c.Err() == nil
 	}
-	if t.Weekday() == time.Sunday {
-		t = t.AddDate(0, 0, 1)
+	select {
+	case <-c.Done():
+		return false
+	case <-clock.After(d):
+		return true
 	}
-	return t
 }
 
 func IntervalStart(ts time.Time, d time.Duration) time.Time {
@@ -123,3 +107,21 @@ func IntervalStart(ts time.Time, d time.Duration) time.Time {
 	sec := int64(d.Seconds())
 	return time.Unix((ts.Unix()/sec)*sec, 0).UTC()
 }
+
+// ReplayTicks ticks on each tickInterval boundary from start until the
+// interval holding end has closed, regardless of trading hours (a recording
+// only holds what was streamed). It waits on clock for each: an
+// AcceleratedClock paces a replay, a SimClock runs it as fast as possible.
+func ReplayTicks(c ctx.Context, clock Clock, ticks chan Tick, start time.Time, end time.Time, tickInterval time.Duration, th TradingHours) {
+	last := IntervalStart(end, tickInterval).Add(tickInterval)
+	for t := IntervalStart(start, tickInterval).Add(tickInterval); !t.After(last); t = t.Add(tickInterval) {
+		if !sleepUntil(c, clock, t) {
+			return
+		}
+		select {
+		case <-c.Done():
+			return
+		case ticks <- NewTick(t):
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package types
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func collectTicks(gen TickGenerator, clock Clock, start, end time.Time, interval time.Duration, th TradingHours) []time.Time {
+	ticks := make(chan Tick)
+	go func() {
+		defer close(ticks)
+		gen(context.Background(), clock, ticks, start, end, interval, th)
+	}()
+	var out []time.Time
+	for tick := range ticks {
+		out = append(out, tick.Time)
+	}
+	return out
+}
+
+func TestGenerateLiveTicks_SimClock(t *testing.T) {
+	th := TradingHours{OpenHour: 9, OpenMinute: 30, CloseHour: 16, WeekendsOff: true, ExchangeTZ: "America/New_York"}
+
+	// Friday 15:50 New York, just before the close, until Monday 9:45
+	now := time.Date(2024, 3, 8, 20, 50, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 11, 13, 45, 0, 0, time.UTC) // after the switch to daylight saving
+	clock := NewSimClock(now)
+	ticks := collectTicks(GenerateLiveTicks, clock, now, end, 5*time.Minute, th)
+
+	require.Equal(t, []time.Time{
+		time.Date(2024, 3, 8, 20, 55, 0, 0, time.UTC),
+		time.Date(2024, 3, 8, 21, 0, 0, 0, time.UTC),   // the close
+		time.Date(2024, 3, 11, 13, 35, 0, 0, time.UTC), // 9:30 EDT open
+		time.Date(2024, 3, 11, 13, 40, 0, 0, time.UTC),
+	}, ticks)
+	require.Equal(t, ticks[len(ticks)-1], clock.Now())
+}
+
+func TestGenerateTestTicks_PastDates(t *testing.T) {
+	th := TradingHours{OpenHour: 9, OpenMinute: 30, CloseHour: 16, WeekendsOff: true, ExchangeTZ: "America/New_York"}
+	start := time.Date(2024, 1, 5, 20, 50, 0, 0, time.UTC) // Friday 15:50
+	end := time.Date(2024, 1, 8, 14, 45, 0, 0, time.UTC)   // Monday 9:45
+
+	ticks := collectTicks(GenerateTestTicks, NewSimClock(start), start, end, 5*time.Minute, th)
+	require.Equal(t, []time.Time{
+		time.Date(2024, 1, 5, 20, 50, 0, 0, time.UTC),
+		time.Date(2024, 1, 5, 20, 55, 0, 0, time.UTC),
+		time.Date(2024, 1, 5, 21, 0, 0, 0, time.UTC), // the close
+		time.Date(2024, 1, 8, 14, 35, 0, 0, time.UTC),
+		time.Date(2024, 1, 8, 14, 40, 0, 0, time.UTC),
+	}, ticks)
+}
+
+func TestAcceleratedClock(t *testing.T) {
+	start := time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+	clock := NewAcceleratedClock(start, 600)
+	fired := <-clock.After(time.Minute) // 100ms of real time
+	require.False(t, fired.Before(start.Add(time.Minute)))
+	require.Less(t, fired.Sub(start), 10*time.Minute)
+}
+
+func TestGenerateTestTicks_ExchangeCalendar(t *testing.T) {
+	th := TradingHours{OpenHour: 9, OpenMinute: 30, CloseHour: 16, WeekendsOff: true, ExchangeTZ: "America/New_York", Exchange: "NYSE"}
+	start := time.Date(2024, 11, 27, 20, 0, 0, 0, time.UTC) // Wednesday 15:00
+	end := time.Date(2024, 12, 2, 16, 0, 0, 0, time.UTC)    // Monday 11:00
+
+	ticks := collectTicks(GenerateTestTicks, NewSimClock(start), start, end, time.Hour, th)
+	require.Equal(t, []time.Time{
+		time.Date(2024, 11, 27, 20, 0, 0, 0, time.UTC),
+		time.Date(2024, 11, 27, 21, 0, 0, 0, time.UTC),
+		// Thanksgiving off, half day Friday
+		time.Date(2024, 11, 29, 15, 30, 0, 0, time.UTC),
+		time.Date(2024, 11, 29, 16, 30, 0, 0, time.UTC),
+		time.Date(2024, 11, 29, 17, 30, 0, 0, time.UTC),
+		time.Date(2024, 12, 2, 15, 30, 0, 0, time.UTC),
+	}, ticks)
+
+	live := collectTicks(GenerateLiveTicks, NewSimClock(start), start, end, time.Hour, th)
+	require.Equal(t, ticks[1:], live, "live ticks start an interval after being started")
+}
@@ -3,6 +3,8 @@ package types
 import (
 	"fmt"
 	"time"
+
+	"github.com/joshskilla/trading-bot/internal/calendar"
 )
 
 type TradingHours struct {
@@ -12,44 +14,68 @@ type TradingHours struct {
 	CloseMinute int
 	WeekendsOff bool
 	ExchangeTZ  string
+	Exchange    string // calendar whose holidays & early closes apply, e.g. "NYSE" ("" => none)
+	Extended    bool   // also trade the exchange's pre & post-market sessions
 }
 
-func (th *TradingHours) IsOpenAt(t time.Time) bool {
-	if th.WeekendsOff && (t.Weekday() == time.Saturday || t.Weekday() == time.Sunday) {
-		return false
-	}
-	openTime, closeTime, err := th.GetTradingHours()
+// Calendar works the hours out day by day: with the exchange's holidays,
+// early closes & extended hours if Exchange is set
+func (th *TradingHours) Calendar() (*calendar.Calendar, error) {
+	loc, err := time.LoadLocation(th.ExchangeTZ)
 	if err != nil {
-		panic(fmt.Errorf("failed to get trading hours: %w", err))
+		return nil, fmt.Errorf("failed to load timezone: %w", err)
 	}
-	return !t.Before(openTime) && !t.After(closeTime)
+	cal := &calendar.Calendar{
+		Location:    loc,
+		Open:        calendar.TimeOfDay{Hour: th.OpenHour, Minute: th.OpenMinute},
+		Close:       calendar.TimeOfDay{Hour: th.CloseHour, Minute: th.CloseMinute},
+		WeekendsOff: th.WeekendsOff,
+		Extended:    th.Extended,
+	}
+	if th.Exchange != "" {
+		if cal.Exchange, err = calendar.LookupExchange(th.Exchange); err != nil {
+			return nil, err
+		}
+	}
+	return cal, nil
 }
 
-func (th *TradingHours) GetTradingHours() (time.Time, time.Time, error) {
-	loc, err := time.LoadLocation(th.ExchangeTZ)
+func (th *TradingHours) IsOpenAt(t time.Time) bool {
+	return th.mustCalendar().IsOpenAt(t)
+}
+
+// GetTradingHours returns when trading opens & closes (UTC) on the
+// exchange's day holding ts, or an error if the market is shut that day
+func (th *TradingHours) GetTradingHours(ts time.Time) (time.Time, time.Time, error) {
+	cal, err := th.Calendar()
 	if err != nil {
-		return time.Time{}, time.Time{}, fmt.Errorf("failed to load timezone: %w", err)
+		return time.Time{}, time.Time{}, err
+	}
+	day := calendar.DateOf(ts, cal.Location)
+	s, ok := cal.SessionOn(day)
+	if !ok {
+		if name, holiday := cal.Holiday(day); holiday {
+			return time.Time{}, time.Time{}, fmt.Errorf("market closed on %s: %s", day, name)
+		}
+		return time.Time{}, time.Time{}, fmt.Errorf("market closed on %s", day)
 	}
-	now := time.Now().UTC()
-	closingTime := time.Date(now.Year(), now.Month(), now.Day(), th.CloseHour, th.CloseMinute, 0, 0, loc).UTC()
-	openingTime := time.Date(now.Year(), now.Month(), now.Day(), th.OpenHour, th.OpenMinute, 0, 0, loc).UTC()
-	return openingTime, closingTime, nil
+	return s.Start(), s.End(), nil
 }
 
-func (th *TradingHours) getNextOpenTime(t time.Time) time.Time {
-	if th.WeekendsOff && (t.Weekday() == time.Saturday || t.Weekday() == time.Sunday) {
-		t = shiftToWorkingDay(t)
-	}
-	openTime, _, err := th.GetTradingHours()
+// NextOpen is when trading next opens, at or after t
+func (th *TradingHours) NextOpen(t time.Time) time.Time {
+	return th.mustCalendar().NextOpen(t)
+}
+
+// SessionsBetween is each day's trading within [start, end)
+func (th *TradingHours) SessionsBetween(start, end time.Time) []calendar.Session {
+	return th.mustCalendar().SessionsBetween(start, end)
+}
+
+func (th *TradingHours) mustCalendar() *calendar.Calendar {
+	cal, err := th.Calendar()
 	if err != nil {
 		panic(fmt.Errorf("failed to get trading hours: %w", err))
 	}
-	if t.Before(openTime) {
-		return openTime
-	}
-	t = openTime.AddDate(0, 0, 1)
-	if th.WeekendsOff {
-		return shiftToWorkingDay(t)
-	}
-	return t
+	return cal
 }
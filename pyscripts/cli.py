@@ -1,7 +1,11 @@
 # pyscripts/cli.py
 from pathlib import Path
+import json
 import os
 import subprocess
+import urllib.error
+import urllib.parse
+import urllib.request
 
 from . import PROJECT_ROOT, BIN_DIR, BOT_BIN  # from __init__.py
 
@@ -60,4 +64,95 @@ def stream_bot(args, env=None):
     ) as p:
         for line in p.stdout:
             print(line, end="")
-        return p.wait()
\ No newline at end of file
+        return p.wait()
+# Starts a long-running bot (e.g. `run --listen :8080`) without waiting on it
+def start_bot(args, env=None):
+    """
+    Start the bot CLI in the background, returning the process.
+    Example: proc = start_bot(["run", "-p", "demo", "-s", "momentum", "-c", "cp1", "--listen", "localhost:8080"])
+    """
+    _ensure_built()
+    full_env = os.environ.copy()
+    if env:
+        full_env.update(env)
+    full_env.setdefault("BOT_PATH", str(PROJECT_ROOT))
+
+    return subprocess.Popen(
+        [str(BOT_BIN), *args],
+        cwd=str(PROJECT_ROOT),
+        env=full_env,
+        text=True,
+        stdin=subprocess.PIPE,  # keeps the session's console open
+        stdout=subprocess.PIPE,
+        stderr=subprocess.STDOUT,
+        bufsize=1,
+    )
+
+# Talks to a session started with --listen, instead of parsing its output
+class BotAPI:
+    """
+    Client for the bot's HTTP API.
+    Example:
+        api = BotAPI("http://localhost:8080")
+        api.status()
+        for event in api.events(types=["fill"]):
+            print(event)
+    """
+
+    def __init__(self, base_url="http://localhost:8080", timeout=10):
+        self.base_url = base_url.rstrip("/")
+        self.timeout = timeout
+
+    def _url(self, path, params=None):
+        url = self.base_url + path
+        params = {k: v for k, v in (params or {}).items() if v is not None}
+        if params:
+            url += "?" + urllib.parse.urlencode(params)
+        return url
+
+    def _request(self, method, path, params=None, body=None):
+        data = json.dumps(body).encode() if body is not None else None
+        req = urllib.request.Request(self._url(path, params), data=data, method=method, headers={"Content-Type": "application/json"})
+        try:
+            with urllib.request.urlopen(req, timeout=self.timeout) as resp:
+                return json.load(resp)
+        except urllib.error.HTTPError as err:
+            # Error responses carry the same JSON body
+            return json.load(err)
+
+    def status(self, portfolio=None):
+        return self._request("GET", "/status", {"portfolio": portfolio})
+
+    def portfolio(self, name):
+        return self._request("GET", f"/portfolios/{urllib.parse.quote(name)}")
+
+    def executions(self, portfolio=None, n=None):
+        return self._request("GET", "/executions", {"portfolio": portfolio, "n": n})
+
+    def bars(self, portfolio=None):
+        return self._request("GET", "/bars", {"portfolio": portfolio})
+
+    def pause(self, portfolio=None):
+        return self._request("POST", "/pause", {"portfolio": portfolio})
+
+    def resume(self, portfolio=None):
+        return self._request("POST", "/resume", {"portfolio": portfolio})
+
+    def checkpoint(self, portfolio=None, id=None):
+        return self._request("POST", "/checkpoint", {"portfolio": portfolio, "id": id})
+
+    def shutdown(self):
+        return self._request("POST", "/shutdown")
+
+    def command(self, line):
+        """Run any console command, e.g. api.command("flatten AAPL @demo")"""
+        return self._request("POST", "/command", body={"command": line})
+
+    def events(self, portfolio=None, types=None):
+        """Yield events (dicts) from the session as they happen, until it ends."""
+        params = {"portfolio": portfolio, "type": ",".join(types) if types else None}
+        with urllib.request.urlopen(self._url("/events", params)) as resp:
+            for raw in resp:
+                line = raw.decode().rstrip("\n")
+                if line.startswith("data: "):
+                    yield json.loads(line[len("data: "):])